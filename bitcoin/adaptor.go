@@ -0,0 +1,277 @@
+package bitcoin
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// ECDSA adaptor signatures allow a signature to be created that only becomes valid when it is
+//   completed with a secret, the discrete log of an "adaptor" point. Publishing the completed
+//   signature reveals the secret to the holder of the adaptor signature. This is the basis of
+//   atomic swaps, where publishing one side's transaction reveals the secret needed to complete
+//   the other side's signature.
+//
+//   // Alice knows secret t with adaptor T = t*G and gives T to Bob.
+//   // Bob creates an adaptor signature and gives it to Alice.
+//   adaptorSig, err := bobKey.AdaptorSign(hash, T)
+//   ok := adaptorSig.Verify(hash, bobKey.PublicKey(), T)
+//
+//   // Alice completes the signature and publishes it.
+//   sig, err := adaptorSig.Complete(t)
+//
+//   // Bob sees the published signature and extracts the secret.
+//   t, err := adaptorSig.ExtractSecret(sig, T)
+//
+// The adaptor signature contains a DLEQ (discrete log equality) proof that the nonce points share
+//   the same nonce, so the verifier knows the completed signature will be valid.
+
+const (
+	AdaptorSignatureLength = 2*PublicKeyCompressedLength + 3*32
+)
+
+var (
+	ErrInvalidAdaptorSignature = errors.New("Invalid adaptor signature")
+)
+
+// AdaptorSignature is an ECDSA pre-signature that is completed with the secret of an adaptor
+// point.
+type AdaptorSignature struct {
+	R  PublicKey // k * T, the nonce point of the completed signature
+	RG PublicKey // k * G
+	S  big.Int   // the s value before it is divided by the secret
+
+	// DLEQ proof that R and RG use the same nonce.
+	ProofE big.Int
+	ProofS big.Int
+}
+
+// AdaptorSignatureFromBytes decodes an adaptor signature.
+func AdaptorSignatureFromBytes(b []byte) (AdaptorSignature, error) {
+	if len(b) != AdaptorSignatureLength {
+		return AdaptorSignature{}, fmt.Errorf("Wrong length : %d should be %d", len(b),
+			AdaptorSignatureLength)
+	}
+
+	var result AdaptorSignature
+	offset := 0
+
+	r, err := PublicKeyFromBytes(b[offset : offset+PublicKeyCompressedLength])
+	if err != nil {
+		return AdaptorSignature{}, errors.Wrap(err, "R")
+	}
+	result.R = r
+	offset += PublicKeyCompressedLength
+
+	rg, err := PublicKeyFromBytes(b[offset : offset+PublicKeyCompressedLength])
+	if err != nil {
+		return AdaptorSignature{}, errors.Wrap(err, "RG")
+	}
+	result.RG = rg
+	offset += PublicKeyCompressedLength
+
+	result.S.SetBytes(b[offset : offset+32])
+	offset += 32
+	result.ProofE.SetBytes(b[offset : offset+32])
+	offset += 32
+	result.ProofS.SetBytes(b[offset : offset+32])
+
+	return result, nil
+}
+
+// Bytes returns the binary encoding of the adaptor signature.
+func (s AdaptorSignature) Bytes() []byte {
+	result := make([]byte, 0, AdaptorSignatureLength)
+	result = append(result, s.R.Bytes()...)
+	result = append(result, s.RG.Bytes()...)
+	result = append(result, scalarBytes(&s.S)...)
+	result = append(result, scalarBytes(&s.ProofE)...)
+	result = append(result, scalarBytes(&s.ProofS)...)
+	return result
+}
+
+// AdaptorSign creates an adaptor signature of the hash that can be completed with the secret of
+// the adaptor point.
+func (k Key) AdaptorSign(hash Hash32, adaptor PublicKey) (AdaptorSignature, error) {
+	for {
+		nonceKey, err := GenerateKey(MainNet)
+		if err != nil {
+			return AdaptorSignature{}, errors.Wrap(err, "generate nonce")
+		}
+
+		proofNonceKey, err := GenerateKey(MainNet)
+		if err != nil {
+			return AdaptorSignature{}, errors.Wrap(err, "generate proof nonce")
+		}
+
+		if result, ok := k.adaptorSign(hash, adaptor, &nonceKey.value,
+			&proofNonceKey.value); ok {
+			return result, nil
+		}
+	}
+}
+
+// adaptorSign creates an adaptor signature using the specified nonces. It returns false if the
+// nonce doesn't produce a valid signature and a different nonce must be used.
+func (k Key) adaptorSign(hash Hash32, adaptor PublicKey, nonce,
+	proofNonce *big.Int) (AdaptorSignature, bool) {
+
+	N := curveS256Params.N
+	e := hashToInt(hash[:], curveS256)
+
+	rx, ry := curveS256.ScalarMult(&adaptor.X, &adaptor.Y, scalarBytes(nonce))
+	r := new(big.Int).Mod(rx, N)
+	if r.Sign() == 0 {
+		return AdaptorSignature{}, false
+	}
+
+	// s = k^-1 (e + r * x)
+	s := new(big.Int).Mul(r, &k.value)
+	s.Add(s, e)
+	s.Mul(s, new(big.Int).ModInverse(nonce, N))
+	s.Mod(s, N)
+	if s.Sign() == 0 {
+		return AdaptorSignature{}, false
+	}
+
+	var result AdaptorSignature
+	result.R.X.Set(rx)
+	result.R.Y.Set(ry)
+	rgx, rgy := curveS256.ScalarBaseMult(scalarBytes(nonce))
+	result.RG = PublicKey{X: *rgx, Y: *rgy}
+	result.S.Set(s)
+
+	proofE, proofS := proveDLEQ(nonce, proofNonce, result.RG, adaptor, result.R)
+	result.ProofE.Set(proofE)
+	result.ProofS.Set(proofS)
+
+	return result, true
+}
+
+// Verify returns true if the adaptor signature will be a valid signature of the hash for the
+// public key once it is completed with the secret of the adaptor point.
+func (s AdaptorSignature) Verify(hash Hash32, publicKey PublicKey, adaptor PublicKey) bool {
+	N := curveS256Params.N
+
+	if s.S.Sign() == 0 || s.S.Cmp(N) >= 0 {
+		return false
+	}
+
+	if !verifyDLEQ(&s.ProofE, &s.ProofS, s.RG, adaptor, s.R) {
+		return false
+	}
+
+	r := new(big.Int).Mod(&s.R.X, N)
+	if r.Sign() == 0 {
+		return false
+	}
+
+	// RG = s^-1 (e*G + r*P)
+	sInv := new(big.Int).ModInverse(&s.S, N)
+	u1 := new(big.Int).Mul(hashToInt(hash[:], curveS256), sInv)
+	u1.Mod(u1, N)
+	u2 := new(big.Int).Mul(r, sInv)
+	u2.Mod(u2, N)
+
+	x1, y1 := curveS256.ScalarBaseMult(scalarBytes(u1))
+	x2, y2 := curveS256.ScalarMult(&publicKey.X, &publicKey.Y, scalarBytes(u2))
+	x, y := curveS256.Add(x1, y1, x2, y2)
+
+	return x.Cmp(&s.RG.X) == 0 && y.Cmp(&s.RG.Y) == 0
+}
+
+// Complete returns the signature completed with the secret of the adaptor point.
+func (s AdaptorSignature) Complete(secret Key) (Signature, error) {
+	N := curveS256Params.N
+
+	if secret.value.Sign() == 0 || secret.value.Cmp(N) >= 0 {
+		return Signature{}, ErrOutOfRangeKey
+	}
+
+	sig := Signature{}
+	sig.R.Mod(&s.R.X, N)
+
+	sig.S.Mul(&s.S, new(big.Int).ModInverse(&secret.value, N))
+	sig.S.Mod(&sig.S, N)
+	if sig.S.Cmp(curveHalfOrder) == 1 {
+		sig.S.Sub(N, &sig.S)
+	}
+
+	return sig, sig.Validate()
+}
+
+// ExtractSecret returns the secret of the adaptor point from a signature completed from this
+// adaptor signature.
+func (s AdaptorSignature) ExtractSecret(sig Signature, adaptor PublicKey) (Key, error) {
+	N := curveS256Params.N
+
+	r := new(big.Int).Mod(&s.R.X, N)
+	if sig.R.Cmp(r) != 0 {
+		return Key{}, errors.Wrap(ErrInvalidAdaptorSignature, "R doesn't match")
+	}
+	if sig.S.Sign() == 0 {
+		return Key{}, errors.Wrap(ErrInvalidAdaptorSignature, "s is zero")
+	}
+
+	// t = s' / s, or its negation if the completed s was negated to be low S.
+	secret := new(big.Int).Mul(&s.S, new(big.Int).ModInverse(&sig.S, N))
+	secret.Mod(secret, N)
+
+	for i := 0; i < 2; i++ {
+		x, y := curveS256.ScalarBaseMult(scalarBytes(secret))
+		if x.Cmp(&adaptor.X) == 0 && y.Cmp(&adaptor.Y) == 0 {
+			return KeyFromNumber(scalarBytes(secret), MainNet)
+		}
+
+		secret.Sub(N, secret)
+	}
+
+	return Key{}, errors.Wrap(ErrInvalidAdaptorSignature, "secret doesn't match adaptor")
+}
+
+// proveDLEQ creates a Chaum-Pedersen proof that the discrete log of a with respect to G equals
+// the discrete log of b with respect to base. It returns the challenge and response.
+func proveDLEQ(secret, nonce *big.Int, a, base, b PublicKey) (*big.Int, *big.Int) {
+	N := curveS256Params.N
+
+	r1x, r1y := curveS256.ScalarBaseMult(scalarBytes(nonce))
+	r2x, r2y := curveS256.ScalarMult(&base.X, &base.Y, scalarBytes(nonce))
+
+	e := dleqChallenge(a, base, b, r1x, r1y, r2x, r2y)
+
+	// s = nonce + e * secret
+	s := new(big.Int).Mul(e, secret)
+	s.Add(s, nonce)
+	s.Mod(s, N)
+
+	return e, s
+}
+
+func verifyDLEQ(e, s *big.Int, a, base, b PublicKey) bool {
+	N := curveS256Params.N
+	if e.Cmp(N) >= 0 || s.Cmp(N) >= 0 {
+		return false
+	}
+
+	negE := new(big.Int).Sub(N, e)
+	negE.Mod(negE, N)
+
+	// R1 = s*G - e*A
+	x1, y1 := curveS256.ScalarBaseMult(scalarBytes(s))
+	x2, y2 := curveS256.ScalarMult(&a.X, &a.Y, scalarBytes(negE))
+	r1x, r1y := curveS256.Add(x1, y1, x2, y2)
+
+	// R2 = s*Base - e*B
+	x1, y1 = curveS256.ScalarMult(&base.X, &base.Y, scalarBytes(s))
+	x2, y2 = curveS256.ScalarMult(&b.X, &b.Y, scalarBytes(negE))
+	r2x, r2y := curveS256.Add(x1, y1, x2, y2)
+
+	return dleqChallenge(a, base, b, r1x, r1y, r2x, r2y).Cmp(e) == 0
+}
+
+func dleqChallenge(a, base, b PublicKey, r1x, r1y, r2x, r2y *big.Int) *big.Int {
+	e := new(big.Int).SetBytes(taggedHash("ECDSAAdaptor/DLEQ", a.Bytes(), base.Bytes(),
+		b.Bytes(), compressPublicKey(*r1x, *r1y), compressPublicKey(*r2x, *r2y)))
+	return e.Mod(e, curveS256Params.N)
+}
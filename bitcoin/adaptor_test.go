@@ -0,0 +1,257 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestAdaptorSignature(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		key, _ := GenerateKey(MainNet)
+		secret, _ := GenerateKey(MainNet)
+		adaptor := secret.PublicKey()
+		hash := Hash32(sha256.Sum256([]byte{byte(i)}))
+
+		adaptorSig, err := key.AdaptorSign(hash, adaptor)
+		if err != nil {
+			t.Fatalf("Failed to adaptor sign : %s", err)
+		}
+
+		if !adaptorSig.Verify(hash, key.PublicKey(), adaptor) {
+			t.Fatalf("Failed to verify adaptor signature")
+		}
+
+		decoded, err := AdaptorSignatureFromBytes(adaptorSig.Bytes())
+		if err != nil {
+			t.Fatalf("Failed to decode adaptor signature : %s", err)
+		}
+
+		if !decoded.Verify(hash, key.PublicKey(), adaptor) {
+			t.Fatalf("Failed to verify decoded adaptor signature")
+		}
+
+		other, _ := GenerateKey(MainNet)
+		if adaptorSig.Verify(hash, key.PublicKey(), other.PublicKey()) {
+			t.Fatalf("Verified with wrong adaptor")
+		}
+		if adaptorSig.Verify(hash, other.PublicKey(), adaptor) {
+			t.Fatalf("Verified with wrong public key")
+		}
+
+		otherHash := Hash32(sha256.Sum256([]byte{byte(i), 1}))
+		if adaptorSig.Verify(otherHash, key.PublicKey(), adaptor) {
+			t.Fatalf("Verified with wrong hash")
+		}
+
+		// The adaptor signature isn't a valid signature until it is completed.
+		var preSig Signature
+		preSig.R.Mod(&adaptorSig.R.X, curveS256Params.N)
+		preSig.S.Set(&adaptorSig.S)
+		if preSig.Verify(hash, key.PublicKey()) {
+			t.Fatalf("Adaptor signature valid without secret")
+		}
+
+		sig, err := adaptorSig.Complete(secret)
+		if err != nil {
+			t.Fatalf("Failed to complete : %s", err)
+		}
+
+		if !sig.Verify(hash, key.PublicKey()) {
+			t.Fatalf("Completed signature invalid")
+		}
+
+		extracted, err := adaptorSig.ExtractSecret(sig, adaptor)
+		if err != nil {
+			t.Fatalf("Failed to extract secret : %s", err)
+		}
+
+		if !extracted.Equal(secret) {
+			t.Fatalf("Wrong secret : got %x, want %x", extracted.Number(), secret.Number())
+		}
+
+		if _, err := adaptorSig.ExtractSecret(sig, other.PublicKey()); err == nil {
+			t.Fatalf("Extracted secret for wrong adaptor")
+		}
+	}
+}
+
+func TestAdaptorSignatureModifiedProof(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	secret, _ := GenerateKey(MainNet)
+	hash := Hash32(sha256.Sum256([]byte("swap")))
+
+	adaptorSig, err := key.AdaptorSign(hash, secret.PublicKey())
+	if err != nil {
+		t.Fatalf("Failed to adaptor sign : %s", err)
+	}
+
+	// Replacing the nonce point with one that isn't k * T must fail the DLEQ proof.
+	other, _ := GenerateKey(MainNet)
+	modified := adaptorSig
+	modified.R = other.PublicKey()
+	if modified.Verify(hash, key.PublicKey(), secret.PublicKey()) {
+		t.Fatalf("Verified with modified R")
+	}
+
+	modified = adaptorSig
+	modified.ProofS.Add(&modified.ProofS, one)
+	if modified.Verify(hash, key.PublicKey(), secret.PublicKey()) {
+		t.Fatalf("Verified with modified proof")
+	}
+}
+
+// TestAdaptorSignatureVectors checks pre-signing, verifying, completing and extracting against
+// fixed vectors. The vectors were computed with a separate implementation of the same
+// construction, written in Python directly from the curve arithmetic, so they don't depend on this
+// package. Inputs are sha256("key i"), sha256("secret i"), sha256("message i"), sha256("nonce i")
+// and sha256("proof nonce i"). The completed s value of the second vector is high and is negated,
+// so extraction has to use the negated secret.
+func TestAdaptorSignatureVectors(t *testing.T) {
+	tests := []struct {
+		key        string
+		publicKey  string
+		secret     string
+		adaptor    string
+		hash       string
+		nonce      string
+		proofNonce string
+		adaptorSig string
+		sig        string
+	}{
+		{
+			key:        "49ac5de219edae62f9fdeea0fc3f3af48fd832f22fac50820ac11174d6e068bd",
+			publicKey:  "029784cc16e4098e738a135e815bd059fdaa5bbc994a62e060bcc35109bae6670f",
+			secret:     "6b85ef3dff7bb6fea77cd2b8662cb19b7a6895139e8e86e307e1875e456dab7e",
+			adaptor:    "0340d6b9f8a4d1e9b2550fbeafe1473318a6244795854c6806d7202624cf2ffe63",
+			hash:       "74f2bab0f7b496db35967b365a4bedc0f6378888dea671ec307ee99e677fe21d",
+			nonce:      "7e47af158e9db54fc5e4902996f5360a933c581e7bad35436d50e489bd3bd262",
+			proofNonce: "5c59c8f1841fb480747345e3089dfbd6f9efbcf43a4ce28b3b7e8d7ca5626ffd",
+			adaptorSig: "02c4dedc63450fcbed055c6ca2c5efc1af14c7a4640f5c87561042711797c56e94" +
+				"023a1aec073d4f105d611872c4262481643c19d113438583eb53a8a767a72e7627" +
+				"2db469d54028d2f63c6efa815593d971ca970e1a86444fc38c29951be771b92c" +
+				"314331d5322b1ea04166fff4248bd82a1d49b8414628619965c35bbc7195e5a4" +
+				"cd1a81cfd7777ae913e5fe5c3932dbca91cfea7186a52601d249517c5a1c273e",
+			sig: "3045022100c4dedc63450fcbed055c6ca2c5efc1af14c7a4640f5c87561042711797c56e94" +
+				"0220473cb076484fe9cfadaea8e671795b5a52971af71b196bae59e125745f3628dd",
+		},
+		{
+			key:        "3d3ee11c2fbf7f6a6b1e6aa16c382631ec5f1fbfc50ca3ba5a89d366d22eeaef",
+			publicKey:  "036563dc5530120b82c9d5770c56171f53739db4d8c53a8b7ba3b7a3f7004c3c39",
+			secret:     "57bb17f3f5f52ee8b9737be34ae152fd977096ad23f2390bb80ba3084d7fa6e2",
+			adaptor:    "021d3932ab673230486d0f956d05b9e88791ee298d9af2d6df7d9ed5bb861c92dd",
+			hash:       "fb29a8d5309d7c35b180dbd78c63a455a5d1fb45149a3264c08f1aff43524beb",
+			nonce:      "801125136d32a6287ce42b2630f06d53dcb3a0c8de7d1ace094b016a950a04d2",
+			proofNonce: "321beac50041ef15b14dfd49ae893865cdb46a01acf06d065382b5e7c3a2a535",
+			adaptorSig: "02204bd49dd2ffe9f5df61abb37755c158734fc34ecbaf91e2e141707f3203ca70" +
+				"023808ce0140f2f8044e887fb660178da65d225bdbf42648269a03c18f0b748cfa" +
+				"dd2fa334494f6e626cbea07cc76154962809d2ca56e6aed2596c3e69f92ae030" +
+				"0f65cee0a784774765d5632891089db0cc9354f785eebf4e8e301a32d31a8357" +
+				"8a8a4b97ec336c07a2c41f39d977839b6c754f1aa532acf6421667c75fbf3085",
+			sig: "30440220204bd49dd2ffe9f5df61abb37755c158734fc34ecbaf91e2e141707f3203ca70" +
+				"0220393a8a727176690e90b820de0051601d6565fa9b9384a9fcaa127373c9427688",
+		},
+	}
+
+	for i, tt := range tests {
+		b, _ := hex.DecodeString(tt.key)
+		key, err := KeyFromNumber(b, MainNet)
+		if err != nil {
+			t.Fatalf("Failed to create key %d : %s", i, err)
+		}
+
+		publicKey, err := PublicKeyFromStr(tt.publicKey)
+		if err != nil {
+			t.Fatalf("Failed to parse public key %d : %s", i, err)
+		}
+
+		if !key.PublicKey().Equal(publicKey) {
+			t.Fatalf("Wrong public key %d : got %s, want %s", i, key.PublicKey(), publicKey)
+		}
+
+		b, _ = hex.DecodeString(tt.secret)
+		secret, err := KeyFromNumber(b, MainNet)
+		if err != nil {
+			t.Fatalf("Failed to create secret %d : %s", i, err)
+		}
+
+		adaptor, err := PublicKeyFromStr(tt.adaptor)
+		if err != nil {
+			t.Fatalf("Failed to parse adaptor %d : %s", i, err)
+		}
+
+		b, _ = hex.DecodeString(tt.hash)
+		hash, err := NewHash32(b)
+		if err != nil {
+			t.Fatalf("Failed to create hash %d : %s", i, err)
+		}
+
+		b, _ = hex.DecodeString(tt.nonce)
+		nonce := new(big.Int).SetBytes(b)
+		b, _ = hex.DecodeString(tt.proofNonce)
+		proofNonce := new(big.Int).SetBytes(b)
+
+		wantAdaptorSig, _ := hex.DecodeString(tt.adaptorSig)
+		wantSig, _ := hex.DecodeString(tt.sig)
+
+		// Pre-sign
+		adaptorSig, ok := key.adaptorSign(*hash, adaptor, nonce, proofNonce)
+		if !ok {
+			t.Fatalf("Failed to adaptor sign %d", i)
+		}
+
+		if !bytes.Equal(adaptorSig.Bytes(), wantAdaptorSig) {
+			t.Errorf("Wrong adaptor signature %d : \ngot  %x\nwant %x", i, adaptorSig.Bytes(),
+				wantAdaptorSig)
+		}
+
+		// Verify
+		decoded, err := AdaptorSignatureFromBytes(wantAdaptorSig)
+		if err != nil {
+			t.Fatalf("Failed to decode adaptor signature %d : %s", i, err)
+		}
+
+		if !decoded.Verify(*hash, publicKey, adaptor) {
+			t.Errorf("Failed to verify adaptor signature %d", i)
+		}
+
+		// The adaptor of the other vector must not verify.
+		other := tests[(i+1)%len(tests)]
+		otherAdaptor, _ := PublicKeyFromStr(other.adaptor)
+		if decoded.Verify(*hash, publicKey, otherAdaptor) {
+			t.Errorf("Verified adaptor signature %d with wrong adaptor", i)
+		}
+
+		// Complete
+		sig, err := decoded.Complete(secret)
+		if err != nil {
+			t.Fatalf("Failed to complete %d : %s", i, err)
+		}
+
+		if !bytes.Equal(sig.Bytes(), wantSig) {
+			t.Errorf("Wrong completed signature %d : \ngot  %x\nwant %x", i, sig.Bytes(), wantSig)
+		}
+
+		if !sig.Verify(*hash, publicKey) {
+			t.Errorf("Completed signature %d invalid", i)
+		}
+
+		// Extract
+		vectorSig, err := SignatureFromBytes(wantSig)
+		if err != nil {
+			t.Fatalf("Failed to decode signature %d : %s", i, err)
+		}
+
+		extracted, err := decoded.ExtractSecret(vectorSig, adaptor)
+		if err != nil {
+			t.Fatalf("Failed to extract secret %d : %s", i, err)
+		}
+
+		if !extracted.Equal(secret) {
+			t.Errorf("Wrong extracted secret %d : got %x, want %x", i, extracted.Number(),
+				secret.Number())
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bitcoin
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+
+	"github.com/pkg/errors"
+)
+
+// BRC-42 is a method of deriving keys shared between two parties from an invoice number.
+// The sender and recipient each calculate the ECDH shared secret from their private key and the
+//   other party's public key. The HMAC-SHA256 of the invoice number, keyed with the compressed
+//   shared secret, is added to the recipient's key the same way WP42 adds a hash. So the sender
+//   can derive the recipient's child public key, and only the recipient can derive the matching
+//   child private key.
+//
+//   // Sender derives the recipient's public key for an invoice
+//   childPublicKey, err := recipientPublicKey.DeriveBRC42(senderKey, invoiceNumber)
+//
+//   // Recipient derives the private key for the same invoice
+//   childKey, err := recipientKey.DeriveBRC42(senderPublicKey, invoiceNumber)
+//
+// BRC-43 (brc43.go) specifies the format of invoice numbers used by BRC-100 wallets.
+
+// BRC42Hash returns the value added to a key to derive a BRC-42 child key. It is the
+// HMAC-SHA256 of the invoice number keyed with the compressed ECDH shared secret of the key and
+// the counterparty's public key.
+func BRC42Hash(key Key, counterparty PublicKey, invoiceNumber string) (Hash32, error) {
+	x, y := curveS256.ScalarMult(&counterparty.X, &counterparty.Y, key.Number())
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return Hash32{}, errors.Wrap(ErrOutOfRangeKey, "shared secret")
+	}
+
+	mac := hmac.New(sha256.New, compressPublicKey(*x, *y))
+	mac.Write([]byte(invoiceNumber))
+
+	var result Hash32
+	copy(result[:], mac.Sum(nil))
+	return result, nil
+}
+
+// DeriveBRC42 derives the child private key for an invoice number shared with the counterparty
+// that owns the public key.
+func (k Key) DeriveBRC42(counterparty PublicKey, invoiceNumber string) (Key, error) {
+	hash, err := BRC42Hash(k, counterparty, invoiceNumber)
+	if err != nil {
+		return Key{}, errors.Wrap(err, "hash")
+	}
+
+	return NextKey(k, hash)
+}
+
+// DeriveBRC42 derives the child public key for an invoice number. The counterparty is the
+// private key of the other party, so the owner of this public key can derive the matching child
+// private key.
+func (k PublicKey) DeriveBRC42(counterparty Key, invoiceNumber string) (PublicKey, error) {
+	hash, err := BRC42Hash(counterparty, k, invoiceNumber)
+	if err != nil {
+		return PublicKey{}, errors.Wrap(err, "hash")
+	}
+
+	return NextPublicKey(k, hash)
+}
@@ -0,0 +1,146 @@
+package bitcoin
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BRC-43 specifies invoice numbers for BRC-42 key derivation so that keys derived by different
+//   applications don't collide. An invoice number is "<security level>-<protocol>-<key id>", like
+//   "2-3241645161d8-invoice 12".
+//
+// The counterparty is the other party's public key. A key only used by its owner uses its own
+//   public key as the counterparty ("self"), and a key that anyone can derive uses
+//   AnyonePublicKey ("anyone").
+
+const (
+	// SecurityLevelSilent keys can be used by an application without asking the user.
+	SecurityLevelSilent = SecurityLevel(0)
+
+	// SecurityLevelApp keys require the user's permission for each application.
+	SecurityLevelApp = SecurityLevel(1)
+
+	// SecurityLevelCounterparty keys require the user's permission for each application and
+	// counterparty.
+	SecurityLevelCounterparty = SecurityLevel(2)
+
+	brc43MinProtocolLength = 5
+	brc43MaxProtocolLength = 400
+	brc43MaxKeyIDLength    = 800
+)
+
+var (
+	ErrInvalidSecurityLevel = errors.New("Invalid security level")
+	ErrInvalidProtocolName  = errors.New("Invalid protocol name")
+	ErrInvalidKeyID         = errors.New("Invalid key id")
+)
+
+// SecurityLevel is the level of permission a BRC-100 wallet requires to use a derived key.
+type SecurityLevel uint8
+
+// ProtocolID identifies the protocol a BRC-43 key is used for.
+type ProtocolID struct {
+	SecurityLevel SecurityLevel
+	Protocol      string
+}
+
+// NewInvoiceNumber returns the BRC-43 invoice number for a protocol and key id. The protocol name
+// is normalized to lower case without leading or trailing spaces.
+func NewInvoiceNumber(protocolID ProtocolID, keyID string) (string, error) {
+	if protocolID.SecurityLevel > SecurityLevelCounterparty {
+		return "", errors.Wrapf(ErrInvalidSecurityLevel, "%d", protocolID.SecurityLevel)
+	}
+
+	protocol := strings.ToLower(strings.TrimSpace(protocolID.Protocol))
+	if err := validateBRC43Protocol(protocol); err != nil {
+		return "", errors.Wrap(err, protocol)
+	}
+
+	if len(keyID) == 0 {
+		return "", errors.Wrap(ErrInvalidKeyID, "empty")
+	}
+	if len(keyID) > brc43MaxKeyIDLength {
+		return "", errors.Wrapf(ErrInvalidKeyID, "more than %d characters", brc43MaxKeyIDLength)
+	}
+
+	return fmt.Sprintf("%d-%s-%s", protocolID.SecurityLevel, protocol, keyID), nil
+}
+
+func validateBRC43Protocol(protocol string) error {
+	if len(protocol) < brc43MinProtocolLength {
+		return errors.Wrapf(ErrInvalidProtocolName, "less than %d characters",
+			brc43MinProtocolLength)
+	}
+	if len(protocol) > brc43MaxProtocolLength {
+		return errors.Wrapf(ErrInvalidProtocolName, "more than %d characters",
+			brc43MaxProtocolLength)
+	}
+
+	if strings.Contains(protocol, "  ") {
+		return errors.Wrap(ErrInvalidProtocolName, "consecutive spaces")
+	}
+
+	for _, c := range protocol {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != ' ' {
+			return errors.Wrapf(ErrInvalidProtocolName, "invalid character %q", c)
+		}
+	}
+
+	if strings.HasSuffix(protocol, " protocol") {
+		return errors.Wrap(ErrInvalidProtocolName, "redundant \" protocol\" suffix")
+	}
+
+	return nil
+}
+
+// AnyoneKey returns the private key with value 1 that is used as the counterparty for keys that
+// anyone can derive.
+func AnyoneKey() Key {
+	result := Key{net: MainNet}
+	result.value.SetInt64(1)
+	return result
+}
+
+// AnyonePublicKey returns the public key of AnyoneKey, which is the generator point.
+func AnyonePublicKey() PublicKey {
+	return AnyoneKey().PublicKey()
+}
+
+// DeriveBRC43 derives the child private key for a protocol and key id shared with the
+// counterparty.
+func (k Key) DeriveBRC43(protocolID ProtocolID, keyID string,
+	counterparty PublicKey) (Key, error) {
+
+	invoiceNumber, err := NewInvoiceNumber(protocolID, keyID)
+	if err != nil {
+		return Key{}, errors.Wrap(err, "invoice number")
+	}
+
+	return k.DeriveBRC42(counterparty, invoiceNumber)
+}
+
+// DeriveBRC43PublicKey derives a child public key for a protocol and key id shared with the
+// counterparty. When forSelf is true it is the public key of the child private key returned by
+// DeriveBRC43. Otherwise it is the counterparty's child public key, which only the counterparty
+// can derive the private key for.
+func (k Key) DeriveBRC43PublicKey(protocolID ProtocolID, keyID string, counterparty PublicKey,
+	forSelf bool) (PublicKey, error) {
+
+	if forSelf {
+		key, err := k.DeriveBRC43(protocolID, keyID, counterparty)
+		if err != nil {
+			return PublicKey{}, err
+		}
+
+		return key.PublicKey(), nil
+	}
+
+	invoiceNumber, err := NewInvoiceNumber(protocolID, keyID)
+	if err != nil {
+		return PublicKey{}, errors.Wrap(err, "invoice number")
+	}
+
+	return counterparty.DeriveBRC42(k, invoiceNumber)
+}
@@ -0,0 +1,135 @@
+package bitcoin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestNewInvoiceNumber(t *testing.T) {
+	tests := []struct {
+		protocolID ProtocolID
+		keyID      string
+		want       string
+		err        error
+	}{
+		{
+			protocolID: ProtocolID{SecurityLevelCounterparty, "3241645161d8"},
+			keyID:      "invoice 12",
+			want:       "2-3241645161d8-invoice 12",
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelSilent, "  Hello World "},
+			keyID:      "1",
+			want:       "0-hello world-1",
+		},
+		{
+			protocolID: ProtocolID{3, "hello world"},
+			keyID:      "1",
+			err:        ErrInvalidSecurityLevel,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "abcd"},
+			keyID:      "1",
+			err:        ErrInvalidProtocolName,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "hello  world"},
+			keyID:      "1",
+			err:        ErrInvalidProtocolName,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "hello-world"},
+			keyID:      "1",
+			err:        ErrInvalidProtocolName,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "payment protocol"},
+			keyID:      "1",
+			err:        ErrInvalidProtocolName,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, strings.Repeat("a", 401)},
+			keyID:      "1",
+			err:        ErrInvalidProtocolName,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "hello world"},
+			keyID:      "",
+			err:        ErrInvalidKeyID,
+		},
+		{
+			protocolID: ProtocolID{SecurityLevelApp, "hello world"},
+			keyID:      strings.Repeat("a", 801),
+			err:        ErrInvalidKeyID,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := NewInvoiceNumber(tt.protocolID, tt.keyID)
+			if tt.err != nil {
+				if errors.Cause(err) != tt.err {
+					t.Fatalf("Wrong error : got %v, want %v", err, tt.err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to create invoice number : %s", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Wrong invoice number : got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveBRC43(t *testing.T) {
+	alice, _ := GenerateKey(MainNet)
+	bob, _ := GenerateKey(MainNet)
+	protocolID := ProtocolID{SecurityLevelCounterparty, "tokenized test"}
+
+	// Alice derives Bob's public key and Bob derives his own.
+	bobPublicKey, err := alice.DeriveBRC43PublicKey(protocolID, "1", bob.PublicKey(), false)
+	if err != nil {
+		t.Fatalf("Failed to derive public key : %s", err)
+	}
+
+	bobKey, err := bob.DeriveBRC43(protocolID, "1", alice.PublicKey())
+	if err != nil {
+		t.Fatalf("Failed to derive key : %s", err)
+	}
+
+	if !bobKey.PublicKey().Equal(bobPublicKey) {
+		t.Fatalf("Wrong public key : got %s, want %s", bobPublicKey, bobKey.PublicKey())
+	}
+
+	bobSelfPublicKey, err := bob.DeriveBRC43PublicKey(protocolID, "1", alice.PublicKey(), true)
+	if err != nil {
+		t.Fatalf("Failed to derive self public key : %s", err)
+	}
+
+	if !bobSelfPublicKey.Equal(bobPublicKey) {
+		t.Fatalf("Wrong self public key : got %s, want %s", bobSelfPublicKey, bobPublicKey)
+	}
+
+	// Anyone can derive a key for the "anyone" counterparty.
+	anyonePublicKey, err := AnyoneKey().DeriveBRC43PublicKey(protocolID, "1", alice.PublicKey(),
+		false)
+	if err != nil {
+		t.Fatalf("Failed to derive anyone public key : %s", err)
+	}
+
+	aliceKey, err := alice.DeriveBRC43(protocolID, "1", AnyonePublicKey())
+	if err != nil {
+		t.Fatalf("Failed to derive anyone key : %s", err)
+	}
+
+	if !aliceKey.PublicKey().Equal(anyonePublicKey) {
+		t.Fatalf("Wrong anyone public key : got %s, want %s", anyonePublicKey,
+			aliceKey.PublicKey())
+	}
+}
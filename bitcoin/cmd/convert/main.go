@@ -7,6 +7,8 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 
 	"github.com/pkg/errors"
@@ -14,11 +16,34 @@ import (
 	"github.com/tokenized/pkg/bitcoin"
 )
 
-const usage = ""
+// maxAsmFileSize is the maximum size of an ASM file that will be assembled.
+const maxAsmFileSize = 10000000
+
+const usage = `<value>
+  convert asm <script hex>  : print the script as indented ASM
+  convert assemble <file>   : assemble an ASM file, or stdin when the file is "-"`
 
 func main() {
 	ctx := logger.ContextWithLogger(context.Background(), true, false, "")
 
+	if len(os.Args) == 3 {
+		switch os.Args[1] {
+		case "asm":
+			if err := disassemble(os.Args[2]); err != nil {
+				fmt.Printf("Failed to disassemble script : %s\n", err)
+				os.Exit(1)
+			}
+			return
+
+		case "assemble":
+			if err := assemble(os.Args[2]); err != nil {
+				fmt.Printf("Failed to assemble script : %s\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	if len(os.Args) != 2 {
 		fmt.Printf("One argument required : %s\n", usage)
 		os.Exit(1)
@@ -30,6 +55,45 @@ func main() {
 	}
 }
 
+func disassemble(arg string) error {
+	b, err := hex.DecodeString(arg)
+	if err != nil {
+		return errors.Wrap(err, "hex")
+	}
+
+	fmt.Println(bitcoin.ScriptToPrettyAsm(bitcoin.Script(b)))
+	return nil
+}
+
+func assemble(path string) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return errors.Wrap(err, "open")
+		}
+		defer f.Close()
+		r = f
+	}
+
+	// Read one byte more than the maximum to detect files that are too large.
+	text, err := ioutil.ReadAll(io.LimitReader(r, maxAsmFileSize+1))
+	if err != nil {
+		return errors.Wrap(err, "read")
+	}
+
+	if len(text) > maxAsmFileSize {
+		return fmt.Errorf("ASM file larger than %d bytes", maxAsmFileSize)
+	}
+
+	script, err := bitcoin.AsmToScript(string(text))
+	if err != nil {
+		return errors.Wrap(err, "assemble")
+	}
+
+	return printScript(script)
+}
+
 func convert(ctx context.Context, arg string) error {
 	if b, err := hex.DecodeString(arg); err == nil {
 		return errors.Wrap(convertBytes(ctx, b), "bytes")
@@ -126,6 +190,7 @@ func convertPublicKey(ctx context.Context, b []byte) error {
 func printScript(b []byte) error {
 	fmt.Printf("Script Size %d bytes\n", len(b))
 	fmt.Printf("Script: %s\n", bitcoin.ScriptToString(bitcoin.Script(b)))
+	fmt.Printf("Script ASM: %s\n", bitcoin.UnlockingScriptToAsm(bitcoin.Script(b)))
 	fmt.Printf("Script Hex: %s\n", hex.EncodeToString(b))
 	fmt.Printf("Script Base64: %s\n", base64.StdEncoding.EncodeToString(b))
 
@@ -2,18 +2,62 @@ package main
 
 import (
 	"encoding/hex"
+	"flag"
 	"os"
 
 	"github.com/tokenized/pkg/bitcoin"
 )
 
 func main() {
+	mnemonicBits := flag.Int("mnemonic", 0,
+		"generate a BIP-0039 mnemonic with this many bits of entropy (128-256) and its master key")
+	passphrase := flag.String("passphrase", "", "BIP-0039 passphrase used with -mnemonic")
+	wordlistName := flag.String("wordlist", "english", "BIP-0039 wordlist used with -mnemonic")
+	flag.Parse()
+
+	if *mnemonicBits != 0 {
+		generateMnemonic(*mnemonicBits, *passphrase, *wordlistName)
+		return
+	}
+
 	key, err := bitcoin.GenerateKey(bitcoin.MainNet)
 	if err != nil {
 		println("Failed to generate key:", err.Error())
 		os.Exit(1)
 	}
 
+	printKey(key)
+}
+
+func generateMnemonic(bits int, passphrase, wordlistName string) {
+	wordlist, err := bitcoin.GetWordlist(wordlistName)
+	if err != nil {
+		println("Failed to get wordlist:", err.Error())
+		os.Exit(1)
+	}
+
+	mnemonic, err := bitcoin.GenerateMnemonic(bits, wordlist)
+	if err != nil {
+		println("Failed to generate mnemonic:", err.Error())
+		os.Exit(1)
+	}
+
+	xkey, err := bitcoin.LoadMasterExtendedKeyFromMnemonic(mnemonic, passphrase, wordlist)
+	if err != nil {
+		println("Failed to load master key:", err.Error())
+		os.Exit(1)
+	}
+	xkey.Network = bitcoin.MainNet
+
+	println("Mnemonic:", mnemonic)
+	println("Master Key:", xkey.String())
+	println("Master Key (base 58):", xkey.String58())
+	println("Master Public Key:", xkey.ExtendedPublicKey().String())
+
+	printKey(xkey.Key(bitcoin.MainNet))
+}
+
+func printKey(key bitcoin.Key) {
 	println("Key:", key.String())
 
 	ra, err := key.RawAddress()
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/tokenized/pkg/bitcoin"
+)
+
+// Passwords are read from these environment variables when set, otherwise they are read from
+// stdin.
+const (
+	passwordEnv    = "KEYSTORE_PASSWORD"
+	newPasswordEnv = "KEYSTORE_NEW_PASSWORD"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "create":
+		create(os.Args[2:])
+	case "password":
+		changePassword(os.Args[2:])
+	case "export":
+		export(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	println("Usage:")
+	println("  keystore create [-type key|xkey|xkeys] [-kdf scrypt|argon2id] [-network name]")
+	println("    [-count n] [-import] <file>")
+	println("      Create a keystore file with a new key, or a key read from stdin with -import.")
+	println("  keystore password [-kdf scrypt|argon2id] <file>")
+	println("      Change the password of a keystore file.")
+	println("  keystore export [-public] <file>")
+	println("      Print the key in a keystore file.")
+	println()
+	println("Passwords are read from " + passwordEnv + " and " + newPasswordEnv + " if set.")
+	os.Exit(1)
+}
+
+func create(args []string) {
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	keyType := flags.String("type", bitcoin.KeystoreTypeKey, "type of key (key, xkey, xkeys)")
+	kdfName := flags.String("kdf", bitcoin.KeystoreKDFScrypt, "key derivation (scrypt, argon2id)")
+	networkName := flags.String("network", "mainnet", "network of the key")
+	count := flags.Int("count", 1, "number of keys generated for xkeys")
+	importKey := flags.Bool("import", false, "read the key text from stdin instead of generating")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+	path := flags.Arg(0)
+
+	kdf := parseKDF(*kdfName)
+	net := bitcoin.NetworkFromString(*networkName)
+	if net == bitcoin.InvalidNet {
+		println("Invalid network:", *networkName)
+		os.Exit(1)
+	}
+
+	var keyText string
+	if *importKey {
+		keyText = readLine("Key: ")
+	}
+
+	password := readNewPassword(passwordEnv)
+
+	var keystore *bitcoin.Keystore
+	var err error
+	switch *keyType {
+	case bitcoin.KeystoreTypeKey:
+		var key bitcoin.Key
+		if *importKey {
+			key, err = bitcoin.KeyFromStr(keyText)
+		} else {
+			key, err = bitcoin.GenerateKey(net)
+		}
+		if err != nil {
+			println("Failed to get key:", err.Error())
+			os.Exit(1)
+		}
+
+		keystore, err = bitcoin.EncryptKey(key, password, kdf)
+
+	case bitcoin.KeystoreTypeExtendedKey:
+		var xkey bitcoin.ExtendedKey
+		if *importKey {
+			xkey, err = bitcoin.ExtendedKeyFromStr(keyText)
+		} else {
+			xkey, err = generateExtendedKey(net)
+		}
+		if err != nil {
+			println("Failed to get xkey:", err.Error())
+			os.Exit(1)
+		}
+
+		keystore, err = bitcoin.EncryptExtendedKey(xkey, password, kdf)
+
+	case bitcoin.KeystoreTypeExtendedKeys:
+		var xkeys bitcoin.ExtendedKeys
+		if *importKey {
+			xkeys, err = bitcoin.ExtendedKeysFromStr(keyText)
+		} else {
+			for i := 0; i < *count; i++ {
+				xkey, gerr := generateExtendedKey(net)
+				if gerr != nil {
+					err = gerr
+					break
+				}
+				xkeys = append(xkeys, xkey)
+			}
+		}
+		if err != nil {
+			println("Failed to get xkeys:", err.Error())
+			os.Exit(1)
+		}
+
+		keystore, err = bitcoin.EncryptExtendedKeys(xkeys, password, kdf)
+
+	default:
+		println("Invalid key type:", *keyType)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		println("Failed to encrypt:", err.Error())
+		os.Exit(1)
+	}
+
+	writeKeystore(path, keystore, false)
+	println("Public Key:", keystore.PublicKey)
+}
+
+func changePassword(args []string) {
+	flags := flag.NewFlagSet("password", flag.ExitOnError)
+	kdfName := flags.String("kdf", bitcoin.KeystoreKDFScrypt, "key derivation (scrypt, argon2id)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+	path := flags.Arg(0)
+
+	keystore := readKeystore(path)
+	oldPassword := readPassword(passwordEnv, "Password: ")
+	newPassword := readNewPassword(newPasswordEnv)
+
+	changed, err := keystore.ChangePassword(oldPassword, newPassword, parseKDF(*kdfName))
+	if err != nil {
+		println("Failed to change password:", err.Error())
+		os.Exit(1)
+	}
+
+	writeKeystore(path, changed, true)
+}
+
+func export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	public := flags.Bool("public", false, "print only the public key, no password is required")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	keystore := readKeystore(flags.Arg(0))
+	if *public {
+		fmt.Println(keystore.PublicKey)
+		return
+	}
+
+	password := readPassword(passwordEnv, "Password: ")
+
+	var text string
+	switch keystore.Type {
+	case bitcoin.KeystoreTypeKey:
+		key, err := keystore.DecryptKey(password)
+		if err != nil {
+			println("Failed to decrypt:", err.Error())
+			os.Exit(1)
+		}
+		text = key.String()
+
+	case bitcoin.KeystoreTypeExtendedKey:
+		xkey, err := keystore.DecryptExtendedKey(password)
+		if err != nil {
+			println("Failed to decrypt:", err.Error())
+			os.Exit(1)
+		}
+		text = xkey.String()
+
+	case bitcoin.KeystoreTypeExtendedKeys:
+		xkeys, err := keystore.DecryptExtendedKeys(password)
+		if err != nil {
+			println("Failed to decrypt:", err.Error())
+			os.Exit(1)
+		}
+		text = xkeys.String()
+
+	default:
+		println("Unsupported keystore type:", keystore.Type)
+		os.Exit(1)
+	}
+
+	fmt.Println(text)
+}
+
+func generateExtendedKey(net bitcoin.Network) (bitcoin.ExtendedKey, error) {
+	xkey, err := bitcoin.GenerateMasterExtendedKey()
+	if err != nil {
+		return bitcoin.ExtendedKey{}, err
+	}
+	xkey.Network = net
+	return xkey, nil
+}
+
+func parseKDF(name string) bitcoin.KeystoreKDF {
+	switch name {
+	case bitcoin.KeystoreKDFScrypt:
+		return bitcoin.DefaultScryptKDF()
+	case bitcoin.KeystoreKDFArgon2id:
+		return bitcoin.DefaultArgon2idKDF()
+	}
+
+	println("Invalid KDF:", name)
+	os.Exit(1)
+	return bitcoin.KeystoreKDF{}
+}
+
+func readKeystore(path string) *bitcoin.Keystore {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		println("Failed to read keystore:", err.Error())
+		os.Exit(1)
+	}
+
+	keystore := &bitcoin.Keystore{}
+	if err := json.Unmarshal(b, keystore); err != nil {
+		println("Failed to parse keystore:", err.Error())
+		os.Exit(1)
+	}
+
+	return keystore
+}
+
+// writeKeystore writes the keystore to a file only readable by the owner. An existing file is
+// only replaced when overwrite is true.
+func writeKeystore(path string, keystore *bitcoin.Keystore, overwrite bool) {
+	b, err := json.MarshalIndent(keystore, "", "  ")
+	if err != nil {
+		println("Failed to serialize keystore:", err.Error())
+		os.Exit(1)
+	}
+	b = append(b, '\n')
+
+	if !overwrite {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			println("Failed to create keystore:", err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+
+		if _, err := file.Write(b); err != nil {
+			println("Failed to write keystore:", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Write to a temporary file and rename so the keystore isn't lost if the write fails.
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, b, 0600); err != nil {
+		println("Failed to write keystore:", err.Error())
+		os.Exit(1)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		println("Failed to replace keystore:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func readPassword(env, prompt string) string {
+	if password, ok := os.LookupEnv(env); ok {
+		return password
+	}
+
+	return readLine(prompt)
+}
+
+func readNewPassword(env string) string {
+	if password, ok := os.LookupEnv(env); ok {
+		return password
+	}
+
+	password := readLine("New Password: ")
+	if readLine("Confirm Password: ") != password {
+		println("Passwords don't match")
+		os.Exit(1)
+	}
+
+	return password
+}
+
+func readLine(prompt string) string {
+	fmt.Fprint(os.Stderr, prompt)
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && len(line) == 0 {
+		println("Failed to read input:", err.Error())
+		os.Exit(1)
+	}
+
+	return strings.TrimRight(line, "\r\n")
+}
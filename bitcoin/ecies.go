@@ -0,0 +1,276 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ECIES (Elliptic Curve Integrated Encryption Scheme) encrypts data to a public key with a key
+//   derived from the ECDH shared secret and authenticates it so modified ciphertext is detected.
+//
+// BIE1 is the Electrum compatible format. The shared secret point, from an ephemeral key and the
+//   recipient's public key, is hashed with SHA512 to derive an IV, an AES-128-CBC key and an
+//   HMAC-SHA256 key. The output is "BIE1", the ephemeral public key, the ciphertext and the HMAC.
+//
+// BRC-78 encrypts a message from a sender's key to a recipient's public key with AES-256-GCM using
+//   keys derived with BRC-42 from a random key id. The output contains the version, both public
+//   keys, the key id, and the IV, ciphertext and GCM tag.
+
+const (
+	bie1MACSize    = sha256.Size
+	brc78KeyIDSize = 32
+	brc78IVSize    = 32
+)
+
+var (
+	bie1Magic    = []byte("BIE1")
+	brc78Version = []byte{0x42, 0x42, 0x10, 0x33}
+
+	ErrDecryptAuthentication = errors.New("Encrypted data failed authentication")
+	ErrWrongEncryptionFormat = errors.New("Wrong encryption format")
+	ErrWrongRecipient        = errors.New("Wrong recipient")
+)
+
+// EncryptBIE1 encrypts a message to the public key in the Electrum BIE1 format with a random
+// ephemeral key.
+func EncryptBIE1(message []byte, recipient PublicKey) ([]byte, error) {
+	ephemeral, err := GenerateKey(MainNet)
+	if err != nil {
+		return nil, errors.Wrap(err, "generate key")
+	}
+
+	return EncryptBIE1FromKey(message, recipient, ephemeral)
+}
+
+// EncryptBIE1FromKey encrypts a message to the public key in the Electrum BIE1 format using the
+// sender's key instead of an ephemeral key. The result is deterministic, so the key should only be
+// reused for the same recipient when that is acceptable.
+func EncryptBIE1FromKey(message []byte, recipient PublicKey, sender Key) ([]byte, error) {
+	iv, encryptionKey, macKey := bie1Keys(sender, recipient)
+
+	aesCipher, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+
+	plaintext := pkcs7Pad(message, aes.BlockSize)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(aesCipher, iv).CryptBlocks(ciphertext, plaintext)
+
+	result := &bytes.Buffer{}
+	result.Write(bie1Magic)
+	result.Write(sender.PublicKey().Bytes())
+	result.Write(ciphertext)
+
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(result.Bytes())
+	result.Write(mac.Sum(nil))
+
+	return result.Bytes(), nil
+}
+
+// DecryptBIE1 authenticates and decrypts data in the Electrum BIE1 format with the recipient's
+// key.
+func DecryptBIE1(encrypted []byte, key Key) ([]byte, error) {
+	headerSize := len(bie1Magic) + PublicKeyCompressedLength
+	if len(encrypted) < headerSize+aes.BlockSize+bie1MACSize {
+		return nil, errors.Wrap(ErrWrongEncryptionFormat, "too short")
+	}
+
+	if !bytes.Equal(encrypted[:len(bie1Magic)], bie1Magic) {
+		return nil, errors.Wrap(ErrWrongEncryptionFormat, "missing BIE1 magic")
+	}
+
+	ephemeral, err := PublicKeyFromBytes(encrypted[len(bie1Magic):headerSize])
+	if err != nil {
+		return nil, errors.Wrap(err, "ephemeral public key")
+	}
+
+	iv, encryptionKey, macKey := bie1Keys(key, ephemeral)
+
+	macOffset := len(encrypted) - bie1MACSize
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(encrypted[:macOffset])
+	if !hmac.Equal(mac.Sum(nil), encrypted[macOffset:]) {
+		return nil, ErrDecryptAuthentication
+	}
+
+	ciphertext := encrypted[headerSize:macOffset]
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.Wrap(ErrWrongEncryptionFormat, "not block aligned")
+	}
+
+	aesCipher, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(aesCipher, iv).CryptBlocks(plaintext, ciphertext)
+
+	return pkcs7Unpad(plaintext, aes.BlockSize)
+}
+
+// bie1Keys returns the IV, AES key, and HMAC key derived from the SHA512 of the compressed ECDH
+// shared secret point.
+func bie1Keys(key Key, publicKey PublicKey) ([]byte, []byte, []byte) {
+	hash := sha512.Sum512(ecdhPoint(key, publicKey))
+	return hash[:16], hash[16:32], hash[32:]
+}
+
+// EncryptBRC78 encrypts a message from the sender to the recipient with BRC-78 message
+// encryption.
+func EncryptBRC78(message []byte, sender Key, recipient PublicKey) ([]byte, error) {
+	keyID := make([]byte, brc78KeyIDSize)
+	if _, err := rand.Read(keyID); err != nil {
+		return nil, errors.Wrap(err, "random key id")
+	}
+
+	invoiceNumber := brc78InvoiceNumber(keyID)
+	signingKey, err := sender.DeriveBRC42(recipient, invoiceNumber)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive sender key")
+	}
+
+	recipientPublicKey, err := recipient.DeriveBRC42(sender, invoiceNumber)
+	if err != nil {
+		return nil, errors.Wrap(err, "derive recipient key")
+	}
+
+	aead, err := brc78Cipher(signingKey, recipientPublicKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "cipher")
+	}
+
+	iv := make([]byte, brc78IVSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, errors.Wrap(err, "random iv")
+	}
+
+	result := &bytes.Buffer{}
+	result.Write(brc78Version)
+	result.Write(sender.PublicKey().Bytes())
+	result.Write(recipient.Bytes())
+	result.Write(keyID)
+	result.Write(iv)
+	result.Write(aead.Seal(nil, iv, message, nil))
+
+	return result.Bytes(), nil
+}
+
+// DecryptBRC78 authenticates and decrypts a BRC-78 encrypted message with the recipient's key. It
+// also returns the sender's public key.
+func DecryptBRC78(encrypted []byte, recipient Key) ([]byte, PublicKey, error) {
+	headerSize := len(brc78Version) + 2*PublicKeyCompressedLength + brc78KeyIDSize + brc78IVSize
+	if len(encrypted) < headerSize+aes.BlockSize {
+		return nil, PublicKey{}, errors.Wrap(ErrWrongEncryptionFormat, "too short")
+	}
+
+	offset := 0
+	if !bytes.Equal(encrypted[:len(brc78Version)], brc78Version) {
+		return nil, PublicKey{}, errors.Wrap(ErrWrongEncryptionFormat,
+			fmt.Sprintf("version %x", encrypted[:len(brc78Version)]))
+	}
+	offset += len(brc78Version)
+
+	sender, err := PublicKeyFromBytes(encrypted[offset : offset+PublicKeyCompressedLength])
+	if err != nil {
+		return nil, PublicKey{}, errors.Wrap(err, "sender public key")
+	}
+	offset += PublicKeyCompressedLength
+
+	recipientBytes := encrypted[offset : offset+PublicKeyCompressedLength]
+	if !bytes.Equal(recipientBytes, recipient.PublicKey().Bytes()) {
+		return nil, PublicKey{}, errors.Wrap(ErrWrongRecipient,
+			fmt.Sprintf("encrypted to %x", recipientBytes))
+	}
+	offset += PublicKeyCompressedLength
+
+	keyID := encrypted[offset : offset+brc78KeyIDSize]
+	offset += brc78KeyIDSize
+
+	invoiceNumber := brc78InvoiceNumber(keyID)
+	signingPublicKey, err := sender.DeriveBRC42(recipient, invoiceNumber)
+	if err != nil {
+		return nil, PublicKey{}, errors.Wrap(err, "derive sender key")
+	}
+
+	recipientKey, err := recipient.DeriveBRC42(sender, invoiceNumber)
+	if err != nil {
+		return nil, PublicKey{}, errors.Wrap(err, "derive recipient key")
+	}
+
+	aead, err := brc78Cipher(recipientKey, signingPublicKey)
+	if err != nil {
+		return nil, PublicKey{}, errors.Wrap(err, "cipher")
+	}
+
+	iv := encrypted[offset : offset+brc78IVSize]
+	offset += brc78IVSize
+
+	message, err := aead.Open(nil, iv, encrypted[offset:], nil)
+	if err != nil {
+		return nil, PublicKey{}, ErrDecryptAuthentication
+	}
+
+	return message, sender, nil
+}
+
+func brc78InvoiceNumber(keyID []byte) string {
+	return "2-message encryption-" + base64.StdEncoding.EncodeToString(keyID)
+}
+
+// brc78Cipher returns AES-256-GCM, with BRC-78's 32 byte IV, keyed with the x coordinate of the
+// ECDH shared secret.
+func brc78Cipher(key Key, publicKey PublicKey) (cipher.AEAD, error) {
+	aesCipher, err := aes.NewCipher(ecdhPoint(key, publicKey)[1:])
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+
+	return cipher.NewGCMWithNonceSize(aesCipher, brc78IVSize)
+}
+
+// ecdhPoint returns the compressed ECDH shared secret point.
+func ecdhPoint(key Key, publicKey PublicKey) []byte {
+	x, y := curveS256.ScalarMult(&publicKey.X, &publicKey.Y, key.Number())
+	return compressPublicKey(*x, *y)
+}
+
+func pkcs7Pad(b []byte, blockSize int) []byte {
+	padding := blockSize - len(b)%blockSize
+	result := make([]byte, len(b)+padding)
+	copy(result, b)
+	for i := len(b); i < len(result); i++ {
+		result[i] = byte(padding)
+	}
+	return result
+}
+
+func pkcs7Unpad(b []byte, blockSize int) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errors.Wrap(ErrWrongEncryptionFormat, "empty padding")
+	}
+
+	padding := int(b[len(b)-1])
+	if padding == 0 || padding > blockSize || padding > len(b) {
+		return nil, errors.Wrap(ErrWrongEncryptionFormat, "invalid padding")
+	}
+
+	for _, v := range b[len(b)-padding:] {
+		if int(v) != padding {
+			return nil, errors.Wrap(ErrWrongEncryptionFormat, "invalid padding")
+		}
+	}
+
+	return b[:len(b)-padding], nil
+}
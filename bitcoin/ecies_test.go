@@ -0,0 +1,226 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestBIE1(t *testing.T) {
+	recipient, _ := GenerateKey(MainNet)
+
+	for _, size := range []int{0, 1, 15, 16, 17, 100} {
+		message := bytes.Repeat([]byte{0xab}, size)
+
+		encrypted, err := EncryptBIE1(message, recipient.PublicKey())
+		if err != nil {
+			t.Fatalf("Failed to encrypt : %s", err)
+		}
+
+		if !bytes.Equal(encrypted[:4], []byte("BIE1")) {
+			t.Fatalf("Missing magic : %x", encrypted[:4])
+		}
+
+		decrypted, err := DecryptBIE1(encrypted, recipient)
+		if err != nil {
+			t.Fatalf("Failed to decrypt : %s", err)
+		}
+
+		if !bytes.Equal(decrypted, message) {
+			t.Fatalf("Wrong message : got %x, want %x", decrypted, message)
+		}
+
+		// Modify each section of the encrypted data.
+		for _, index := range []int{40, len(encrypted) - 40, len(encrypted) - 1} {
+			modified := append([]byte(nil), encrypted...)
+			modified[index] ^= 0x01
+			if _, err := DecryptBIE1(modified, recipient); err == nil {
+				t.Fatalf("Modified data at %d decrypted", index)
+			}
+		}
+
+		other, _ := GenerateKey(MainNet)
+		if _, err := DecryptBIE1(encrypted, other); errors.Cause(err) != ErrDecryptAuthentication {
+			t.Fatalf("Wrong error for wrong key : got %v, want %v", err,
+				ErrDecryptAuthentication)
+		}
+	}
+}
+
+func TestBIE1FromKey(t *testing.T) {
+	sender, _ := GenerateKey(MainNet)
+	recipient, _ := GenerateKey(MainNet)
+	message := []byte("attack at dawn")
+
+	encrypted, err := EncryptBIE1FromKey(message, recipient.PublicKey(), sender)
+	if err != nil {
+		t.Fatalf("Failed to encrypt : %s", err)
+	}
+
+	again, _ := EncryptBIE1FromKey(message, recipient.PublicKey(), sender)
+	if !bytes.Equal(encrypted, again) {
+		t.Fatalf("Encryption from key not deterministic")
+	}
+
+	if !bytes.Equal(encrypted[4:37], sender.PublicKey().Bytes()) {
+		t.Fatalf("Wrong public key in header : got %x, want %x", encrypted[4:37],
+			sender.PublicKey().Bytes())
+	}
+
+	decrypted, err := DecryptBIE1(encrypted, recipient)
+	if err != nil {
+		t.Fatalf("Failed to decrypt : %s", err)
+	}
+
+	if !bytes.Equal(decrypted, message) {
+		t.Fatalf("Wrong message : got %s, want %s", decrypted, message)
+	}
+}
+
+func TestBRC78(t *testing.T) {
+	sender, _ := KeyFromNumber([]byte{15}, MainNet)
+	recipient, _ := KeyFromNumber([]byte{21}, MainNet)
+	message := []byte{1, 2, 4, 8, 16, 32}
+
+	encrypted, err := EncryptBRC78(message, sender, recipient.PublicKey())
+	if err != nil {
+		t.Fatalf("Failed to encrypt : %s", err)
+	}
+
+	decrypted, senderPublicKey, err := DecryptBRC78(encrypted, recipient)
+	if err != nil {
+		t.Fatalf("Failed to decrypt : %s", err)
+	}
+
+	if !bytes.Equal(decrypted, message) {
+		t.Fatalf("Wrong message : got %x, want %x", decrypted, message)
+	}
+
+	if !senderPublicKey.Equal(sender.PublicKey()) {
+		t.Fatalf("Wrong sender : got %s, want %s", senderPublicKey, sender.PublicKey())
+	}
+
+	wrongVersion := append([]byte(nil), encrypted...)
+	wrongVersion[0] = 1
+	if _, _, err := DecryptBRC78(wrongVersion, recipient); errors.Cause(err) != ErrWrongEncryptionFormat {
+		t.Fatalf("Wrong error for version : got %v, want %v", err, ErrWrongEncryptionFormat)
+	}
+
+	wrongRecipient, _ := KeyFromNumber([]byte{22}, MainNet)
+	if _, _, err := DecryptBRC78(encrypted, wrongRecipient); errors.Cause(err) != ErrWrongRecipient {
+		t.Fatalf("Wrong error for recipient : got %v, want %v", err, ErrWrongRecipient)
+	}
+
+	modified := append([]byte(nil), encrypted...)
+	modified[len(modified)-1] ^= 0x01
+	if _, _, err := DecryptBRC78(modified, recipient); errors.Cause(err) != ErrDecryptAuthentication {
+		t.Fatalf("Wrong error for modified : got %v, want %v", err, ErrDecryptAuthentication)
+	}
+}
+
+// TestBIE1Vectors decrypts data encrypted by other Electrum BIE1 implementations.
+func TestBIE1Vectors(t *testing.T) {
+	tests := []struct {
+		key       string
+		encrypted string // hex
+		message   string
+	}{
+		// Encrypted to itself with the sender key, from the go-sdk Electrum compatibility tests.
+		{
+			key:       "L211enC224G1kV8pyyq7bjVd9SxZebnRYEzzM3i7ZHCc1c5E7dQu",
+			encrypted: "4249453103bbce95ff192e17a6d842cbafe14f7f192ac0466e7f0928c187398e627e66a84fcf742abb7d708464fd42d7681e6e0b4f28c11202cde9c56e6df5a591aed2008cdae3b1a687f01da70a89dc19d10eda13",
+			message:   "hello world",
+		},
+		// Encrypted with ephemeral keys by go-sdk ElectrumEncrypt.
+		{
+			key:       "L27ZSAC1xTsZrghYHqnxwAQZ12bH57piaAdoGaLizTp3JZrjkZjK",
+			encrypted: "42494531022787faaf8197841e942c74eb5e0e6f05c456c456c2cdddf83415e1ea11bd7aee7d9096a9bbae867646951b5abe6e09addea9d25784b8aa6f39d28b2520c3e2a6e3626b7c44c307c1bac5d170543cf21f",
+			message:   "hello world",
+		},
+		{
+			key:       "L27ZSAC1xTsZrghYHqnxwAQZ12bH57piaAdoGaLizTp3JZrjkZjK",
+			encrypted: "42494531039e5d4ed62ddbcd06717f322e4de3f7ed259235f69c35784976d387ea58b317cecbc6b26b0f079deaaac56d181bb52f9830166547220be342b1d9ad3e748ef7c000fc455050cdb7ada2200121c67d4bcd",
+			message:   "",
+		},
+		{
+			key:       "L27ZSAC1xTsZrghYHqnxwAQZ12bH57piaAdoGaLizTp3JZrjkZjK",
+			encrypted: "42494531028e91b26413d008a6cbe6db5ffb7a18ef58f288ea4f5fd7d34eb22fa0a4d1a598bb707e9311a66d06941cbc98321d65b2122163f9cfaa0223fd4a901a0891d12aa43f7c2414294df3792f7a16d2e6a0f6e4fdd5ad9edb200217e62597a0f26fca",
+			message:   "exactly 16 bytes",
+		},
+	}
+
+	for i, tt := range tests {
+		key, err := KeyFromStr(tt.key)
+		if err != nil {
+			t.Fatalf("Failed to parse key %d : %s", i, err)
+		}
+
+		encrypted, err := hex.DecodeString(tt.encrypted)
+		if err != nil {
+			t.Fatalf("Failed to decode encrypted %d : %s", i, err)
+		}
+
+		decrypted, err := DecryptBIE1(encrypted, key)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d : %s", i, err)
+		}
+
+		if string(decrypted) != tt.message {
+			t.Fatalf("Wrong message %d : got %q, want %q", i, decrypted, tt.message)
+		}
+	}
+
+	// Encrypting from the same key must reproduce the published ciphertext.
+	key, _ := KeyFromStr(tests[0].key)
+	encrypted, err := EncryptBIE1FromKey([]byte(tests[0].message), key.PublicKey(), key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt : %s", err)
+	}
+
+	want, _ := hex.DecodeString(tests[0].encrypted)
+	if !bytes.Equal(encrypted, want) {
+		t.Fatalf("Wrong encryption : got %x, want %x", encrypted, want)
+	}
+}
+
+// TestBRC78Vectors decrypts messages encrypted by the go-sdk port of the ts-sdk EncryptedMessage.
+func TestBRC78Vectors(t *testing.T) {
+	sender, _ := KeyFromNumber([]byte{15}, MainNet)
+	recipient, _ := KeyFromNumber([]byte{21}, MainNet)
+
+	tests := []struct {
+		encrypted string // hex
+		message   []byte
+	}{
+		{
+			encrypted: "4242103302d7924d4f7d43ea965a465ae3095ff41131e5946f3c85f79e44adbcf8e27e080e02352bbf4a4cdd12564f93fa332ce333301d9ad40271f8107181340aef25be59d5a3d84582510f850b55a3853f9039e0703e0e1e4af3f0ce22305561cbbe8667e6d76badb87ecc0389d66ebc608f6d154947bfd2748db694ef15d2ba24dbb5aaf512538fb72fff004d1ac070e7d3f9f32fefaaab8c8dca",
+			message:   []byte{1, 2, 4, 8, 16, 32},
+		},
+		{
+			encrypted: "4242103302d7924d4f7d43ea965a465ae3095ff41131e5946f3c85f79e44adbcf8e27e080e02352bbf4a4cdd12564f93fa332ce333301d9ad40271f8107181340aef25be59d515bdfac419b363a62bbcfb31fec4560260dc093fce559d8917f52b5495cc3e823c47926f1ecef67aad26ee20559ace5b1496acf73b92aeb1e60403361a047bbaa959a1dc60509f2805eb3bf51b1caf84876b25d37043b6af657adf266edeff05c85623d00534b8eb87fe96d234be59a4f849d7fa59",
+			message:   []byte("BRC-78 message encryption test vector"),
+		},
+	}
+
+	for i, tt := range tests {
+		encrypted, err := hex.DecodeString(tt.encrypted)
+		if err != nil {
+			t.Fatalf("Failed to decode encrypted %d : %s", i, err)
+		}
+
+		decrypted, senderPublicKey, err := DecryptBRC78(encrypted, recipient)
+		if err != nil {
+			t.Fatalf("Failed to decrypt %d : %s", i, err)
+		}
+
+		if !bytes.Equal(decrypted, tt.message) {
+			t.Fatalf("Wrong message %d : got %x, want %x", i, decrypted, tt.message)
+		}
+
+		if !senderPublicKey.Equal(sender.PublicKey()) {
+			t.Fatalf("Wrong sender %d : got %s, want %s", i, senderPublicKey, sender.PublicKey())
+		}
+	}
+}
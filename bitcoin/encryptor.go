@@ -11,13 +11,15 @@ import (
 )
 
 // Encryptor is an io.WriteCloser (Writer and Closer) the encrypts data with a specified key.
+// The data is not authenticated. Use GCMEncryptor when modified data must be detected.
 type Encryptor struct {
 	cipher.BlockMode
 	w         io.Writer
 	remainder []byte
 }
 
-// Decryptor is an io.Reader that decrypts data with a specified key
+// Decryptor is an io.Reader that decrypts data with a specified key. Use GCMDecryptor for data
+// written by a GCMEncryptor.
 type Decryptor struct {
 	cipher.BlockMode
 	r         io.Reader
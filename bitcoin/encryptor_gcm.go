@@ -0,0 +1,279 @@
+package bitcoin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// GCM streams encrypt data in chunks with AES-GCM so that each chunk is authenticated as it is
+//   read, instead of the whole payload being buffered. The header is a version byte, the chunk
+//   size, and a random nonce prefix. Each chunk's nonce is the prefix, a chunk counter, and a flag
+//   for the final chunk, so reordered, removed, or truncated chunks fail authentication.
+//
+// Each chunk is preceded by its plaintext size with the high bit set for the final chunk, so the
+//   decryptor stops reading at the end of the final chunk. The stream can be followed by other
+//   data, or read from a connection that stays open.
+
+const (
+	// DefaultGCMChunkSize is the plaintext size of each chunk in a GCM stream.
+	DefaultGCMChunkSize = 64 * 1024
+
+	// MaxGCMChunkSize is the largest chunk size accepted by a GCMDecryptor.
+	MaxGCMChunkSize = 16 * 1024 * 1024
+
+	gcmStreamVersion     = 1
+	gcmNoncePrefixSize   = 7
+	gcmStreamHeaderSize  = 1 + 4 + gcmNoncePrefixSize
+	gcmFinalChunk        = 1
+	gcmIntermediateChunk = 0
+	gcmChunkHeaderSize   = 4
+	gcmFinalChunkFlag    = 1 << 31
+)
+
+// GCMEncryptor is an io.WriteCloser that encrypts data to a writer as an authenticated AES-GCM
+// stream. Close must be called to write the final chunk.
+type GCMEncryptor struct {
+	aead      cipher.AEAD
+	w         io.Writer
+	header    []byte
+	chunkSize int
+	counter   uint32
+	buffer    []byte
+	closed    bool
+}
+
+// GCMDecryptor is an io.Reader that decrypts and authenticates an AES-GCM stream written by a
+// GCMEncryptor.
+type GCMDecryptor struct {
+	aead      cipher.AEAD
+	r         io.Reader
+	header    []byte
+	chunkSize int
+	counter   uint32
+	plaintext []byte
+	complete  bool
+}
+
+// NewGCMEncryptor creates a new GCM stream encryptor with the default chunk size. The key must be
+// 16, 24, or 32 bytes. w is the writer that the encrypted data should be written to.
+func NewGCMEncryptor(key []byte, w io.Writer) (*GCMEncryptor, error) {
+	return NewGCMEncryptorChunkSize(key, DefaultGCMChunkSize, w)
+}
+
+// NewGCMEncryptorChunkSize creates a new GCM stream encryptor with a specified chunk size.
+func NewGCMEncryptorChunkSize(key []byte, chunkSize int, w io.Writer) (*GCMEncryptor, error) {
+	if chunkSize <= 0 || chunkSize > MaxGCMChunkSize {
+		return nil, fmt.Errorf("Invalid chunk size : %d should be (0 > s <= %d)", chunkSize,
+			MaxGCMChunkSize)
+	}
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, gcmStreamHeaderSize)
+	header[0] = gcmStreamVersion
+	endian.PutUint32(header[1:5], uint32(chunkSize))
+	if _, err := rand.Read(header[5:]); err != nil {
+		return nil, errors.Wrap(err, "random nonce prefix")
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "write header")
+	}
+
+	return &GCMEncryptor{
+		aead:      aead,
+		w:         w,
+		header:    header,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+// Write implements io.Writer.
+func (e *GCMEncryptor) Write(b []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("Encryptor closed")
+	}
+
+	e.buffer = append(e.buffer, b...)
+
+	// Keep at least one byte buffered so the final chunk, written by Close, is never empty unless
+	// the stream is.
+	for len(e.buffer) > e.chunkSize {
+		if err := e.writeChunk(e.buffer[:e.chunkSize], false); err != nil {
+			return 0, err
+		}
+		e.buffer = e.buffer[e.chunkSize:]
+	}
+
+	// Copy the remainder to allow freeing of the input slice.
+	e.buffer = append([]byte(nil), e.buffer...)
+
+	return len(b), nil
+}
+
+// Close implements io.Closer. It writes the final chunk, but doesn't close the underlying writer.
+func (e *GCMEncryptor) Close() error {
+	if e.closed {
+		return nil
+	}
+
+	if err := e.writeChunk(e.buffer, true); err != nil {
+		return err
+	}
+
+	e.buffer = nil
+	e.closed = true
+	return nil
+}
+
+func (e *GCMEncryptor) writeChunk(plaintext []byte, final bool) error {
+	if e.counter == math.MaxUint32 {
+		return errors.New("Too many chunks")
+	}
+
+	nonce := gcmChunkNonce(e.header, e.counter, final)
+	e.counter++
+
+	chunkHeader := uint32(len(plaintext))
+	if final {
+		chunkHeader |= gcmFinalChunkFlag
+	}
+
+	chunk := make([]byte, gcmChunkHeaderSize, gcmChunkHeaderSize+len(plaintext)+e.aead.Overhead())
+	endian.PutUint32(chunk, chunkHeader)
+	chunk = e.aead.Seal(chunk, nonce, plaintext, e.header)
+
+	if _, err := e.w.Write(chunk); err != nil {
+		return errors.Wrap(err, "write chunk")
+	}
+
+	return nil
+}
+
+// NewGCMDecryptor creates a new GCM stream decryptor. r is the reader that the encrypted data
+// should be read from.
+func NewGCMDecryptor(key []byte, r io.Reader) (*GCMDecryptor, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, gcmStreamHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, errors.Wrap(err, "read header")
+	}
+
+	if header[0] != gcmStreamVersion {
+		return nil, errors.Wrapf(ErrWrongEncryptionFormat, "version %d", header[0])
+	}
+
+	chunkSize := int(endian.Uint32(header[1:5]))
+	if chunkSize == 0 || chunkSize > MaxGCMChunkSize {
+		return nil, errors.Wrapf(ErrWrongEncryptionFormat, "chunk size %d", chunkSize)
+	}
+
+	return &GCMDecryptor{
+		aead:      aead,
+		r:         r,
+		header:    header,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+// Read implements io.Reader. It returns ErrDecryptAuthentication if the stream was modified or
+// truncated, and io.EOF after the final chunk without reading any further from the underlying
+// reader.
+func (d *GCMDecryptor) Read(b []byte) (int, error) {
+	for len(d.plaintext) == 0 {
+		if d.complete {
+			return 0, io.EOF
+		}
+
+		if err := d.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, d.plaintext)
+	d.plaintext = d.plaintext[n:]
+	return n, nil
+}
+
+func (d *GCMDecryptor) readChunk() error {
+	var chunkHeader [gcmChunkHeaderSize]byte
+	if _, err := io.ReadFull(d.r, chunkHeader[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.Wrap(ErrDecryptAuthentication, "missing final chunk")
+		}
+		return errors.Wrap(err, "read chunk header")
+	}
+
+	// The final flag is also in the nonce so a modified flag fails authentication.
+	value := endian.Uint32(chunkHeader[:])
+	final := value&gcmFinalChunkFlag != 0
+	size := int(value &^ gcmFinalChunkFlag)
+	if size > d.chunkSize || (!final && size != d.chunkSize) {
+		return errors.Wrapf(ErrWrongEncryptionFormat, "chunk size %d", size)
+	}
+
+	ciphertext := make([]byte, size+d.aead.Overhead())
+	if _, err := io.ReadFull(d.r, ciphertext); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.Wrap(ErrDecryptAuthentication, "truncated chunk")
+		}
+		return errors.Wrap(err, "read chunk")
+	}
+
+	return d.openChunk(ciphertext, final)
+}
+
+func (d *GCMDecryptor) openChunk(ciphertext []byte, final bool) error {
+	nonce := gcmChunkNonce(d.header, d.counter, final)
+	plaintext, err := d.aead.Open(nil, nonce, ciphertext, d.header)
+	if err != nil {
+		return ErrDecryptAuthentication
+	}
+	d.counter++
+	d.plaintext = plaintext
+	d.complete = final
+
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new cipher")
+	}
+
+	aead, err := cipher.NewGCM(aesCipher)
+	if err != nil {
+		return nil, errors.Wrap(err, "new gcm")
+	}
+
+	return aead, nil
+}
+
+// gcmChunkNonce returns the nonce prefix from the header, the big endian chunk counter, and the
+// final chunk flag.
+func gcmChunkNonce(header []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, gcmNoncePrefixSize+5)
+	copy(nonce, header[5:])
+	binary.BigEndian.PutUint32(nonce[gcmNoncePrefixSize:], counter)
+	if final {
+		nonce[gcmNoncePrefixSize+4] = gcmFinalChunk
+	} else {
+		nonce[gcmNoncePrefixSize+4] = gcmIntermediateChunk
+	}
+	return nonce
+}
@@ -0,0 +1,156 @@
+package bitcoin
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestGCMEncryptor(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 1
+
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 33, 100} {
+		payload := make([]byte, size)
+		for i := range payload {
+			payload[i] = byte(i)
+		}
+
+		var buf bytes.Buffer
+		encryptor, err := NewGCMEncryptorChunkSize(key, 16, &buf)
+		if err != nil {
+			t.Fatalf("Failed to create encryptor : %s", err)
+		}
+
+		// Write in uneven pieces.
+		for offset := 0; offset < size; offset += 7 {
+			end := offset + 7
+			if end > size {
+				end = size
+			}
+			if _, err := encryptor.Write(payload[offset:end]); err != nil {
+				t.Fatalf("Failed to write : %s", err)
+			}
+		}
+
+		if err := encryptor.Close(); err != nil {
+			t.Fatalf("Failed to close : %s", err)
+		}
+
+		encrypted := buf.Bytes()
+
+		decryptor, err := NewGCMDecryptor(key, bytes.NewReader(encrypted))
+		if err != nil {
+			t.Fatalf("Failed to create decryptor : %s", err)
+		}
+
+		decrypted, err := ioutil.ReadAll(decryptor)
+		if err != nil {
+			t.Fatalf("Failed to read size %d : %s", size, err)
+		}
+
+		if !bytes.Equal(decrypted, payload) {
+			t.Fatalf("Wrong payload : \ngot  %x\nwant %x", decrypted, payload)
+		}
+
+		// Modified data
+		for index := gcmStreamHeaderSize; index < len(encrypted); index += 5 {
+			modified := append([]byte(nil), encrypted...)
+			modified[index] ^= 0x01
+			if _, err := readGCM(key, modified); err == nil {
+				t.Fatalf("Modified data at %d decrypted for size %d", index, size)
+			}
+		}
+
+		// Truncated at each chunk boundary
+		for end := gcmStreamHeaderSize; end < len(encrypted); end += gcmChunkHeaderSize + 16 + 16 {
+			if _, err := readGCM(key, encrypted[:end]); errors.Cause(err) != ErrDecryptAuthentication {
+				t.Fatalf("Wrong error for truncated at %d of %d : got %v, want %v", end,
+					len(encrypted), err, ErrDecryptAuthentication)
+			}
+		}
+	}
+}
+
+func TestGCMDecryptorStopsAtFinalChunk(t *testing.T) {
+	key := make([]byte, 32)
+	key[0] = 1
+
+	for _, size := range []int{0, 5, 16, 32, 40} {
+		payload := bytes.Repeat([]byte{0xab}, size)
+
+		var buf bytes.Buffer
+		encryptor, err := NewGCMEncryptorChunkSize(key, 16, &buf)
+		if err != nil {
+			t.Fatalf("Failed to create encryptor : %s", err)
+		}
+		encryptor.Write(payload)
+		if err := encryptor.Close(); err != nil {
+			t.Fatalf("Failed to close : %s", err)
+		}
+		encrypted := buf.Bytes()
+
+		// The data following the stream is not read.
+		next := []byte("next message")
+		r := bytes.NewReader(append(append([]byte(nil), encrypted...), next...))
+		decryptor, err := NewGCMDecryptor(key, r)
+		if err != nil {
+			t.Fatalf("Failed to create decryptor : %s", err)
+		}
+
+		decrypted, err := ioutil.ReadAll(decryptor)
+		if err != nil {
+			t.Fatalf("Failed to read size %d : %s", size, err)
+		}
+
+		if !bytes.Equal(decrypted, payload) {
+			t.Fatalf("Wrong payload : \ngot  %x\nwant %x", decrypted, payload)
+		}
+
+		remaining, _ := ioutil.ReadAll(r)
+		if !bytes.Equal(remaining, next) {
+			t.Fatalf("Wrong data after stream : got %q, want %q", remaining, next)
+		}
+
+		// Reading from a connection that stays open doesn't block after the final chunk.
+		pr, pw := io.Pipe()
+		go pw.Write(encrypted)
+
+		complete := make(chan error, 1)
+		go func() {
+			decryptor, err := NewGCMDecryptor(key, pr)
+			if err != nil {
+				complete <- err
+				return
+			}
+			_, err = ioutil.ReadAll(decryptor)
+			complete <- err
+		}()
+
+		select {
+		case err := <-complete:
+			if err != nil {
+				t.Fatalf("Failed to read from pipe : %s", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Read blocked after final chunk for size %d", size)
+		}
+		pr.Close()
+	}
+}
+
+func readGCM(key, encrypted []byte) ([]byte, error) {
+	decryptor, err := NewGCMDecryptor(key, bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadAll(decryptor)
+}
+
+var _ io.WriteCloser = &GCMEncryptor{}
+var _ io.Reader = &GCMDecryptor{}
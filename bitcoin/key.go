@@ -169,7 +169,7 @@ func (k Key) String() string {
 		keyType = typeTestPrivKey
 	}
 
-	b := append([]byte{keyType}, k.value.Bytes()...)
+	b := append([]byte{keyType}, k.Number()...)
 	//b = append(b, 0x01) // compressed public key // Don't know if we want this or not.
 	return encodeAddress(b)
 }
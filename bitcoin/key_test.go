@@ -71,6 +71,23 @@ func TestKey(t *testing.T) {
 	}
 }
 
+func TestKeyStringLeadingZero(t *testing.T) {
+	b, _ := hex.DecodeString("00a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f")
+	key, err := KeyFromNumber(b, MainNet)
+	if err != nil {
+		t.Fatalf("Failed to create key : %s", err)
+	}
+
+	read, err := KeyFromStr(key.String())
+	if err != nil {
+		t.Fatalf("Failed to read key : %s", err)
+	}
+
+	if !read.Equal(key) {
+		t.Errorf("Wrong key : got %s, want %s", read, key)
+	}
+}
+
 type MaskedKeyStruct struct {
 	Key Key `json:"key" masked:"true"`
 }
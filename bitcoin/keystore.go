@@ -0,0 +1,307 @@
+package bitcoin
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Keystores hold a Key, ExtendedKey, or ExtendedKeys encrypted with a password so they can be
+//   stored as a file instead of in plain text. The encryption key is derived from the password
+//   with scrypt or argon2id and the key text is encrypted with AES-256-GCM. The keystore is
+//   serialized with encoding/json.
+//
+//   The version, type, and public key are authenticated along with the encrypted key, so they
+//   can't be modified without detection.
+
+const (
+	KeystoreVersion = 1
+
+	KeystoreTypeKey          = "key"
+	KeystoreTypeExtendedKey  = "xkey"
+	KeystoreTypeExtendedKeys = "xkeys"
+
+	KeystoreKDFScrypt   = "scrypt"
+	KeystoreKDFArgon2id = "argon2id"
+
+	KeystoreCipherAES256GCM = "aes-256-gcm"
+
+	keystoreSaltSize = 32
+	keystoreKeySize  = 32
+
+	// Limits on the KDF parameters of keystores being decrypted so a modified file can't use an
+	// unreasonable amount of memory or time.
+	maxKeystoreKDFMemory = 2 * 1024 * 1024 * 1024 // bytes
+	maxKeystoreKDFTime   = 100
+)
+
+var (
+	ErrWrongPassword           = errors.New("Wrong password")
+	ErrWrongKeystoreType       = errors.New("Wrong keystore type")
+	ErrUnsupportedKeystore     = errors.New("Unsupported keystore")
+	ErrInvalidKeystoreKDFParam = errors.New("Invalid keystore KDF parameter")
+)
+
+// Keystore is a password encrypted key.
+type Keystore struct {
+	Version    int         `json:"version"`
+	Type       string      `json:"type"`
+	PublicKey  string      `json:"public_key"` // public key, xpub, or xpubs in text form
+	KDF        KeystoreKDF `json:"kdf"`
+	Cipher     string      `json:"cipher"`
+	Nonce      string      `json:"nonce"`      // hex
+	Ciphertext string      `json:"ciphertext"` // hex
+}
+
+// KeystoreKDF specifies the function and parameters used to derive the encryption key from the
+// password. N, R, and P are used by scrypt. Time, Memory (in KiB), and Threads are used by
+// argon2id.
+type KeystoreKDF struct {
+	Name string `json:"name"`
+	Salt string `json:"salt,omitempty"` // hex
+
+	N int `json:"n,omitempty"`
+	R int `json:"r,omitempty"`
+	P int `json:"p,omitempty"`
+
+	Time    uint32 `json:"time,omitempty"`
+	Memory  uint32 `json:"memory,omitempty"`
+	Threads uint8  `json:"threads,omitempty"`
+}
+
+// DefaultScryptKDF returns the recommended scrypt parameters.
+func DefaultScryptKDF() KeystoreKDF {
+	return KeystoreKDF{
+		Name: KeystoreKDFScrypt,
+		N:    1 << 18,
+		R:    8,
+		P:    1,
+	}
+}
+
+// DefaultArgon2idKDF returns the recommended argon2id parameters.
+func DefaultArgon2idKDF() KeystoreKDF {
+	return KeystoreKDF{
+		Name:    KeystoreKDFArgon2id,
+		Time:    3,
+		Memory:  64 * 1024,
+		Threads: 4,
+	}
+}
+
+// EncryptKey returns a keystore containing the key encrypted with the password. A new random salt
+// is always generated so the salt of kdf is ignored.
+func EncryptKey(key Key, password string, kdf KeystoreKDF) (*Keystore, error) {
+	return newKeystore(KeystoreTypeKey, key.PublicKey().String(), key.String(), password, kdf)
+}
+
+// EncryptExtendedKey returns a keystore containing the extended key encrypted with the password.
+func EncryptExtendedKey(key ExtendedKey, password string, kdf KeystoreKDF) (*Keystore, error) {
+	return newKeystore(KeystoreTypeExtendedKey, key.ExtendedPublicKey().String(), key.String(),
+		password, kdf)
+}
+
+// EncryptExtendedKeys returns a keystore containing the extended keys encrypted with the
+// password.
+func EncryptExtendedKeys(keys ExtendedKeys, password string,
+	kdf KeystoreKDF) (*Keystore, error) {
+	return newKeystore(KeystoreTypeExtendedKeys, keys.ExtendedPublicKeys().String(),
+		keys.String(), password, kdf)
+}
+
+// DecryptKey returns the key in the keystore.
+func (k Keystore) DecryptKey(password string) (Key, error) {
+	plaintext, err := k.decrypt(KeystoreTypeKey, password)
+	if err != nil {
+		return Key{}, err
+	}
+
+	result, err := KeyFromStr(string(plaintext))
+	if err != nil {
+		return Key{}, errors.Wrap(err, "key")
+	}
+
+	return result, nil
+}
+
+// DecryptExtendedKey returns the extended key in the keystore.
+func (k Keystore) DecryptExtendedKey(password string) (ExtendedKey, error) {
+	plaintext, err := k.decrypt(KeystoreTypeExtendedKey, password)
+	if err != nil {
+		return ExtendedKey{}, err
+	}
+
+	result, err := ExtendedKeyFromStr(string(plaintext))
+	if err != nil {
+		return ExtendedKey{}, errors.Wrap(err, "xkey")
+	}
+
+	return result, nil
+}
+
+// DecryptExtendedKeys returns the extended keys in the keystore.
+func (k Keystore) DecryptExtendedKeys(password string) (ExtendedKeys, error) {
+	plaintext, err := k.decrypt(KeystoreTypeExtendedKeys, password)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := ExtendedKeysFromStr(string(plaintext))
+	if err != nil {
+		return nil, errors.Wrap(err, "xkeys")
+	}
+
+	return result, nil
+}
+
+// ChangePassword returns a new keystore containing the same key encrypted with the new password
+// and KDF.
+func (k Keystore) ChangePassword(oldPassword, newPassword string,
+	kdf KeystoreKDF) (*Keystore, error) {
+
+	plaintext, err := k.decrypt(k.Type, oldPassword)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(plaintext)
+
+	return newKeystore(k.Type, k.PublicKey, string(plaintext), newPassword, kdf)
+}
+
+func newKeystore(typ, publicKey, plaintext, password string, kdf KeystoreKDF) (*Keystore, error) {
+	salt := make([]byte, keystoreSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "random salt")
+	}
+	kdf.Salt = hex.EncodeToString(salt)
+
+	result := &Keystore{
+		Version:   KeystoreVersion,
+		Type:      typ,
+		PublicKey: publicKey,
+		KDF:       kdf,
+		Cipher:    KeystoreCipherAES256GCM,
+	}
+
+	key, err := kdf.deriveKey(password)
+	if err != nil {
+		return nil, errors.Wrap(err, "kdf")
+	}
+	defer zeroBytes(key)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "random nonce")
+	}
+
+	result.Nonce = hex.EncodeToString(nonce)
+	result.Ciphertext = hex.EncodeToString(aead.Seal(nil, nonce, []byte(plaintext),
+		result.additionalData()))
+
+	return result, nil
+}
+
+func (k Keystore) decrypt(typ, password string) ([]byte, error) {
+	if k.Version != KeystoreVersion {
+		return nil, errors.Wrapf(ErrUnsupportedKeystore, "version %d", k.Version)
+	}
+	if k.Cipher != KeystoreCipherAES256GCM {
+		return nil, errors.Wrapf(ErrUnsupportedKeystore, "cipher %s", k.Cipher)
+	}
+	if k.Type != typ {
+		return nil, errors.Wrapf(ErrWrongKeystoreType, "%s should be %s", k.Type, typ)
+	}
+
+	nonce, err := hex.DecodeString(k.Nonce)
+	if err != nil {
+		return nil, errors.Wrap(err, "nonce")
+	}
+
+	ciphertext, err := hex.DecodeString(k.Ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "ciphertext")
+	}
+
+	key, err := k.KDF.deriveKey(password)
+	if err != nil {
+		return nil, errors.Wrap(err, "kdf")
+	}
+	defer zeroBytes(key)
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("Wrong nonce length : %d should be %d", len(nonce),
+			aead.NonceSize())
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, k.additionalData())
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+
+	return plaintext, nil
+}
+
+// additionalData returns the data authenticated with the encrypted key.
+func (k Keystore) additionalData() []byte {
+	return []byte(fmt.Sprintf("%d:%s:%s", k.Version, k.Type, k.PublicKey))
+}
+
+func (kdf KeystoreKDF) deriveKey(password string) ([]byte, error) {
+	salt, err := hex.DecodeString(kdf.Salt)
+	if err != nil {
+		return nil, errors.Wrap(err, "salt")
+	}
+	if len(salt) == 0 {
+		return nil, errors.Wrap(ErrInvalidKeystoreKDFParam, "missing salt")
+	}
+
+	switch kdf.Name {
+	case KeystoreKDFScrypt:
+		if kdf.N <= 1 || kdf.R <= 0 || kdf.P <= 0 {
+			return nil, errors.Wrapf(ErrInvalidKeystoreKDFParam, "scrypt n %d, r %d, p %d",
+				kdf.N, kdf.R, kdf.P)
+		}
+		if uint64(128*kdf.R)*uint64(kdf.N) > maxKeystoreKDFMemory ||
+			kdf.P > maxKeystoreKDFTime {
+			return nil, errors.Wrapf(ErrInvalidKeystoreKDFParam,
+				"scrypt n %d, r %d, p %d exceeds limits", kdf.N, kdf.R, kdf.P)
+		}
+
+		return scrypt.Key([]byte(password), salt, kdf.N, kdf.R, kdf.P, keystoreKeySize)
+
+	case KeystoreKDFArgon2id:
+		if kdf.Time == 0 || kdf.Memory == 0 || kdf.Threads == 0 {
+			return nil, errors.Wrapf(ErrInvalidKeystoreKDFParam,
+				"argon2id time %d, memory %d, threads %d", kdf.Time, kdf.Memory, kdf.Threads)
+		}
+		if uint64(kdf.Memory)*1024 > maxKeystoreKDFMemory || kdf.Time > maxKeystoreKDFTime {
+			return nil, errors.Wrapf(ErrInvalidKeystoreKDFParam,
+				"argon2id time %d, memory %d exceeds limits", kdf.Time, kdf.Memory)
+		}
+
+		return argon2.IDKey([]byte(password), salt, kdf.Time, kdf.Memory, kdf.Threads,
+			keystoreKeySize), nil
+
+	default:
+		return nil, errors.Wrapf(ErrUnsupportedKeystore, "kdf %s", kdf.Name)
+	}
+}
+
+func zeroBytes(b []byte) {
+	subtle.XORBytes(b, b, b)
+}
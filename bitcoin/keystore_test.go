@@ -0,0 +1,184 @@
+package bitcoin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// Light parameters so tests run quickly.
+var testKeystoreKDFs = []KeystoreKDF{
+	{Name: KeystoreKDFScrypt, N: 1 << 10, R: 8, P: 1},
+	{Name: KeystoreKDFArgon2id, Time: 1, Memory: 1024, Threads: 1},
+}
+
+func TestKeystoreKey(t *testing.T) {
+	for _, kdf := range testKeystoreKDFs {
+		t.Run(kdf.Name, func(t *testing.T) {
+			key, _ := GenerateKey(TestNet)
+
+			keystore, err := EncryptKey(key, "password", kdf)
+			if err != nil {
+				t.Fatalf("Failed to encrypt key : %s", err)
+			}
+
+			if keystore.PublicKey != key.PublicKey().String() {
+				t.Fatalf("Wrong public key : got %s, want %s", keystore.PublicKey,
+					key.PublicKey().String())
+			}
+
+			// Round trip through JSON like a keystore file.
+			js, err := json.Marshal(keystore)
+			if err != nil {
+				t.Fatalf("Failed to marshal keystore : %s", err)
+			}
+			t.Logf("Keystore : %s", js)
+
+			var read Keystore
+			if err := json.Unmarshal(js, &read); err != nil {
+				t.Fatalf("Failed to unmarshal keystore : %s", err)
+			}
+
+			decrypted, err := read.DecryptKey("password")
+			if err != nil {
+				t.Fatalf("Failed to decrypt key : %s", err)
+			}
+
+			if !decrypted.Equal(key) {
+				t.Fatalf("Wrong key : got %s, want %s", decrypted, key)
+			}
+			if decrypted.Network() != TestNet {
+				t.Fatalf("Wrong network : got %s, want %s", decrypted.Network(), TestNet)
+			}
+
+			if _, err := read.DecryptKey("wrong"); errors.Cause(err) != ErrWrongPassword {
+				t.Fatalf("Wrong error for wrong password : %v", err)
+			}
+
+			if _, err := read.DecryptExtendedKey("password"); errors.Cause(err) !=
+				ErrWrongKeystoreType {
+				t.Fatalf("Wrong error for wrong type : %v", err)
+			}
+		})
+	}
+}
+
+func TestKeystoreExtendedKeys(t *testing.T) {
+	xkey, _ := GenerateMasterExtendedKey()
+	xkey.Network = MainNet
+	xkey2, _ := GenerateMasterExtendedKey()
+	xkey2.Network = MainNet
+	xkeys := ExtendedKeys{xkey, xkey2}
+
+	for _, kdf := range testKeystoreKDFs {
+		t.Run(kdf.Name, func(t *testing.T) {
+			keystore, err := EncryptExtendedKey(xkey, "password", kdf)
+			if err != nil {
+				t.Fatalf("Failed to encrypt xkey : %s", err)
+			}
+
+			decrypted, err := keystore.DecryptExtendedKey("password")
+			if err != nil {
+				t.Fatalf("Failed to decrypt xkey : %s", err)
+			}
+
+			if !decrypted.Equal(xkey) {
+				t.Fatalf("Wrong xkey : got %s, want %s", decrypted, xkey)
+			}
+
+			keystore, err = EncryptExtendedKeys(xkeys, "password", kdf)
+			if err != nil {
+				t.Fatalf("Failed to encrypt xkeys : %s", err)
+			}
+
+			if keystore.PublicKey != xkeys.ExtendedPublicKeys().String() {
+				t.Fatalf("Wrong public key : got %s, want %s", keystore.PublicKey,
+					xkeys.ExtendedPublicKeys().String())
+			}
+
+			decryptedKeys, err := keystore.DecryptExtendedKeys("password")
+			if err != nil {
+				t.Fatalf("Failed to decrypt xkeys : %s", err)
+			}
+
+			if !decryptedKeys.Equal(xkeys) {
+				t.Fatalf("Wrong xkeys : got %s, want %s", decryptedKeys, xkeys)
+			}
+		})
+	}
+}
+
+func TestKeystoreChangePassword(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+
+	keystore, err := EncryptKey(key, "old", testKeystoreKDFs[0])
+	if err != nil {
+		t.Fatalf("Failed to encrypt key : %s", err)
+	}
+
+	if _, err := keystore.ChangePassword("wrong", "new", testKeystoreKDFs[1]); errors.Cause(err) !=
+		ErrWrongPassword {
+		t.Fatalf("Wrong error for wrong password : %v", err)
+	}
+
+	changed, err := keystore.ChangePassword("old", "new", testKeystoreKDFs[1])
+	if err != nil {
+		t.Fatalf("Failed to change password : %s", err)
+	}
+
+	if changed.KDF.Name != KeystoreKDFArgon2id {
+		t.Fatalf("Wrong KDF : got %s, want %s", changed.KDF.Name, KeystoreKDFArgon2id)
+	}
+	if changed.KDF.Salt == keystore.KDF.Salt {
+		t.Fatalf("Salt not changed")
+	}
+
+	if _, err := changed.DecryptKey("old"); errors.Cause(err) != ErrWrongPassword {
+		t.Fatalf("Wrong error for old password : %v", err)
+	}
+
+	decrypted, err := changed.DecryptKey("new")
+	if err != nil {
+		t.Fatalf("Failed to decrypt key : %s", err)
+	}
+
+	if !decrypted.Equal(key) {
+		t.Fatalf("Wrong key : got %s, want %s", decrypted, key)
+	}
+}
+
+func TestKeystoreModified(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	other, _ := GenerateKey(MainNet)
+
+	keystore, err := EncryptKey(key, "password", testKeystoreKDFs[0])
+	if err != nil {
+		t.Fatalf("Failed to encrypt key : %s", err)
+	}
+
+	modified := *keystore
+	modified.PublicKey = other.PublicKey().String()
+	if _, err := modified.DecryptKey("password"); errors.Cause(err) != ErrWrongPassword {
+		t.Fatalf("Wrong error for modified public key : %v", err)
+	}
+
+	modified = *keystore
+	modified.Version = 2
+	if _, err := modified.DecryptKey("password"); errors.Cause(err) != ErrUnsupportedKeystore {
+		t.Fatalf("Wrong error for modified version : %v", err)
+	}
+
+	modified = *keystore
+	modified.KDF.N = 1 << 30
+	if _, err := modified.DecryptKey("password"); errors.Cause(err) !=
+		ErrInvalidKeystoreKDFParam {
+		t.Fatalf("Wrong error for excessive KDF parameter : %v", err)
+	}
+
+	modified = *keystore
+	modified.KDF.Name = "pbkdf2"
+	if _, err := modified.DecryptKey("password"); errors.Cause(err) != ErrUnsupportedKeystore {
+		t.Fatalf("Wrong error for unknown KDF : %v", err)
+	}
+}
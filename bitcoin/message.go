@@ -0,0 +1,299 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// Bitcoin Signed Message is the format used by wallets to sign text with the key of an address.
+//   The message is hashed with a prefix so that it can't be a transaction, then signed into a
+//   compact signature that contains the information needed to recover the public key. The
+//   signature is verified by recovering the public key and comparing it to the address.
+//
+//   signature, err := SignMessage(key, "hello")
+//   err := VerifyMessage(address, "hello", signature)
+
+const (
+	// CompactSignatureLength is the size of a compact signature. A header byte followed by 32 byte
+	// R and S values.
+	CompactSignatureLength = 65
+
+	compactSignatureHeader     = 27
+	compactSignatureCompressed = 4
+
+	signedMessagePrefix = "Bitcoin Signed Message:\n"
+)
+
+var (
+	ErrPublicKeyRecovery       = errors.New("Public key recovery failed")
+	ErrInvalidMessageSignature = errors.New("Invalid message signature")
+)
+
+// CompactSignature is a signature with the recovery ID needed to recover the public key that
+// created it.
+type CompactSignature struct {
+	Signature Signature
+
+	// RecoveryID (0-3) selects which of the possible public keys for the signature is correct.
+	RecoveryID byte
+
+	// Compressed is true when the signing public key was serialized compressed, which determines
+	// the public key hash for the address.
+	Compressed bool
+}
+
+// CompactSignatureFromStr converts base64 compact signature text to a compact signature.
+func CompactSignatureFromStr(s string) (CompactSignature, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return CompactSignature{}, errors.Wrap(err, "base64 decode")
+	}
+
+	return CompactSignatureFromBytes(b)
+}
+
+// CompactSignatureFromBytes decodes a 65 byte compact signature.
+func CompactSignatureFromBytes(b []byte) (CompactSignature, error) {
+	if len(b) != CompactSignatureLength {
+		return CompactSignature{}, fmt.Errorf("Wrong length : %d should be %d", len(b),
+			CompactSignatureLength)
+	}
+
+	header := int(b[0]) - compactSignatureHeader
+	if header < 0 || header > 7 {
+		return CompactSignature{}, fmt.Errorf("Invalid header : %d should be (27 >= h <= 34)",
+			b[0])
+	}
+
+	var result CompactSignature
+	result.Compressed = header&compactSignatureCompressed != 0
+	result.RecoveryID = byte(header & 3)
+	result.Signature.R.SetBytes(b[1:33])
+	result.Signature.S.SetBytes(b[33:])
+
+	return result, result.Signature.Validate()
+}
+
+// Bytes returns the 65 byte compact encoding of the signature.
+func (s CompactSignature) Bytes() []byte {
+	result := make([]byte, CompactSignatureLength)
+
+	header := compactSignatureHeader + s.RecoveryID
+	if s.Compressed {
+		header += compactSignatureCompressed
+	}
+	result[0] = header
+
+	s.Signature.R.FillBytes(result[1:33])
+	s.Signature.S.FillBytes(result[33:])
+	return result
+}
+
+// String returns the base64 compact encoding of the signature.
+func (s CompactSignature) String() string {
+	return base64.StdEncoding.EncodeToString(s.Bytes())
+}
+
+// RecoverPublicKey returns the public key that created the signature of the hash.
+func (s CompactSignature) RecoverPublicKey(hash Hash32) (PublicKey, error) {
+	return recoverPublicKey(s.Signature, s.RecoveryID, hash[:])
+}
+
+// SignCompact returns a compact signature of the hash that the public key can be recovered from.
+func (k Key) SignCompact(hash Hash32) (CompactSignature, error) {
+	sig, err := k.Sign(hash)
+	if err != nil {
+		return CompactSignature{}, errors.Wrap(err, "sign")
+	}
+
+	publicKey := k.PublicKey()
+	for recoveryID := byte(0); recoveryID < 4; recoveryID++ {
+		recovered, err := recoverPublicKey(sig, recoveryID, hash[:])
+		if err != nil {
+			continue
+		}
+
+		if recovered.Equal(publicKey) {
+			return CompactSignature{
+				Signature:  sig,
+				RecoveryID: recoveryID,
+				Compressed: true,
+			}, nil
+		}
+	}
+
+	return CompactSignature{}, ErrPublicKeyRecovery
+}
+
+// SignatureHashForMessage calculates the double SHA256 hash of a message prefixed with "Bitcoin
+// Signed Message:\n" that is signed in the Bitcoin Signed Message format.
+func SignatureHashForMessage(message string) Hash32 {
+	hasher := sha256.New()
+
+	writeVarInt(hasher, uint64(len(signedMessagePrefix)))
+	hasher.Write([]byte(signedMessagePrefix))
+
+	writeVarInt(hasher, uint64(len(message)))
+	hasher.Write([]byte(message))
+
+	return Hash32(sha256.Sum256(hasher.Sum(nil)))
+}
+
+// SignMessage signs a message in the Bitcoin Signed Message format and returns the base64 compact
+// signature.
+func SignMessage(key Key, message string) (string, error) {
+	sig, err := key.SignCompact(SignatureHashForMessage(message))
+	if err != nil {
+		return "", err
+	}
+
+	return sig.String(), nil
+}
+
+// VerifyMessage verifies a base64 compact signature of a message in the Bitcoin Signed Message
+// format was created by the key of a public key hash or public key address.
+func VerifyMessage(address Address, message, signature string) error {
+	sig, err := CompactSignatureFromStr(signature)
+	if err != nil {
+		return errors.Wrap(err, "signature")
+	}
+
+	publicKey, err := sig.RecoverPublicKey(SignatureHashForMessage(message))
+	if err != nil {
+		return errors.Wrap(ErrInvalidMessageSignature, err.Error())
+	}
+
+	ra := NewRawAddressFromAddress(address)
+	switch ra.Type() {
+	case ScriptTypePKH:
+		pkh, err := ra.GetPublicKeyHash()
+		if err != nil {
+			return errors.Wrap(err, "public key hash")
+		}
+
+		var serialized []byte
+		if sig.Compressed {
+			serialized = publicKey.Bytes()
+		} else {
+			serialized = uncompressedPublicKey(publicKey)
+		}
+
+		if !bytes.Equal(Hash160(serialized), pkh[:]) {
+			return ErrInvalidMessageSignature
+		}
+
+	case ScriptTypePK:
+		addressPublicKey, err := address.GetPublicKey()
+		if err != nil {
+			return errors.Wrap(err, "public key")
+		}
+
+		if !addressPublicKey.Equal(publicKey) {
+			return ErrInvalidMessageSignature
+		}
+
+	default:
+		return errors.Wrap(ErrWrongType, "not public key or public key hash")
+	}
+
+	return nil
+}
+
+// recoverPublicKey implements SEC 1 section 4.1.6 public key recovery for secp256k1.
+func recoverPublicKey(sig Signature, recoveryID byte, hash []byte) (PublicKey, error) {
+	if recoveryID > 3 {
+		return PublicKey{}, errors.Wrapf(ErrPublicKeyRecovery, "recovery id %d", recoveryID)
+	}
+
+	if err := sig.Validate(); err != nil {
+		return PublicKey{}, errors.Wrap(err, "signature")
+	}
+
+	P := curveS256Params.P
+	N := curveS256Params.N
+
+	// R's x coordinate is r, or r + N when the second bit of the recovery id is set.
+	x := new(big.Int).Set(&sig.R)
+	if recoveryID&2 != 0 {
+		x.Add(x, N)
+	}
+	if x.Cmp(P) >= 0 {
+		return PublicKey{}, errors.Wrap(ErrPublicKeyRecovery, "x out of range")
+	}
+
+	// y^2 = x^3 + 7
+	ySq := new(big.Int).Exp(x, big.NewInt(3), P)
+	ySq.Add(ySq, curveS256Params.B)
+	ySq.Mod(ySq, P)
+	y := new(big.Int).ModSqrt(ySq, P)
+	if y == nil {
+		return PublicKey{}, errors.Wrap(ErrPublicKeyRecovery, "x not on curve")
+	}
+	if y.Bit(0) != uint(recoveryID&1) {
+		y.Sub(P, y)
+	}
+
+	// Q = r^-1 (sR - eG)
+	rInv := new(big.Int).ModInverse(&sig.R, N)
+	e := hashToInt(hash, curveS256)
+
+	u1 := new(big.Int).Mul(e, rInv)
+	u1.Neg(u1)
+	u1.Mod(u1, N)
+
+	u2 := new(big.Int).Mul(&sig.S, rInv)
+	u2.Mod(u2, N)
+
+	x1, y1 := curveS256.ScalarBaseMult(u1.Bytes())
+	x2, y2 := curveS256.ScalarMult(x, y, u2.Bytes())
+	qx, qy := curveS256.Add(x1, y1, x2, y2)
+
+	if qx.Sign() == 0 && qy.Sign() == 0 {
+		return PublicKey{}, errors.Wrap(ErrPublicKeyRecovery, "point at infinity")
+	}
+
+	return PublicKey{X: *qx, Y: *qy}, nil
+}
+
+// uncompressedPublicKey returns the 65 byte uncompressed serialization of the public key.
+func uncompressedPublicKey(k PublicKey) []byte {
+	result := make([]byte, 65)
+	result[0] = 0x04
+	k.X.FillBytes(result[1:33])
+	k.Y.FillBytes(result[33:])
+	return result
+}
+
+// writeVarInt writes a bitcoin variable length integer.
+func writeVarInt(w io.Writer, value uint64) error {
+	if value < 0xfd {
+		return binary.Write(w, endian, uint8(value))
+	}
+
+	if value <= math.MaxUint16 {
+		if err := binary.Write(w, endian, uint8(0xfd)); err != nil {
+			return err
+		}
+		return binary.Write(w, endian, uint16(value))
+	}
+
+	if value <= math.MaxUint32 {
+		if err := binary.Write(w, endian, uint8(0xfe)); err != nil {
+			return err
+		}
+		return binary.Write(w, endian, uint32(value))
+	}
+
+	if err := binary.Write(w, endian, uint8(0xff)); err != nil {
+		return err
+	}
+	return binary.Write(w, endian, value)
+}
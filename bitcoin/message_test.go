@@ -0,0 +1,109 @@
+package bitcoin
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestVerifyMessage(t *testing.T) {
+	// Signature of a txid created by a MoneyButton wallet for a bsvalias P2P transaction.
+	publicKey, err := PublicKeyFromStr("037d391ec99f5fbc48894986391d3d2388045bcf85409ce2e2a92a683dc7a76581")
+	if err != nil {
+		t.Fatalf("Failed to parse public key : %s", err)
+	}
+	message := "43b83509a310acbbcdb91164285829505ae415ad476e773f1e9ce49023387ac8"
+	signature := "H84lMGpH1L2iFf8BzPuxzevTjyij8i2lej1OBmBVBqF1ZwnLn5+R3VdgLFUS+fUQgMkZmPCb85xlw1R6PtSe0DY="
+
+	sig, err := CompactSignatureFromStr(signature)
+	if err != nil {
+		t.Fatalf("Failed to parse signature : %s", err)
+	}
+
+	if sig.String() != signature {
+		t.Fatalf("Wrong encoding : \ngot  %s\nwant %s", sig.String(), signature)
+	}
+
+	recovered, err := sig.RecoverPublicKey(SignatureHashForMessage(message))
+	if err != nil {
+		t.Fatalf("Failed to recover public key : %s", err)
+	}
+
+	if !recovered.Equal(publicKey) {
+		t.Fatalf("Wrong public key : got %s, want %s", recovered, publicKey)
+	}
+
+	address, err := NewAddressPKH(Hash160(publicKey.Bytes()), MainNet)
+	if err != nil {
+		t.Fatalf("Failed to create address : %s", err)
+	}
+
+	if err := VerifyMessage(address, message, signature); err != nil {
+		t.Fatalf("Failed to verify message : %s", err)
+	}
+
+	if err := VerifyMessage(address, message+" ", signature); errors.Cause(err) != ErrInvalidMessageSignature {
+		t.Fatalf("Wrong error for modified message : got %v, want %v", err,
+			ErrInvalidMessageSignature)
+	}
+}
+
+func TestSignMessage(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		key, err := GenerateKey(MainNet)
+		if err != nil {
+			t.Fatalf("Failed to generate key : %s", err)
+		}
+
+		message := "Test message"
+		signature, err := SignMessage(key, message)
+		if err != nil {
+			t.Fatalf("Failed to sign message : %s", err)
+		}
+
+		ra, _ := key.RawAddress()
+		address := NewAddressFromRawAddress(ra, MainNet)
+		if err := VerifyMessage(address, message, signature); err != nil {
+			t.Fatalf("Failed to verify message : %s", err)
+		}
+
+		pkAddress, _ := NewAddressPublicKey(key.PublicKey(), MainNet)
+		if err := VerifyMessage(pkAddress, message, signature); err != nil {
+			t.Fatalf("Failed to verify message with public key address : %s", err)
+		}
+
+		otherKey, _ := GenerateKey(MainNet)
+		otherRA, _ := otherKey.RawAddress()
+		otherAddress := NewAddressFromRawAddress(otherRA, MainNet)
+		if err := VerifyMessage(otherAddress, message, signature); errors.Cause(err) != ErrInvalidMessageSignature {
+			t.Fatalf("Wrong error for other address : got %v, want %v", err,
+				ErrInvalidMessageSignature)
+		}
+	}
+}
+
+func TestSignMessageUncompressed(t *testing.T) {
+	key, err := GenerateKey(MainNet)
+	if err != nil {
+		t.Fatalf("Failed to generate key : %s", err)
+	}
+
+	message := "Uncompressed"
+	sig, err := key.SignCompact(SignatureHashForMessage(message))
+	if err != nil {
+		t.Fatalf("Failed to sign : %s", err)
+	}
+	sig.Compressed = false
+
+	address, _ := NewAddressPKH(Hash160(uncompressedPublicKey(key.PublicKey())), MainNet)
+	if err := VerifyMessage(address, message, sig.String()); err != nil {
+		t.Fatalf("Failed to verify uncompressed : %s", err)
+	}
+
+	ra, _ := key.RawAddress()
+	compressedAddress := NewAddressFromRawAddress(ra, MainNet)
+	if err := VerifyMessage(compressedAddress, message, sig.String()); errors.Cause(err) != ErrInvalidMessageSignature {
+		t.Fatalf("Wrong error for compressed address : got %v, want %v", err,
+			ErrInvalidMessageSignature)
+	}
+}
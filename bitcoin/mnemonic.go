@@ -0,0 +1,259 @@
+package bitcoin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// BIP-0039 mnemonics encode entropy as a list of words, with a checksum, so that it can be written
+//   down and recovered by a person. The mnemonic, and an optional passphrase, are converted to a
+//   seed that is used to create a master extended key.
+//
+//   // Generate a new mnemonic and master key
+//   mnemonic, err := GenerateMnemonic(128, nil)
+//   key, err := LoadMasterExtendedKeyFromMnemonic(mnemonic, passphrase, nil)
+//
+// The specification requires the mnemonic and passphrase to be UTF-8 NFKD normalized before the
+//   seed is derived. Words in the English wordlist are already normalized, but a passphrase
+//   containing non-ASCII characters must be normalized by the caller, for example with
+//   golang.org/x/text/unicode/norm, or it will produce a different seed than other wallets.
+
+const (
+	// MnemonicWordlistSize is the number of words in a BIP-0039 wordlist. Each word encodes 11 bits.
+	MnemonicWordlistSize = 2048
+
+	// MnemonicSeedIterations is the PBKDF2 iteration count used to derive a seed from a mnemonic.
+	MnemonicSeedIterations = 2048
+
+	mnemonicWordBits = 11
+)
+
+var (
+	ErrInvalidEntropyLength = errors.New("Invalid mnemonic entropy length")
+	ErrInvalidWordCount     = errors.New("Invalid mnemonic word count")
+	ErrUnknownMnemonicWord  = errors.New("Unknown mnemonic word")
+	ErrInvalidChecksum      = errors.New("Invalid mnemonic checksum")
+	ErrUnknownWordlist      = errors.New("Unknown wordlist")
+
+	//go:embed wordlists/english.txt
+	englishWords string
+
+	// EnglishWordlist is the BIP-0039 English wordlist. It is the default wordlist.
+	EnglishWordlist = mustWordlist(NewWordlist("english", strings.Fields(englishWords), " "))
+
+	wordlists = map[string]*Wordlist{
+		EnglishWordlist.Name(): EnglishWordlist,
+	}
+	wordlistsLock sync.RWMutex
+)
+
+// Wordlist is a list of words used to encode mnemonics.
+type Wordlist struct {
+	name      string
+	words     []string
+	indexes   map[string]int
+	separator string
+}
+
+// NewWordlist creates a wordlist from 2048 unique words. The separator is put between words when
+// a mnemonic is created. It is a space for most languages, but Japanese uses an ideographic space.
+func NewWordlist(name string, words []string, separator string) (*Wordlist, error) {
+	if len(words) != MnemonicWordlistSize {
+		return nil, fmt.Errorf("Wrong word count : got %d, want %d", len(words),
+			MnemonicWordlistSize)
+	}
+
+	result := &Wordlist{
+		name:      name,
+		words:     make([]string, len(words)),
+		indexes:   make(map[string]int, len(words)),
+		separator: separator,
+	}
+
+	for i, word := range words {
+		if len(word) == 0 {
+			return nil, fmt.Errorf("Empty word at index %d", i)
+		}
+		if _, exists := result.indexes[word]; exists {
+			return nil, fmt.Errorf("Duplicate word : %s", word)
+		}
+
+		result.words[i] = word
+		result.indexes[word] = i
+	}
+
+	return result, nil
+}
+
+func mustWordlist(wordlist *Wordlist, err error) *Wordlist {
+	if err != nil {
+		panic(fmt.Sprintf("Invalid wordlist : %s", err))
+	}
+	return wordlist
+}
+
+// RegisterWordlist makes a wordlist available by name through GetWordlist.
+func RegisterWordlist(wordlist *Wordlist) {
+	wordlistsLock.Lock()
+	wordlists[wordlist.Name()] = wordlist
+	wordlistsLock.Unlock()
+}
+
+// GetWordlist returns a registered wordlist by name, like "english".
+func GetWordlist(name string) (*Wordlist, error) {
+	wordlistsLock.RLock()
+	wordlist, exists := wordlists[strings.ToLower(name)]
+	wordlistsLock.RUnlock()
+
+	if !exists {
+		return nil, errors.Wrap(ErrUnknownWordlist, name)
+	}
+
+	return wordlist, nil
+}
+
+// Name returns the name of the wordlist.
+func (w *Wordlist) Name() string {
+	return w.name
+}
+
+// Word returns the word at an index.
+func (w *Wordlist) Word(index int) string {
+	return w.words[index]
+}
+
+// Index returns the index of a word and true if it is in the wordlist.
+func (w *Wordlist) Index(word string) (int, bool) {
+	index, exists := w.indexes[word]
+	return index, exists
+}
+
+// GenerateMnemonic creates a mnemonic from random entropy. The entropy size must be 128, 160, 192,
+// 224, or 256 bits, which produce 12, 15, 18, 21, or 24 words. A nil wordlist is English.
+func GenerateMnemonic(entropyBits int, wordlist *Wordlist) (string, error) {
+	if entropyBits%32 != 0 || entropyBits < 128 || entropyBits > 256 {
+		return "", errors.Wrapf(ErrInvalidEntropyLength, "%d bits", entropyBits)
+	}
+
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", errors.Wrap(err, "random")
+	}
+
+	return NewMnemonic(entropy, wordlist)
+}
+
+// NewMnemonic encodes entropy as a mnemonic. The entropy must be 16, 20, 24, 28, or 32 bytes. A nil
+// wordlist is English.
+func NewMnemonic(entropy []byte, wordlist *Wordlist) (string, error) {
+	if len(entropy)%4 != 0 || len(entropy) < 16 || len(entropy) > 32 {
+		return "", errors.Wrapf(ErrInvalidEntropyLength, "%d bytes", len(entropy))
+	}
+	if wordlist == nil {
+		wordlist = EnglishWordlist
+	}
+
+	// The checksum is the first entropy bits / 32 bits of the hash, which is never more than a byte.
+	hash := sha256.Sum256(entropy)
+	data := make([]byte, len(entropy)+1)
+	copy(data, entropy)
+	data[len(entropy)] = hash[0]
+
+	wordCount := (len(entropy)*8 + len(entropy)/4) / mnemonicWordBits
+	words := make([]string, wordCount)
+	for i := range words {
+		words[i] = wordlist.Word(readBits(data, i*mnemonicWordBits, mnemonicWordBits))
+	}
+
+	return strings.Join(words, wordlist.separator), nil
+}
+
+// MnemonicToEntropy decodes a mnemonic and verifies its checksum. A nil wordlist is English.
+func MnemonicToEntropy(mnemonic string, wordlist *Wordlist) ([]byte, error) {
+	if wordlist == nil {
+		wordlist = EnglishWordlist
+	}
+
+	words := strings.Fields(mnemonic)
+	if len(words)%3 != 0 || len(words) < 12 || len(words) > 24 {
+		return nil, errors.Wrapf(ErrInvalidWordCount, "%d words", len(words))
+	}
+
+	totalBits := len(words) * mnemonicWordBits
+	checksumBits := totalBits / 33
+	entropyBits := totalBits - checksumBits
+
+	data := make([]byte, (totalBits+7)/8)
+	for i, word := range words {
+		index, exists := wordlist.Index(word)
+		if !exists {
+			// The word itself isn't included because mnemonics are secret.
+			return nil, errors.Wrapf(ErrUnknownMnemonicWord, "word %d", i+1)
+		}
+		writeBits(data, i*mnemonicWordBits, mnemonicWordBits, index)
+	}
+
+	entropy := data[:entropyBits/8]
+	hash := sha256.Sum256(entropy)
+	shift := uint(8 - checksumBits)
+	if hash[0]>>shift != data[entropyBits/8]>>shift {
+		return nil, ErrInvalidChecksum
+	}
+
+	return entropy, nil
+}
+
+// ValidateMnemonic returns an error if the mnemonic has the wrong number of words, contains words
+// not in the wordlist, or has an invalid checksum. A nil wordlist is English.
+func ValidateMnemonic(mnemonic string, wordlist *Wordlist) error {
+	_, err := MnemonicToEntropy(mnemonic, wordlist)
+	return err
+}
+
+// MnemonicToSeed derives a 64 byte seed from a mnemonic and passphrase with PBKDF2-HMAC-SHA512.
+// The mnemonic is not validated, so call ValidateMnemonic first when it was entered by a user.
+func MnemonicToSeed(mnemonic, passphrase string) []byte {
+	// Words are separated by a single space after normalization.
+	normalized := strings.Join(strings.Fields(mnemonic), " ")
+	return pbkdf2.Key([]byte(normalized), []byte("mnemonic"+passphrase), MnemonicSeedIterations,
+		64, sha512.New)
+}
+
+// LoadMasterExtendedKeyFromMnemonic validates a mnemonic and creates a master key from the seed
+// derived from it and the passphrase. A nil wordlist is English.
+func LoadMasterExtendedKeyFromMnemonic(mnemonic, passphrase string,
+	wordlist *Wordlist) (ExtendedKey, error) {
+
+	if err := ValidateMnemonic(mnemonic, wordlist); err != nil {
+		return ExtendedKey{}, errors.Wrap(err, "validate")
+	}
+
+	return LoadMasterExtendedKey(MnemonicToSeed(mnemonic, passphrase))
+}
+
+// readBits returns count bits, most significant first, starting at bit offset in data.
+func readBits(data []byte, offset, count int) int {
+	result := 0
+	for i := offset; i < offset+count; i++ {
+		result = result<<1 | int(data[i/8]>>uint(7-i%8)&1)
+	}
+	return result
+}
+
+// writeBits writes the low count bits of value, most significant first, at bit offset in data.
+func writeBits(data []byte, offset, count, value int) {
+	for i := 0; i < count; i++ {
+		if value&(1<<uint(count-1-i)) != 0 {
+			bit := offset + i
+			data[bit/8] |= 1 << uint(7-bit%8)
+		}
+	}
+}
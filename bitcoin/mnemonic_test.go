@@ -0,0 +1,168 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestMnemonicVectors(t *testing.T) {
+	// BIP-0039 test vectors using the passphrase "TREZOR".
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+		key      string
+	}{
+		{
+			entropy:  "00000000000000000000000000000000",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			seed:     "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+			key:      "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF",
+		},
+		{
+			entropy:  "7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			mnemonic: "legal winner thank year wave sausage worth useful legal winner thank yellow",
+			seed:     "2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			entropy:  "ffffffffffffffffffffffffffffffff",
+			mnemonic: "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			seed:     "ac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		},
+		{
+			entropy:  "0000000000000000000000000000000000000000",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon address",
+			seed:     "fa08713f46bf5cb48728ceb70e3aae1bc53c5cb7b4e29c5610261d1cbb7be3bed4d805256fec515754d2be35974fc5da678168e9d9bb0cb70948026923b0def3",
+		},
+		{
+			entropy:  "808080808080808080808080808080808080808080808080",
+			mnemonic: "letter advice cage absurd amount doctor acoustic avoid letter advice cage absurd amount doctor acoustic avoid letter always",
+			seed:     "107d7c02a5aa6f38c58083ff74f04c607c2d2c0ecc55501dadd72d025b751bc27fe913ffb796f841c49b1d33b610cf0e91d3aa239027f5e99fe4ce9e5088cd65",
+		},
+		{
+			entropy:  "9e885d952ad362caeb4efe34a8e91bd2",
+			mnemonic: "ozone drill grab fiber curtain grace pudding thank cruise elder eight picnic",
+			seed:     "274ddc525802f7c828d8ef7ddbcdc5304e87ac3535913611fbbfa986d0c9e5476c91689f9c8a54fd55bd38606aa6a8595ad213d4c9c9f9aca3fb217069a41028",
+		},
+		{
+			entropy:  "68a79eaca2324873eacc50cb9c6eca8cc68ea5d936f98787c60c7ebc74e6ce7c",
+			mnemonic: "hamster diagram private dutch cause delay private meat slide toddler razor book happy fancy gospel tennis maple dilemma loan word shrug inflict delay length",
+			seed:     "64c87cde7e12ecf6704ab95bb1408bef047c22db4cc7491c4271d170a1b213d20b385bc1588d9c7b38f1b39d415665b8a9030c9ec653d75e65f847d8fc1fc440",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.entropy, func(t *testing.T) {
+			entropy, _ := hex.DecodeString(tt.entropy)
+
+			mnemonic, err := NewMnemonic(entropy, nil)
+			if err != nil {
+				t.Fatalf("Failed to create mnemonic : %s", err)
+			}
+
+			if mnemonic != tt.mnemonic {
+				t.Fatalf("Wrong mnemonic : \ngot  %s\nwant %s", mnemonic, tt.mnemonic)
+			}
+
+			decoded, err := MnemonicToEntropy(mnemonic, nil)
+			if err != nil {
+				t.Fatalf("Failed to decode mnemonic : %s", err)
+			}
+
+			if !bytes.Equal(decoded, entropy) {
+				t.Fatalf("Wrong entropy : got %x, want %x", decoded, entropy)
+			}
+
+			seed := MnemonicToSeed(mnemonic, "TREZOR")
+			if hex.EncodeToString(seed) != tt.seed {
+				t.Fatalf("Wrong seed : \ngot  %x\nwant %s", seed, tt.seed)
+			}
+
+			if len(tt.key) == 0 {
+				return
+			}
+
+			key, err := LoadMasterExtendedKeyFromMnemonic(mnemonic, "TREZOR", nil)
+			if err != nil {
+				t.Fatalf("Failed to load key : %s", err)
+			}
+
+			if key.String58() != tt.key {
+				t.Fatalf("Wrong key : got %s, want %s", key.String58(), tt.key)
+			}
+		})
+	}
+}
+
+func TestMnemonicInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		mnemonic string
+		err      error
+	}{
+		{
+			name:     "checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			err:      ErrInvalidChecksum,
+		},
+		{
+			name:     "word count",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			err:      ErrInvalidWordCount,
+		},
+		{
+			name:     "unknown word",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abou",
+			err:      ErrUnknownMnemonicWord,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMnemonic(tt.mnemonic, nil)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("Wrong error : got %v, want %v", err, tt.err)
+			}
+		})
+	}
+
+	if _, err := NewMnemonic(make([]byte, 15), nil); errors.Cause(err) != ErrInvalidEntropyLength {
+		t.Fatalf("Wrong entropy length error : got %v, want %v", err, ErrInvalidEntropyLength)
+	}
+}
+
+func TestGenerateMnemonic(t *testing.T) {
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := GenerateMnemonic(bits, nil)
+		if err != nil {
+			t.Fatalf("Failed to generate mnemonic : %s", err)
+		}
+
+		wordCount := len(strings.Fields(mnemonic))
+		if wordCount != bits*33/32/11 {
+			t.Fatalf("Wrong word count for %d bits : got %d, want %d", bits, wordCount,
+				bits*33/32/11)
+		}
+
+		if err := ValidateMnemonic(mnemonic, nil); err != nil {
+			t.Fatalf("Generated mnemonic invalid : %s", err)
+		}
+	}
+
+	if _, err := GenerateMnemonic(100, nil); errors.Cause(err) != ErrInvalidEntropyLength {
+		t.Fatalf("Wrong error : got %v, want %v", err, ErrInvalidEntropyLength)
+	}
+
+	wordlist, err := GetWordlist("english")
+	if err != nil {
+		t.Fatalf("Failed to get wordlist : %s", err)
+	}
+
+	if wordlist.Word(0) != "abandon" || wordlist.Word(MnemonicWordlistSize-1) != "zoo" {
+		t.Fatalf("Wrong english wordlist")
+	}
+}
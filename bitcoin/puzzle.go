@@ -0,0 +1,146 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pushTxHashType is the signature hash type of the preimage verified by the lock time template.
+const pushTxHashType = SigHashAll | SigHashForkID
+
+// RPuzzleHash returns the R puzzle hash for signatures created with the nonce. It is the Hash160 of
+// the DER encoding of the R value, which is what the locking script extracts from the signature.
+func RPuzzleHash(nonce Key) Hash20 {
+	r, _ := curveS256.ScalarBaseMult(scalarBytes(&nonce.value))
+	r.Mod(r, curveS256Params.N)
+
+	var result Hash20
+	copy(result[:], Hash160(canonicalizeInt(*r)))
+	return result
+}
+
+// RPuzzleUnlockingScript returns an unlocking script for an R puzzle locking script. The signature
+// of the signature hash is created with the nonce whose R value hash is in the locking script. The
+// key doesn't need to be related to the locking script.
+func RPuzzleUnlockingScript(key, nonce Key, sigHash Hash32, hashType byte) (Script, error) {
+	sig, err := SignWithK(key.value, nonce.value, sigHash[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "sign")
+	}
+
+	buf := &bytes.Buffer{}
+	if err := WritePushDataScript(buf, key.PublicKey().Bytes()); err != nil {
+		return nil, errors.Wrap(err, "public key")
+	}
+
+	if err := WritePushDataScript(buf, append(sig.Bytes(), hashType)); err != nil {
+		return nil, errors.Wrap(err, "signature")
+	}
+
+	return Script(buf.Bytes()), nil
+}
+
+// HashPuzzleUnlockingScript returns an unlocking script for a hash puzzle locking script.
+func HashPuzzleUnlockingScript(preimage []byte) (Script, error) {
+	buf := &bytes.Buffer{}
+	if err := WritePushDataScript(buf, preimage); err != nil {
+		return nil, errors.Wrap(err, "preimage")
+	}
+
+	return Script(buf.Bytes()), nil
+}
+
+// HashLockUnlockingScript returns an unlocking script for a hash lock locking script.
+func HashLockUnlockingScript(sig Signature, hashType byte, publicKey PublicKey,
+	preimage []byte) (Script, error) {
+	return signaturePreimageUnlockingScript(sig, hashType, publicKey, preimage)
+}
+
+// LockTimeUnlockingScript returns an unlocking script for a lock time locking script. The preimage
+// is the signature hash preimage of the spending input with SigHashAll|SigHashForkID and must be
+// checked with IsValidLockTimePreimage. The transaction must have a lock time at or after the lock
+// time of the locking script and the input's sequence must not be 0xffffffff.
+func LockTimeUnlockingScript(sig Signature, hashType byte, publicKey PublicKey,
+	preimage []byte) (Script, error) {
+	return signaturePreimageUnlockingScript(sig, hashType, publicKey, preimage)
+}
+
+func signaturePreimageUnlockingScript(sig Signature, hashType byte, publicKey PublicKey,
+	preimage []byte) (Script, error) {
+
+	buf := &bytes.Buffer{}
+	if err := WritePushDataScript(buf, append(sig.Bytes(), hashType)); err != nil {
+		return nil, errors.Wrap(err, "signature")
+	}
+
+	if err := WritePushDataScript(buf, publicKey.Bytes()); err != nil {
+		return nil, errors.Wrap(err, "public key")
+	}
+
+	if err := WritePushDataScript(buf, preimage); err != nil {
+		return nil, errors.Wrap(err, "preimage")
+	}
+
+	return Script(buf.Bytes()), nil
+}
+
+// IsValidLockTimePreimage returns true if the signature hash preimage can be used to unlock a lock
+// time locking script. The script creates a signature of the preimage with a private key and nonce
+// of one, so the signature's s value is the hash plus the generator's x coordinate. That only
+// forms a valid low S signature when s is DER encoded in 32 bytes and is no more than half the
+// curve order. About half of preimages are valid, so when this returns false change the
+// transaction, for example by incrementing the lock time, and try again.
+func IsValidLockTimePreimage(preimage []byte) bool {
+	s := pushTxS(preimage)
+	return s.BitLen() >= 248 && s.Cmp(curveHalfOrder) <= 0
+}
+
+// pushTxS returns the s value of the signature created by the lock time script.
+func pushTxS(preimage []byte) *big.Int {
+	s := new(big.Int).SetBytes(DoubleSha256(preimage))
+	s.Add(s, curveS256Params.Gx)
+	return s.Mod(s, curveS256Params.N)
+}
+
+// lockTimeScriptTemplateText returns the text of the lock time template.
+//
+// BSV doesn't have OP_CHECKLOCKTIMEVERIFY, so the transaction's lock time is read from the
+// signature hash preimage in the unlocking script. The preimage is proven to be for the spending
+// transaction with the OP_PUSH_TX technique. The script calculates the signature of the preimage's
+// hash with a private key and nonce of one and checks it against the generator point with
+// OP_CHECKSIGVERIFY, which only passes if the preimage is the one the interpreter signs.
+//
+// The unlocking script is <signature> <public key> <preimage>.
+func lockTimeScriptTemplateText() string {
+	reverse32 := strings.Repeat("OP_1 OP_SPLIT ", 31) + strings.Repeat("OP_SWAP OP_CAT ", 31)
+
+	gx := scalarBytes(curveS256Params.Gx)
+	n := append(reverseEndian(scalarBytes(curveS256Params.N)), 0x00) // positive script number
+	sigPrefix := append([]byte{0x30, 0x44, 0x02, 0x20}, gx...)
+	sigPrefix = append(sigPrefix, 0x02, 0x20)
+	generator := compressPublicKey(*curveS256Params.Gx, *curveS256Params.Gy)
+
+	pushTxVerify := "OP_HASH256 " + reverse32 + // hash as little endian
+		"0x00 OP_CAT OP_BIN2NUM " + // positive script number
+		"0x" + hex.EncodeToString(reverseEndian(gx)) + " OP_ADD " + // s = hash + r
+		"0x" + hex.EncodeToString(n) + " OP_MOD " +
+		reverse32 + // s as big endian
+		"0x" + hex.EncodeToString(sigPrefix) + " OP_SWAP OP_CAT " +
+		"0x" + hex.EncodeToString([]byte{pushTxHashType}) + " OP_CAT " +
+		"0x" + hex.EncodeToString(generator) + " OP_CHECKSIGVERIFY "
+
+	// The preimage ends with the sequence, outputs hash, lock time, and signature hash type.
+	lockTime := "OP_SIZE 44 OP_SUB OP_SPLIT OP_NIP " +
+		"OP_4 OP_SPLIT OP_SWAP 0xffffffff OP_EQUAL OP_NOT OP_VERIFY " + // lock time enabled
+		"32 OP_SPLIT OP_NIP OP_4 OP_SPLIT OP_DROP 0x00 OP_CAT OP_BIN2NUM " +
+		"OP_DUP <lock_time:locktime> OP_GREATERTHANOREQUAL OP_VERIFY " +
+		"500000000 OP_LESSTHAN <lock_time:locktime> 500000000 OP_LESSTHAN " + // same type
+		"OP_NUMEQUALVERIFY "
+
+	return "OP_DUP " + pushTxVerify + lockTime +
+		"OP_DUP OP_HASH160 <pkh:hash20> OP_EQUALVERIFY OP_CHECKSIG"
+}
@@ -0,0 +1,245 @@
+package bitcoin
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// BIP-0340 Schnorr signatures use 32 byte "x only" public keys, where the y coordinate is always
+//   even, and 64 byte signatures containing the x coordinate of the nonce point R and s.
+//   Hashes are "tagged" with a protocol specific prefix so they can't be reused in other
+//   protocols.
+
+const (
+	SchnorrSignatureLength = 64
+	XOnlyPublicKeyLength   = 32
+)
+
+var (
+	ErrInvalidSchnorrSignature = errors.New("Invalid schnorr signature")
+)
+
+// SchnorrSignature is a BIP-0340 Schnorr signature.
+type SchnorrSignature struct {
+	R big.Int // x coordinate of the nonce point
+	S big.Int
+}
+
+// SchnorrSignatureFromBytes decodes a 64 byte Schnorr signature. The values are range checked
+// during verification.
+func SchnorrSignatureFromBytes(b []byte) (SchnorrSignature, error) {
+	if len(b) != SchnorrSignatureLength {
+		return SchnorrSignature{}, fmt.Errorf("Wrong length : %d should be %d", len(b),
+			SchnorrSignatureLength)
+	}
+
+	var result SchnorrSignature
+	result.R.SetBytes(b[:32])
+	result.S.SetBytes(b[32:])
+	return result, nil
+}
+
+// SchnorrSignatureFromStr decodes hex text to a Schnorr signature.
+func SchnorrSignatureFromStr(s string) (SchnorrSignature, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return SchnorrSignature{}, errors.Wrap(err, "hex")
+	}
+
+	return SchnorrSignatureFromBytes(b)
+}
+
+// Bytes returns the 64 byte encoding of the signature.
+func (s SchnorrSignature) Bytes() []byte {
+	result := make([]byte, SchnorrSignatureLength)
+	s.R.FillBytes(result[:32])
+	s.S.FillBytes(result[32:])
+	return result
+}
+
+// String returns the signature encoded as hex.
+func (s SchnorrSignature) String() string {
+	return hex.EncodeToString(s.Bytes())
+}
+
+// XOnlyBytes returns the 32 byte x coordinate used as a BIP-0340 public key.
+func (k PublicKey) XOnlyBytes() []byte {
+	result := make([]byte, XOnlyPublicKeyLength)
+	k.X.FillBytes(result)
+	return result
+}
+
+// PublicKeyFromXOnly returns the public key with the x coordinate and an even y coordinate.
+func PublicKeyFromXOnly(b []byte) (PublicKey, error) {
+	if len(b) != XOnlyPublicKeyLength {
+		return PublicKey{}, fmt.Errorf("Wrong length : %d should be %d", len(b),
+			XOnlyPublicKeyLength)
+	}
+
+	var x big.Int
+	x.SetBytes(b)
+	y, err := liftX(&x)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	var result PublicKey
+	result.X.Set(&x)
+	result.Y.Set(y)
+	return result, nil
+}
+
+// SignSchnorr creates a BIP-0340 Schnorr signature of the hash with random auxiliary data.
+func (k Key) SignSchnorr(hash Hash32) (SchnorrSignature, error) {
+	var aux [32]byte
+	if _, err := rand.Read(aux[:]); err != nil {
+		return SchnorrSignature{}, errors.Wrap(err, "random")
+	}
+
+	return k.SignSchnorrAux(hash, aux)
+}
+
+// SignSchnorrAux creates a BIP-0340 Schnorr signature of the hash with the specified auxiliary
+// random data. The same auxiliary data always creates the same signature.
+func (k Key) SignSchnorrAux(hash Hash32, aux [32]byte) (SchnorrSignature, error) {
+	N := curveS256Params.N
+
+	if k.value.Sign() == 0 || k.value.Cmp(N) >= 0 {
+		return SchnorrSignature{}, ErrOutOfRangeKey
+	}
+
+	publicKey := k.PublicKey()
+	d := new(big.Int).Set(&k.value)
+	if publicKey.Y.Bit(0) != 0 {
+		d.Sub(N, d)
+	}
+
+	// t = d xor hash(aux)
+	t := scalarBytes(d)
+	auxHash := taggedHash("BIP0340/aux", aux[:])
+	for i := range t {
+		t[i] ^= auxHash[i]
+	}
+
+	nonceHash := taggedHash("BIP0340/nonce", t, publicKey.XOnlyBytes(), hash[:])
+	nonce := new(big.Int).SetBytes(nonceHash)
+	nonce.Mod(nonce, N)
+	if nonce.Sign() == 0 {
+		return SchnorrSignature{}, errors.New("Nonce is zero")
+	}
+
+	rx, ry := curveS256.ScalarBaseMult(scalarBytes(nonce))
+	if ry.Bit(0) != 0 {
+		nonce.Sub(N, nonce)
+	}
+
+	e := schnorrChallenge(rx, &publicKey.X, hash)
+
+	// s = k + e * d
+	s := new(big.Int).Mul(e, d)
+	s.Add(s, nonce)
+	s.Mod(s, N)
+
+	var result SchnorrSignature
+	result.R.Set(rx)
+	result.S.Set(s)
+	return result, nil
+}
+
+// Verify returns true if the signature is a valid BIP-0340 Schnorr signature of the hash for the
+// public key. Only the x coordinate of the public key is used.
+func (s SchnorrSignature) Verify(hash Hash32, publicKey PublicKey) bool {
+	return s.verify(hash, publicKey) == nil
+}
+
+func (s SchnorrSignature) verify(hash Hash32, publicKey PublicKey) error {
+	P := curveS256Params.P
+	N := curveS256Params.N
+
+	py, err := liftX(&publicKey.X)
+	if err != nil {
+		return errors.Wrap(err, "public key")
+	}
+
+	if s.R.Cmp(P) >= 0 {
+		return errors.Wrap(ErrInvalidSchnorrSignature, "r out of range")
+	}
+	if s.S.Cmp(N) >= 0 {
+		return errors.Wrap(ErrInvalidSchnorrSignature, "s out of range")
+	}
+
+	e := schnorrChallenge(&s.R, &publicKey.X, hash)
+
+	// R = s*G - e*P
+	sx, sy := curveS256.ScalarBaseMult(scalarBytes(&s.S))
+	negE := new(big.Int).Sub(N, e)
+	negE.Mod(negE, N)
+	ex, ey := curveS256.ScalarMult(&publicKey.X, py, scalarBytes(negE))
+	rx, ry := curveS256.Add(sx, sy, ex, ey)
+
+	if rx.Sign() == 0 && ry.Sign() == 0 {
+		return errors.Wrap(ErrInvalidSchnorrSignature, "R is infinity")
+	}
+	if ry.Bit(0) != 0 {
+		return errors.Wrap(ErrInvalidSchnorrSignature, "R y is odd")
+	}
+	if rx.Cmp(&s.R) != 0 {
+		return errors.Wrap(ErrInvalidSchnorrSignature, "R doesn't match")
+	}
+
+	return nil
+}
+
+func schnorrChallenge(rx, px *big.Int, hash Hash32) *big.Int {
+	e := new(big.Int).SetBytes(taggedHash("BIP0340/challenge", scalarBytes(rx), scalarBytes(px),
+		hash[:]))
+	return e.Mod(e, curveS256Params.N)
+}
+
+// taggedHash returns SHA256(SHA256(tag) || SHA256(tag) || data...).
+func taggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+
+	hasher := sha256.New()
+	hasher.Write(tagHash[:])
+	hasher.Write(tagHash[:])
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	return hasher.Sum(nil)
+}
+
+// liftX returns the even y coordinate for the x coordinate.
+func liftX(x *big.Int) (*big.Int, error) {
+	P := curveS256Params.P
+	if x.Sign() < 0 || x.Cmp(P) >= 0 {
+		return nil, errors.Wrap(ErrOutOfRangeKey, "x out of range")
+	}
+
+	// y^2 = x^3 + 7
+	ySq := new(big.Int).Exp(x, big.NewInt(3), P)
+	ySq.Add(ySq, curveS256Params.B)
+	ySq.Mod(ySq, P)
+
+	y := new(big.Int).ModSqrt(ySq, P)
+	if y == nil {
+		return nil, errors.Wrap(ErrOutOfRangeKey, "x not on curve")
+	}
+
+	if y.Bit(0) != 0 {
+		y.Sub(P, y)
+	}
+	return y, nil
+}
+
+// scalarBytes returns the 32 byte big endian encoding of a value.
+func scalarBytes(v *big.Int) []byte {
+	result := make([]byte, 32)
+	v.FillBytes(result)
+	return result
+}
@@ -20,6 +20,9 @@ const (
 
 	PublicKeyHashSize   = 20
 	SigHashAll          = 0x01
+	SigHashNone         = 0x02
+	SigHashSingle       = 0x03
+	SigHashForkID       = 0x40
 	SigHashAnyOneCanPay = 0x80
 
 	OP_FALSE = byte(0x00)
@@ -347,10 +350,18 @@ var (
 		"OP_HASH256":              OP_HASH256,
 		"OP_EQUAL":                OP_EQUAL,
 		"OP_EQUALVERIFY":          OP_EQUALVERIFY,
+		"OP_BOOLAND":              OP_BOOLAND,
+		"OP_BOOLOR":               OP_BOOLOR,
+		"OP_NUMEQUAL":             OP_NUMEQUAL,
+		"OP_NUMEQUALVERIFY":       OP_NUMEQUALVERIFY,
+		"OP_NUMNOTEQUAL":          OP_NUMNOTEQUAL,
 		"OP_LESSTHAN":             OP_LESSTHAN,
 		"OP_GREATERTHAN":          OP_GREATERTHAN,
 		"OP_LESSTHANOREQUAL":      OP_LESSTHANOREQUAL,
 		"OP_GREATERTHANOREQUAL":   OP_GREATERTHANOREQUAL,
+		"OP_MIN":                  OP_MIN,
+		"OP_MAX":                  OP_MAX,
+		"OP_WITHIN":               OP_WITHIN,
 		"OP_CODESEPARATOR":        OP_CODESEPARATOR,
 		"OP_CHECKSIG":             OP_CHECKSIG,
 		"OP_CHECKSIGVERIFY":       OP_CHECKSIGVERIFY,
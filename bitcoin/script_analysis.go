@@ -0,0 +1,1017 @@
+package bitcoin
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// The analyzer walks a locking script without executing it to find bounds on what is needed to
+//   unlock it. Values are tracked as known bytes, items provided by the unlocking script, or
+//   unknown results. When a branch condition isn't known both branches are followed, so the
+//   analysis covers every path through the script. Paths that reach the same state are merged so
+//   scripts like multi-pkh accumulators don't grow exponentially.
+//
+//   Unlocking script items are classified by how they are used. Items used as signatures are
+//   counted as the maximum DER signature size plus the sig hash type, public keys as compressed
+//   public keys, and branch conditions as OP_TRUE or OP_FALSE. The size of other items can't be
+//   known, so only their push op is counted and they are counted in UnknownSizeItems.
+
+const (
+	// maxAnalysisStates is the maximum number of distinct states followed through a script.
+	maxAnalysisStates = 4096
+
+	// maxAnalysisPick is the maximum index of OP_PICK and OP_ROLL that will be analyzed.
+	maxAnalysisPick = 1000
+
+	// maxMultiSigKeys is the maximum public key count of OP_CHECKMULTISIG.
+	maxMultiSigKeys = 20
+
+	maxSignatureScriptSize = 1 + 72 + 1 // push op, DER signature, sig hash type
+	publicKeyScriptSize    = 1 + PublicKeyCompressedLength
+	boolScriptSize         = 1
+	unknownScriptSize      = 1 // push op only
+)
+
+var (
+	ErrScriptTooComplex    = errors.New("Script Too Complex")
+	ErrScriptNotAnalyzable = errors.New("Script Not Analyzable")
+)
+
+// ScriptAnalysis is the result of analyzing a locking script. The signature, size, and stack
+// values only include paths through the script that can succeed.
+type ScriptAnalysis struct {
+	// Unspendable is true when no path through the script can succeed.
+	Unspendable bool
+
+	// RequiredSignatures is the minimum number of valid signatures needed to unlock the script.
+	// MaxSignatures is the maximum number of valid signatures used by a successful path.
+	RequiredSignatures int
+	MaxSignatures      int
+
+	// MaxSigOps is the maximum number of signature checks executed. OP_CHECKMULTISIG counts one
+	// for each public key.
+	MaxSigOps int
+
+	// MaxStackDepth and MaxAltStackDepth are the maximum number of items on the stacks, including
+	// the items provided by the unlocking script.
+	MaxStackDepth    int
+	MaxAltStackDepth int
+
+	// MinUnlockingItems and MaxUnlockingItems are the number of items the unlocking script must
+	// provide.
+	MinUnlockingItems int
+	MaxUnlockingItems int
+
+	// MinUnlockingScriptSize and MaxUnlockingScriptSize are estimates of the unlocking script size
+	// in bytes. Items of unknown size only count their push op.
+	MinUnlockingScriptSize int
+	MaxUnlockingScriptSize int
+
+	// UnknownSizeItems is the maximum number of unlocking script items with unknown sizes. Their
+	// data size must be added to the unlocking script size estimates.
+	UnknownSizeItems int
+
+	// UnreachableBranches are the item indexes of OP_IF, OP_NOTIF, and OP_ELSE op codes whose
+	// branch is never executed.
+	UnreachableBranches []int
+
+	// NonMinimalPushes are the item indexes of pushes that don't use the smallest encoding.
+	NonMinimalPushes []int
+}
+
+type analysisInputKind uint8
+
+const (
+	analysisInputUnknown = analysisInputKind(iota)
+	analysisInputBool
+	analysisInputSignature
+	analysisInputPublicKey
+	analysisInputKindCount
+)
+
+// analysisValue is a stack value. It is known data, an item provided by the unlocking script, or
+// an unknown result.
+type analysisValue struct {
+	data  []byte
+	known bool
+	input int // index into the state's live inputs or -1
+	sigs  int // valid signatures needed for the value to be true
+}
+
+type analysisState struct {
+	stack    []analysisValue
+	altStack []analysisValue
+	exec     []bool
+
+	// inputs are the kinds of unlocking script items that are still referenced by stack values.
+	// inputCounts are the counts of the kinds of the rest.
+	inputs      []analysisInputKind
+	inputCounts [analysisInputKindCount]int
+
+	sigs   int
+	sigOps int
+
+	// maxRelativeDepth is the maximum of the stack size minus the number of inputs pulled from
+	// the unlocking script at that point. Adding the total inputs gives the maximum depth.
+	maxRelativeDepth int
+	maxAltDepth      int
+
+	failed bool
+	done   bool
+}
+
+// Analyze returns an analysis of the locking script.
+func (s Script) Analyze() (*ScriptAnalysis, error) {
+	return analyzeScript(s, false)
+}
+
+// Analyze returns an analysis of the template. OP_PUBKEY and OP_PUBKEYHASH are treated as pushes
+// of a public key and a public key hash.
+func (t Template) Analyze() (*ScriptAnalysis, error) {
+	return analyzeScript(Script(t), true)
+}
+
+func analyzeScript(script Script, isTemplate bool) (*ScriptAnalysis, error) {
+	result := &ScriptAnalysis{}
+
+	var items ScriptItems
+	buf := bytes.NewReader(script)
+	for buf.Len() > 0 {
+		offset := len(script) - buf.Len()
+		item, err := ParseScript(buf)
+		if err != nil {
+			return nil, errors.Wrapf(err, "item %d", len(items))
+		}
+
+		if !isMinimalPush(item, script[offset]) {
+			result.NonMinimalPushes = append(result.NonMinimalPushes, len(items))
+		}
+
+		items = append(items, item)
+	}
+
+	executed := make(map[int]bool)
+	states := []*analysisState{{}}
+	var ended []*analysisState
+
+	for index, item := range items {
+		var next []*analysisState
+		for _, state := range states {
+			stepped, err := state.step(index, item, isTemplate, executed)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d: %s", index, item)
+			}
+
+			for _, s := range stepped {
+				if s.failed {
+					continue
+				}
+
+				if s.done {
+					ended = append(ended, s)
+					continue
+				}
+
+				s.compact()
+				next = append(next, s)
+			}
+		}
+
+		if item.Type == ScriptItemTypeOpCode && item.OpCode == OP_ENDIF {
+			next = mergeAnalysisStates(next)
+		}
+
+		if len(next) > maxAnalysisStates {
+			return nil, errors.Wrapf(ErrScriptTooComplex, "item %d: %d states", index, len(next))
+		}
+
+		states = next
+	}
+
+	for _, state := range states {
+		if len(state.exec) != 0 {
+			continue // unbalanced conditional
+		}
+
+		state.finish()
+		if !state.failed {
+			ended = append(ended, state)
+		}
+	}
+
+	for index, item := range items {
+		if item.Type != ScriptItemTypeOpCode {
+			continue
+		}
+
+		switch item.OpCode {
+		case OP_IF, OP_NOTIF, OP_ELSE:
+			if !executed[index] {
+				result.UnreachableBranches = append(result.UnreachableBranches, index)
+			}
+		}
+	}
+
+	if len(ended) == 0 {
+		result.Unspendable = true
+		return result, nil
+	}
+
+	result.RequiredSignatures = math.MaxInt32
+	result.MinUnlockingItems = math.MaxInt32
+	result.MinUnlockingScriptSize = math.MaxInt32
+	for _, state := range ended {
+		state.compact()
+		items, size, unknown := state.unlockingSize()
+
+		result.RequiredSignatures = minInt(result.RequiredSignatures, state.sigs)
+		result.MaxSignatures = maxInt(result.MaxSignatures, state.sigs)
+		result.MaxSigOps = maxInt(result.MaxSigOps, state.sigOps)
+		result.MaxStackDepth = maxInt(result.MaxStackDepth, state.maxRelativeDepth+items)
+		result.MaxAltStackDepth = maxInt(result.MaxAltStackDepth, state.maxAltDepth)
+		result.MinUnlockingItems = minInt(result.MinUnlockingItems, items)
+		result.MaxUnlockingItems = maxInt(result.MaxUnlockingItems, items)
+		result.MinUnlockingScriptSize = minInt(result.MinUnlockingScriptSize, size)
+		result.MaxUnlockingScriptSize = maxInt(result.MaxUnlockingScriptSize, size)
+		result.UnknownSizeItems = maxInt(result.UnknownSizeItems, unknown)
+	}
+
+	return result, nil
+}
+
+// isMinimalPush returns true if the item isn't a push or is pushed with the smallest encoding.
+func isMinimalPush(item *ScriptItem, opCode byte) bool {
+	if item.Type != ScriptItemTypePushData {
+		return true
+	}
+
+	if len(item.Data) == 0 {
+		return false // should be OP_0
+	}
+
+	if len(item.Data) == 1 && ((item.Data[0] >= 1 && item.Data[0] <= 16) ||
+		item.Data[0] == 0x81) {
+		return false // should be OP_1 to OP_16 or OP_1NEGATE
+	}
+
+	size := len(item.Data)
+	switch {
+	case size <= int(OP_MAX_SINGLE_BYTE_PUSH_DATA):
+		return opCode == byte(size)
+	case uint64(size) <= OP_PUSH_DATA_1_MAX:
+		return opCode == OP_PUSH_DATA_1
+	case uint64(size) <= OP_PUSH_DATA_2_MAX:
+		return opCode == OP_PUSH_DATA_2
+	}
+
+	return true
+}
+
+// mergeAnalysisStates removes duplicate states, keeping the maximums of their metrics.
+func mergeAnalysisStates(states []*analysisState) []*analysisState {
+	byKey := make(map[string]*analysisState)
+	var result []*analysisState
+	for _, state := range states {
+		key := state.key()
+		if existing, exists := byKey[key]; exists {
+			existing.sigOps = maxInt(existing.sigOps, state.sigOps)
+			existing.maxRelativeDepth = maxInt(existing.maxRelativeDepth, state.maxRelativeDepth)
+			existing.maxAltDepth = maxInt(existing.maxAltDepth, state.maxAltDepth)
+			continue
+		}
+
+		byKey[key] = state
+		result = append(result, state)
+	}
+
+	return result
+}
+
+// key returns a value that is the same for states that behave the same for the rest of the
+// script.
+func (s *analysisState) key() string {
+	buf := &bytes.Buffer{}
+	writeValues := func(values []analysisValue) {
+		fmt.Fprintf(buf, "%d:", len(values))
+		for _, v := range values {
+			if v.known {
+				fmt.Fprintf(buf, "k%x,", v.data)
+			} else if v.input != -1 {
+				fmt.Fprintf(buf, "i%d,%d,", v.input, v.sigs)
+			} else {
+				fmt.Fprintf(buf, "u%d,", v.sigs)
+			}
+		}
+	}
+
+	writeValues(s.stack)
+	writeValues(s.altStack)
+	fmt.Fprintf(buf, "%v%v%v%d", s.exec, s.inputs, s.inputCounts, s.sigs)
+	return buf.String()
+}
+
+func (s *analysisState) copy() *analysisState {
+	result := *s
+	result.stack = append([]analysisValue(nil), s.stack...)
+	result.altStack = append([]analysisValue(nil), s.altStack...)
+	result.exec = append([]bool(nil), s.exec...)
+	result.inputs = append([]analysisInputKind(nil), s.inputs...)
+	return &result
+}
+
+// compact moves inputs that are no longer referenced by stack values to the counts and relabels
+// the rest in order of appearance so equivalent states have the same key.
+func (s *analysisState) compact() {
+	labels := make(map[int]int)
+	var inputs []analysisInputKind
+	relabel := func(values []analysisValue) {
+		for i, v := range values {
+			if v.input == -1 {
+				continue
+			}
+
+			label, exists := labels[v.input]
+			if !exists {
+				label = len(inputs)
+				labels[v.input] = label
+				inputs = append(inputs, s.inputs[v.input])
+			}
+			values[i].input = label
+		}
+	}
+
+	relabel(s.stack)
+	relabel(s.altStack)
+
+	for i, kind := range s.inputs {
+		if _, exists := labels[i]; !exists {
+			s.inputCounts[kind]++
+		}
+	}
+
+	s.inputs = inputs
+}
+
+func (s *analysisState) inputCount() int {
+	result := len(s.inputs)
+	for _, count := range s.inputCounts {
+		result += count
+	}
+	return result
+}
+
+// unlockingSize returns the number of items, the estimated size, and the number of items with
+// unknown size of the unlocking script. The state must be compacted with no live inputs.
+func (s *analysisState) unlockingSize() (int, int, int) {
+	counts := s.inputCounts
+	for _, kind := range s.inputs {
+		counts[kind]++
+	}
+
+	size := counts[analysisInputUnknown]*unknownScriptSize +
+		counts[analysisInputBool]*boolScriptSize +
+		counts[analysisInputSignature]*maxSignatureScriptSize +
+		counts[analysisInputPublicKey]*publicKeyScriptSize
+
+	return s.inputCount(), size, counts[analysisInputUnknown]
+}
+
+func (s *analysisState) isExecuting() bool {
+	for _, e := range s.exec {
+		if !e {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *analysisState) updateDepth() {
+	s.maxRelativeDepth = maxInt(s.maxRelativeDepth, len(s.stack)-s.inputCount())
+	s.maxAltDepth = maxInt(s.maxAltDepth, len(s.altStack))
+}
+
+// need makes sure the stack has at least count items by pulling items from the unlocking script.
+func (s *analysisState) need(count int) {
+	for len(s.stack) < count {
+		input := analysisValue{input: len(s.inputs)}
+		s.inputs = append(s.inputs, analysisInputUnknown)
+		s.stack = append([]analysisValue{input}, s.stack...)
+	}
+}
+
+func (s *analysisState) pop() analysisValue {
+	s.need(1)
+	result := s.stack[len(s.stack)-1]
+	s.stack = s.stack[:len(s.stack)-1]
+	return result
+}
+
+func (s *analysisState) push(v analysisValue) {
+	s.stack = append(s.stack, v)
+}
+
+// mark sets the kind of an unlocking script item if it isn't already known.
+func (s *analysisState) mark(v analysisValue, kind analysisInputKind) {
+	if v.input != -1 && s.inputs[v.input] == analysisInputUnknown {
+		s.inputs[v.input] = kind
+	}
+}
+
+// require applies a value that must be true for the script to succeed.
+func (s *analysisState) require(v analysisValue) {
+	if v.known {
+		if !analysisBool(v.data) {
+			s.failed = true
+		}
+		return
+	}
+
+	s.mark(v, analysisInputBool)
+	s.sigs += v.sigs
+}
+
+// finish checks the top stack item at the end of the script.
+func (s *analysisState) finish() {
+	s.require(s.pop())
+	s.done = true
+}
+
+// step returns the states after the item is applied to the state.
+func (s *analysisState) step(index int, item *ScriptItem, isTemplate bool,
+	executed map[int]bool) ([]*analysisState, error) {
+
+	if item.Type == ScriptItemTypeOpCode {
+		switch item.OpCode {
+		case OP_IF, OP_NOTIF:
+			if !s.isExecuting() {
+				s.exec = append(s.exec, false)
+				return []*analysisState{s}, nil
+			}
+
+			v := s.pop()
+			if v.known {
+				value := analysisBool(v.data)
+				if item.OpCode == OP_NOTIF {
+					value = !value
+				}
+				if value {
+					executed[index] = true
+				}
+				s.exec = append(s.exec, value)
+				return []*analysisState{s}, nil
+			}
+
+			s.mark(v, analysisInputBool)
+			executed[index] = true
+
+			other := s.copy()
+			s.exec = append(s.exec, true)
+			other.exec = append(other.exec, false)
+			if item.OpCode == OP_IF {
+				s.sigs += v.sigs
+			} else {
+				other.sigs += v.sigs
+			}
+			return []*analysisState{s, other}, nil
+
+		case OP_ELSE:
+			if len(s.exec) == 0 {
+				s.failed = true
+				return []*analysisState{s}, nil
+			}
+
+			s.exec[len(s.exec)-1] = !s.exec[len(s.exec)-1]
+			if s.isExecuting() {
+				executed[index] = true
+			}
+			return []*analysisState{s}, nil
+
+		case OP_ENDIF:
+			if len(s.exec) == 0 {
+				s.failed = true
+				return []*analysisState{s}, nil
+			}
+
+			s.exec = s.exec[:len(s.exec)-1]
+			return []*analysisState{s}, nil
+
+		case OP_VERIF, OP_VERNOTIF:
+			s.failed = true
+			return []*analysisState{s}, nil
+		}
+	}
+
+	if !s.isExecuting() {
+		return []*analysisState{s}, nil
+	}
+
+	if item.Type == ScriptItemTypeOpCode && item.OpCode == OP_IFDUP {
+		s.need(1)
+		v := s.stack[len(s.stack)-1]
+		if !v.known {
+			// Follow both the true value that is duplicated and the false value that isn't.
+			other := s.copy()
+			other.mark(v, analysisInputBool)
+			other.stack[len(other.stack)-1] = analysisBoolValue(false)
+
+			s.require(v)
+			s.push(v)
+			s.updateDepth()
+			return []*analysisState{s, other}, nil
+		}
+	}
+
+	if err := s.apply(item, isTemplate); err != nil {
+		return nil, err
+	}
+	s.updateDepth()
+	return []*analysisState{s}, nil
+}
+
+// apply applies a non-conditional item to an executing state.
+func (s *analysisState) apply(item *ScriptItem, isTemplate bool) error {
+	if item.Type == ScriptItemTypePushData {
+		s.push(knownValue(item.Data))
+		return nil
+	}
+
+	opCode := item.OpCode
+	if opCode == OP_0 || opCode == OP_1NEGATE || (opCode >= OP_1 && opCode <= OP_16) {
+		value, _ := ScriptNumberValue(item)
+		s.push(knownValue(scriptNumberBytes(value)))
+		return nil
+	}
+
+	if isTemplate && (opCode == OP_PUBKEY || opCode == OP_PUBKEYHASH) {
+		s.push(unknownValue())
+		return nil
+	}
+
+	switch opCode {
+	case OP_NOP, OP_NOP1, OP_NOP2, OP_NOP3, OP_NOP4, OP_NOP5, OP_NOP6, OP_NOP7, OP_NOP8, OP_NOP9,
+		OP_NOP10, OP_CODESEPARATOR:
+
+	case OP_VERIFY:
+		s.require(s.pop())
+
+	case OP_RETURN:
+		s.finish()
+
+	case OP_TOALTSTACK:
+		s.altStack = append(s.altStack, s.pop())
+
+	case OP_FROMALTSTACK:
+		if len(s.altStack) == 0 {
+			s.failed = true
+			return nil
+		}
+		s.push(s.altStack[len(s.altStack)-1])
+		s.altStack = s.altStack[:len(s.altStack)-1]
+
+	case OP_DROP:
+		s.pop()
+
+	case OP_2DROP:
+		s.pop()
+		s.pop()
+
+	case OP_DUP:
+		s.need(1)
+		s.push(s.stack[len(s.stack)-1])
+
+	case OP_2DUP:
+		s.need(2)
+		s.stack = append(s.stack, s.stack[len(s.stack)-2:]...)
+
+	case OP_3DUP:
+		s.need(3)
+		s.stack = append(s.stack, s.stack[len(s.stack)-3:]...)
+
+	case OP_2OVER:
+		s.need(4)
+		s.stack = append(s.stack, s.stack[len(s.stack)-4:len(s.stack)-2]...)
+
+	case OP_IFDUP: // unknown values are split into two states by step
+		s.need(1)
+		v := s.stack[len(s.stack)-1]
+		if analysisBool(v.data) {
+			s.push(v)
+		}
+
+	case OP_DEPTH:
+		s.push(unknownValue())
+
+	case OP_NIP:
+		s.need(2)
+		s.stack = append(s.stack[:len(s.stack)-2], s.stack[len(s.stack)-1])
+
+	case OP_OVER:
+		s.need(2)
+		s.push(s.stack[len(s.stack)-2])
+
+	case OP_PICK, OP_ROLL:
+		value, ok := analysisNumber(s.pop())
+		if !ok {
+			return errors.Wrap(ErrScriptNotAnalyzable, "unknown stack index")
+		}
+		if value < 0 {
+			s.failed = true
+			return nil
+		}
+		if value > maxAnalysisPick {
+			return errors.Wrapf(ErrScriptTooComplex, "stack index %d", value)
+		}
+
+		s.need(int(value) + 1)
+		position := len(s.stack) - 1 - int(value)
+		v := s.stack[position]
+		if opCode == OP_ROLL {
+			s.stack = append(s.stack[:position], s.stack[position+1:]...)
+		}
+		s.push(v)
+
+	case OP_ROT:
+		s.need(3)
+		l := len(s.stack)
+		s.stack[l-3], s.stack[l-2], s.stack[l-1] = s.stack[l-2], s.stack[l-1], s.stack[l-3]
+
+	case OP_2ROT:
+		s.need(6)
+		l := len(s.stack)
+		moved := []analysisValue{s.stack[l-6], s.stack[l-5]}
+		s.stack = append(s.stack[:l-6], s.stack[l-4:]...)
+		s.stack = append(s.stack, moved...)
+
+	case OP_SWAP:
+		s.need(2)
+		l := len(s.stack)
+		s.stack[l-2], s.stack[l-1] = s.stack[l-1], s.stack[l-2]
+
+	case OP_2SWAP:
+		s.need(4)
+		l := len(s.stack)
+		s.stack[l-4], s.stack[l-3], s.stack[l-2], s.stack[l-1] = s.stack[l-2], s.stack[l-1],
+			s.stack[l-4], s.stack[l-3]
+
+	case OP_TUCK:
+		s.need(2)
+		l := len(s.stack)
+		top := s.stack[l-1]
+		s.stack = append(s.stack[:l-2], top, s.stack[l-2], top)
+
+	case OP_CAT:
+		b := s.pop()
+		a := s.pop()
+		if a.known && b.known {
+			s.push(knownValue(append(append([]byte{}, a.data...), b.data...)))
+		} else {
+			s.push(unknownValue())
+		}
+
+	case OP_SPLIT:
+		n := s.pop()
+		v := s.pop()
+		position, ok := analysisNumber(n)
+		if v.known && ok {
+			if position < 0 || position > int64(len(v.data)) {
+				s.failed = true
+				return nil
+			}
+			s.push(knownValue(v.data[:position]))
+			s.push(knownValue(v.data[position:]))
+		} else {
+			s.push(unknownValue())
+			s.push(unknownValue())
+		}
+
+	case OP_SIZE:
+		s.need(1)
+		v := s.stack[len(s.stack)-1]
+		if v.known {
+			s.push(knownValue(scriptNumberBytes(int64(len(v.data)))))
+		} else {
+			s.push(unknownValue())
+		}
+
+	case OP_NUM2BIN, OP_AND, OP_OR, OP_XOR, OP_LSHIFT, OP_RSHIFT:
+		s.pop()
+		s.pop()
+		s.push(unknownValue())
+
+	case OP_BIN2NUM, OP_INVERT, OP_RIPEMD160, OP_SHA1, OP_SHA256, OP_HASH160, OP_HASH256:
+		s.pop()
+		s.push(unknownValue())
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		b := s.pop()
+		a := s.pop()
+		result := unknownValue()
+		if a.known && b.known {
+			result = analysisBoolValue(bytes.Equal(a.data, b.data))
+		}
+
+		if opCode == OP_EQUALVERIFY {
+			s.require(result)
+		} else {
+			s.push(result)
+		}
+
+	case OP_1ADD, OP_1SUB, OP_2MUL, OP_2DIV, OP_NEGATE, OP_ABS, OP_NOT, OP_0NOTEQUAL:
+		v := s.pop()
+		value, ok := analysisNumber(v)
+		if !ok {
+			s.push(unknownValue())
+			return nil
+		}
+
+		switch opCode {
+		case OP_1ADD:
+			value++
+		case OP_1SUB:
+			value--
+		case OP_2MUL:
+			value *= 2
+		case OP_2DIV:
+			value /= 2
+		case OP_NEGATE:
+			value = -value
+		case OP_ABS:
+			if value < 0 {
+				value = -value
+			}
+		case OP_NOT:
+			value = boolNumber(value == 0)
+		case OP_0NOTEQUAL:
+			value = boolNumber(value != 0)
+		}
+		s.push(knownValue(scriptNumberBytes(value)))
+
+	case OP_BOOLAND, OP_BOOLOR:
+		b := s.pop()
+		a := s.pop()
+		s.push(analysisBoolOp(opCode, a, b))
+
+	case OP_ADD, OP_SUB, OP_MUL, OP_DIV, OP_MOD, OP_NUMEQUAL, OP_NUMEQUALVERIFY,
+		OP_NUMNOTEQUAL, OP_LESSTHAN, OP_GREATERTHAN, OP_LESSTHANOREQUAL,
+		OP_GREATERTHANOREQUAL, OP_MIN, OP_MAX:
+		b := s.pop()
+		a := s.pop()
+		result := analysisNumberOp(opCode, a, b)
+		if result.known && result.data == nil {
+			s.failed = true // divide by zero
+			return nil
+		}
+
+		if opCode == OP_NUMEQUALVERIFY {
+			s.require(result)
+		} else {
+			s.push(result)
+		}
+
+	case OP_WITHIN:
+		max := s.pop()
+		min := s.pop()
+		v := s.pop()
+		maxValue, maxOk := analysisNumber(max)
+		minValue, minOk := analysisNumber(min)
+		value, ok := analysisNumber(v)
+		if maxOk && minOk && ok {
+			s.push(analysisBoolValue(value >= minValue && value < maxValue))
+		} else {
+			s.push(unknownValue())
+		}
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		publicKey := s.pop()
+		signature := s.pop()
+		s.mark(publicKey, analysisInputPublicKey)
+		s.mark(signature, analysisInputSignature)
+		s.sigOps++
+
+		// Only signatures provided by the unlocking script are counted. Signatures calculated by
+		// the script, like with OP_PUSH_TX, don't need to be provided.
+		sigs := 0
+		if signature.input != -1 {
+			sigs = 1
+		}
+
+		if opCode == OP_CHECKSIGVERIFY {
+			s.sigs += sigs
+		} else {
+			s.push(analysisValue{input: -1, sigs: sigs})
+		}
+
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		keyCount, ok := analysisNumber(s.pop())
+		if !ok {
+			return errors.Wrap(ErrScriptNotAnalyzable, "unknown public key count")
+		}
+		if keyCount < 0 || keyCount > maxMultiSigKeys {
+			s.failed = true
+			return nil
+		}
+		for i := int64(0); i < keyCount; i++ {
+			s.mark(s.pop(), analysisInputPublicKey)
+		}
+
+		sigCount, ok := analysisNumber(s.pop())
+		if !ok {
+			return errors.Wrap(ErrScriptNotAnalyzable, "unknown signature count")
+		}
+		if sigCount < 0 || sigCount > keyCount {
+			s.failed = true
+			return nil
+		}
+		sigs := 0
+		for i := int64(0); i < sigCount; i++ {
+			signature := s.pop()
+			s.mark(signature, analysisInputSignature)
+			if signature.input != -1 {
+				sigs++
+			}
+		}
+
+		s.mark(s.pop(), analysisInputBool) // extra value popped by OP_CHECKMULTISIG, OP_0
+		s.sigOps += int(keyCount)
+
+		if opCode == OP_CHECKMULTISIGVERIFY {
+			s.sigs += sigs
+		} else {
+			s.push(analysisValue{input: -1, sigs: sigs})
+		}
+
+	default:
+		// Disabled, reserved, and undefined op codes fail when executed.
+		s.failed = true
+	}
+
+	return nil
+}
+
+func knownValue(b []byte) analysisValue {
+	if b == nil {
+		b = []byte{}
+	}
+	return analysisValue{data: b, known: true, input: -1}
+}
+
+func unknownValue() analysisValue {
+	return analysisValue{input: -1}
+}
+
+func analysisBoolValue(value bool) analysisValue {
+	if value {
+		return knownValue([]byte{1})
+	}
+	return knownValue(nil)
+}
+
+// analysisBool returns the boolean value of stack data the way the interpreter does.
+func analysisBool(b []byte) bool {
+	for i, v := range b {
+		if v != 0 {
+			// Negative zero is false.
+			return !(i == len(b)-1 && v == 0x80)
+		}
+	}
+	return false
+}
+
+func analysisNumber(v analysisValue) (int64, bool) {
+	if !v.known || len(v.data) > 8 {
+		return 0, false
+	}
+
+	if len(v.data) == 0 {
+		return 0, true
+	}
+
+	value, err := DecodeScriptLittleEndian(v.data)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+func analysisBoolOp(opCode byte, a, b analysisValue) analysisValue {
+	aValue, aOk := analysisNumber(a)
+	bValue, bOk := analysisNumber(b)
+	if aOk && bOk {
+		if opCode == OP_BOOLAND {
+			return analysisBoolValue(aValue != 0 && bValue != 0)
+		}
+		return analysisBoolValue(aValue != 0 || bValue != 0)
+	}
+
+	if opCode == OP_BOOLAND {
+		if (aOk && aValue == 0) || (bOk && bValue == 0) {
+			return analysisBoolValue(false)
+		}
+		return analysisValue{input: -1, sigs: a.sigs + b.sigs}
+	}
+
+	if (aOk && aValue != 0) || (bOk && bValue != 0) {
+		return analysisBoolValue(true)
+	}
+	if aOk {
+		return analysisValue{input: -1, sigs: b.sigs}
+	}
+	if bOk {
+		return analysisValue{input: -1, sigs: a.sigs}
+	}
+	return analysisValue{input: -1, sigs: minInt(a.sigs, b.sigs)}
+}
+
+// analysisNumberOp returns the result of a binary number op code. A known value with nil data is
+// returned for division by zero.
+func analysisNumberOp(opCode byte, a, b analysisValue) analysisValue {
+	aValue, aOk := analysisNumber(a)
+	bValue, bOk := analysisNumber(b)
+	if !aOk || !bOk {
+		return unknownValue()
+	}
+
+	var value int64
+	switch opCode {
+	case OP_ADD:
+		value = aValue + bValue
+	case OP_SUB:
+		value = aValue - bValue
+	case OP_MUL:
+		value = aValue * bValue
+	case OP_DIV, OP_MOD:
+		if bValue == 0 {
+			return analysisValue{known: true, input: -1}
+		}
+		if opCode == OP_DIV {
+			value = aValue / bValue
+		} else {
+			value = aValue % bValue
+		}
+	case OP_NUMEQUAL, OP_NUMEQUALVERIFY:
+		value = boolNumber(aValue == bValue)
+	case OP_NUMNOTEQUAL:
+		value = boolNumber(aValue != bValue)
+	case OP_LESSTHAN:
+		value = boolNumber(aValue < bValue)
+	case OP_GREATERTHAN:
+		value = boolNumber(aValue > bValue)
+	case OP_LESSTHANOREQUAL:
+		value = boolNumber(aValue <= bValue)
+	case OP_GREATERTHANOREQUAL:
+		value = boolNumber(aValue >= bValue)
+	case OP_MIN:
+		value = aValue
+		if bValue < aValue {
+			value = bValue
+		}
+	case OP_MAX:
+		value = aValue
+		if bValue > aValue {
+			value = bValue
+		}
+	}
+
+	return knownValue(scriptNumberBytes(value))
+}
+
+func boolNumber(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// scriptNumberBytes returns the stack value of a number.
+func scriptNumberBytes(n int64) []byte {
+	item := PushNumberScriptItem(n)
+	if item.Type == ScriptItemTypePushData {
+		return item.Data
+	}
+
+	switch {
+	case item.OpCode == OP_0:
+		return []byte{}
+	case item.OpCode == OP_1NEGATE:
+		return []byte{0x81}
+	default:
+		return []byte{item.OpCode - OP_1 + 1}
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
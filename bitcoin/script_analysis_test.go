@@ -0,0 +1,257 @@
+package bitcoin
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_ScriptAnalysis(t *testing.T) {
+	multiPKH, _ := NewMultiPKHTemplate(2, 3)
+	threshold, _ := SigningThreshold{Required: 1, Total: 2}.SubTemplate()
+	or, _ := NewOrTemplate(PKHEmbeddedTemplate, threshold)
+	or = append(or, OP_1)
+
+	tests := []struct {
+		name     string
+		asm      string
+		template Template
+		want     ScriptAnalysis
+	}{
+		{
+			name:     "pkh",
+			template: PKHTemplate,
+			want: ScriptAnalysis{
+				RequiredSignatures:     1,
+				MaxSignatures:          1,
+				MaxSigOps:              1,
+				MaxStackDepth:          4,
+				MinUnlockingItems:      2,
+				MaxUnlockingItems:      2,
+				MinUnlockingScriptSize: 108,
+				MaxUnlockingScriptSize: 108,
+			},
+		},
+		{
+			name:     "pk",
+			template: PKTemplate,
+			want: ScriptAnalysis{
+				RequiredSignatures:     1,
+				MaxSignatures:          1,
+				MaxSigOps:              1,
+				MaxStackDepth:          2,
+				MinUnlockingItems:      1,
+				MaxUnlockingItems:      1,
+				MinUnlockingScriptSize: 74,
+				MaxUnlockingScriptSize: 74,
+			},
+		},
+		{
+			name:     "multi-pkh 2 of 3",
+			template: multiPKH,
+			want: ScriptAnalysis{
+				RequiredSignatures:     2,
+				MaxSignatures:          3,
+				MaxSigOps:              3,
+				MaxStackDepth:          10,
+				MaxAltStackDepth:       1,
+				MinUnlockingItems:      7,
+				MaxUnlockingItems:      9,
+				MinUnlockingScriptSize: 2*108 + 3,
+				MaxUnlockingScriptSize: 3*108 + 3,
+			},
+		},
+		{
+			name:     "pkh or 1 of 2",
+			template: or,
+			want: ScriptAnalysis{
+				RequiredSignatures:     1,
+				MaxSignatures:          2,
+				MaxSigOps:              2,
+				MaxStackDepth:          7,
+				MaxAltStackDepth:       1,
+				MinUnlockingItems:      3,
+				MaxUnlockingItems:      7,
+				MinUnlockingScriptSize: 108 + 1,
+				MaxUnlockingScriptSize: 2*108 + 3,
+			},
+		},
+		{
+			name: "checkmultisig",
+			asm: "OP_2 02a1633cafcc01ebfb6d78e39f687a1f0995c62fc95f51ead10a02ee0be551b5dc " +
+				"02a1633cafcc01ebfb6d78e39f687a1f0995c62fc95f51ead10a02ee0be551b5dd " +
+				"02a1633cafcc01ebfb6d78e39f687a1f0995c62fc95f51ead10a02ee0be551b5de " +
+				"OP_3 OP_CHECKMULTISIG",
+			want: ScriptAnalysis{
+				RequiredSignatures:     2,
+				MaxSignatures:          2,
+				MaxSigOps:              3,
+				MaxStackDepth:          8,
+				MinUnlockingItems:      3,
+				MaxUnlockingItems:      3,
+				MinUnlockingScriptSize: 2*74 + 1,
+				MaxUnlockingScriptSize: 2*74 + 1,
+			},
+		},
+		{
+			name: "hash puzzle",
+			asm:  "OP_HASH160 e3b0c44298fc1c149afbf4c8996fb92427ae41e4 OP_EQUAL",
+			want: ScriptAnalysis{
+				MaxStackDepth:          2,
+				MinUnlockingItems:      1,
+				MaxUnlockingItems:      1,
+				MinUnlockingScriptSize: 1,
+				MaxUnlockingScriptSize: 1,
+				UnknownSizeItems:       1,
+			},
+		},
+		{
+			name: "unreachable branches",
+			asm: "OP_0 OP_IF OP_CHECKSIG OP_ELSE OP_1 OP_IF OP_DROP OP_ELSE OP_RETURN OP_ENDIF " +
+				"OP_ENDIF",
+			want: ScriptAnalysis{
+				MaxStackDepth:          3,
+				MinUnlockingItems:      2,
+				MaxUnlockingItems:      2,
+				MinUnlockingScriptSize: 2,
+				MaxUnlockingScriptSize: 2,
+				UnknownSizeItems:       1,
+				UnreachableBranches:    []int{1, 7},
+			},
+		},
+		{
+			name: "if dup",
+			asm:  "OP_IFDUP OP_NOTIF OP_1 OP_ENDIF",
+			want: ScriptAnalysis{
+				MaxStackDepth:          2,
+				MinUnlockingItems:      1,
+				MaxUnlockingItems:      1,
+				MinUnlockingScriptSize: 1,
+				MaxUnlockingScriptSize: 1,
+			},
+		},
+		{
+			name: "unspendable",
+			asm:  "OP_FALSE OP_RETURN \"data\"",
+			want: ScriptAnalysis{
+				Unspendable: true,
+			},
+		},
+		{
+			name: "always fails",
+			asm:  "OP_2 OP_3 OP_NUMEQUALVERIFY OP_CHECKSIG",
+			want: ScriptAnalysis{
+				Unspendable: true,
+			},
+		},
+		{
+			name: "non-minimal pushes",
+			asm:  "{0x0105} {0x4c020102} {0x4c00} 0x0102 OP_2DROP OP_2DROP",
+			want: ScriptAnalysis{
+				MaxStackDepth:          5,
+				MinUnlockingItems:      1,
+				MaxUnlockingItems:      1,
+				MinUnlockingScriptSize: 1,
+				MaxUnlockingScriptSize: 1,
+				NonMinimalPushes:       []int{0, 1, 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var analysis *ScriptAnalysis
+			var err error
+			if tt.template != nil {
+				analysis, err = tt.template.Analyze()
+			} else {
+				script, serr := AsmToScript(tt.asm)
+				if serr != nil {
+					t.Fatalf("Failed to assemble script : %s", serr)
+				}
+				analysis, err = script.Analyze()
+			}
+			if err != nil {
+				t.Fatalf("Failed to analyze : %s", err)
+			}
+
+			t.Logf("Analysis : %+v", *analysis)
+
+			if !reflect.DeepEqual(*analysis, tt.want) {
+				t.Fatalf("Wrong analysis : \n  got  : %+v\n  want : %+v", *analysis, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ScriptAnalysisLockTime(t *testing.T) {
+	values := TemplateValues{}
+	values.SetLockTime("lock_time", 800000)
+	values.SetHash20("pkh", Hash20{})
+	lockingScript, err := LockTimeScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+
+	analysis, err := lockingScript.Analyze()
+	if err != nil {
+		t.Fatalf("Failed to analyze : %s", err)
+	}
+
+	t.Logf("Analysis : %+v", *analysis)
+
+	// The OP_PUSH_TX signature is calculated by the script so only one signature is needed. The
+	// preimage size isn't known.
+	if analysis.RequiredSignatures != 1 {
+		t.Fatalf("Wrong required signatures : got %d, want %d", analysis.RequiredSignatures, 1)
+	}
+
+	if analysis.MaxSigOps != 2 {
+		t.Fatalf("Wrong sig ops : got %d, want %d", analysis.MaxSigOps, 2)
+	}
+
+	if analysis.MaxUnlockingItems != 3 || analysis.UnknownSizeItems != 1 {
+		t.Fatalf("Wrong unlocking items : got %d (%d unknown size), want 3 (1 unknown size)",
+			analysis.MaxUnlockingItems, analysis.UnknownSizeItems)
+	}
+}
+
+func Test_ScriptAnalysisErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		asm  string
+		err  error
+	}{
+		{"unknown pick index", "OP_PICK", ErrScriptNotAnalyzable},
+		{"unknown multisig count", "OP_CHECKMULTISIG", ErrScriptNotAnalyzable},
+		{"large pick index", "5000 OP_PICK", ErrScriptTooComplex},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := AsmToScript(tt.asm)
+			if err != nil {
+				t.Fatalf("Failed to assemble script : %s", err)
+			}
+
+			if _, err := script.Analyze(); errors.Cause(err) != tt.err {
+				t.Fatalf("Wrong error : got %v, want %s", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_ScriptAnalysisTooManyStates(t *testing.T) {
+	// Each branch leaves a different value on the alt stack, so the states can't be merged.
+	script := Script{}
+	for i := 0; i < 13; i++ {
+		script = append(script, OP_IF)
+		script = append(script, PushNumberScript(int64(i+1))...)
+		script = append(script, OP_TOALTSTACK, OP_ENDIF)
+	}
+
+	if _, err := script.Analyze(); errors.Cause(err) != ErrScriptTooComplex {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrScriptTooComplex)
+	}
+}
@@ -0,0 +1,563 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ASM is the text form of script used by bitcoin-sv. Pushes of up to 4 bytes are shown as decimal
+//   numbers, larger pushes as hex, OP_0 as "0", OP_1NEGATE as "-1", and OP_1 through OP_16 as
+//   "1" through "16". Other op codes use their names.
+//
+//   The assembler accepts that form along with multiple lines, comments starting with "#" or "//",
+//   op code names with or without the "OP_" prefix, "0x" prefixed hex pushes, quoted text pushes,
+//   raw bytes in braces like "{0x4c05}", and signatures with a sig hash type suffix like
+//   "3044...01[ALL|FORKID]".
+//
+//   Macros are defined with ".macro <name>" and ".endm" and are expanded with "@<name>". A macro
+//   can be repeated with "@<name>*<count>". The total number of tokens expanded and the size of
+//   the assembled script are limited, so small text can't expand to a huge script.
+
+const (
+	// maxAsmMacroDepth is the maximum depth of macros expanding other macros.
+	maxAsmMacroDepth = 16
+
+	// maxAsmMacroRepeat is the maximum repeat count of a macro expansion.
+	maxAsmMacroRepeat = 10000
+
+	// maxAsmExpandedTokens is the maximum number of tokens, including macro expansions, that can
+	// be assembled. It prevents small text with nested repeated macros from taking a very long
+	// time to assemble.
+	maxAsmExpandedTokens = 1000000
+
+	// maxAsmScriptSize is the maximum size in bytes of an assembled script.
+	maxAsmScriptSize = 10000000
+
+	// maxAsmNumber is the maximum number shown as decimal, which is the largest 4 byte number.
+	maxAsmNumber = 0x7fffffff
+
+	asmIndent = "  "
+)
+
+var (
+	ErrInvalidAsm        = errors.New("Invalid ASM")
+	ErrUnknownAsmMacro   = errors.New("Unknown ASM Macro")
+	ErrAsmMacroTooDeep   = errors.New("ASM Macro Too Deep")
+	ErrDuplicateAsmMacro = errors.New("Duplicate ASM Macro")
+	ErrAsmTooLarge       = errors.New("ASM Too Large")
+
+	sigHashTypeNames = map[byte]string{
+		SigHashAll:                                          "ALL",
+		SigHashAll | SigHashAnyOneCanPay:                    "ALL|ANYONECANPAY",
+		SigHashAll | SigHashForkID:                          "ALL|FORKID",
+		SigHashAll | SigHashForkID | SigHashAnyOneCanPay:    "ALL|FORKID|ANYONECANPAY",
+		SigHashNone:                                         "NONE",
+		SigHashNone | SigHashAnyOneCanPay:                   "NONE|ANYONECANPAY",
+		SigHashNone | SigHashForkID:                         "NONE|FORKID",
+		SigHashNone | SigHashForkID | SigHashAnyOneCanPay:   "NONE|FORKID|ANYONECANPAY",
+		SigHashSingle:                                       "SINGLE",
+		SigHashSingle | SigHashAnyOneCanPay:                 "SINGLE|ANYONECANPAY",
+		SigHashSingle | SigHashForkID:                       "SINGLE|FORKID",
+		SigHashSingle | SigHashForkID | SigHashAnyOneCanPay: "SINGLE|FORKID|ANYONECANPAY",
+	}
+)
+
+// Assembler converts ASM text to script. Macros defined with DefineMacro are available to all
+// text assembled. Macros defined in the text are only available within that text.
+type Assembler struct {
+	macros map[string][]asmToken
+}
+
+type asmToken struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// NewAssembler returns an assembler with no macros defined.
+func NewAssembler() *Assembler {
+	return &Assembler{
+		macros: make(map[string][]asmToken),
+	}
+}
+
+// AsmToScript converts ASM text to script.
+func AsmToScript(text string) (Script, error) {
+	return NewAssembler().Assemble(text)
+}
+
+// DefineMacro defines a macro that can be used in all text assembled.
+func (a *Assembler) DefineMacro(name, text string) error {
+	if !isAsmMacroName(name) {
+		return errors.Wrapf(ErrInvalidAsm, "macro name \"%s\"", name)
+	}
+
+	if _, exists := a.macros[name]; exists {
+		return errors.Wrap(ErrDuplicateAsmMacro, name)
+	}
+
+	tokens, err := tokenizeAsm(text)
+	if err != nil {
+		return errors.Wrap(err, "tokenize")
+	}
+
+	for _, token := range tokens {
+		if !token.quoted && strings.HasPrefix(token.text, ".") {
+			return errors.Wrapf(ErrInvalidAsm, "line %d: directive in macro: %s", token.line,
+				token.text)
+		}
+	}
+
+	a.macros[name] = tokens
+	return nil
+}
+
+// Assemble converts ASM text to script.
+func (a *Assembler) Assemble(text string) (Script, error) {
+	tokens, err := tokenizeAsm(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "tokenize")
+	}
+
+	macros := make(map[string][]asmToken)
+	for name, body := range a.macros {
+		macros[name] = body
+	}
+
+	// Collect macro definitions.
+	var code []asmToken
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if token.quoted || token.text != ".macro" {
+			if !token.quoted && token.text == ".endm" {
+				return nil, errors.Wrapf(ErrInvalidAsm, "line %d: .endm without .macro",
+					token.line)
+			}
+			code = append(code, token)
+			continue
+		}
+
+		i++
+		if i == len(tokens) || tokens[i].quoted || !isAsmMacroName(tokens[i].text) {
+			return nil, errors.Wrapf(ErrInvalidAsm, "line %d: missing macro name", token.line)
+		}
+		name := tokens[i].text
+		if _, exists := macros[name]; exists {
+			return nil, errors.Wrapf(ErrDuplicateAsmMacro, "line %d: %s", token.line, name)
+		}
+
+		var body []asmToken
+		for {
+			i++
+			if i == len(tokens) {
+				return nil, errors.Wrapf(ErrInvalidAsm, "line %d: macro %s missing .endm",
+					token.line, name)
+			}
+
+			if !tokens[i].quoted && tokens[i].text == ".endm" {
+				break
+			}
+
+			if !tokens[i].quoted && tokens[i].text == ".macro" {
+				return nil, errors.Wrapf(ErrInvalidAsm, "line %d: nested macro",
+					tokens[i].line)
+			}
+
+			body = append(body, tokens[i])
+		}
+
+		macros[name] = body
+	}
+
+	out := &asmOutput{}
+	if err := assembleAsmTokens(out, code, macros, 0); err != nil {
+		return nil, err
+	}
+
+	return Script(out.buf.Bytes()), nil
+}
+
+// asmOutput is the script being assembled and the number of tokens expanded into it.
+type asmOutput struct {
+	buf        bytes.Buffer
+	tokenCount int
+}
+
+// addToken counts a token, or an expansion of a macro, and returns an error when the limit is
+// exceeded.
+func (out *asmOutput) addToken(token asmToken) error {
+	out.tokenCount++
+	if out.tokenCount > maxAsmExpandedTokens {
+		return errors.Wrapf(ErrAsmTooLarge, "line %d: more than %d tokens", token.line,
+			maxAsmExpandedTokens)
+	}
+	return nil
+}
+
+func assembleAsmTokens(out *asmOutput, tokens []asmToken, macros map[string][]asmToken,
+	depth int) error {
+
+	for _, token := range tokens {
+		if token.quoted || !strings.HasPrefix(token.text, "@") {
+			if err := out.addToken(token); err != nil {
+				return err
+			}
+
+			if err := writeAsmToken(&out.buf, token); err != nil {
+				return errors.Wrapf(err, "line %d", token.line)
+			}
+
+			if out.buf.Len() > maxAsmScriptSize {
+				return errors.Wrapf(ErrAsmTooLarge, "line %d: more than %d bytes", token.line,
+					maxAsmScriptSize)
+			}
+			continue
+		}
+
+		name := token.text[1:]
+		count := 1
+		if index := strings.IndexByte(name, '*'); index != -1 {
+			c, err := strconv.Atoi(name[index+1:])
+			if err != nil || c < 0 || c > maxAsmMacroRepeat {
+				return errors.Wrapf(ErrInvalidAsm, "line %d: macro repeat count: %s", token.line,
+					token.text)
+			}
+			count = c
+			name = name[:index]
+		}
+
+		body, exists := macros[name]
+		if !exists {
+			return errors.Wrapf(ErrUnknownAsmMacro, "line %d: %s", token.line, name)
+		}
+
+		if depth == maxAsmMacroDepth {
+			return errors.Wrapf(ErrAsmMacroTooDeep, "line %d: %s", token.line, name)
+		}
+
+		for i := 0; i < count; i++ {
+			// Count each expansion so macros with empty bodies are limited too.
+			if err := out.addToken(token); err != nil {
+				return err
+			}
+
+			if err := assembleAsmTokens(out, body, macros, depth+1); err != nil {
+				return errors.Wrap(err, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// writeAsmToken writes the script for an ASM token.
+func writeAsmToken(w io.Writer, token asmToken) error {
+	text := token.text
+	if token.quoted {
+		return WritePushDataScript(w, []byte(text))
+	}
+
+	// Raw bytes
+	if len(text) >= 2 && text[0] == '{' && text[len(text)-1] == '}' {
+		b, err := hex.DecodeString(strings.TrimPrefix(text[1:len(text)-1], "0x"))
+		if err != nil {
+			return errors.Wrapf(ErrInvalidAsm, "raw hex: %s", text)
+		}
+
+		_, err = w.Write(b)
+		return err
+	}
+
+	// Push data hex
+	if strings.HasPrefix(text, "0x") {
+		b, err := hex.DecodeString(text[2:])
+		if err != nil {
+			return errors.Wrapf(ErrInvalidAsm, "push data hex: %s", text)
+		}
+
+		return WritePushDataScript(w, b)
+	}
+
+	// Signature with sig hash type
+	if index := strings.IndexByte(text, '['); index != -1 && text[len(text)-1] == ']' {
+		b, err := hex.DecodeString(text[:index])
+		if err != nil {
+			return errors.Wrapf(ErrInvalidAsm, "signature hex: %s", text)
+		}
+
+		hashType, exists := sigHashTypeFromName(text[index+1 : len(text)-1])
+		if !exists {
+			return errors.Wrapf(ErrInvalidAsm, "sig hash type: %s", text)
+		}
+
+		return WritePushDataScript(w, append(b, hashType))
+	}
+
+	// Op code names
+	if opCode, exists := byteFromNames[text]; exists {
+		_, err := w.Write([]byte{opCode})
+		return err
+	}
+	if !strings.HasPrefix(text, "OP_") {
+		if opCode, exists := byteFromNames["OP_"+text]; exists {
+			_, err := w.Write([]byte{opCode})
+			return err
+		}
+	}
+
+	// Numbers have priority over hex when they are written the way bitcoin-sv shows pushes of up to
+	// 4 bytes. Other digits, like those with leading zeros, are hex.
+	number, numberErr := strconv.ParseInt(text, 10, 64)
+	if numberErr == nil && number <= maxAsmNumber && number >= -maxAsmNumber &&
+		strconv.FormatInt(number, 10) == text {
+		return PushNumberScriptItem(number).Write(w)
+	}
+
+	if len(text)%2 == 0 {
+		if b, err := hex.DecodeString(text); err == nil {
+			return WritePushDataScript(w, b)
+		}
+	}
+
+	if numberErr == nil {
+		return PushNumberScriptItem(number).Write(w)
+	}
+
+	return errors.Wrapf(ErrInvalidAsm, "unknown token: %s", text)
+}
+
+func sigHashTypeFromName(name string) (byte, bool) {
+	for hashType, n := range sigHashTypeNames {
+		if n == name {
+			return hashType, true
+		}
+	}
+
+	return 0, false
+}
+
+// tokenizeAsm splits ASM text into tokens, removing comments.
+func tokenizeAsm(text string) ([]asmToken, error) {
+	var result []asmToken
+	line := 1
+	for i := 0; i < len(text); {
+		c := text[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+
+		case c == '#' || (c == '/' && i+1 < len(text) && text[i+1] == '/'):
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+
+		case c == '"' || c == '\'':
+			end := strings.IndexByte(text[i+1:], c)
+			if end == -1 {
+				return nil, errors.Wrapf(ErrInvalidAsm, "line %d: unterminated text", line)
+			}
+
+			value := text[i+1 : i+1+end]
+			if strings.IndexByte(value, '\n') != -1 {
+				return nil, errors.Wrapf(ErrInvalidAsm, "line %d: unterminated text", line)
+			}
+
+			result = append(result, asmToken{text: value, line: line, quoted: true})
+			i += end + 2
+
+		default:
+			start := i
+			for i < len(text) && !isAsmSeparator(text[i]) {
+				i++
+			}
+			result = append(result, asmToken{text: text[start:i], line: line})
+		}
+	}
+
+	return result, nil
+}
+
+func isAsmSeparator(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', '#', '"', '\'':
+		return true
+	}
+	return false
+}
+
+func isAsmMacroName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	for _, c := range []byte(name) {
+		if !isLetterChar(c) && !isNumberChar(c) && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ScriptToAsm converts script to the ASM form used by bitcoin-sv. Undefined op codes are shown as
+// "{0x..}" so they can be assembled. If the script is invalid then "[error]" is appended to the
+// valid part.
+//
+// Like bitcoin-sv, pushes of up to 4 bytes are shown as numbers, so script with pushes that aren't
+// minimally encoded numbers doesn't assemble to the same bytes. Use ScriptToPrettyAsm when that is
+// needed.
+func ScriptToAsm(script Script) string {
+	return scriptToAsm(script, false)
+}
+
+// UnlockingScriptToAsm converts script to ASM like ScriptToAsm, but pushes that are signatures are
+// shown in hex with the sig hash type after them like "3044...[ALL|FORKID]".
+func UnlockingScriptToAsm(script Script) string {
+	return scriptToAsm(script, true)
+}
+
+func scriptToAsm(script Script, decodeSigHash bool) string {
+	var result []string
+	buf := bytes.NewReader(script)
+	for buf.Len() > 0 {
+		item, err := ParseScript(buf)
+		if err != nil {
+			result = append(result, "[error]")
+			break
+		}
+
+		result = append(result, asmItemText(item, decodeSigHash))
+	}
+
+	return strings.Join(result, " ")
+}
+
+// asmItemText returns the bitcoin-sv ASM text of a script item.
+func asmItemText(item *ScriptItem, decodeSigHash bool) string {
+	if item.Type == ScriptItemTypePushData {
+		if len(item.Data) <= 4 {
+			if len(item.Data) == 0 {
+				return "0"
+			}
+			value, _ := DecodeScriptLittleEndian(item.Data)
+			return strconv.FormatInt(value, 10)
+		}
+
+		if decodeSigHash && isSignatureWithHashType(item.Data) {
+			hashType := item.Data[len(item.Data)-1]
+			return hex.EncodeToString(item.Data[:len(item.Data)-1]) + "[" +
+				sigHashTypeNames[hashType] + "]"
+		}
+
+		return hex.EncodeToString(item.Data)
+	}
+
+	switch {
+	case item.OpCode == OP_0:
+		return "0"
+	case item.OpCode == OP_1NEGATE:
+		return "-1"
+	case item.OpCode >= OP_1 && item.OpCode <= OP_16:
+		return strconv.Itoa(int(item.OpCode-OP_1) + 1)
+	}
+
+	return OpCodeToString(item.OpCode)
+}
+
+// isSignatureWithHashType returns true if the data is a DER encoded signature followed by a
+// defined sig hash type.
+func isSignatureWithHashType(b []byte) bool {
+	if len(b) < 9 {
+		return false
+	}
+
+	if _, exists := sigHashTypeNames[b[len(b)-1]]; !exists {
+		return false
+	}
+
+	// The DER length must cover all but the hash type.
+	if int(b[1])+3 != len(b) {
+		return false
+	}
+
+	_, err := SignatureFromBytes(b[:len(b)-1])
+	return err == nil
+}
+
+// ScriptToPrettyAsm converts script to ASM with one item per line and the contents of
+// OP_IF/OP_NOTIF, OP_ELSE, and OP_ENDIF indented. Unlike ScriptToAsm it always assembles back to
+// the same bytes. Items that wouldn't are shown as "0x" push data or raw bytes.
+func ScriptToPrettyAsm(script Script) string {
+	var lines []string
+	depth := 0
+	buf := bytes.NewReader(script)
+	for buf.Len() > 0 {
+		offset := len(script) - buf.Len()
+		item, err := ParseScript(buf)
+		if err != nil {
+			// Show the remaining bytes as raw so nothing is lost.
+			lines = append(lines, prettyAsmLine(depth,
+				fmt.Sprintf("{0x%s}", hex.EncodeToString(script[offset:]))))
+			break
+		}
+		raw := script[offset : len(script)-buf.Len()]
+
+		if item.Type == ScriptItemTypeOpCode {
+			switch item.OpCode {
+			case OP_ELSE:
+				lines = append(lines, prettyAsmLine(depth-1, asmItemText(item, false)))
+				continue
+			case OP_ENDIF:
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+
+		lines = append(lines, prettyAsmLine(depth, losslessAsmItemText(item, raw)))
+
+		if item.Type == ScriptItemTypeOpCode {
+			switch item.OpCode {
+			case OP_IF, OP_NOTIF, OP_VERIF, OP_VERNOTIF:
+				depth++
+			}
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// losslessAsmItemText returns the ASM text of an item that assembles to the raw bytes of the item.
+func losslessAsmItemText(item *ScriptItem, raw []byte) string {
+	candidates := []string{asmItemText(item, true)}
+	if item.Type == ScriptItemTypePushData {
+		candidates = append(candidates, "0x"+hex.EncodeToString(item.Data))
+	}
+
+	for _, text := range candidates {
+		buf := &bytes.Buffer{}
+		if err := writeAsmToken(buf, asmToken{text: text}); err == nil &&
+			bytes.Equal(buf.Bytes(), raw) {
+			return text
+		}
+	}
+
+	return fmt.Sprintf("{0x%s}", hex.EncodeToString(raw))
+}
+
+func prettyAsmLine(depth int, text string) string {
+	if depth < 0 {
+		depth = 0
+	}
+	return strings.Repeat(asmIndent, depth) + text
+}
@@ -0,0 +1,322 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_ScriptToAsm(t *testing.T) {
+	pkh, _ := hex.DecodeString("e3b0c44298fc1c149afbf4c8996fb92427ae41e4")
+
+	tests := []struct {
+		name   string
+		script Script
+		asm    string
+	}{
+		{
+			name:   "p2pkh",
+			script: ConcatScript(OP_DUP, OP_HASH160, PushData(pkh), OP_EQUALVERIFY, OP_CHECKSIG),
+			asm:    "OP_DUP OP_HASH160 e3b0c44298fc1c149afbf4c8996fb92427ae41e4 OP_EQUALVERIFY OP_CHECKSIG",
+		},
+		{
+			name:   "small numbers",
+			script: Script{OP_0, OP_1NEGATE, OP_1, OP_16, OP_FALSE, OP_RETURN},
+			asm:    "0 -1 1 16 0 OP_RETURN",
+		},
+		{
+			name: "number pushes",
+			script: ConcatScript(PushNumberScript(17), PushNumberScript(-500),
+				PushNumberScript(800000)),
+			asm: "17 -500 800000",
+		},
+		{
+			name:   "non-minimal number push",
+			script: Script{0x01, 0x05, 0x02, 0x00, 0x00},
+			asm:    "5 0",
+		},
+		{
+			name:   "five byte push",
+			script: Script{0x05, 0x01, 0x02, 0x03, 0x04, 0x05},
+			asm:    "0102030405",
+		},
+		{
+			name:   "undefined op code",
+			script: Script{0xba, OP_NOP},
+			asm:    "{0xba} OP_NOP",
+		},
+		{
+			name:   "invalid",
+			script: Script{OP_DUP, 0x05, 0x01},
+			asm:    "OP_DUP [error]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			asm := ScriptToAsm(tt.script)
+			t.Logf("ASM : %s", asm)
+
+			if asm != tt.asm {
+				t.Fatalf("Wrong asm : \n  got  : %s\n  want : %s", asm, tt.asm)
+			}
+		})
+	}
+}
+
+func Test_AsmToScript(t *testing.T) {
+	pkh, _ := hex.DecodeString("e3b0c44298fc1c149afbf4c8996fb92427ae41e4")
+	p2pkh := ConcatScript(OP_DUP, OP_HASH160, PushData(pkh), OP_EQUALVERIFY, OP_CHECKSIG)
+
+	tests := []struct {
+		name   string
+		text   string
+		script Script
+	}{
+		{
+			name:   "bitcoin-sv asm",
+			text:   "OP_DUP OP_HASH160 e3b0c44298fc1c149afbf4c8996fb92427ae41e4 OP_EQUALVERIFY OP_CHECKSIG",
+			script: p2pkh,
+		},
+		{
+			name: "multi line with comments",
+			text: `# pay to public key hash
+				DUP HASH160 // no OP_ prefix
+				0xe3b0c44298fc1c149afbf4c8996fb92427ae41e4
+				EQUALVERIFY CHECKSIG # end`,
+			script: p2pkh,
+		},
+		{
+			name: "numbers",
+			text: "0 OP_0 OP_FALSE -1 1 16 17 -500 800000",
+			script: ConcatScript(OP_0, OP_0, OP_0, OP_1NEGATE, OP_1, OP_16, PushNumberScript(17),
+				PushNumberScript(-500), PushNumberScript(800000)),
+		},
+		{
+			name: "text",
+			text: `OP_FALSE OP_RETURN "text # not a comment" 'single'`,
+			script: ConcatScript(OP_FALSE, OP_RETURN, PushData([]byte("text # not a comment")),
+				PushData([]byte("single"))),
+		},
+		{
+			name:   "digit hex",
+			text:   "0000000000000000000000000000000000000000 0120",
+			script: ConcatScript(PushData(make([]byte, 20)), PushData([]byte{0x01, 0x20})),
+		},
+		{
+			name:   "raw bytes",
+			text:   "{0x4c0105} {ba}",
+			script: Script{0x4c, 0x01, 0x05, 0xba},
+		},
+		{
+			name: "macros",
+			text: `.macro check_pkh
+					OP_DUP OP_HASH160 e3b0c44298fc1c149afbf4c8996fb92427ae41e4 OP_EQUALVERIFY
+				.endm
+				.macro swap_cat
+					OP_SWAP OP_CAT
+				.endm
+				@check_pkh OP_CHECKSIG
+				@swap_cat*3 @swap_cat*0`,
+			script: ConcatScript(p2pkh, OP_SWAP, OP_CAT, OP_SWAP, OP_CAT, OP_SWAP, OP_CAT),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := AsmToScript(tt.text)
+			if err != nil {
+				t.Fatalf("Failed to assemble : %s", err)
+			}
+
+			if !bytes.Equal(script, tt.script) {
+				t.Fatalf("Wrong script : \n  got  : %s\n  want : %s", script, tt.script)
+			}
+		})
+	}
+}
+
+func Test_AsmToScriptErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		err  error
+	}{
+		{"unknown token", "OP_DUP OP_NOTANOPCODE", ErrInvalidAsm},
+		{"odd hex", "0x123", ErrInvalidAsm},
+		{"unterminated text", "\"text", ErrInvalidAsm},
+		{"unknown macro", "@missing", ErrUnknownAsmMacro},
+		{"missing endm", ".macro name OP_DUP", ErrInvalidAsm},
+		{"endm without macro", "OP_DUP .endm", ErrInvalidAsm},
+		{"nested macro", ".macro a .macro b .endm .endm", ErrInvalidAsm},
+		{"duplicate macro", ".macro a OP_DUP .endm .macro a OP_DROP .endm", ErrDuplicateAsmMacro},
+		{"recursive macro", ".macro a @a .endm @a", ErrAsmMacroTooDeep},
+		{"bad repeat", ".macro a OP_DUP .endm @a*x", ErrInvalidAsm},
+		{"bad sig hash type", "3006020101020101[ANY]", ErrInvalidAsm},
+		{"too many tokens", ".macro a OP_NOP .endm .macro b @a*10000 .endm @b*101",
+			ErrAsmTooLarge},
+		{"too many empty expansions", ".macro e .endm .macro a @e*10000 .endm " +
+			".macro b @a*10000 .endm @b", ErrAsmTooLarge},
+		{"too many bytes", ".macro a 0x" + strings.Repeat("ab", 1000) + " .endm " +
+			".macro b @a*10000 .endm @b*2", ErrAsmTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := AsmToScript(tt.text)
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("Wrong error : got %v, want %s", err, tt.err)
+			}
+			t.Logf("Error : %s", err)
+		})
+	}
+}
+
+func Test_AssemblerDefineMacro(t *testing.T) {
+	assembler := NewAssembler()
+	if err := assembler.DefineMacro("reverse2", "OP_1 OP_SPLIT OP_SWAP OP_CAT"); err != nil {
+		t.Fatalf("Failed to define macro : %s", err)
+	}
+
+	err := assembler.DefineMacro("reverse2", "OP_DROP")
+	if errors.Cause(err) != ErrDuplicateAsmMacro {
+		t.Fatalf("Wrong error for duplicate macro : %v", err)
+	}
+
+	if err := assembler.DefineMacro("bad name", "OP_DROP"); errors.Cause(err) != ErrInvalidAsm {
+		t.Fatalf("Wrong error for bad macro name : %v", err)
+	}
+
+	script, err := assembler.Assemble("0x0102 @reverse2")
+	if err != nil {
+		t.Fatalf("Failed to assemble : %s", err)
+	}
+
+	want := ConcatScript(PushData([]byte{0x01, 0x02}), OP_1, OP_SPLIT, OP_SWAP, OP_CAT)
+	if !bytes.Equal(script, want) {
+		t.Fatalf("Wrong script : \n  got  : %s\n  want : %s", script, want)
+	}
+
+	// Macros defined in text aren't kept by the assembler.
+	if _, err := assembler.Assemble(".macro local OP_DUP .endm @local"); err != nil {
+		t.Fatalf("Failed to assemble : %s", err)
+	}
+	if _, err := assembler.Assemble("@local"); errors.Cause(err) != ErrUnknownAsmMacro {
+		t.Fatalf("Wrong error for text macro : %v", err)
+	}
+}
+
+func Test_UnlockingScriptToAsm(t *testing.T) {
+	key, err := GenerateKey(MainNet)
+	if err != nil {
+		t.Fatalf("Failed to generate key : %s", err)
+	}
+
+	var hash Hash32
+	sig, err := key.Sign(hash)
+	if err != nil {
+		t.Fatalf("Failed to sign : %s", err)
+	}
+
+	sigBytes := append(sig.Bytes(), SigHashAll|SigHashForkID)
+	publicKey := key.PublicKey().Bytes()
+	script := ConcatScript(PushData(sigBytes), PushData(publicKey))
+
+	asm := UnlockingScriptToAsm(script)
+	t.Logf("ASM : %s", asm)
+
+	want := hex.EncodeToString(sig.Bytes()) + "[ALL|FORKID] " + hex.EncodeToString(publicKey)
+	if asm != want {
+		t.Fatalf("Wrong asm : \n  got  : %s\n  want : %s", asm, want)
+	}
+
+	want = hex.EncodeToString(sigBytes) + " " + hex.EncodeToString(publicKey)
+	if asm := ScriptToAsm(script); asm != want {
+		t.Fatalf("Wrong asm without sig hash : \n  got  : %s\n  want : %s", asm, want)
+	}
+
+	assembled, err := AsmToScript(UnlockingScriptToAsm(script))
+	if err != nil {
+		t.Fatalf("Failed to assemble : %s", err)
+	}
+
+	if !bytes.Equal(assembled, script) {
+		t.Fatalf("Wrong script : \n  got  : %s\n  want : %s", assembled, script)
+	}
+}
+
+func Test_ScriptToPrettyAsm(t *testing.T) {
+	script, err := AsmToScript(`
+		OP_IF
+			OP_DUP OP_HASH160 e3b0c44298fc1c149afbf4c8996fb92427ae41e4 OP_EQUALVERIFY
+		OP_ELSE
+			OP_NOTIF 800000 OP_ENDIF
+		OP_ENDIF
+		OP_CHECKSIG`)
+	if err != nil {
+		t.Fatalf("Failed to assemble : %s", err)
+	}
+
+	pretty := ScriptToPrettyAsm(script)
+	t.Logf("Pretty ASM :\n%s", pretty)
+
+	want := strings.Join([]string{
+		"OP_IF",
+		"  OP_DUP",
+		"  OP_HASH160",
+		"  e3b0c44298fc1c149afbf4c8996fb92427ae41e4",
+		"  OP_EQUALVERIFY",
+		"OP_ELSE",
+		"  OP_NOTIF",
+		"    800000",
+		"  OP_ENDIF",
+		"OP_ENDIF",
+		"OP_CHECKSIG",
+	}, "\n")
+
+	if pretty != want {
+		t.Fatalf("Wrong pretty asm : \n%s\nwant :\n%s", pretty, want)
+	}
+}
+
+func Test_ScriptToPrettyAsmRoundTrip(t *testing.T) {
+	values := TemplateValues{}
+	values.SetLockTime("lock_time", 800000)
+	values.SetHash20("pkh", Hash20{})
+	lockTimeScript, err := LockTimeScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		script Script
+	}{
+		{"lock time template", lockTimeScript},
+		{"non-minimal number", Script{0x01, 0x05, 0x04, 0x00, 0x00, 0x00, 0x80}},
+		{"non-minimal push op", Script{0x4c, 0x02, 0x01, 0x02, 0x4d, 0x00, 0x00}},
+		{"numeric hex", Script{0x05, 0x12, 0x34, 0x56, 0x78, 0x90}},
+		{"unbalanced", Script{OP_ENDIF, OP_ELSE, OP_IF}},
+		{"undefined op code", Script{0xba, 0xff}},
+		{"invalid", Script{OP_DUP, 0x05, 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pretty := ScriptToPrettyAsm(tt.script)
+
+			script, err := AsmToScript(pretty)
+			if err != nil {
+				t.Fatalf("Failed to assemble : %s", err)
+			}
+
+			if !bytes.Equal(script, tt.script) {
+				t.Fatalf("Wrong script : \n  got  : %x\n  want : %x", []byte(script),
+					[]byte(tt.script))
+			}
+		})
+	}
+}
@@ -0,0 +1,525 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Script templates are locking scripts with named parameters in place of the values that are
+//   specific to each locking script. They are written in the text form used by StringToScript
+//   with parameters in the form <name:type>, for example:
+//
+//   OP_DUP OP_HASH160 <pkh:hash20> OP_EQUALVERIFY OP_CHECKSIG
+//
+//   A parameter name can be used more than once, in which case all of its uses have the same
+//   value. A locking script can be parsed back into the template's parameter values with Parse.
+
+const (
+	TemplateParamTypeHash20    = TemplateParamType(0x01) // 20 byte push
+	TemplateParamTypeHash32    = TemplateParamType(0x02) // 32 byte push
+	TemplateParamTypePublicKey = TemplateParamType(0x03) // compressed public key push
+	TemplateParamTypeNumber    = TemplateParamType(0x04) // minimally encoded script number
+	TemplateParamTypeLockTime  = TemplateParamType(0x05) // script number from 0 to 0xffffffff
+	TemplateParamTypeData      = TemplateParamType(0x06) // any push data
+)
+
+var (
+	ErrMissingTemplateValue     = errors.New("Missing Template Value")
+	ErrInvalidTemplateValue     = errors.New("Invalid Template Value")
+	ErrInvalidTemplateParam     = errors.New("Invalid Template Parameter")
+	ErrUnknownTemplateParamType = errors.New("Unknown Template Parameter Type")
+
+	templateParamTypeNames = map[TemplateParamType]string{
+		TemplateParamTypeHash20:    "hash20",
+		TemplateParamTypeHash32:    "hash32",
+		TemplateParamTypePublicKey: "pubkey",
+		TemplateParamTypeNumber:    "number",
+		TemplateParamTypeLockTime:  "locktime",
+		TemplateParamTypeData:      "data",
+	}
+
+	PKHScriptTemplate = mustParseScriptTemplate("P2PKH",
+		"OP_DUP OP_HASH160 <pkh:hash20> OP_EQUALVERIFY OP_CHECKSIG")
+
+	PKScriptTemplate = mustParseScriptTemplate("P2PK", "<pubkey:pubkey> OP_CHECKSIG")
+
+	// HashPuzzleScriptTemplate can be unlocked by anyone that knows the preimage of the hash.
+	// Since the preimage is revealed when the transaction is broadcast use HashLockScriptTemplate
+	// unless that is intended.
+	HashPuzzleScriptTemplate = mustParseScriptTemplate("HashPuzzle",
+		"OP_SHA256 <hash:hash32> OP_EQUAL")
+
+	// HashLockScriptTemplate requires both the preimage of the hash and a signature for the public
+	// key hash.
+	HashLockScriptTemplate = mustParseScriptTemplate("HashLock",
+		"OP_SHA256 <hash:hash32> OP_EQUALVERIFY "+
+			"OP_DUP OP_HASH160 <pkh:hash20> OP_EQUALVERIFY OP_CHECKSIG")
+
+	// RPuzzleScriptTemplate requires a signature with the R value, from a specific nonce, that
+	// hashes to the R puzzle hash. It is the same as an RPH raw address.
+	RPuzzleScriptTemplate = mustParseScriptTemplate("RPuzzle",
+		"OP_DUP OP_3 OP_SPLIT OP_NIP OP_1 OP_SPLIT OP_SWAP OP_SPLIT OP_DROP "+
+			"OP_HASH160 <rhash:hash20> OP_EQUALVERIFY OP_SWAP OP_CHECKSIG")
+
+	// LockTimeScriptTemplate requires a signature for the public key hash in a transaction with a
+	// lock time at or after the lock time parameter. See lockTimeScriptTemplateText.
+	LockTimeScriptTemplate = mustParseScriptTemplate("LockTime", lockTimeScriptTemplateText())
+
+	// OrdinalScriptTemplate is a 1Sat ordinal inscription envelope followed by P2PKH.
+	OrdinalScriptTemplate = mustParseScriptTemplate("Ordinal",
+		"OP_0 OP_IF \"ord\" OP_1 <content_type:data> OP_0 <content:data> OP_ENDIF "+
+			"OP_DUP OP_HASH160 <pkh:hash20> OP_EQUALVERIFY OP_CHECKSIG")
+
+	// ScriptTemplates are the templates used by MatchScriptTemplate by default.
+	ScriptTemplates = []*ScriptTemplate{
+		PKHScriptTemplate,
+		PKScriptTemplate,
+		HashPuzzleScriptTemplate,
+		HashLockScriptTemplate,
+		RPuzzleScriptTemplate,
+		LockTimeScriptTemplate,
+		OrdinalScriptTemplate,
+	}
+)
+
+type TemplateParamType uint8
+
+// TemplateParam is a named placeholder for a value in a script template.
+type TemplateParam struct {
+	Name string
+	Type TemplateParamType
+}
+
+// ScriptTemplate is a locking script with named parameters.
+type ScriptTemplate struct {
+	Name string
+
+	items  ScriptItems
+	params []*TemplateParam // parameter for each item, nil for fixed items
+}
+
+// TemplateValues holds the values of the parameters of a script template as the script items
+// that are put in the locking script.
+type TemplateValues map[string]*ScriptItem
+
+// ParseScriptTemplate parses the text form of a script template.
+func ParseScriptTemplate(name, text string) (*ScriptTemplate, error) {
+	result := &ScriptTemplate{Name: name}
+	paramTypes := make(map[string]TemplateParamType)
+
+	var fixed []string
+	flush := func() error {
+		if len(fixed) == 0 {
+			return nil
+		}
+
+		script, err := StringToScript(strings.Join(fixed, " "))
+		if err != nil {
+			return err
+		}
+		fixed = nil
+
+		items, err := ParseScriptItems(bytes.NewReader(script), -1)
+		if err != nil {
+			return errors.Wrap(err, "parse items")
+		}
+
+		for _, item := range items {
+			result.items = append(result.items, item)
+			result.params = append(result.params, nil)
+		}
+		return nil
+	}
+
+	for _, part := range strings.Fields(text) {
+		if len(part) < 2 || part[0] != '<' || part[len(part)-1] != '>' {
+			fixed = append(fixed, part)
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return nil, err
+		}
+
+		param, err := parseTemplateParam(part[1 : len(part)-1])
+		if err != nil {
+			return nil, errors.Wrap(err, part)
+		}
+
+		if typ, exists := paramTypes[param.Name]; exists && typ != param.Type {
+			return nil, errors.Wrapf(ErrInvalidTemplateParam, "%s: conflicting types %s and %s",
+				param.Name, typ, param.Type)
+		}
+		paramTypes[param.Name] = param.Type
+
+		result.items = append(result.items, nil)
+		result.params = append(result.params, param)
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func mustParseScriptTemplate(name, text string) *ScriptTemplate {
+	result, err := ParseScriptTemplate(name, text)
+	if err != nil {
+		panic(fmt.Sprintf("script template %s : %s", name, err))
+	}
+	return result
+}
+
+func parseTemplateParam(s string) (*TemplateParam, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 || len(parts[0]) == 0 {
+		return nil, errors.Wrap(ErrInvalidTemplateParam, "should be <name:type>")
+	}
+
+	for typ, name := range templateParamTypeNames {
+		if name == parts[1] {
+			return &TemplateParam{Name: parts[0], Type: typ}, nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrUnknownTemplateParamType, parts[1])
+}
+
+// Params returns the parameters of the template in the order they first appear.
+func (t ScriptTemplate) Params() []TemplateParam {
+	var result []TemplateParam
+	used := make(map[string]bool)
+	for _, param := range t.params {
+		if param == nil || used[param.Name] {
+			continue
+		}
+
+		used[param.Name] = true
+		result = append(result, *param)
+	}
+
+	return result
+}
+
+// LockingScript creates a locking script from the template with the specified parameter values.
+func (t ScriptTemplate) LockingScript(values TemplateValues) (Script, error) {
+	buf := &bytes.Buffer{}
+	for i, item := range t.items {
+		if param := t.params[i]; param != nil {
+			value, exists := values[param.Name]
+			if !exists {
+				return nil, errors.Wrap(ErrMissingTemplateValue, param.Name)
+			}
+
+			if err := param.check(value); err != nil {
+				return nil, errors.Wrap(err, param.Name)
+			}
+
+			item = value
+		}
+
+		if err := item.Write(buf); err != nil {
+			return nil, errors.Wrapf(err, "item %d", i)
+		}
+	}
+
+	return Script(buf.Bytes()), nil
+}
+
+// Parse returns the parameter values of a locking script created from the template. It returns
+// ErrWrongScriptTemplate if the locking script doesn't match the template.
+func (t ScriptTemplate) Parse(lockingScript Script) (TemplateValues, error) {
+	items, err := ParseScriptItems(bytes.NewReader(lockingScript), -1)
+	if err != nil {
+		return nil, errors.Wrap(ErrWrongScriptTemplate, err.Error())
+	}
+
+	if len(items) != len(t.items) {
+		return nil, errors.Wrapf(ErrWrongScriptTemplate, "%d items should be %d", len(items),
+			len(t.items))
+	}
+
+	result := make(TemplateValues)
+	for i, item := range items {
+		param := t.params[i]
+		if param == nil {
+			if !item.Equal(*t.items[i]) {
+				return nil, errors.Wrapf(ErrWrongScriptTemplate, "item %d: %s should be %s", i,
+					item, t.items[i])
+			}
+			continue
+		}
+
+		if err := param.check(item); err != nil {
+			return nil, errors.Wrapf(ErrWrongScriptTemplate, "item %d: %s: %s", i, param.Name,
+				err)
+		}
+
+		if previous, exists := result[param.Name]; exists && !previous.Equal(*item) {
+			return nil, errors.Wrapf(ErrWrongScriptTemplate, "item %d: %s: conflicting values",
+				i, param.Name)
+		}
+
+		result[param.Name] = item
+	}
+
+	return result, nil
+}
+
+// MatchScriptTemplate returns the first template that the locking script matches and its
+// parameter values. The built in templates are used when templates is empty.
+func MatchScriptTemplate(lockingScript Script,
+	templates ...*ScriptTemplate) (*ScriptTemplate, TemplateValues, error) {
+
+	if len(templates) == 0 {
+		templates = ScriptTemplates
+	}
+
+	for _, template := range templates {
+		if values, err := template.Parse(lockingScript); err == nil {
+			return template, values, nil
+		}
+	}
+
+	return nil, nil, ErrUnknownScriptTemplate
+}
+
+// String returns the text form of the template. Unlike ScriptToString, push data is written as
+// hex unless it is simple text so the text always converts back to the same template.
+func (t ScriptTemplate) String() string {
+	var result []string
+	for i, item := range t.items {
+		if param := t.params[i]; param != nil {
+			result = append(result, fmt.Sprintf("<%s:%s>", param.Name, param.Type))
+			continue
+		}
+
+		if item.Type == ScriptItemTypePushData {
+			if isText(item.Data) && !bytes.Contains(item.Data, []byte(" ")) {
+				result = append(result, fmt.Sprintf("\"%s\"", string(item.Data)))
+			} else {
+				result = append(result, "0x"+hex.EncodeToString(item.Data))
+			}
+			continue
+		}
+
+		result = append(result, item.String())
+	}
+
+	return strings.Join(result, " ")
+}
+
+// MarshalText returns the text encoding of the template.
+// Implements encoding.TextMarshaler interface.
+func (t ScriptTemplate) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText parses a text encoded template and sets the value of this object.
+// Implements encoding.TextUnmarshaler interface.
+func (t *ScriptTemplate) UnmarshalText(text []byte) error {
+	result, err := ParseScriptTemplate(t.Name, string(text))
+	if err != nil {
+		return err
+	}
+
+	*t = *result
+	return nil
+}
+
+func (v TemplateParamType) String() string {
+	if name, exists := templateParamTypeNames[v]; exists {
+		return name
+	}
+
+	return fmt.Sprintf("unknown(%d)", uint8(v))
+}
+
+// check returns an error if the script item isn't a valid value for the parameter.
+func (p TemplateParam) check(item *ScriptItem) error {
+	switch p.Type {
+	case TemplateParamTypeHash20:
+		if item.Type != ScriptItemTypePushData || len(item.Data) != Hash20Size {
+			return errors.Wrap(ErrInvalidTemplateValue, "not a 20 byte push")
+		}
+
+	case TemplateParamTypeHash32:
+		if item.Type != ScriptItemTypePushData || len(item.Data) != Hash32Size {
+			return errors.Wrap(ErrInvalidTemplateValue, "not a 32 byte push")
+		}
+
+	case TemplateParamTypePublicKey:
+		if item.Type != ScriptItemTypePushData || !isPublicKey(item.Data) {
+			return errors.Wrap(ErrInvalidTemplateValue, "not a public key")
+		}
+
+	case TemplateParamTypeNumber:
+		if _, err := minimalScriptNumber(item); err != nil {
+			return err
+		}
+
+	case TemplateParamTypeLockTime:
+		value, err := minimalScriptNumber(item)
+		if err != nil {
+			return err
+		}
+
+		if value < 0 || value > 0xffffffff {
+			return errors.Wrapf(ErrInvalidTemplateValue, "lock time out of range : %d", value)
+		}
+
+	case TemplateParamTypeData:
+		if item.Type != ScriptItemTypePushData &&
+			!(item.Type == ScriptItemTypeOpCode && item.OpCode == OP_0) {
+			return errors.Wrap(ErrInvalidTemplateValue, "not push data")
+		}
+
+	default:
+		return errors.Wrapf(ErrUnknownTemplateParamType, "%d", p.Type)
+	}
+
+	return nil
+}
+
+// minimalScriptNumber returns the value of a script item that is a minimally encoded number.
+func minimalScriptNumber(item *ScriptItem) (int64, error) {
+	if item.Type == ScriptItemTypePushData && len(item.Data) == 0 {
+		return 0, errors.Wrap(ErrInvalidTemplateValue, "empty number push")
+	}
+
+	value, err := ScriptNumberValue(item)
+	if err != nil {
+		return 0, errors.Wrap(ErrInvalidTemplateValue, err.Error())
+	}
+
+	script, _ := item.Script()
+	minimal, _ := PushNumberScriptItem(value).Script()
+	if !bytes.Equal(script, minimal) {
+		return 0, errors.Wrap(ErrInvalidTemplateValue, "number not minimally encoded")
+	}
+
+	return value, nil
+}
+
+// SetHash20 sets the value of a hash20 parameter.
+func (v TemplateValues) SetHash20(name string, hash Hash20) {
+	v[name] = NewPushDataScriptItem(hash.Bytes())
+}
+
+// SetHash32 sets the value of a hash32 parameter.
+func (v TemplateValues) SetHash32(name string, hash Hash32) {
+	v[name] = NewPushDataScriptItem(hash.Bytes())
+}
+
+// SetPublicKey sets the value of a public key parameter.
+func (v TemplateValues) SetPublicKey(name string, publicKey PublicKey) {
+	v[name] = NewPushDataScriptItem(publicKey.Bytes())
+}
+
+// SetNumber sets the value of a number parameter.
+func (v TemplateValues) SetNumber(name string, value int64) {
+	v[name] = PushNumberScriptItem(value)
+}
+
+// SetLockTime sets the value of a lock time parameter.
+func (v TemplateValues) SetLockTime(name string, lockTime uint32) {
+	v[name] = PushNumberScriptItem(int64(lockTime))
+}
+
+// SetData sets the value of a data parameter.
+func (v TemplateValues) SetData(name string, b []byte) {
+	if len(b) == 0 {
+		v[name] = NewOpCodeScriptItem(OP_0)
+		return
+	}
+
+	v[name] = NewPushDataScriptItem(b)
+}
+
+// Hash20 returns the value of a hash20 parameter.
+func (v TemplateValues) Hash20(name string) (Hash20, error) {
+	item, err := v.get(name, TemplateParamTypeHash20)
+	if err != nil {
+		return Hash20{}, err
+	}
+
+	var result Hash20
+	copy(result[:], item.Data)
+	return result, nil
+}
+
+// Hash32 returns the value of a hash32 parameter.
+func (v TemplateValues) Hash32(name string) (Hash32, error) {
+	item, err := v.get(name, TemplateParamTypeHash32)
+	if err != nil {
+		return Hash32{}, err
+	}
+
+	var result Hash32
+	copy(result[:], item.Data)
+	return result, nil
+}
+
+// PublicKey returns the value of a public key parameter.
+func (v TemplateValues) PublicKey(name string) (PublicKey, error) {
+	item, err := v.get(name, TemplateParamTypePublicKey)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	return PublicKeyFromBytes(item.Data)
+}
+
+// Number returns the value of a number parameter.
+func (v TemplateValues) Number(name string) (int64, error) {
+	item, err := v.get(name, TemplateParamTypeNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	return ScriptNumberValue(item)
+}
+
+// LockTime returns the value of a lock time parameter.
+func (v TemplateValues) LockTime(name string) (uint32, error) {
+	item, err := v.get(name, TemplateParamTypeLockTime)
+	if err != nil {
+		return 0, err
+	}
+
+	value, err := ScriptNumberValue(item)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(value), nil
+}
+
+// Data returns the value of a data parameter.
+func (v TemplateValues) Data(name string) ([]byte, error) {
+	item, err := v.get(name, TemplateParamTypeData)
+	if err != nil {
+		return nil, err
+	}
+
+	return item.Data, nil
+}
+
+func (v TemplateValues) get(name string, typ TemplateParamType) (*ScriptItem, error) {
+	item, exists := v[name]
+	if !exists {
+		return nil, errors.Wrap(ErrMissingTemplateValue, name)
+	}
+
+	param := TemplateParam{Name: name, Type: typ}
+	if err := param.check(item); err != nil {
+		return nil, errors.Wrap(err, name)
+	}
+
+	return item, nil
+}
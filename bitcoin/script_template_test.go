@@ -0,0 +1,776 @@
+package bitcoin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func Test_ScriptTemplateText(t *testing.T) {
+	for _, template := range ScriptTemplates {
+		t.Run(template.Name, func(t *testing.T) {
+			text := template.String()
+
+			parsed, err := ParseScriptTemplate(template.Name, text)
+			if err != nil {
+				t.Fatalf("Failed to parse template : %s", err)
+			}
+
+			if parsed.String() != text {
+				t.Fatalf("Wrong text : \ngot  : %s\nwant : %s", parsed.String(), text)
+			}
+
+			if len(parsed.items) != len(template.items) {
+				t.Fatalf("Wrong item count : got %d, want %d", len(parsed.items),
+					len(template.items))
+			}
+
+			for i, item := range template.items {
+				if item == nil {
+					if parsed.items[i] != nil {
+						t.Fatalf("Item %d should be a parameter", i)
+					}
+					continue
+				}
+
+				if parsed.items[i] == nil || !parsed.items[i].Equal(*item) {
+					t.Fatalf("Wrong item %d : got %v, want %v", i, parsed.items[i], item)
+				}
+			}
+		})
+	}
+}
+
+func Test_ScriptTemplateParseErrors(t *testing.T) {
+	tests := []struct {
+		text string
+		err  error
+	}{
+		{"OP_DUP <pkh:hash21>", ErrUnknownTemplateParamType},
+		{"OP_DUP <pkh>", ErrInvalidTemplateParam},
+		{"OP_DUP <:hash20>", ErrInvalidTemplateParam},
+		{"<value:hash20> <value:number>", ErrInvalidTemplateParam},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if _, err := ParseScriptTemplate("test", tt.text); errors.Cause(err) != tt.err {
+				t.Fatalf("Wrong error : got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func Test_ScriptTemplateMatchesRawAddress(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+
+	values := TemplateValues{}
+	pkh, _ := NewHash20FromData(key.PublicKey().Bytes())
+	values.SetHash20("pkh", *pkh)
+
+	lockingScript, err := PKHScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+
+	wantLockingScript, _ := key.LockingScript()
+	if !lockingScript.Equal(wantLockingScript) {
+		t.Fatalf("Wrong P2PKH locking script : \ngot  : %s\nwant : %s", lockingScript,
+			wantLockingScript)
+	}
+
+	nonce, _ := GenerateKey(MainNet)
+	rph := RPuzzleHash(nonce)
+	values = TemplateValues{}
+	values.SetHash20("rhash", rph)
+
+	lockingScript, err = RPuzzleScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+
+	ra, err := NewRawAddressRPH(rph.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to create RPH raw address : %s", err)
+	}
+	wantLockingScript, _ = ra.LockingScript()
+	if !lockingScript.Equal(wantLockingScript) {
+		t.Fatalf("Wrong R puzzle locking script : \ngot  : %s\nwant : %s", lockingScript,
+			wantLockingScript)
+	}
+
+	template, matchValues, err := MatchScriptTemplate(lockingScript)
+	if err != nil {
+		t.Fatalf("Failed to match template : %s", err)
+	}
+
+	if template != RPuzzleScriptTemplate {
+		t.Fatalf("Wrong template : got %s, want %s", template.Name, RPuzzleScriptTemplate.Name)
+	}
+
+	matchRPH, err := matchValues.Hash20("rhash")
+	if err != nil {
+		t.Fatalf("Failed to get R puzzle hash : %s", err)
+	}
+
+	if !matchRPH.Equal(&rph) {
+		t.Fatalf("Wrong R puzzle hash : got %s, want %s", matchRPH, rph)
+	}
+}
+
+func Test_ScriptTemplateValues(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	pkh, _ := NewHash20FromData(key.PublicKey().Bytes())
+
+	values := TemplateValues{}
+	values.SetData("content_type", []byte("text/plain;charset=utf-8"))
+	values.SetData("content", []byte("Hello, world!"))
+	values.SetHash20("pkh", *pkh)
+
+	lockingScript, err := OrdinalScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+	t.Logf("Locking script : %s", lockingScript)
+
+	template, parsed, err := MatchScriptTemplate(lockingScript)
+	if err != nil {
+		t.Fatalf("Failed to match template : %s", err)
+	}
+
+	if template != OrdinalScriptTemplate {
+		t.Fatalf("Wrong template : got %s, want %s", template.Name, OrdinalScriptTemplate.Name)
+	}
+
+	content, err := parsed.Data("content")
+	if err != nil {
+		t.Fatalf("Failed to get content : %s", err)
+	}
+
+	if string(content) != "Hello, world!" {
+		t.Fatalf("Wrong content : got %s, want %s", content, "Hello, world!")
+	}
+
+	contentType, err := parsed.Data("content_type")
+	if err != nil {
+		t.Fatalf("Failed to get content type : %s", err)
+	}
+
+	if string(contentType) != "text/plain;charset=utf-8" {
+		t.Fatalf("Wrong content type : got %s", contentType)
+	}
+
+	if _, err := parsed.Number("content"); errors.Cause(err) != ErrInvalidTemplateValue {
+		t.Fatalf("Wrong error for content as number : %v", err)
+	}
+
+	delete(values, "pkh")
+	if _, err := OrdinalScriptTemplate.LockingScript(values); errors.Cause(err) !=
+		ErrMissingTemplateValue {
+		t.Fatalf("Wrong error for missing value : %v", err)
+	}
+
+	values.SetNumber("pkh", 5)
+	if _, err := OrdinalScriptTemplate.LockingScript(values); errors.Cause(err) !=
+		ErrInvalidTemplateValue {
+		t.Fatalf("Wrong error for invalid value : %v", err)
+	}
+
+	values = TemplateValues{}
+	values.SetLockTime("lock_time", 800000)
+	values.SetHash20("pkh", *pkh)
+
+	lockingScript, err = LockTimeScriptTemplate.LockingScript(values)
+	if err != nil {
+		t.Fatalf("Failed to create locking script : %s", err)
+	}
+
+	parsed, err = LockTimeScriptTemplate.Parse(lockingScript)
+	if err != nil {
+		t.Fatalf("Failed to parse locking script : %s", err)
+	}
+
+	lockTime, err := parsed.LockTime("lock_time")
+	if err != nil {
+		t.Fatalf("Failed to get lock time : %s", err)
+	}
+
+	if lockTime != 800000 {
+		t.Fatalf("Wrong lock time : got %d, want %d", lockTime, 800000)
+	}
+
+	// Change only the last of the lock time values.
+	oldLockTime := PushNumberScript(800000)
+	index := bytes.LastIndex(lockingScript, oldLockTime)
+	mixed := append(Script{}, lockingScript[:index]...)
+	mixed = append(mixed, PushNumberScript(800001)...)
+	mixed = append(mixed, lockingScript[index+len(oldLockTime):]...)
+
+	if _, err := LockTimeScriptTemplate.Parse(mixed); errors.Cause(err) !=
+		ErrWrongScriptTemplate {
+		t.Fatalf("Wrong error for conflicting values : %v", err)
+	}
+
+	if _, err := PKHScriptTemplate.Parse(lockingScript); errors.Cause(err) !=
+		ErrWrongScriptTemplate {
+		t.Fatalf("Wrong error for wrong template : %v", err)
+	}
+}
+
+func Test_ScriptTemplateUnlock(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	pkh, _ := NewHash20FromData(key.PublicKey().Bytes())
+	sigHash := Hash32(sha256.Sum256([]byte("transaction")))
+	hashType := byte(SigHashAll | SigHashForkID)
+
+	sig, err := key.Sign(sigHash)
+	if err != nil {
+		t.Fatalf("Failed to sign : %s", err)
+	}
+
+	preimage := []byte("secret")
+	hash := Hash32(sha256.Sum256(preimage))
+
+	t.Run("hash puzzle", func(t *testing.T) {
+		values := TemplateValues{}
+		values.SetHash32("hash", hash)
+		lockingScript, _ := HashPuzzleScriptTemplate.LockingScript(values)
+
+		unlockingScript, _ := HashPuzzleUnlockingScript(preimage)
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err != nil {
+			t.Fatalf("Failed to unlock : %s", err)
+		}
+
+		unlockingScript, _ = HashPuzzleUnlockingScript([]byte("wrong"))
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err == nil {
+			t.Fatalf("Unlocked with wrong preimage")
+		}
+	})
+
+	t.Run("hash lock", func(t *testing.T) {
+		values := TemplateValues{}
+		values.SetHash32("hash", hash)
+		values.SetHash20("pkh", *pkh)
+		lockingScript, _ := HashLockScriptTemplate.LockingScript(values)
+
+		unlockingScript, _ := HashLockUnlockingScript(sig, hashType, key.PublicKey(), preimage)
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err != nil {
+			t.Fatalf("Failed to unlock : %s", err)
+		}
+
+		other, _ := GenerateKey(MainNet)
+		otherSig, _ := other.Sign(sigHash)
+		unlockingScript, _ = HashLockUnlockingScript(otherSig, hashType, other.PublicKey(),
+			preimage)
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err == nil {
+			t.Fatalf("Unlocked with wrong key")
+		}
+	})
+
+	t.Run("r puzzle", func(t *testing.T) {
+		nonce, _ := GenerateKey(MainNet)
+		values := TemplateValues{}
+		values.SetHash20("rhash", RPuzzleHash(nonce))
+		lockingScript, _ := RPuzzleScriptTemplate.LockingScript(values)
+
+		// Any key can be used with the nonce.
+		other, _ := GenerateKey(MainNet)
+		unlockingScript, err := RPuzzleUnlockingScript(other, nonce, sigHash, hashType)
+		if err != nil {
+			t.Fatalf("Failed to create unlocking script : %s", err)
+		}
+
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err != nil {
+			t.Fatalf("Failed to unlock : %s", err)
+		}
+
+		ra, err := RawAddressFromUnlockingScript(unlockingScript)
+		if err != nil {
+			t.Fatalf("Failed to get raw address from unlocking script : %s", err)
+		}
+		lockingRA, _ := RawAddressFromLockingScript(lockingScript)
+		if !ra.Equal(lockingRA) {
+			t.Fatalf("Wrong raw address : got %x, want %x", ra.Bytes(), lockingRA.Bytes())
+		}
+
+		otherNonce, _ := GenerateKey(MainNet)
+		unlockingScript, _ = RPuzzleUnlockingScript(other, otherNonce, sigHash, hashType)
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err == nil {
+			t.Fatalf("Unlocked with wrong nonce")
+		}
+	})
+
+	t.Run("ordinal", func(t *testing.T) {
+		values := TemplateValues{}
+		values.SetData("content_type", []byte("text/plain"))
+		values.SetData("content", []byte("inscription"))
+		values.SetHash20("pkh", *pkh)
+		lockingScript, _ := OrdinalScriptTemplate.LockingScript(values)
+
+		buf := &bytes.Buffer{}
+		WritePushDataScript(buf, append(sig.Bytes(), hashType))
+		WritePushDataScript(buf, key.PublicKey().Bytes())
+		if err := evalTestScript(Script(buf.Bytes()), lockingScript, sigHash); err != nil {
+			t.Fatalf("Failed to unlock : %s", err)
+		}
+	})
+}
+
+func Test_ScriptTemplateLockTime(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	pkh, _ := NewHash20FromData(key.PublicKey().Bytes())
+	hashType := byte(SigHashAll | SigHashForkID)
+
+	tests := []struct {
+		name           string
+		scriptLockTime uint32
+		txLockTime     uint32
+		sequence       uint32
+		valid          bool
+	}{
+		{"height", 800000, 800000, 0xfffffffe, true},
+		{"later height", 800000, 801000, 0, true},
+		{"early height", 800000, 799000, 0xfffffffe, false},
+		{"final sequence", 800000, 800000, 0xffffffff, false},
+		{"time", 1700000000, 1700000000, 0xfffffffe, true},
+		{"early time", 1700000000, 1690000000, 0xfffffffe, false},
+		{"time for height", 800000, 1700000000, 0xfffffffe, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := TemplateValues{}
+			values.SetLockTime("lock_time", tt.scriptLockTime)
+			values.SetHash20("pkh", *pkh)
+			lockingScript, err := LockTimeScriptTemplate.LockingScript(values)
+			if err != nil {
+				t.Fatalf("Failed to create locking script : %s", err)
+			}
+
+			// Adjust the lock time until the preimage can be signed by the script.
+			lockTime := tt.txLockTime
+			preimage := testSigHashPreimage(lockingScript, tt.sequence, lockTime, hashType)
+			for !IsValidLockTimePreimage(preimage) {
+				lockTime++
+				preimage = testSigHashPreimage(lockingScript, tt.sequence, lockTime, hashType)
+			}
+
+			sigHash := Hash32(sha256.Sum256(Sha256(preimage)))
+			sig, _ := key.Sign(sigHash)
+
+			unlockingScript, err := LockTimeUnlockingScript(sig, hashType, key.PublicKey(),
+				preimage)
+			if err != nil {
+				t.Fatalf("Failed to create unlocking script : %s", err)
+			}
+
+			err = evalTestScript(unlockingScript, lockingScript, sigHash)
+			if tt.valid && err != nil {
+				t.Fatalf("Failed to unlock : %s", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatalf("Unlocked with invalid lock time")
+			}
+
+			if !tt.valid {
+				return
+			}
+
+			// A preimage that isn't for the transaction being signed must fail.
+			otherPreimage := testSigHashPreimage(lockingScript, tt.sequence, lockTime+1, hashType)
+			unlockingScript, _ = LockTimeUnlockingScript(sig, hashType, key.PublicKey(),
+				otherPreimage)
+			if err := evalTestScript(unlockingScript, lockingScript, sigHash); err == nil {
+				t.Fatalf("Unlocked with wrong preimage")
+			}
+		})
+	}
+}
+
+func Test_ScriptTemplateLockTimeInvalidPreimage(t *testing.T) {
+	key, _ := GenerateKey(MainNet)
+	pkh, _ := NewHash20FromData(key.PublicKey().Bytes())
+	hashType := byte(SigHashAll | SigHashForkID)
+
+	values := TemplateValues{}
+	values.SetLockTime("lock_time", 800000)
+	values.SetHash20("pkh", *pkh)
+	lockingScript, _ := LockTimeScriptTemplate.LockingScript(values)
+
+	// Preimages that aren't valid for the script's signature must fail to unlock.
+	count := 0
+	for lockTime := uint32(800000); count < 5; lockTime++ {
+		preimage := testSigHashPreimage(lockingScript, 0, lockTime, hashType)
+		if IsValidLockTimePreimage(preimage) {
+			continue
+		}
+		count++
+
+		sigHash := Hash32(sha256.Sum256(Sha256(preimage)))
+		sig, _ := key.Sign(sigHash)
+		unlockingScript, _ := LockTimeUnlockingScript(sig, hashType, key.PublicKey(), preimage)
+		if err := evalTestScript(unlockingScript, lockingScript, sigHash); err == nil {
+			t.Fatalf("Unlocked with invalid preimage")
+		}
+	}
+}
+
+// testSigHashPreimage returns a BIP-0143 style signature hash preimage for a single input.
+func testSigHashPreimage(lockingScript Script, sequence, lockTime uint32, hashType byte) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, uint32(1)) // version
+	buf.Write(Sha256([]byte("previous outputs")))
+	buf.Write(Sha256([]byte("sequences")))
+	buf.Write(Sha256([]byte("outpoint hash")))
+	binary.Write(buf, binary.LittleEndian, uint32(0)) // outpoint index
+	writeVarInt(buf, uint64(len(lockingScript)))
+	buf.Write(lockingScript)
+	binary.Write(buf, binary.LittleEndian, uint64(1)) // value
+	binary.Write(buf, binary.LittleEndian, sequence)
+	buf.Write(Sha256([]byte("outputs")))
+	binary.Write(buf, binary.LittleEndian, lockTime)
+	binary.Write(buf, binary.LittleEndian, uint32(hashType))
+	return buf.Bytes()
+}
+
+// evalTestScript executes the unlocking script then the locking script with the subset of op codes
+// used by the script templates. Signatures are checked against the specified signature hash.
+func evalTestScript(unlockingScript, lockingScript Script, sigHash Hash32) error {
+	var stack [][]byte
+	pop := func() ([]byte, error) {
+		if len(stack) == 0 {
+			return nil, errors.New("stack empty")
+		}
+		b := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return b, nil
+	}
+	popNumber := func() (*big.Int, error) {
+		b, err := pop()
+		if err != nil {
+			return nil, err
+		}
+		return testDecodeScriptNumber(b), nil
+	}
+	push := func(b []byte) {
+		stack = append(stack, b)
+	}
+	pushBool := func(v bool) {
+		if v {
+			push([]byte{1})
+		} else {
+			push(nil)
+		}
+	}
+
+	for _, script := range []Script{unlockingScript, lockingScript} {
+		items, err := ParseScriptItems(bytes.NewReader(script), -1)
+		if err != nil {
+			return errors.Wrap(err, "parse")
+		}
+
+		var executing []bool
+		for i, item := range items {
+			active := true
+			for _, e := range executing {
+				active = active && e
+			}
+
+			if item.Type == ScriptItemTypeOpCode {
+				switch item.OpCode {
+				case OP_IF, OP_NOTIF:
+					value := false
+					if active {
+						b, err := pop()
+						if err != nil {
+							return errors.Wrapf(err, "item %d", i)
+						}
+						value = testScriptBool(b)
+						if item.OpCode == OP_NOTIF {
+							value = !value
+						}
+					}
+					executing = append(executing, value)
+					continue
+				case OP_ELSE:
+					executing[len(executing)-1] = !executing[len(executing)-1]
+					continue
+				case OP_ENDIF:
+					executing = executing[:len(executing)-1]
+					continue
+				}
+			}
+
+			if !active {
+				continue
+			}
+
+			if item.Type == ScriptItemTypePushData {
+				push(item.Data)
+				continue
+			}
+
+			if err := evalTestOpCode(item.OpCode, &stack, pop, popNumber, push, pushBool,
+				sigHash); err != nil {
+				return errors.Wrapf(err, "item %d: %s", i, item)
+			}
+		}
+	}
+
+	if len(stack) == 0 || !testScriptBool(stack[len(stack)-1]) {
+		return errors.New("false result")
+	}
+
+	return nil
+}
+
+func evalTestOpCode(opCode byte, stack *[][]byte, pop func() ([]byte, error),
+	popNumber func() (*big.Int, error), push func([]byte), pushBool func(bool),
+	sigHash Hash32) error {
+
+	switch {
+	case opCode == OP_0:
+		push(nil)
+		return nil
+	case opCode >= OP_1 && opCode <= OP_16:
+		push(testEncodeScriptNumber(big.NewInt(int64(opCode - OP_1 + 1))))
+		return nil
+	}
+
+	switch opCode {
+	case OP_DUP:
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		push(b)
+		push(b)
+
+	case OP_DROP:
+		_, err := pop()
+		return err
+
+	case OP_NIP, OP_SWAP:
+		a, err := pop()
+		if err != nil {
+			return err
+		}
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		if opCode == OP_SWAP {
+			push(a)
+			push(b)
+		} else {
+			push(a)
+		}
+
+	case OP_SIZE:
+		if len(*stack) == 0 {
+			return errors.New("stack empty")
+		}
+		size := len((*stack)[len(*stack)-1])
+		push(testEncodeScriptNumber(big.NewInt(int64(size))))
+
+	case OP_SPLIT:
+		n, err := popNumber()
+		if err != nil {
+			return err
+		}
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		if n.Sign() < 0 || n.Cmp(big.NewInt(int64(len(b)))) > 0 {
+			return errors.New("invalid split")
+		}
+		push(append([]byte{}, b[:n.Int64()]...))
+		push(append([]byte{}, b[n.Int64():]...))
+
+	case OP_CAT:
+		a, err := pop()
+		if err != nil {
+			return err
+		}
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		push(append(append([]byte{}, b...), a...))
+
+	case OP_BIN2NUM:
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		push(testEncodeScriptNumber(testDecodeScriptNumber(b)))
+
+	case OP_ADD, OP_SUB, OP_MOD, OP_LESSTHAN, OP_GREATERTHANOREQUAL, OP_NUMEQUALVERIFY:
+		b, err := popNumber()
+		if err != nil {
+			return err
+		}
+		a, err := popNumber()
+		if err != nil {
+			return err
+		}
+
+		switch opCode {
+		case OP_ADD:
+			push(testEncodeScriptNumber(new(big.Int).Add(a, b)))
+		case OP_SUB:
+			push(testEncodeScriptNumber(new(big.Int).Sub(a, b)))
+		case OP_MOD:
+			push(testEncodeScriptNumber(new(big.Int).Rem(a, b)))
+		case OP_LESSTHAN:
+			pushBool(a.Cmp(b) < 0)
+		case OP_GREATERTHANOREQUAL:
+			pushBool(a.Cmp(b) >= 0)
+		case OP_NUMEQUALVERIFY:
+			if a.Cmp(b) != 0 {
+				return errors.New("numbers not equal")
+			}
+		}
+
+	case OP_NOT:
+		n, err := popNumber()
+		if err != nil {
+			return err
+		}
+		pushBool(n.Sign() == 0)
+
+	case OP_VERIFY:
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		if !testScriptBool(b) {
+			return errors.New("verify failed")
+		}
+
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := pop()
+		if err != nil {
+			return err
+		}
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		if opCode == OP_EQUALVERIFY {
+			if !bytes.Equal(a, b) {
+				return errors.New("not equal")
+			}
+		} else {
+			pushBool(bytes.Equal(a, b))
+		}
+
+	case OP_SHA256, OP_HASH160, OP_HASH256:
+		b, err := pop()
+		if err != nil {
+			return err
+		}
+		switch opCode {
+		case OP_SHA256:
+			push(Sha256(b))
+		case OP_HASH160:
+			push(Hash160(b))
+		case OP_HASH256:
+			push(DoubleSha256(b))
+		}
+
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKeyBytes, err := pop()
+		if err != nil {
+			return err
+		}
+		sigBytes, err := pop()
+		if err != nil {
+			return err
+		}
+
+		valid := testCheckSig(sigBytes, pubKeyBytes, sigHash)
+		if opCode == OP_CHECKSIGVERIFY {
+			if !valid {
+				return errors.New("signature invalid")
+			}
+		} else {
+			pushBool(valid)
+		}
+
+	default:
+		return fmt.Errorf("Unsupported op code %s", OpCodeToString(opCode))
+	}
+
+	return nil
+}
+
+func testCheckSig(sigBytes, pubKeyBytes []byte, sigHash Hash32) bool {
+	if len(sigBytes) == 0 {
+		return false
+	}
+
+	sig, err := SignatureFromBytes(sigBytes[:len(sigBytes)-1])
+	if err != nil {
+		return false
+	}
+
+	// Low S and DER encoding are required.
+	if sig.S.Cmp(curveHalfOrder) > 0 || !bytes.Equal(sig.Bytes(), sigBytes[:len(sigBytes)-1]) {
+		return false
+	}
+
+	publicKey, err := PublicKeyFromBytes(pubKeyBytes)
+	if err != nil {
+		return false
+	}
+
+	return sig.Verify(sigHash, publicKey)
+}
+
+func testScriptBool(b []byte) bool {
+	for i, v := range b {
+		if v != 0 {
+			// Negative zero is false.
+			return !(i == len(b)-1 && v == 0x80)
+		}
+	}
+	return false
+}
+
+func testDecodeScriptNumber(b []byte) *big.Int {
+	if len(b) == 0 {
+		return new(big.Int)
+	}
+
+	be := reverseEndian(b)
+	negative := be[0]&0x80 != 0
+	be[0] &= 0x7f
+
+	result := new(big.Int).SetBytes(be)
+	if negative {
+		result.Neg(result)
+	}
+	return result
+}
+
+func testEncodeScriptNumber(n *big.Int) []byte {
+	if n.Sign() == 0 {
+		return nil
+	}
+
+	result := reverseEndian(new(big.Int).Abs(n).Bytes())
+	if result[len(result)-1]&0x80 != 0 {
+		result = append(result, 0x00)
+	}
+	if n.Sign() < 0 {
+		result[len(result)-1] |= 0x80
+	}
+	return result
+}
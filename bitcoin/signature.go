@@ -7,7 +7,6 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"database/sql/driver"
-	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"hash"
@@ -132,32 +131,15 @@ func SignatureFromBytes(b []byte) (Signature, error) {
 	return result, result.Validate()
 }
 
-// SignatureFromCompact converts base64 "compact" signature text to a signature.
-// This is apparently a signature format used in old software to sign text messages.
+// SignatureFromCompact converts base64 "compact" signature text to a signature. The recovery ID is
+// discarded, so use CompactSignatureFromStr to recover the public key.
 func SignatureFromCompact(s string) (Signature, error) {
-	b, err := base64.StdEncoding.DecodeString(s)
+	compact, err := CompactSignatureFromStr(s)
 	if err != nil {
-		return Signature{}, errors.Wrap(err, "base64 decode")
-	}
-
-	if len(b) != 65 {
-		return Signature{}, fmt.Errorf("Wrong length : %d should be 65", len(b))
-	}
-
-	recovery := int(b[0]) - 27 - 4
-	if recovery < 0 {
-		recovery += 4
-	}
-
-	if recovery < 0 || recovery > 3 {
-		return Signature{}, fmt.Errorf("Invalid recover value : %d should be (0 >= r <= 3)", recovery)
+		return Signature{}, err
 	}
 
-	var result Signature
-	result.R.SetBytes(b[1:33])
-	result.S.SetBytes(b[33:])
-
-	return result, result.Validate()
+	return compact.Signature, nil
 }
 
 func (s Signature) Copy() Signature {
@@ -313,26 +295,15 @@ func (s Signature) Validate() error {
 	return nil
 }
 
-// ToCompact converts a signature to a base64 "compact" signature encoding.
+// ToCompact converts a signature to a base64 "compact" signature encoding. The signature doesn't
+// contain the recovery ID, so it is always 1 and the public key might not be recoverable from the
+// result. Use Key.SignCompact to create a compact signature with the correct recovery ID.
 func (s Signature) ToCompact() string {
-	b := make([]byte, 0, 65)
-	b = append(b, byte(27+4+1)) // recovery=1, not sure how to choose recovery (0-3) --ce
-
-	rb := s.R.Bytes()
-	if len(rb) < 32 {
-		extra := make([]byte, 32-len(rb))
-		rb = append(extra, rb...)
-	}
-	b = append(b, rb...)
-
-	sb := s.S.Bytes()
-	if len(sb) < 32 {
-		extra := make([]byte, 32-len(sb))
-		sb = append(extra, sb...)
-	}
-	b = append(b, sb...)
-
-	return base64.StdEncoding.EncodeToString(b)
+	return CompactSignature{
+		Signature:  s,
+		RecoveryID: 1,
+		Compressed: true,
+	}.String()
 }
 
 // String returns the signature data with a checksum, encoded with Base58.
@@ -284,54 +284,19 @@ func (t Template) PubKeyCount() uint32 {
 	return result
 }
 
-// RequiredSignatures is the number of signatures required to unlock the template.
-// Note: Only supports PKH, PK, and MultiPKH.
+// RequiredSignatures is the number of signatures required to unlock the template. It is the
+// minimum number of valid signatures of the paths through the template that can succeed.
 func (t Template) RequiredSignatures() (uint32, error) {
-	if bytes.Equal(t, PKHTemplate) || bytes.Equal(t, PKTemplate) {
-		return 1, nil
-	}
-
-	// Assume this is a multi-pkh accumulator script.
-	buf := bytes.NewReader(t)
-	var previousItems []*ScriptItem
-	for {
-		item, err := ParseScript(buf)
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return 0, errors.Wrap(err, "parse")
-		}
-
-		if item.OpCode == OP_LESSTHANOREQUAL {
-			break
-		}
-
-		// Save last two items
-		previousItems = append(previousItems, item)
-		if len(previousItems) > 2 {
-			previousItems = previousItems[1:]
-		}
-	}
-
-	if len(previousItems) != 2 {
-		return 0, errors.Wrap(ErrUnknownScriptTemplate, "not enough items")
-	}
-
-	if previousItems[1].Type != ScriptItemTypeOpCode || previousItems[1].OpCode != OP_FROMALTSTACK {
-		return 0, errors.Wrap(ErrUnknownScriptTemplate, "not OP_FROMALTSTACK")
-	}
-
-	requiredSigners, err := ScriptNumberValue(previousItems[0])
+	analysis, err := t.Analyze()
 	if err != nil {
-		return 0, errors.Wrap(err, "script number")
+		return 0, errors.Wrap(err, "analyze")
 	}
 
-	if requiredSigners < 1 || requiredSigners > 0xffffffff {
-		return 0, errors.Wrapf(ErrUnknownScriptTemplate, "require signer value %d", requiredSigners)
+	if analysis.Unspendable {
+		return 0, errors.Wrap(ErrUnknownScriptTemplate, "unspendable")
 	}
 
-	return uint32(requiredSigners), nil
+	return uint32(analysis.RequiredSignatures), nil
 }
 
 func (t Template) String() string {
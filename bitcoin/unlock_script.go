@@ -126,17 +126,17 @@ func isPublicKey(b []byte) bool {
 	return len(b) == 33 && (b[0] == 0x02 || b[0] == 0x03)
 }
 
-// signatureRValue returns the r value of the signature.
+// signatureRValue returns the DER encoded r value of the signature.
 func signatureRValue(b []byte) ([]byte, error) {
 	if len(b) < 40 {
 		return nil, errors.New("Invalid signature length")
 	}
-	length := b[0]
-	header := b[1]
+	header := b[0]
+	length := b[1]
 	intHeader := b[2]
 	rLength := b[3]
 
-	if length > 4+rLength && header == 0x30 && intHeader == 0x02 && len(b) > int(4+rLength) {
+	if header == 0x30 && intHeader == 0x02 && length > 2+rLength && len(b) > int(4+rLength) {
 		return b[4 : 4+rLength], nil
 	}
 
@@ -0,0 +1,85 @@
+package bitcoin
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func Test_SignatureRValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		signature string // hex DER with sighash type
+		r         string // hex, empty when invalid
+	}{
+		{
+			// Input signature of f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16,
+			// the first bitcoin transaction between people.
+			name:      "block 170",
+			signature: "304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901",
+			r:         "4e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd41",
+		},
+		{
+			// r has the high bit set so it has a leading zero.
+			name:      "high r",
+			signature: "3045022100c4e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901",
+			r:         "00c4e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd41",
+		},
+		{
+			name:      "wrong header",
+			signature: "314402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901",
+		},
+		{
+			name:      "r longer than signature",
+			signature: "304402504e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901",
+		},
+		{
+			name:      "too short",
+			signature: "3006020101020101",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signature, _ := hex.DecodeString(tt.signature)
+
+			r, err := signatureRValue(signature)
+			if len(tt.r) == 0 {
+				if err == nil {
+					t.Fatalf("Invalid signature should fail : r %x", r)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Failed to get r value : %s", err)
+			}
+
+			want, _ := hex.DecodeString(tt.r)
+			if !bytes.Equal(r, want) {
+				t.Fatalf("Wrong r value : got %x, want %x", r, want)
+			}
+		})
+	}
+}
+
+func Test_RawAddressFromUnlockingScript_RPH(t *testing.T) {
+	publicKey, _ := hex.DecodeString("0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	signature, _ := hex.DecodeString("304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901")
+	r, _ := hex.DecodeString("4e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd41")
+
+	// <PublicKey> <Signature>
+	script := append([]byte{byte(len(publicKey))}, publicKey...)
+	script = append(script, byte(len(signature)))
+	script = append(script, signature...)
+
+	ra, err := RawAddressFromUnlockingScript(script)
+	if err != nil {
+		t.Fatalf("Failed to get address : %s", err)
+	}
+
+	want, _ := NewRawAddressRPH(Hash160(r))
+	if !ra.Equal(want) {
+		t.Fatalf("Wrong address : got %x, want %x", ra.Bytes(), want.Bytes())
+	}
+}
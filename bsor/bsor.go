@@ -2,20 +2,95 @@ package bsor
 
 import (
 	"bytes"
-	"fmt"
+	"io"
+	"math"
+	"math/big"
 	"reflect"
+	"time"
 
 	"github.com/tokenized/pkg/bitcoin"
 
 	"github.com/pkg/errors"
 )
 
+const (
+	// EncodingVersionInitial is the original encoding where each field is its id followed by its
+	// value. A reader must know every field to be able to decode it.
+	EncodingVersionInitial = uint8(0)
+
+	// EncodingVersionSkippable follows each field id with the number of script items in the
+	// field's value so readers can skip fields they don't know. The encoding is preceded by the
+	// negative version number so readers can detect it.
+	EncodingVersionSkippable = uint8(1)
+)
+
 var (
-	ErrInvalidID       = errors.New("Invalid Field ID")
-	ErrDuplicateID     = errors.New("Duplicate Field ID")
-	ErrValueConversion = errors.New("Value Conversion")
+	ErrInvalidID          = errors.New("Invalid Field ID")
+	ErrDuplicateID        = errors.New("Duplicate Field ID")
+	ErrValueConversion    = errors.New("Value Conversion")
+	ErrUnknownField       = errors.New("Unknown Field")
+	ErrUnsupportedVersion = errors.New("Unsupported Version")
+	ErrUnregisteredType   = errors.New("Unregistered Type")
+
+	unknownFieldsType = reflect.TypeOf(UnknownFields{})
+	timeType          = reflect.TypeOf(time.Time{})
+	bigIntType        = reflect.TypeOf(big.Int{})
+
+	// zeroTimeData is the encoding of the zero time. It is a negative zero, which isn't the minimal
+	// encoding of any number so it can't be the encoding of another time.
+	zeroTimeData = []byte{0x80}
+
+	// minTime and maxTime are the range of times with nanoseconds since the unix epoch that fit in
+	// an int64. The minimum int64 is excluded because it can't be negated to encode it.
+	minTime = time.Unix(0, math.MinInt64+1)
+	maxTime = time.Unix(0, math.MaxInt64)
 )
 
+type MarshalOptions struct {
+	// Version is the encoding version. Versions above zero are preceded by a version header.
+	Version uint8
+
+	// Reflect ignores generated MarshalBSOR methods and encodes every type with reflection. It is
+	// used to compare generated code with the reflection based encoding.
+	Reflect bool
+}
+
+type UnmarshalOptions struct {
+	// AllowUnknownFields skips fields that aren't defined in the struct instead of returning an
+	// error. This is only possible with EncodingVersionSkippable. Skipped fields are put in a struct
+	// field of type UnknownFields if there is one so they can be included when marshalling again.
+	AllowUnknownFields bool
+
+	// Reflect ignores generated UnmarshalBSOR methods and decodes every type with reflection.
+	Reflect bool
+}
+
+// UnknownFields holds the fields skipped while decoding a struct. Add a field of this type to a
+// struct, with a `bsor:"-"` tag, to retain fields added by newer versions of the struct.
+type UnknownFields []*UnknownField
+
+type UnknownField struct {
+	ID          uint64
+	ScriptItems bitcoin.ScriptItems
+}
+
+// EncodeOptions are the options used while encoding. They are passed to generated MarshalBSOR
+// methods.
+type EncodeOptions struct {
+	Version uint8
+
+	reflect bool
+}
+
+// DecodeOptions are the options used while decoding. The version is read from the version header.
+// They are passed to generated UnmarshalBSOR methods.
+type DecodeOptions struct {
+	Version            uint8
+	AllowUnknownFields bool
+
+	reflect bool
+}
+
 type BinaryMarshaler interface {
 	MarshalBinary() (data []byte, err error)
 }
@@ -30,57 +105,133 @@ type FixedBinaryMarshaler interface {
 }
 
 func Marshal(object interface{}) (bitcoin.ScriptItems, error) {
-	return marshalObject(object, false)
+	return MarshalWithOptions(object, MarshalOptions{})
 }
 
-func MarshalBinary(object interface{}) (bitcoin.Script, error) {
-	items, err := Marshal(object)
-	if err != nil {
-		return nil, errors.Wrap(err, "marshal")
+func MarshalWithOptions(object interface{}, options MarshalOptions) (bitcoin.ScriptItems, error) {
+	if options.Version > EncodingVersionSkippable {
+		return nil, errors.Wrapf(ErrUnsupportedVersion, "%d", options.Version)
 	}
 
-	script, err := items.Script()
-	if err != nil {
-		return nil, errors.Wrap(err, "script")
+	writer := &ScriptItemWriter{}
+	if err := marshal(writer, object, options); err != nil {
+		return nil, err
 	}
 
-	return script, nil
+	return writer.ScriptItems(), nil
+}
+
+func MarshalBinary(object interface{}) (bitcoin.Script, error) {
+	return MarshalBinaryWithOptions(object, MarshalOptions{})
+}
+
+// MarshalBinaryWithOptions writes the encoded items directly to the script without building a
+// slice of script items first.
+func MarshalBinaryWithOptions(object interface{}, options MarshalOptions) (bitcoin.Script, error) {
+	buf := &bytes.Buffer{}
+	encoder := NewEncoder(buf)
+	encoder.SetOptions(options)
+	if err := encoder.Encode(object); err != nil {
+		return nil, errors.Wrap(err, "marshal")
+	}
+
+	return bitcoin.Script(buf.Bytes()), nil
 }
 
 // Unmarshal reads the object from the scrip items and returns any script items remaining after the
 // object has been parsed.
 func Unmarshal(scriptItems bitcoin.ScriptItems, object interface{}) (bitcoin.ScriptItems, error) {
-	objectType := reflect.TypeOf(object)
-	objectValue := reflect.ValueOf(object)
-	if objectType.Kind() != reflect.Ptr {
-		return nil, fmt.Errorf("Unmarshal object is not a ptr: %s", objectType.Name())
+	return UnmarshalWithOptions(scriptItems, object, UnmarshalOptions{})
+}
+
+// UnmarshalWithOptions reads the object from the script items and returns any script items
+// remaining after the object has been parsed. The encoding version is detected from the script.
+func UnmarshalWithOptions(scriptItems bitcoin.ScriptItems, object interface{},
+	options UnmarshalOptions) (bitcoin.ScriptItems, error) {
+
+	reader := NewScriptItemReader(scriptItems)
+	if err := unmarshal(reader, object, options); err != nil {
+		return nil, err
 	}
-	if objectValue.IsNil() {
-		return nil, errors.New("Unmarshal object is nil")
+
+	return reader.ScriptItems(), nil
+}
+
+func UnmarshalBinary(script bitcoin.Script, object interface{}) (bitcoin.Script, error) {
+	return UnmarshalBinaryWithOptions(script, object, UnmarshalOptions{})
+}
+
+// UnmarshalBinaryWithOptions reads the object from the script and returns the remainder of the
+// script. Items are parsed as they are decoded so the whole script isn't parsed first.
+func UnmarshalBinaryWithOptions(script bitcoin.Script, object interface{},
+	options UnmarshalOptions) (bitcoin.Script, error) {
+
+	buf := bytes.NewReader(script)
+	reader := newStreamScriptItemReader(buf)
+	if err := unmarshal(reader, object, options); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
 	}
 
-	if err := unmarshalObject(&scriptItems, objectValue.Elem(), 0, false); err != nil {
-		return nil, errors.Wrap(err, "object")
+	// A peeked item was read from the script but not used.
+	remainingSize := buf.Len()
+	if reader.peeked != nil {
+		remainingSize += scriptItemSize(reader.peeked)
 	}
 
-	return scriptItems, nil
+	return script[len(script)-remainingSize:], nil
 }
 
-func UnmarshalBinary(script bitcoin.Script, object interface{}) (bitcoin.Script, error) {
-	items, err := bitcoin.ParseScriptItems(bytes.NewReader(script), -1)
-	if err != nil {
-		return nil, errors.Wrap(err, "script")
+// readVersionHeader reads the encoding version from the beginning of an object's encoding. Objects
+// always start with a non-negative field count, so a negative number is a version.
+func readVersionHeader(r *ScriptItemReader) (uint8, error) {
+	item, err := r.Peek()
+	if err == io.EOF {
+		return EncodingVersionInitial, nil
+	} else if err != nil {
+		return 0, err
 	}
 
-	remaining, err := Unmarshal(items, object)
-	if err != nil {
-		return nil, errors.Wrap(err, "unmarshal")
+	value, err := bitcoin.ScriptNumberValue(item)
+	if err != nil || value >= 0 {
+		return EncodingVersionInitial, nil
+	}
+
+	if -value > int64(EncodingVersionSkippable) {
+		return 0, errors.Wrapf(ErrUnsupportedVersion, "%d", -value)
+	}
+
+	r.advance()
+	return uint8(-value), nil
+}
+
+// isObjectType returns true if the type is encoded as a struct with a field count.
+func isObjectType(typ reflect.Type) bool {
+	if typ == nil {
+		return false
 	}
 
-	remainingScript, err := remaining.Script()
-	if err != nil {
-		return nil, errors.Wrap(err, "remaining script")
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ.Kind() != reflect.Struct {
+		return false
+	}
+
+	return !typ.Implements(binaryMarshalerType) &&
+		!reflect.PtrTo(typ).Implements(binaryUnmarshalerType)
+}
+
+// findUnknownFieldsIndex returns the index of the struct field that holds unknown fields or -1 if
+// there isn't one.
+func findUnknownFieldsIndex(typ reflect.Type) int {
+	fieldCount := typ.NumField()
+	for i := 0; i < fieldCount; i++ {
+		field := typ.Field(i)
+		if field.Type == unknownFieldsType && field.IsExported() {
+			return i
+		}
 	}
 
-	return remainingScript, nil
+	return -1
 }
@@ -1,14 +1,17 @@
 package bsor
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/validate"
 
 	"github.com/go-test/deep"
+	"github.com/pkg/errors"
 )
 
 type TestStruct struct {
@@ -237,3 +240,482 @@ func Test_Marshal_TestStructSimple(t *testing.T) {
 		})
 	}
 }
+
+type TestMapStruct struct {
+	StringMapField    map[string]string                   `bsor:"1"`
+	IntMapField       map[int]int                         `bsor:"2"`
+	ObjectMapField    map[string]TestSubStruct            `bsor:"3"`
+	ObjectPtrMapField map[uint32]*TestSubStruct           `bsor:"4"`
+	BinaryKeyMapField map[bitcoin.Hash20]bool             `bsor:"5"`
+	ArrayMapField     map[string][]string                 `bsor:"6"`
+	NestedMapField    map[string]map[string]int           `bsor:"7"`
+	MapArrayField     []map[int]string                    `bsor:"8"`
+	PublicKeyMapField map[string]bitcoin.PublicKey        `bsor:"9"`
+	StructKeyMapField map[TestSubStruct]string            `bsor:"10"`
+	EmptyMapField     map[string]string                   `bsor:"11"`
+	NilMapField       map[string]string                   `bsor:"12"`
+	FixedKeyMapField  map[[2]byte]*bitcoin.PublicKey      `bsor:"13"`
+	SubMapStructField map[string]TestMapSubStruct         `bsor:"14"`
+	BoolMapField      map[bool]map[int]map[string]float64 `bsor:"15"`
+}
+
+type TestMapSubStruct struct {
+	Values map[string]int `bsor:"1"`
+}
+
+func Test_Marshal_TestMapStruct(t *testing.T) {
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	pubKey := key.PublicKey()
+
+	tests := []struct {
+		value TestMapStruct
+	}{
+		{
+			value: TestMapStruct{
+				StringMapField: map[string]string{
+					"one":   "1",
+					"two":   "2",
+					"three": "3",
+				},
+				IntMapField: map[int]int{
+					-1:     0,
+					0:      1,
+					1000:   -1000,
+					123456: 7,
+				},
+				ObjectMapField: map[string]TestSubStruct{
+					"first": {
+						SubIntField:    1,
+						SubStringField: "first",
+					},
+					"empty": {},
+				},
+				ObjectPtrMapField: map[uint32]*TestSubStruct{
+					1: nil,
+					2: {
+						SubIntField:    2,
+						SubStringField: "second",
+					},
+				},
+				BinaryKeyMapField: map[bitcoin.Hash20]bool{
+					bitcoin.Hash20{0x01}: true,
+					bitcoin.Hash20{0x02}: false,
+				},
+				ArrayMapField: map[string][]string{
+					"letters": {"a", "b", "c"},
+					"none":    {},
+				},
+				NestedMapField: map[string]map[string]int{
+					"outer": {
+						"inner1": 1,
+						"inner2": 2,
+					},
+				},
+				MapArrayField: []map[int]string{
+					{1: "one"},
+					{2: "two", 3: "three"},
+				},
+				PublicKeyMapField: map[string]bitcoin.PublicKey{
+					"key": pubKey,
+				},
+				StructKeyMapField: map[TestSubStruct]string{
+					{SubIntField: 1}:        "int",
+					{SubStringField: "str"}: "string",
+				},
+				EmptyMapField: map[string]string{},
+				FixedKeyMapField: map[[2]byte]*bitcoin.PublicKey{
+					{0x01, 0x02}: &pubKey,
+					{0x03, 0x04}: nil,
+				},
+				SubMapStructField: map[string]TestMapSubStruct{
+					"sub": {
+						Values: map[string]int{"a": 1},
+					},
+				},
+				BoolMapField: map[bool]map[int]map[string]float64{
+					true: {
+						1: {"pi": 3.14159},
+					},
+					false: {
+						0: {"zero": 0.0},
+					},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("Test %d", i), func(t *testing.T) {
+			scriptItems, err := Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("Failed to marshal struct : %s", err)
+			}
+
+			script, err := scriptItems.Script()
+			if err != nil {
+				t.Fatalf("Failed to create script : %s", err)
+			}
+
+			t.Logf("Script (%d push ops): %s", len(scriptItems), script)
+
+			read := &TestMapStruct{}
+			scriptItems, err = Unmarshal(scriptItems, read)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal script : %s", err)
+			}
+
+			if len(scriptItems) != 0 {
+				t.Errorf("No script items should be remaining : %d", len(scriptItems))
+			}
+
+			if !reflect.DeepEqual(tt.value, *read) {
+				t.Errorf("Unmarshalled value not equal : %v", deep.Equal(*read, tt.value))
+			}
+
+			// Marshalling again must produce the same script regardless of map iteration order.
+			for j := 0; j < 10; j++ {
+				scriptItems, err := Marshal(*read)
+				if err != nil {
+					t.Fatalf("Failed to marshal struct : %s", err)
+				}
+
+				rescript, err := scriptItems.Script()
+				if err != nil {
+					t.Fatalf("Failed to create script : %s", err)
+				}
+
+				if !bytes.Equal(rescript, script) {
+					t.Fatalf("Script not deterministic : \n  got  : %s\n  want : %s", rescript,
+						script)
+				}
+			}
+		})
+	}
+}
+
+func Test_Marshal_MapKeyOrder(t *testing.T) {
+	// Keys are sorted by their encoding, not by insertion order.
+	value := TestMapSubStruct{
+		Values: make(map[string]int),
+	}
+	value.Values["c"] = 3
+	value.Values["a"] = 1
+	value.Values["b"] = 2
+
+	scriptItems, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal struct : %s", err)
+	}
+
+	script, err := scriptItems.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	want, err := bitcoin.ScriptItems{
+		bitcoin.PushNumberScriptItem(1), // field count
+		bitcoin.PushNumberScriptItem(1), // field id
+		bitcoin.PushNumberScriptItem(3), // entry count
+		bitcoin.NewPushDataScriptItem([]byte("a")),
+		bitcoin.PushNumberScriptItem(1),
+		bitcoin.NewPushDataScriptItem([]byte("b")),
+		bitcoin.PushNumberScriptItem(2),
+		bitcoin.NewPushDataScriptItem([]byte("c")),
+		bitcoin.PushNumberScriptItem(3),
+	}.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	if !bytes.Equal(script, want) {
+		t.Fatalf("Wrong script : \n  got  : %s\n  want : %s", script, want)
+	}
+}
+
+func Test_Unmarshal_MapDuplicateKey(t *testing.T) {
+	scriptItems := bitcoin.ScriptItems{
+		bitcoin.PushNumberScriptItem(1), // field count
+		bitcoin.PushNumberScriptItem(1), // field id
+		bitcoin.PushNumberScriptItem(2), // entry count
+		bitcoin.NewPushDataScriptItem([]byte("a")),
+		bitcoin.PushNumberScriptItem(1),
+		bitcoin.NewPushDataScriptItem([]byte("a")),
+		bitcoin.PushNumberScriptItem(2),
+	}
+
+	read := &TestMapSubStruct{}
+	if _, err := Unmarshal(scriptItems, read); errors.Cause(err) != ErrValueConversion {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrValueConversion)
+	}
+}
+
+type TestVersionedStruct struct {
+	IntField    int                      `bsor:"1"`
+	SubStruct   TestVersionedSubStruct   `bsor:"2"`
+	SubStructs  []TestVersionedSubStruct `bsor:"3"`
+	StringField string                   `bsor:"4"`
+
+	UnknownFields UnknownFields `bsor:"-"`
+}
+
+type TestVersionedSubStruct struct {
+	SubIntField int `bsor:"1"`
+
+	UnknownFields UnknownFields `bsor:"-"`
+}
+
+// TestVersionedStructNew is a newer version of TestVersionedStruct with added fields.
+type TestVersionedStructNew struct {
+	IntField       int                         `bsor:"1"`
+	SubStruct      TestVersionedSubStructNew   `bsor:"2"`
+	SubStructs     []TestVersionedSubStructNew `bsor:"3"`
+	StringField    string                      `bsor:"4"`
+	NewStructField TestSubStruct               `bsor:"5"`
+	NewArrayField  []string                    `bsor:"6"`
+	NewMapField    map[string]int              `bsor:"7"`
+}
+
+type TestVersionedSubStructNew struct {
+	SubIntField    int    `bsor:"1"`
+	SubStringField string `bsor:"2"`
+}
+
+func Test_UnknownFields(t *testing.T) {
+	value := TestVersionedStructNew{
+		IntField: 10,
+		SubStruct: TestVersionedSubStructNew{
+			SubIntField:    11,
+			SubStringField: "sub",
+		},
+		SubStructs: []TestVersionedSubStructNew{
+			{
+				SubIntField:    12,
+				SubStringField: "sub array",
+			},
+			{
+				SubIntField: 13,
+			},
+		},
+		StringField: "string",
+		NewStructField: TestSubStruct{
+			SubIntField:    14,
+			SubStringField: "new sub",
+		},
+		NewArrayField: []string{"a", "b"},
+		NewMapField: map[string]int{
+			"a": 1,
+			"b": 2,
+		},
+	}
+
+	scriptItems, err := MarshalWithOptions(value, MarshalOptions{
+		Version: EncodingVersionSkippable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal struct : %s", err)
+	}
+
+	script, err := scriptItems.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	t.Logf("Script (%d push ops): %s", len(scriptItems), script)
+
+	old := &TestVersionedStruct{}
+	if _, err := Unmarshal(scriptItems, old); errors.Cause(err) != ErrUnknownField {
+		t.Fatalf("Wrong error without allowing unknown fields : got %v, want %s", err,
+			ErrUnknownField)
+	}
+
+	old = &TestVersionedStruct{}
+	remaining, err := UnmarshalWithOptions(scriptItems, old, UnmarshalOptions{
+		AllowUnknownFields: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to unmarshal script : %s", err)
+	}
+
+	if len(remaining) != 0 {
+		t.Errorf("No script items should be remaining : %d", len(remaining))
+	}
+
+	js, _ := json.MarshalIndent(old, "", "  ")
+	t.Logf("Old Struct : %s", js)
+
+	if old.IntField != value.IntField || old.StringField != value.StringField ||
+		old.SubStruct.SubIntField != value.SubStruct.SubIntField {
+		t.Errorf("Wrong known field values")
+	}
+
+	if len(old.UnknownFields) != 3 {
+		t.Errorf("Wrong unknown field count : got %d, want %d", len(old.UnknownFields), 3)
+	}
+
+	if len(old.SubStruct.UnknownFields) != 1 {
+		t.Errorf("Wrong sub struct unknown field count : got %d, want %d",
+			len(old.SubStruct.UnknownFields), 1)
+	}
+
+	if len(old.SubStructs) != 2 || len(old.SubStructs[0].UnknownFields) != 1 ||
+		len(old.SubStructs[1].UnknownFields) != 0 {
+		t.Errorf("Wrong sub struct array unknown fields")
+	}
+
+	// Marshalling the old struct must retain the fields it doesn't know.
+	if _, err := Marshal(*old); errors.Cause(err) != ErrUnsupportedVersion {
+		t.Fatalf("Wrong error for unknown fields in initial version : got %v, want %s", err,
+			ErrUnsupportedVersion)
+	}
+
+	oldScriptItems, err := MarshalWithOptions(*old, MarshalOptions{
+		Version: EncodingVersionSkippable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal old struct : %s", err)
+	}
+
+	read := &TestVersionedStructNew{}
+	if _, err := Unmarshal(oldScriptItems, read); err != nil {
+		t.Fatalf("Failed to unmarshal old script : %s", err)
+	}
+
+	if !reflect.DeepEqual(value, *read) {
+		t.Errorf("Unmarshalled value not equal : %v", deep.Equal(*read, value))
+	}
+}
+
+func Test_EncodingVersions(t *testing.T) {
+	stringValue := "string value"
+	value := TestStructSimple{
+		IntField:    100,
+		StringField: "test string",
+		SubStruct: TestSubStruct{
+			SubIntField:    101,
+			SubStringField: "sub_string",
+		},
+		ArrayStringPtrField: []*string{
+			nil,
+			&stringValue,
+		},
+	}
+
+	tests := []struct {
+		version uint8
+		err     error
+	}{
+		{EncodingVersionInitial, nil},
+		{EncodingVersionSkippable, nil},
+		{EncodingVersionSkippable + 1, ErrUnsupportedVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Version %d", tt.version), func(t *testing.T) {
+			scriptItems, err := MarshalWithOptions(value, MarshalOptions{Version: tt.version})
+			if errors.Cause(err) != tt.err {
+				t.Fatalf("Wrong marshal error : got %v, want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				// Also verify an unsupported version header is rejected when decoding.
+				scriptItems, err = MarshalWithOptions(value, MarshalOptions{})
+				if err != nil {
+					t.Fatalf("Failed to marshal struct : %s", err)
+				}
+
+				scriptItems = append(bitcoin.ScriptItems{
+					bitcoin.PushNumberScriptItem(-int64(tt.version)),
+				}, scriptItems...)
+
+				read := &TestStructSimple{}
+				if _, err := Unmarshal(scriptItems, read); errors.Cause(err) != tt.err {
+					t.Fatalf("Wrong unmarshal error : got %v, want %v", err, tt.err)
+				}
+				return
+			}
+
+			script, err := scriptItems.Script()
+			if err != nil {
+				t.Fatalf("Failed to create script : %s", err)
+			}
+
+			t.Logf("Script (%d push ops): %s", len(scriptItems), script)
+
+			read := &TestStructSimple{}
+			remaining, err := UnmarshalBinary(script, read)
+			if err != nil {
+				t.Fatalf("Failed to unmarshal script : %s", err)
+			}
+
+			if len(remaining) != 0 {
+				t.Errorf("No script should be remaining : %d", len(remaining))
+			}
+
+			if !reflect.DeepEqual(value, *read) {
+				t.Errorf("Unmarshalled value not equal : %v", deep.Equal(*read, value))
+			}
+		})
+	}
+}
+
+func Test_UnknownFieldsInitialVersion(t *testing.T) {
+	value := TestVersionedStructNew{
+		IntField:      10,
+		NewArrayField: []string{"a"},
+	}
+
+	scriptItems, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal struct : %s", err)
+	}
+
+	// Fields can't be skipped in the initial encoding since their size isn't known.
+	read := &TestVersionedStruct{}
+	_, err = UnmarshalWithOptions(scriptItems, read, UnmarshalOptions{AllowUnknownFields: true})
+	if errors.Cause(err) != ErrUnknownField {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrUnknownField)
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	type Output struct {
+		Value uint64 `bsor:"1" tkvalidate:"min=1"`
+	}
+
+	type Request struct {
+		TxID    string   `bsor:"1" tkvalidate:"required,hexlen=2"`
+		Outputs []Output `bsor:"2" tkvalidate:"min=1"`
+	}
+
+	script, err := MarshalBinary(Request{
+		TxID:    "0a0b",
+		Outputs: []Output{{Value: 1}, {Value: 0}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	_, err = UnmarshalBinary(script, &Request{})
+	var fieldErrors validate.Errors
+	if !errors.As(err, &fieldErrors) {
+		t.Fatalf("Wrong error : got %v, want validate.Errors", err)
+	}
+
+	if len(fieldErrors) != 1 || fieldErrors[0].Path != "Outputs[1].Value" {
+		t.Errorf("Wrong error : %s", err)
+	}
+
+	scriptItems, err := Marshal(Request{})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	_, err = Unmarshal(scriptItems, &Request{})
+	if !errors.As(err, &fieldErrors) {
+		t.Fatalf("Wrong error : got %v, want validate.Errors", err)
+	}
+
+	if len(fieldErrors) != 2 {
+		t.Errorf("Wrong error : %s", err)
+	}
+}
@@ -0,0 +1,1150 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/format"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	bsorPath    = "github.com/tokenized/pkg/bsor"
+	bitcoinPath = "github.com/tokenized/pkg/bitcoin"
+	errorsPath  = "github.com/pkg/errors"
+)
+
+// generate writes MarshalBSOR and UnmarshalBSOR methods for struct types so they can be encoded
+// without reflection. It is intended to be run by go generate in the package directory.
+func generate(args []string) {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	typeList := flags.String("type", "",
+		"comma separated struct type names, default all structs with bsor tags")
+	output := flags.String("output", "bsor_generated.go", "file name written in the package")
+	flags.Parse(args)
+
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	} else if flags.NArg() > 1 {
+		usage()
+	}
+
+	var typeNames []string
+	if len(*typeList) > 0 {
+		typeNames = strings.Split(*typeList, ",")
+	}
+
+	code, err := generateCode(dir, *output, typeNames)
+	if err != nil {
+		fail("Failed to generate code", err)
+	}
+
+	path := filepath.Join(dir, *output)
+	if err := ioutil.WriteFile(path, code, 0644); err != nil {
+		fail("Failed to write file", err)
+	}
+
+	fmt.Printf("Wrote %s\n", path)
+}
+
+func generateCode(dir, output string, typeNames []string) ([]byte, error) {
+	buildPackage, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, errors.Wrap(err, "import")
+	}
+
+	fileSet := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range buildPackage.GoFiles {
+		if name == output {
+			continue // previously generated code
+		}
+
+		file, err := parser.ParseFile(fileSet, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			return nil, errors.Wrapf(err, "parse %s", name)
+		}
+		files = append(files, file)
+	}
+
+	config := &types.Config{
+		Importer: importer.ForCompiler(fileSet, "source", nil),
+	}
+	pkg, err := config.Check(buildPackage.ImportPath, fileSet, files, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "type check")
+	}
+
+	if len(typeNames) == 0 {
+		typeNames = taggedStructs(pkg, fileSet, files)
+		if len(typeNames) == 0 {
+			return nil, errors.New("No structs with bsor tags")
+		}
+	}
+
+	g := &generator{
+		pkg:       pkg,
+		generated: make(map[*types.TypeName]bool),
+		imports:   make(map[string]bool),
+	}
+
+	var structs []*types.Named
+	for _, typeName := range typeNames {
+		object, ok := pkg.Scope().Lookup(typeName).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("Type not found : %s", typeName)
+		}
+
+		named, ok := object.Type().(*types.Named)
+		if !ok {
+			return nil, fmt.Errorf("Not a named type : %s", typeName)
+		}
+
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("Not a struct : %s", typeName)
+		}
+
+		if g.isBinaryMarshaler(named) {
+			return nil, fmt.Errorf("Already implements MarshalBinary : %s", typeName)
+		}
+
+		g.generated[object] = true
+		structs = append(structs, named)
+	}
+
+	for _, named := range structs {
+		if err := g.writeMarshal(named); err != nil {
+			return nil, errors.Wrapf(err, "marshal %s", named.Obj().Name())
+		}
+
+		if err := g.writeUnmarshal(named); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal %s", named.Obj().Name())
+		}
+	}
+
+	code := &bytes.Buffer{}
+	fmt.Fprintf(code, "// Code generated by \"bsor generate\". DO NOT EDIT.\n\n")
+	fmt.Fprintf(code, "package %s\n\n", pkg.Name())
+	code.WriteString("import (\n")
+	for i, group := range g.importGroups() {
+		if i > 0 {
+			code.WriteString("\n")
+		}
+		for _, path := range group {
+			fmt.Fprintf(code, "\t%q\n", path)
+		}
+	}
+	code.WriteString(")\n")
+	code.Write(g.buf.Bytes())
+
+	result, err := format.Source(code.Bytes())
+	if err != nil {
+		return nil, errors.Wrapf(err, "format:\n%s", code.Bytes())
+	}
+
+	return result, nil
+}
+
+// taggedStructs returns the names of the structs in the files that have bsor tags.
+func taggedStructs(pkg *types.Package, fileSet *token.FileSet, files []*ast.File) []string {
+	var result []string
+	for _, file := range files {
+		for _, declaration := range file.Decls {
+			genDecl, ok := declaration.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				typeSpec := spec.(*ast.TypeSpec)
+				object, ok := pkg.Scope().Lookup(typeSpec.Name.Name).(*types.TypeName)
+				if !ok {
+					continue
+				}
+
+				structType, ok := object.Type().Underlying().(*types.Struct)
+				if !ok {
+					continue
+				}
+
+				for i := 0; i < structType.NumFields(); i++ {
+					if _, exists := reflect.StructTag(structType.Tag(i)).Lookup("bsor"); exists {
+						result = append(result, typeSpec.Name.Name)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+type generator struct {
+	pkg       *types.Package
+	generated map[*types.TypeName]bool
+	imports   map[string]bool
+	buf       bytes.Buffer
+
+	// variable is used to create unique variable names.
+	variable int
+
+	// errorReturn is the code that precedes the error in a return statement.
+	errorReturn string
+}
+
+type bsorField struct {
+	field     *types.Var
+	id        uint64
+	fixedSize uint64
+}
+
+// errorContext describes where an error happened. It is formatted with the variables into the
+// error message.
+type errorContext struct {
+	format    string
+	variables []string
+}
+
+func (c errorContext) with(format string, variables ...string) errorContext {
+	return errorContext{
+		format:    c.format + " " + format,
+		variables: append(append([]string{}, c.variables...), variables...),
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+	g.buf.WriteByte('\n')
+}
+
+func (g *generator) newVariable(name string) string {
+	g.variable++
+	return fmt.Sprintf("%s%d", name, g.variable)
+}
+
+func (g *generator) qualifier(pkg *types.Package) string {
+	if pkg == g.pkg {
+		return ""
+	}
+
+	g.imports[pkg.Path()] = true
+	return pkg.Name()
+}
+
+func (g *generator) typeString(typ types.Type) string {
+	return types.TypeString(typ, g.qualifier)
+}
+
+func (g *generator) importGroups() [][]string {
+	g.imports[bsorPath] = true
+
+	body := g.buf.String()
+	if strings.Contains(body, "bitcoin.") {
+		g.imports[bitcoinPath] = true
+	}
+	if strings.Contains(body, "errors.") {
+		g.imports[errorsPath] = true
+	}
+	if strings.Contains(body, "math.") {
+		g.imports["math"] = true
+	}
+	if strings.Contains(body, "reflect.") {
+		g.imports["reflect"] = true
+	}
+
+	// Standard library, then tokenized, then other packages.
+	groups := make([][]string, 3)
+	for path := range g.imports {
+		switch {
+		case !strings.Contains(strings.Split(path, "/")[0], "."):
+			groups[0] = append(groups[0], path)
+		case strings.HasPrefix(path, "github.com/tokenized/"):
+			groups[1] = append(groups[1], path)
+		default:
+			groups[2] = append(groups[2], path)
+		}
+	}
+
+	var result [][]string
+	for _, group := range groups {
+		if len(group) > 0 {
+			sort.Strings(group)
+			result = append(result, group)
+		}
+	}
+	return result
+}
+
+// returnError writes a return of the error wrapped with the context.
+func (g *generator) returnError(context errorContext) {
+	if len(context.variables) == 0 {
+		g.printf("return %serrors.Wrap(err, %q)", g.errorReturn, context.format)
+		return
+	}
+
+	g.printf("return %serrors.Wrapf(err, %q, %s)", g.errorReturn, context.format,
+		strings.Join(context.variables, ", "))
+}
+
+// returnNewError writes a return of an error with the message formatted with the variables.
+func (g *generator) returnNewError(context errorContext, message string, variables ...string) {
+	variables = append(append([]string{}, context.variables...), variables...)
+	g.printf("return %serrors.Wrapf(bsor.ErrValueConversion, %q, %s)", g.errorReturn,
+		context.format+": "+message, strings.Join(variables, ", "))
+}
+
+func (g *generator) checkError(context errorContext) {
+	g.printf("if err != nil {")
+	g.returnError(context)
+	g.printf("}")
+}
+
+func (g *generator) structFields(named *types.Named) ([]*bsorField, *types.Var, error) {
+	structType := named.Underlying().(*types.Struct)
+
+	var fields []*bsorField
+	var unknownFields *types.Var
+	ids := make(map[uint64]bool)
+	for i := 0; i < structType.NumFields(); i++ {
+		field := structType.Field(i)
+		tag := reflect.StructTag(structType.Tag(i))
+
+		if isUnknownFields(field.Type()) {
+			if field.Exported() {
+				unknownFields = field
+			}
+			continue // holds fields that were skipped when decoding
+		}
+
+		idString, hasTag := tag.Lookup("bsor")
+		if !field.Exported() {
+			if hasTag {
+				return nil, nil, fmt.Errorf("\"bsor\" tag on unexported field: %s", field.Name())
+			}
+			continue // not exported, "private" lower case field name
+		}
+
+		if !hasTag || len(idString) == 0 {
+			return nil, nil, fmt.Errorf("missing \"bsor\" tag: %s", field.Name())
+		}
+
+		if idString == "-" {
+			continue // this field was explicitly excluded from BSOR data
+		}
+
+		id, err := strconv.ParseUint(idString, 10, 64)
+		if err != nil || id == 0 {
+			return nil, nil, fmt.Errorf("bsor tag invalid: \"%s\": %s", idString, field.Name())
+		}
+
+		if ids[id] {
+			return nil, nil, fmt.Errorf("duplicate bsor id %d: %s", id, field.Name())
+		}
+		ids[id] = true
+
+		var fixedSize uint64
+		if fixedSizeString := tag.Get("bsor_fixed_size"); len(fixedSizeString) > 0 {
+			fixedSize, err = strconv.ParseUint(fixedSizeString, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("bsor_fixed_size tag invalid integer: \"%s\": %s",
+					fixedSizeString, field.Name())
+			}
+		}
+
+		fields = append(fields, &bsorField{
+			field:     field,
+			id:        id,
+			fixedSize: fixedSize,
+		})
+	}
+
+	return fields, unknownFields, nil
+}
+
+func isUnknownFields(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	object := named.Obj()
+	return object.Pkg() != nil && object.Pkg().Path() == bsorPath &&
+		object.Name() == "UnknownFields"
+}
+
+func hasMethod(typ types.Type, name string) bool {
+	return types.NewMethodSet(typ).Lookup(nil, name) != nil
+}
+
+func (g *generator) isBinaryMarshaler(typ types.Type) bool {
+	return hasMethod(typ, "MarshalBinary")
+}
+
+// isBinaryUnmarshaler returns true if a pointer to the type implements UnmarshalBinary.
+func (g *generator) isBinaryUnmarshaler(typ types.Type) bool {
+	return hasMethod(types.NewPointer(typ), "UnmarshalBinary")
+}
+
+func (g *generator) isGenerated(typ types.Type) bool {
+	named, ok := typ.(*types.Named)
+	return ok && g.generated[named.Obj()]
+}
+
+func (g *generator) isMarshaler(typ types.Type) bool {
+	return g.isGenerated(typ) || hasMethod(typ, "MarshalBSOR")
+}
+
+// isUnmarshaler returns true if a pointer to the type implements UnmarshalBSOR.
+func (g *generator) isUnmarshaler(typ types.Type) bool {
+	return g.isGenerated(typ) || hasMethod(types.NewPointer(typ), "UnmarshalBSOR")
+}
+
+// isNamed returns true if the type is the named type from the package.
+func isNamed(typ types.Type, path, name string) bool {
+	named, ok := typ.(*types.Named)
+	if !ok {
+		return false
+	}
+
+	object := named.Obj()
+	return object.Pkg() != nil && object.Pkg().Path() == path && object.Name() == name
+}
+
+// hasBaseType returns true for time.Time and big.Int, which have their own encodings even though
+// they implement MarshalBinary or are structs.
+func hasBaseType(typ types.Type) bool {
+	return isNamed(typ, "time", "Time") || isNamed(typ, "math/big", "Int")
+}
+
+func isStruct(typ types.Type) bool {
+	_, ok := typ.Underlying().(*types.Struct)
+	return ok
+}
+
+func isByte(typ types.Type) bool {
+	return types.Identical(typ, types.Typ[types.Byte])
+}
+
+// nonZero returns an expression that is true when the value is not the zero value. Zero values are
+// not encoded.
+func (g *generator) nonZero(expression string, typ types.Type) string {
+	switch underlying := typ.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Interface, *types.Chan,
+		*types.Signature:
+		return expression + " != nil"
+
+	case *types.Basic:
+		info := underlying.Info()
+		switch {
+		case info&types.IsString != 0:
+			return expression + ` != ""`
+		case info&types.IsBoolean != 0:
+			return expression
+		case underlying.Kind() == types.Float32:
+			return fmt.Sprintf("math.Float32bits(float32(%s)) != 0", expression)
+		case underlying.Kind() == types.Float64:
+			return fmt.Sprintf("math.Float64bits(float64(%s)) != 0", expression)
+		default:
+			return expression + " != 0"
+		}
+	}
+
+	if types.Comparable(typ) {
+		return fmt.Sprintf("%s != (%s{})", expression, g.typeString(typ))
+	}
+
+	return fmt.Sprintf("!reflect.ValueOf(%s).IsZero()", expression)
+}
+
+func (g *generator) writeMarshal(named *types.Named) error {
+	fields, unknownFields, err := g.structFields(named)
+	if err != nil {
+		return err
+	}
+
+	name := named.Obj().Name()
+	g.errorReturn = ""
+
+	g.printf("")
+	g.printf("// MarshalBSOR writes the field count followed by the fields of %s.", name)
+	g.printf("func (v %s) MarshalBSOR(w *bsor.ScriptItemWriter,", name)
+	g.printf("options *bsor.EncodeOptions) error {")
+	g.printf("")
+
+	// The field count precedes the fields.
+	if unknownFields != nil {
+		g.printf("fieldCount := len(v.%s)", unknownFields.Name())
+	} else {
+		g.printf("fieldCount := 0")
+	}
+	for _, field := range fields {
+		g.printf("if %s {", g.nonZero("v."+field.field.Name(), field.field.Type()))
+		g.printf("fieldCount++")
+		g.printf("}")
+	}
+	g.printf("encoder := bsor.NewObjectEncoder(w, fieldCount, options)")
+
+	for _, field := range fields {
+		expression := "v." + field.field.Name()
+		typ := field.field.Type()
+		context := errorContext{format: field.field.Name()}
+
+		g.printf("")
+		g.printf("if %s {", g.nonZero(expression, typ))
+		g.printf("fieldWriter := encoder.StartField(%d)", field.id)
+		if err := g.encodeField("fieldWriter", expression, typ, field.fixedSize,
+			context); err != nil {
+			return errors.Wrap(err, field.field.Name())
+		}
+		g.printf("encoder.EndField()")
+		g.printf("}")
+	}
+
+	if unknownFields != nil {
+		g.printf("")
+		g.printf("if err := encoder.WriteUnknownFields(v.%s); err != nil {", unknownFields.Name())
+		g.returnError(errorContext{format: "unknown fields"})
+		g.printf("}")
+	}
+
+	g.printf("")
+	g.printf("return encoder.Close()")
+	g.printf("}")
+	return nil
+}
+
+// encodeField writes the encoding of a field value that is not zero.
+func (g *generator) encodeField(target, expression string, typ types.Type, fixedSize uint64,
+	context errorContext) error {
+
+	switch typ.Underlying().(type) {
+	case *types.Pointer, *types.Struct, *types.Interface:
+		return g.encodeObject(target, expression, typ, false, context)
+	default:
+		return g.encodePrimitive(target, expression, typ, fixedSize, false, context)
+	}
+}
+
+// encodeObject writes the encoding of a value that is a field, array item, or map key or value.
+// Pointers in arrays and maps are preceded by a value that specifies if they are nil.
+func (g *generator) encodeObject(target, expression string, typ types.Type, inArray bool,
+	context errorContext) error {
+
+	if pointer, ok := typ.Underlying().(*types.Pointer); ok {
+		elem := pointer.Elem()
+		if _, ok := elem.Underlying().(*types.Pointer); ok {
+			return g.encodeReflect(target, expression, inArray, context)
+		}
+
+		if inArray {
+			g.printf("if %s == nil {", expression)
+			g.printf("%s.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))", target)
+			g.printf("} else {")
+			g.printf("%s.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))", target)
+		}
+
+		var err error
+		if isNamed(elem, "math/big", "Int") {
+			g.printf("%s.Add(bsor.BigIntScriptItem(%s))", target, expression)
+		} else if hasBaseType(elem) {
+			err = g.encodePrimitive(target, "(*"+expression+")", elem, 0, inArray, context)
+		} else if g.isBinaryMarshaler(typ) {
+			g.encodeBinary(target, expression, context)
+		} else if isStruct(elem) {
+			err = g.encodeStruct(target, expression, elem, context)
+		} else {
+			err = g.encodePrimitive(target, "(*"+expression+")", elem, 0, inArray, context)
+		}
+
+		if inArray {
+			g.printf("}")
+		}
+		return err
+	}
+
+	if hasBaseType(typ) {
+		return g.encodePrimitive(target, expression, typ, 0, inArray, context)
+	}
+
+	if g.isBinaryMarshaler(typ) {
+		g.encodeBinary(target, expression, context)
+		return nil
+	}
+
+	switch typ.Underlying().(type) {
+	case *types.Struct:
+		return g.encodeStruct(target, expression, typ, context)
+	case *types.Interface:
+		g.printf("if err := bsor.MarshalUnion(%s, &%s, options); err != nil {", target,
+			expression)
+		g.returnError(context)
+		g.printf("}")
+		return nil
+	default:
+		return g.encodePrimitive(target, expression, typ, 0, inArray, context)
+	}
+}
+
+func (g *generator) encodeBinary(target, expression string, context errorContext) {
+	b := g.newVariable("b")
+	g.printf("%s, err := %s.MarshalBinary()", b, expression)
+	g.checkError(context.with("binary marshal"))
+	g.printf("%s.Add(bitcoin.NewPushDataScriptItem(%s))", target, b)
+}
+
+func (g *generator) encodeStruct(target, expression string, typ types.Type,
+	context errorContext) error {
+
+	if !g.isMarshaler(typ) {
+		return g.encodeReflect(target, expression, false, context)
+	}
+
+	g.printf("if err := %s.MarshalBSOR(%s, options); err != nil {", expression, target)
+	g.returnError(context)
+	g.printf("}")
+	return nil
+}
+
+// encodeReflect writes the encoding of a value using reflection.
+func (g *generator) encodeReflect(target, expression string, inArray bool,
+	context errorContext) error {
+
+	g.printf("if err := bsor.MarshalValue(%s, %s, %t, options); err != nil {", target,
+		expression, inArray)
+	g.returnError(context)
+	g.printf("}")
+	return nil
+}
+
+func (g *generator) encodePrimitive(target, expression string, typ types.Type, fixedSize uint64,
+	inArray bool, context errorContext) error {
+
+	if isNamed(typ, "time", "Time") {
+		item := g.newVariable("item")
+		g.printf("%s, err := bsor.TimeScriptItem(%s)", item, expression)
+		g.checkError(context)
+		g.printf("%s.Add(%s)", target, item)
+		return nil
+	}
+
+	if isNamed(typ, "math/big", "Int") {
+		g.printf("%s.Add(bsor.BigIntScriptItem(&%s))", target, expression)
+		return nil
+	}
+
+	switch underlying := typ.Underlying().(type) {
+	case *types.Basic:
+		info := underlying.Info()
+		switch {
+		case info&types.IsString != 0:
+			if fixedSize > 0 {
+				g.printf("if len(%s) != %d {", expression, fixedSize)
+				g.returnNewError(context, "Fixed string wrong size : got %d, want %d",
+					"len("+expression+")", strconv.FormatUint(fixedSize, 10))
+				g.printf("}")
+			}
+			g.printf("%s.Add(bitcoin.NewPushDataScriptItem([]byte(%s)))", target, expression)
+
+		case info&types.IsBoolean != 0:
+			g.printf("if %s {", expression)
+			g.printf("%s.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))", target)
+			g.printf("} else {")
+			g.printf("%s.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))", target)
+			g.printf("}")
+
+		case info&types.IsUnsigned != 0:
+			g.printf("%s.Add(bitcoin.PushNumberScriptItemUnsigned(uint64(%s)))", target, expression)
+
+		case info&types.IsInteger != 0:
+			g.printf("%s.Add(bitcoin.PushNumberScriptItem(int64(%s)))", target,
+				expression)
+
+		case underlying.Kind() == types.Float32:
+			g.printf("%s.Add(bsor.Float32ScriptItem(float32(%s)))", target,
+				expression)
+
+		case underlying.Kind() == types.Float64:
+			g.printf("%s.Add(bsor.Float64ScriptItem(float64(%s)))", target,
+				expression)
+
+		default:
+			return fmt.Errorf("unsupported type: %s", typ)
+		}
+
+		return nil
+
+	case *types.Array:
+		if isByte(underlying.Elem()) {
+			if fixedSize > 0 && fixedSize != uint64(underlying.Len()) {
+				return fmt.Errorf("fixed size %d doesn't match array length %d", fixedSize,
+					underlying.Len())
+			}
+
+			// Copy so the script doesn't reference the value.
+			g.printf("%s.Add(bitcoin.NewPushDataScriptItem(append([]byte{}, %s[:]...)))", target,
+				expression)
+			return nil
+		}
+
+		return g.encodeItems(target, expression, underlying.Elem(), context)
+
+	case *types.Slice:
+		if isByte(underlying.Elem()) {
+			if fixedSize > 0 {
+				g.printf("if len(%s) != %d {", expression, fixedSize)
+				g.returnNewError(context, "Fixed binary wrong size : got %d, want %d",
+					"len("+expression+")", strconv.FormatUint(fixedSize, 10))
+				g.printf("}")
+			}
+			g.printf("%s.Add(bitcoin.NewPushDataScriptItem([]byte(%s)))", target, expression)
+			return nil
+		}
+
+		g.printf("%s.Add(bitcoin.PushNumberScriptItem(int64(len(%s))))", target, expression)
+		return g.encodeItems(target, expression, underlying.Elem(), context)
+
+	case *types.Map:
+		if _, ok := underlying.Key().Underlying().(*types.Pointer); ok {
+			return fmt.Errorf("pointer map key: %s", typ)
+		}
+
+		encoder := g.newVariable("mapEncoder")
+		key := g.newVariable("key")
+		value := g.newVariable("value")
+		keyWriter := g.newVariable("keyWriter")
+		valueWriter := g.newVariable("valueWriter")
+
+		// Entries are buffered so they can be sorted.
+		g.printf("%s := bsor.NewMapEncoder(len(%s))", encoder, expression)
+		g.printf("for %s, %s := range %s {", key, value, expression)
+		g.printf("%s := &bsor.ScriptItemWriter{}", keyWriter)
+		if err := g.encodeObject(keyWriter, key, underlying.Key(), true,
+			context.with("key")); err != nil {
+			return errors.Wrap(err, "key")
+		}
+		g.printf("%s := &bsor.ScriptItemWriter{}", valueWriter)
+		if err := g.encodeObject(valueWriter, value, underlying.Elem(), true,
+			context.with("value")); err != nil {
+			return errors.Wrap(err, "value")
+		}
+		g.printf("if err := %s.Add(%s.ScriptItems(), %s.ScriptItems()); err != nil {", encoder,
+			keyWriter, valueWriter)
+		g.returnError(context.with("entry"))
+		g.printf("}")
+		g.printf("}")
+
+		g.printf("if err := %s.Write(%s); err != nil {", encoder, target)
+		g.returnError(context)
+		g.printf("}")
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported type: %s", typ)
+	}
+}
+
+func (g *generator) encodeItems(target, expression string, elem types.Type,
+	context errorContext) error {
+
+	index := g.newVariable("i")
+	item := g.newVariable("item")
+
+	// Write the loop body first so the index can be left out when no error message uses it.
+	outer := g.buf
+	g.buf = bytes.Buffer{}
+	err := g.encodeObject(target, item, elem, true, context.with("item %d", index))
+	body := g.buf
+	g.buf = outer
+	if err != nil {
+		return errors.Wrap(err, "item")
+	}
+
+	if !regexp.MustCompile(`\b` + index + `\b`).Match(body.Bytes()) {
+		index = "_"
+	}
+
+	g.printf("for %s, %s := range %s {", index, item, expression)
+	g.buf.Write(body.Bytes())
+	g.printf("}")
+	return nil
+}
+
+func (g *generator) writeUnmarshal(named *types.Named) error {
+	fields, unknownFields, err := g.structFields(named)
+	if err != nil {
+		return err
+	}
+
+	name := named.Obj().Name()
+	g.errorReturn = "true, "
+
+	g.printf("")
+	g.printf("// UnmarshalBSOR reads the field count followed by the fields of %s.", name)
+	g.printf("func (v *%s) UnmarshalBSOR(r *bsor.ScriptItemReader,", name)
+	g.printf("options *bsor.DecodeOptions) error {")
+	g.printf("")
+
+	if unknownFields != nil {
+		g.printf("unknownFields, err := bsor.UnmarshalFields(r, options, %q,", name)
+	} else {
+		g.printf("_, err := bsor.UnmarshalFields(r, options, %q,", name)
+	}
+	g.printf("func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {")
+
+	if len(fields) == 0 {
+		g.printf("return false, nil")
+	} else {
+		g.printf("switch id {")
+		for _, field := range fields {
+			typ := field.field.Type()
+			context := errorContext{format: field.field.Name()}
+
+			g.printf("case %d:", field.id)
+			if err := g.decodeField("value", typ, field.fixedSize, context); err != nil {
+				return errors.Wrap(err, field.field.Name())
+			}
+			g.printf("v.%s = value", field.field.Name())
+			g.printf("")
+		}
+		g.printf("default:")
+		g.printf("return false, nil")
+		g.printf("}")
+		g.printf("")
+		g.printf("return true, nil")
+	}
+
+	g.printf("})")
+	g.printf("if err != nil {")
+	g.printf("return err")
+	g.printf("}")
+
+	if unknownFields != nil {
+		g.printf("")
+		g.printf("if len(unknownFields) > 0 {")
+		g.printf("v.%s = unknownFields", unknownFields.Name())
+		g.printf("}")
+	}
+
+	g.printf("")
+	g.printf("return nil")
+	g.printf("}")
+	return nil
+}
+
+// decodeField writes the decoding of a field into target, which is declared as a new variable.
+func (g *generator) decodeField(target string, typ types.Type, fixedSize uint64,
+	context errorContext) error {
+
+	if pointer, ok := typ.Underlying().(*types.Pointer); ok {
+		if isNamed(pointer.Elem(), "math/big", "Int") {
+			g.printf("%s, err := bsor.ReadBigInt(fieldReader)", target)
+			g.checkError(context.with("big int"))
+			return nil
+		}
+
+		// Pointer fields are always set when they are encoded, even if the value has no fields.
+		g.printf("%s := new(%s)", target, g.typeString(pointer.Elem()))
+		return g.decodeObject("(*"+target+")", pointer.Elem(), false, fixedSize, context)
+	}
+
+	g.printf("var %s %s", target, g.typeString(typ))
+	switch typ.Underlying().(type) {
+	case *types.Struct, *types.Interface:
+		return g.decodeObject(target, typ, false, fixedSize, context)
+	default:
+		return g.decodePrimitive(target, typ, fixedSize, false, context)
+	}
+}
+
+// decodeObject writes the decoding of a value that is a field, array item, or map key or value.
+// target must be addressable and contain the zero value.
+func (g *generator) decodeObject(target string, typ types.Type, inArray bool, fixedSize uint64,
+	context errorContext) error {
+
+	if pointer, ok := typ.Underlying().(*types.Pointer); ok {
+		elem := pointer.Elem()
+
+		baseType := hasBaseType(elem)
+		binary := !baseType && g.isBinaryUnmarshaler(elem)
+		switch elem.Underlying().(type) {
+		case *types.Pointer, *types.Interface:
+			return g.decodeReflect(target, inArray, context)
+		case *types.Struct:
+			if !baseType && !binary && !g.isUnmarshaler(elem) {
+				return g.decodeReflect(target, inArray, context)
+			}
+		}
+
+		if inArray {
+			notNil := g.newVariable("notNil")
+			g.printf("%s, err := bsor.ReadUnsignedInteger(fieldReader)", notNil)
+			g.checkError(context.with("not nil"))
+			g.printf("if %s != 0 {", notNil)
+		}
+
+		item := g.newVariable("item")
+		var err error
+		if isNamed(elem, "math/big", "Int") {
+			value := g.newVariable("value")
+			g.printf("%s, err := bsor.ReadBigInt(fieldReader)", value)
+			g.checkError(context.with("big int"))
+			g.printf("%s = %s", target, value)
+		} else if baseType {
+			g.printf("%s := new(%s)", item, g.typeString(elem))
+			err = g.decodePrimitive("(*"+item+")", elem, fixedSize, inArray, context)
+			g.printf("%s = %s", target, item)
+		} else if binary {
+			b := g.newVariable("b")
+			g.printf("%s, err := bsor.ReadBytes(fieldReader)", b)
+			g.checkError(context.with("bytes"))
+			g.printf("%s := new(%s)", item, g.typeString(elem))
+			g.printf("if err := %s.UnmarshalBinary(%s); err != nil {", item, b)
+			g.returnError(context.with("binary unmarshal"))
+			g.printf("}")
+			g.printf("%s = %s", target, item)
+		} else if isStruct(elem) {
+			// Pointers to objects without fields are left nil.
+			empty := g.newVariable("empty")
+			g.printf("%s, err := bsor.SkipEmptyObject(fieldReader)", empty)
+			g.checkError(context)
+			g.printf("if !%s {", empty)
+			g.printf("%s := new(%s)", item, g.typeString(elem))
+			g.printf("if err := %s.UnmarshalBSOR(fieldReader, options); err != nil {", item)
+			g.returnError(context)
+			g.printf("}")
+			g.printf("%s = %s", target, item)
+			g.printf("}")
+		} else {
+			g.printf("%s := new(%s)", item, g.typeString(elem))
+			err = g.decodePrimitive("(*"+item+")", elem, fixedSize, inArray, context)
+			g.printf("%s = %s", target, item)
+		}
+
+		if inArray {
+			g.printf("}")
+		}
+		return err
+	}
+
+	if hasBaseType(typ) {
+		return g.decodePrimitive(target, typ, fixedSize, inArray, context)
+	}
+
+	if g.isBinaryUnmarshaler(typ) {
+		b := g.newVariable("b")
+		g.printf("%s, err := bsor.ReadBytes(fieldReader)", b)
+		g.checkError(context.with("bytes"))
+		g.printf("if err := %s.UnmarshalBinary(%s); err != nil {", target, b)
+		g.returnError(context.with("binary unmarshal"))
+		g.printf("}")
+		return nil
+	}
+
+	switch typ.Underlying().(type) {
+	case *types.Struct:
+		if !g.isUnmarshaler(typ) {
+			return g.decodeReflect(target, inArray, context)
+		}
+
+		g.printf("if err := %s.UnmarshalBSOR(fieldReader, options); err != nil {", target)
+		g.returnError(context)
+		g.printf("}")
+		return nil
+
+	case *types.Interface:
+		return g.decodeReflect(target, inArray, context)
+
+	default:
+		return g.decodePrimitive(target, typ, fixedSize, inArray, context)
+	}
+}
+
+// decodeReflect writes the decoding of a value using reflection.
+func (g *generator) decodeReflect(target string, inArray bool, context errorContext) error {
+	g.printf("if err := bsor.UnmarshalValue(fieldReader, &%s, %t, options); err != nil {",
+		target, inArray)
+	g.returnError(context)
+	g.printf("}")
+	return nil
+}
+
+func (g *generator) decodePrimitive(target string, typ types.Type, fixedSize uint64,
+	inArray bool, context errorContext) error {
+
+	typeString := g.typeString(typ)
+
+	if isNamed(typ, "time", "Time") {
+		value := g.newVariable("value")
+		g.printf("%s, err := bsor.ReadTime(fieldReader)", value)
+		g.checkError(context.with("time"))
+		g.printf("%s = %s", target, value)
+		return nil
+	}
+
+	if isNamed(typ, "math/big", "Int") {
+		value := g.newVariable("value")
+		g.printf("%s, err := bsor.ReadBigInt(fieldReader)", value)
+		g.checkError(context.with("big int"))
+		g.printf("%s = *%s", target, value)
+		return nil
+	}
+
+	switch underlying := typ.Underlying().(type) {
+	case *types.Basic:
+		info := underlying.Info()
+		value := g.newVariable("value")
+		switch {
+		case info&types.IsString != 0:
+			g.printf("%s, err := bsor.ReadBytes(fieldReader)", value)
+			g.checkError(context.with("bytes"))
+			if fixedSize > 0 {
+				g.printf("if len(%s) != %d {", value, fixedSize)
+				g.returnNewError(context, "Fixed string wrong size : got %d, want %d",
+					"len("+value+")", strconv.FormatUint(fixedSize, 10))
+				g.printf("}")
+			}
+			g.printf("%s = %s(%s)", target, typeString, value)
+
+		case info&types.IsBoolean != 0:
+			g.printf("%s, err := bsor.ReadUnsignedInteger(fieldReader)", value)
+			g.checkError(context.with("bool"))
+			g.printf("%s = %s != 0", target, value)
+
+		case info&types.IsUnsigned != 0:
+			g.printf("%s, err := bsor.ReadUnsignedInteger(fieldReader)", value)
+			g.checkError(context.with("integer"))
+			g.printf("%s = %s(%s)", target, typeString, value)
+
+		case info&types.IsInteger != 0:
+			g.printf("%s, err := bsor.ReadInteger(fieldReader)", value)
+			g.checkError(context.with("integer"))
+			g.printf("%s = %s(%s)", target, typeString, value)
+
+		case underlying.Kind() == types.Float32:
+			g.printf("%s, err := bsor.ReadFloat32(fieldReader)", value)
+			g.checkError(context.with("float32"))
+			g.printf("%s = %s(%s)", target, typeString, value)
+
+		case underlying.Kind() == types.Float64:
+			g.printf("%s, err := bsor.ReadFloat64(fieldReader)", value)
+			g.checkError(context.with("float64"))
+			g.printf("%s = %s(%s)", target, typeString, value)
+
+		default:
+			return fmt.Errorf("unsupported type: %s", typ)
+		}
+
+		return nil
+
+	case *types.Array:
+		if isByte(underlying.Elem()) {
+			b := g.newVariable("b")
+			g.printf("%s, err := bsor.ReadBytes(fieldReader)", b)
+			g.checkError(context.with("fixed bytes"))
+			if fixedSize > 0 {
+				g.printf("if len(%s) != %d {", b, fixedSize)
+				g.returnNewError(context, "Fixed binary wrong size : got %d, want %d",
+					"len("+b+")", strconv.FormatUint(fixedSize, 10))
+				g.printf("}")
+			}
+			g.printf("copy(%s[:], %s)", target, b)
+			return nil
+		}
+
+		return g.decodeItems(target, underlying.Elem(), context)
+
+	case *types.Slice:
+		if isByte(underlying.Elem()) {
+			b := g.newVariable("b")
+			g.printf("%s, err := bsor.ReadBytes(fieldReader)", b)
+			g.checkError(context.with("bytes"))
+			if fixedSize > 0 {
+				g.printf("if len(%s) != %d {", b, fixedSize)
+				g.returnNewError(context, "Fixed binary wrong size : got %d, want %d",
+					"len("+b+")", strconv.FormatUint(fixedSize, 10))
+				g.printf("}")
+			}
+			g.printf("%s = %s(%s)", target, typeString, b)
+			return nil
+		}
+
+		// Items are appended so a corrupt count can't allocate more than the script contains.
+		count := g.newVariable("count")
+		capacity := g.newVariable("capacity")
+		index := g.newVariable("i")
+		item := g.newVariable("item")
+		g.printf("%s, %s, err := bsor.ReadItemCount(fieldReader)", count, capacity)
+		g.checkError(context.with("count"))
+		g.printf("%s = make(%s, 0, %s)", target, typeString, capacity)
+		g.printf("for %s := uint64(0); %s < %s; %s++ {", index, index, count, index)
+		g.printf("var %s %s", item, g.typeString(underlying.Elem()))
+		if err := g.decodeObject(item, underlying.Elem(), true, 0,
+			context.with("item %d", index)); err != nil {
+			return errors.Wrap(err, "item")
+		}
+		g.printf("%s = append(%s, %s)", target, target, item)
+		g.printf("}")
+		return nil
+
+	case *types.Map:
+		count := g.newVariable("count")
+		result := g.newVariable("m")
+		index := g.newVariable("i")
+		key := g.newVariable("key")
+		value := g.newVariable("value")
+
+		capacity := g.newVariable("capacity")
+
+		g.printf("%s, %s, err := bsor.ReadItemCount(fieldReader)", count, capacity)
+		g.checkError(context.with("count"))
+		g.printf("%s := make(%s, %s)", result, typeString, capacity)
+		g.printf("for %s := uint64(0); %s < %s; %s++ {", index, index, count, index)
+		g.printf("var %s %s", key, g.typeString(underlying.Key()))
+		if err := g.decodeObject(key, underlying.Key(), true, 0,
+			context.with("key %d", index)); err != nil {
+			return errors.Wrap(err, "key")
+		}
+		g.printf("if _, exists := %s[%s]; exists {", result, key)
+		g.returnNewError(context, "duplicate map key %d", index)
+		g.printf("}")
+		g.printf("var %s %s", value, g.typeString(underlying.Elem()))
+		if err := g.decodeObject(value, underlying.Elem(), true, 0,
+			context.with("value %d", index)); err != nil {
+			return errors.Wrap(err, "value")
+		}
+		g.printf("%s[%s] = %s", result, key, value)
+		g.printf("}")
+		g.printf("%s = %s", target, result)
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported type: %s", typ)
+	}
+}
+
+func (g *generator) decodeItems(target string, elem types.Type, context errorContext) error {
+	index := g.newVariable("i")
+	g.printf("for %s := range %s {", index, target)
+	if err := g.decodeObject(target+"["+index+"]", elem, true, 0,
+		context.with("item %d", index)); err != nil {
+		return errors.Wrap(err, "item")
+	}
+	g.printf("}")
+	return nil
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+
+	"github.com/pkg/errors"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "decode":
+		decode(os.Args[2:])
+	case "encode":
+		encode(os.Args[2:])
+	case "types":
+		printTypes(os.Args[2:])
+	case "compare":
+		compare(os.Args[2:])
+	case "generate":
+		generate(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	println("Usage:")
+	println("  bsor decode [-allow-unknown] <definitions file> <type name> <script hex|base64|->")
+	println("      Print the BSOR script as JSON. The script is read from stdin when it is \"-\".")
+	println("  bsor encode [-version n] <definitions file> <type name> <json file|->")
+	println("      Print the JSON as a hex BSOR script. The JSON is read from stdin when it is \"-\".")
+	println("  bsor types <definitions file>")
+	println("      Print the type names in a definitions file.")
+	println("  bsor compare [-forward] [-allow-unknown] <old definitions file> <new definitions file>")
+	println("      Print changes that prevent data encoded with the old definitions from being")
+	println("      decoded with the new definitions. Exits with 1 when there are any.")
+	println("  bsor generate [-type T1,T2] [-output file] [package directory]")
+	println("      Write MarshalBSOR and UnmarshalBSOR methods so the structs are encoded without")
+	println("      reflection. Types default to all structs with bsor tags.")
+	println()
+	println("Definitions files are in the text or JSON form written by bsor.Definitions.")
+	os.Exit(1)
+}
+
+func decode(args []string) {
+	flags := flag.NewFlagSet("decode", flag.ExitOnError)
+	allowUnknown := flags.Bool("allow-unknown", false, "skip fields not in the definitions")
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		usage()
+	}
+
+	definitions := readDefinitions(flags.Arg(0))
+	typeName := flags.Arg(1)
+
+	script, err := readScript(flags.Arg(2))
+	if err != nil {
+		fail("Failed to read script", err)
+	}
+
+	scriptItems, err := bitcoin.ParseScriptItems(bytes.NewReader(script), -1)
+	if err != nil {
+		fail("Failed to parse script", err)
+	}
+
+	value, remaining, err := definitions.UnmarshalDynamic(scriptItems, typeName,
+		bsor.UnmarshalOptions{
+			AllowUnknownFields: *allowUnknown,
+		})
+	if err != nil {
+		fail("Failed to decode script", err)
+	}
+
+	js, err := bsor.DynamicToJSON(value)
+	if err != nil {
+		fail("Failed to convert to JSON", err)
+	}
+
+	indented := &bytes.Buffer{}
+	if err := json.Indent(indented, js, "", "  "); err != nil {
+		fail("Failed to indent JSON", err)
+	}
+	fmt.Println(indented.String())
+
+	if object, ok := value.(*bsor.Object); ok && len(object.UnknownFields) > 0 {
+		fmt.Fprintf(os.Stderr, "Skipped %d unknown fields\n", len(object.UnknownFields))
+	}
+
+	if len(remaining) > 0 {
+		remainingScript, _ := remaining.Script()
+		fmt.Fprintf(os.Stderr, "Remaining script (%d items) : %s\n", len(remaining),
+			remainingScript)
+	}
+}
+
+func encode(args []string) {
+	flags := flag.NewFlagSet("encode", flag.ExitOnError)
+	version := flags.Uint("version", uint(bsor.EncodingVersionInitial), "encoding version")
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		usage()
+	}
+
+	definitions := readDefinitions(flags.Arg(0))
+	typeName := flags.Arg(1)
+
+	js, err := readFileOrStdin(flags.Arg(2))
+	if err != nil {
+		fail("Failed to read JSON", err)
+	}
+
+	value, err := definitions.DynamicFromJSON(js, typeName)
+	if err != nil {
+		fail("Failed to convert from JSON", err)
+	}
+
+	scriptItems, err := definitions.MarshalDynamic(value, typeName, bsor.MarshalOptions{
+		Version: uint8(*version),
+	})
+	if err != nil {
+		fail("Failed to encode", err)
+	}
+
+	script, err := scriptItems.Script()
+	if err != nil {
+		fail("Failed to create script", err)
+	}
+
+	fmt.Println(hex.EncodeToString(script))
+}
+
+func printTypes(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+
+	definitions := readDefinitions(args[0])
+
+	var names []string
+	for name := range definitions.Definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch definitions.Definitions[name].(type) {
+		case *bsor.StructDefinition:
+			fmt.Printf("%s (struct)\n", name)
+		case *bsor.UnionDefinition:
+			fmt.Printf("%s (union)\n", name)
+		default:
+			fmt.Printf("%s\n", name)
+		}
+	}
+}
+
+func compare(args []string) {
+	flags := flag.NewFlagSet("compare", flag.ExitOnError)
+	forward := flags.Bool("forward", false,
+		"also check that the old definitions can decode data encoded with the new definitions")
+	allowUnknown := flags.Bool("allow-unknown", false,
+		"decoders skip fields they don't have, requires encoding version 1")
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		usage()
+	}
+
+	old := readDefinitions(flags.Arg(0))
+	new := readDefinitions(flags.Arg(1))
+
+	incompatibilities := bsor.CheckCompatibility(old, new, bsor.CompatibilityOptions{
+		Forward:            *forward,
+		AllowUnknownFields: *allowUnknown,
+	})
+	if len(incompatibilities) == 0 {
+		fmt.Println("Compatible")
+		return
+	}
+
+	fmt.Println(incompatibilities)
+	os.Exit(1)
+}
+
+func readDefinitions(path string) *bsor.Definitions {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		fail("Failed to read definitions", err)
+	}
+
+	definitions, err := bsor.ParseDefinitions(data)
+	if err != nil {
+		fail("Failed to parse definitions", err)
+	}
+
+	return definitions
+}
+
+// readScript reads a script as hex or base64 text from the argument, or raw bytes from stdin when
+// the argument is "-".
+func readScript(arg string) (bitcoin.Script, error) {
+	if arg == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, errors.Wrap(err, "stdin")
+		}
+
+		// Allow hex text to be piped in as well as raw bytes.
+		if h, err := hex.DecodeString(strings.TrimSpace(string(b))); err == nil {
+			return bitcoin.Script(h), nil
+		}
+
+		return bitcoin.Script(b), nil
+	}
+
+	if b, err := hex.DecodeString(arg); err == nil {
+		return bitcoin.Script(b), nil
+	}
+
+	if b, err := base64.StdEncoding.DecodeString(arg); err == nil {
+		return bitcoin.Script(b), nil
+	}
+
+	return nil, errors.New("Not hex or base64")
+}
+
+func readFileOrStdin(path string) ([]byte, error) {
+	if path == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+func fail(message string, err error) {
+	fmt.Fprintf(os.Stderr, "%s : %s\n", message, err)
+	os.Exit(1)
+}
@@ -0,0 +1,296 @@
+package bsor
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"sort"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+// Marshaler is implemented by structs with generated encoding. Marshal calls MarshalBSOR instead
+// of using reflection. MarshalBSOR writes the field count followed by the fields. Generate the
+// methods with `go run github.com/tokenized/pkg/bsor/cmd generate`.
+type Marshaler interface {
+	MarshalBSOR(w *ScriptItemWriter, options *EncodeOptions) error
+}
+
+// Unmarshaler is implemented by structs with generated decoding. Unmarshal calls UnmarshalBSOR
+// instead of using reflection. UnmarshalBSOR reads the field count followed by the fields.
+type Unmarshaler interface {
+	UnmarshalBSOR(r *ScriptItemReader, options *DecodeOptions) error
+}
+
+// ObjectEncoder writes the encoding of a struct's fields. The field count is written first so the
+// fields that will be written must be counted before the encoder is created.
+type ObjectEncoder struct {
+	w          *ScriptItemWriter
+	version    uint8
+	fieldCount int
+	written    int
+
+	// field buffers the value of the current field when its size must precede it.
+	field *ScriptItemWriter
+}
+
+// NewObjectEncoder writes the field count. Exactly fieldCount fields must be written before Close
+// is called.
+func NewObjectEncoder(w *ScriptItemWriter, fieldCount int,
+	options *EncodeOptions) *ObjectEncoder {
+
+	w.Add(bitcoin.PushNumberScriptItem(int64(fieldCount)))
+
+	return &ObjectEncoder{
+		w:          w,
+		version:    options.Version,
+		fieldCount: fieldCount,
+	}
+}
+
+// StartField writes the field id and returns the writer to write the field's value to. EndField
+// must be called after the value is written. Fields with zero values should not be written.
+func (e *ObjectEncoder) StartField(id uint64) *ScriptItemWriter {
+	e.written++
+	e.w.Add(bitcoin.PushNumberScriptItemUnsigned(id))
+
+	if e.version < EncodingVersionSkippable {
+		return e.w
+	}
+
+	if e.field == nil {
+		e.field = &ScriptItemWriter{}
+	} else {
+		e.field.items = e.field.items[:0]
+	}
+	return e.field
+}
+
+// EndField writes the size of the field value followed by the value when the field value was
+// buffered.
+func (e *ObjectEncoder) EndField() {
+	if e.version < EncodingVersionSkippable {
+		return
+	}
+
+	e.w.Add(bitcoin.PushNumberScriptItem(int64(len(e.field.items))))
+	e.w.AddItems(e.field.items)
+}
+
+// WriteUnknownFields writes fields that were skipped when the struct was decoded. They can only
+// be encoded with EncodingVersionSkippable.
+func (e *ObjectEncoder) WriteUnknownFields(fields UnknownFields) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if e.version < EncodingVersionSkippable {
+		return errors.Wrapf(ErrUnsupportedVersion, "unknown fields require encoding version %d",
+			EncodingVersionSkippable)
+	}
+
+	for _, field := range fields {
+		e.StartField(field.ID).AddItems(field.ScriptItems)
+		e.EndField()
+	}
+
+	return nil
+}
+
+// Close returns an error if the number of fields written doesn't match the field count.
+func (e *ObjectEncoder) Close() error {
+	if e.written != e.fieldCount {
+		return errors.Wrapf(ErrValueConversion, "wrote %d fields, counted %d", e.written,
+			e.fieldCount)
+	}
+
+	return nil
+}
+
+// MapEncoder builds the encoding of a map. The entries are sorted by the encoded bytes of their
+// keys so the same map always produces the same script.
+type MapEncoder struct {
+	entries []*mapEntryScriptItems
+}
+
+type mapEntryScriptItems struct {
+	key        []byte
+	keyItems   bitcoin.ScriptItems
+	valueItems bitcoin.ScriptItems
+}
+
+func NewMapEncoder(count int) *MapEncoder {
+	return &MapEncoder{
+		entries: make([]*mapEntryScriptItems, 0, count),
+	}
+}
+
+// Add adds the encoded key and value of an entry.
+func (e *MapEncoder) Add(keyItems, valueItems bitcoin.ScriptItems) error {
+	keyScript, err := keyItems.Script()
+	if err != nil {
+		return errors.Wrap(err, "key script")
+	}
+
+	e.entries = append(e.entries, &mapEntryScriptItems{
+		key:        keyScript,
+		keyItems:   keyItems,
+		valueItems: valueItems,
+	})
+	return nil
+}
+
+// Write writes the entry count followed by the sorted entries.
+func (e *MapEncoder) Write(w *ScriptItemWriter) error {
+	sort.Slice(e.entries, func(i, j int) bool {
+		return bytes.Compare(e.entries[i].key, e.entries[j].key) < 0
+	})
+
+	for i := 1; i < len(e.entries); i++ {
+		if bytes.Equal(e.entries[i-1].key, e.entries[i].key) {
+			return errors.Wrapf(ErrValueConversion, "duplicate map key encoding: %s",
+				bitcoin.Script(e.entries[i].key))
+		}
+	}
+
+	w.Add(bitcoin.PushNumberScriptItem(int64(len(e.entries))))
+	for _, entry := range e.entries {
+		w.AddItems(entry.keyItems)
+		w.AddItems(entry.valueItems)
+	}
+
+	return nil
+}
+
+// UnmarshalFields reads the field count and fields of a struct. unmarshalField is called for each
+// field and returns false if the id is not a field of the struct. The fields that are skipped are
+// returned.
+func UnmarshalFields(r *ScriptItemReader, options *DecodeOptions, typeName string,
+	unmarshalField func(id uint64, r *ScriptItemReader) (bool, error)) (UnknownFields, error) {
+
+	fieldCount, err := ReadCount(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "field count")
+	}
+
+	return unmarshalFields(r, fieldCount, options, typeName, unmarshalField)
+}
+
+func unmarshalFields(r *ScriptItemReader, fieldCount uint64, options *DecodeOptions,
+	typeName string,
+	unmarshalField func(id uint64, r *ScriptItemReader) (bool, error)) (UnknownFields, error) {
+
+	var unknownFields UnknownFields
+	for i := uint64(0); i < fieldCount; i++ {
+		nextScriptItem, err := r.Read()
+		if err != nil {
+			return nil, errors.Wrap(err, "number")
+		}
+
+		id, err := bitcoin.ScriptNumberValue(nextScriptItem)
+		if err != nil {
+			return nil, errors.Wrap(err, "field id number")
+		}
+
+		fieldReader := r
+		if options.Version >= EncodingVersionSkippable {
+			size, err := ReadCount(r)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d size", id)
+			}
+
+			fieldReader, err = r.limit(size)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d", id)
+			}
+		}
+
+		found, err := unmarshalField(uint64(id), fieldReader)
+		if err != nil {
+			return nil, err
+		}
+
+		if !found {
+			if options.Version < EncodingVersionSkippable || !options.AllowUnknownFields {
+				return nil, errors.Wrapf(ErrUnknownField, "%d in %s", id, typeName)
+			}
+
+			scriptItems, err := fieldReader.readAll()
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d", id)
+			}
+
+			unknownFields = append(unknownFields, &UnknownField{
+				ID:          uint64(id),
+				ScriptItems: scriptItems,
+			})
+			continue
+		}
+
+		if fieldReader != r {
+			if unused, _ := fieldReader.available(); unused != 0 {
+				return nil, errors.Wrapf(ErrValueConversion, "field %d has %d unused script items",
+					id, unused)
+			}
+		}
+	}
+
+	return unknownFields, nil
+}
+
+// SkipEmptyObject returns true, and consumes the field count, if the next object has no fields.
+// Pointers to objects without fields are left nil when they are in arrays and maps.
+func SkipEmptyObject(r *ScriptItemReader) (bool, error) {
+	item, err := r.Peek()
+	if err == io.EOF {
+		return false, errors.Wrap(ErrValueConversion, "missing field count")
+	} else if err != nil {
+		return false, err
+	}
+
+	fieldCount, err := bitcoin.ScriptNumberValue(item)
+	if err != nil {
+		return false, errors.Wrap(err, "field count")
+	}
+
+	if fieldCount != 0 {
+		return false, nil
+	}
+
+	r.advance()
+	return true, nil
+}
+
+// MarshalValue encodes a value with reflection. Generated code uses it for types it can't encode
+// directly.
+func MarshalValue(w *ScriptItemWriter, value interface{}, inArray bool,
+	options *EncodeOptions) error {
+	return marshalObject(w, value, inArray, options)
+}
+
+// MarshalUnion writes the interface value pointed to by ifacePtr with the id of its concrete type.
+// Generated code uses it for interface types because the interface type is lost when the value is
+// passed as an interface{}.
+func MarshalUnion(w *ScriptItemWriter, ifacePtr interface{}, options *EncodeOptions) error {
+	value := reflect.ValueOf(ifacePtr)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Interface {
+		return errors.Wrapf(ErrValueConversion, "not a pointer to an interface: %T", ifacePtr)
+	}
+
+	return marshalUnion(w, value.Elem(), options)
+}
+
+// UnmarshalValue decodes a value with reflection into the value pointed to by object. Generated
+// code uses it for types it can't decode directly.
+func UnmarshalValue(r *ScriptItemReader, object interface{}, inArray bool,
+	options *DecodeOptions) error {
+
+	value := reflect.ValueOf(object)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return errors.Wrapf(ErrValueConversion, "not a pointer: %T", object)
+	}
+
+	return unmarshalObject(r, value.Elem(), 0, inArray, options)
+}
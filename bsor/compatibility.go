@@ -0,0 +1,372 @@
+package bsor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CompatibilityOptions specify which changes are reported by CheckCompatibility.
+type CompatibilityOptions struct {
+	// Forward also reports changes that prevent the old definitions from decoding data encoded
+	// with the new definitions, like added fields.
+	Forward bool
+
+	// AllowUnknownFields doesn't report fields that the decoding definitions don't have. Decoders
+	// skip them when they use EncodingVersionSkippable and UnmarshalOptions.AllowUnknownFields.
+	AllowUnknownFields bool
+}
+
+// Incompatibility is a change that prevents data encoded with one version of the definitions from
+// being decoded with the other.
+type Incompatibility struct {
+	TypeName  string `json:"type_name"`
+	FieldName string `json:"field_name,omitempty"`
+	FieldID   uint   `json:"field_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+type Incompatibilities []*Incompatibility
+
+// CheckCompatibility returns the changes in the new definitions that prevent data encoded with the
+// old definitions from being decoded with the new definitions. Fields are matched by id, so
+// renaming a field is compatible. Types are matched by name, so renaming a type is reported as the
+// type being removed unless a type with the old name is kept.
+func CheckCompatibility(old, new *Definitions, options CompatibilityOptions) Incompatibilities {
+	backward := &compatibilityChecker{
+		writer:             old,
+		reader:             new,
+		allowUnknownFields: options.AllowUnknownFields,
+		checked:            make(map[[2]string]bool),
+	}
+
+	var typeNames []string
+	for name := range old.Definitions {
+		typeNames = append(typeNames, name)
+	}
+	sort.Strings(typeNames)
+
+	for _, name := range typeNames {
+		if _, exists := new.Definitions[name]; !exists {
+			backward.add(name, nil, "type removed")
+			continue
+		}
+
+		backward.checkNamed(name, name)
+	}
+
+	result := backward.result
+	if !options.Forward {
+		return result
+	}
+
+	forward := &compatibilityChecker{
+		writer:             new,
+		reader:             old,
+		forward:            true,
+		allowUnknownFields: options.AllowUnknownFields,
+		checked:            make(map[[2]string]bool),
+	}
+
+	// Types added to the new definitions can't be encoded with the old definitions so they don't
+	// affect old decoders.
+	for _, name := range typeNames {
+		if _, exists := new.Definitions[name]; exists {
+			forward.checkNamed(name, name)
+		}
+	}
+
+	return append(result, forward.result...)
+}
+
+// compatibilityChecker checks that data encoded with the writer definitions can be decoded with
+// the reader definitions.
+type compatibilityChecker struct {
+	writer, reader     *Definitions
+	forward            bool
+	allowUnknownFields bool
+
+	// checked contains the writer and reader type names that have been checked.
+	checked map[[2]string]bool
+
+	result Incompatibilities
+}
+
+func (c *compatibilityChecker) add(typeName string, field *Field, format string,
+	args ...interface{}) {
+
+	message := fmt.Sprintf(format, args...)
+	if c.forward {
+		message = "forward: " + message
+	}
+
+	incompatibility := &Incompatibility{
+		TypeName: typeName,
+		Message:  message,
+	}
+	if field != nil {
+		incompatibility.FieldName = field.Name
+		incompatibility.FieldID = field.ID
+	}
+
+	c.result = append(c.result, incompatibility)
+}
+
+func (c *compatibilityChecker) checkNamed(writerName, readerName string) {
+	key := [2]string{writerName, readerName}
+	if c.checked[key] {
+		return
+	}
+	c.checked[key] = true
+
+	switch writerDefinition := c.writer.Definitions[writerName].(type) {
+	case *StructDefinition:
+		readerDefinition, ok := c.reader.Definitions[readerName].(*StructDefinition)
+		if !ok {
+			c.add(readerName, nil, "changed from struct to %s",
+				definitionKind(c.reader.Definitions[readerName]))
+			return
+		}
+
+		c.checkStruct(readerName, writerDefinition, readerDefinition)
+
+	case *UnionDefinition:
+		readerDefinition, ok := c.reader.Definitions[readerName].(*UnionDefinition)
+		if !ok {
+			c.add(readerName, nil, "changed from union to %s",
+				definitionKind(c.reader.Definitions[readerName]))
+			return
+		}
+
+		c.checkUnion(readerName, writerDefinition, readerDefinition)
+
+	case *BaseDefinition:
+		readerDefinition, ok := c.reader.Definitions[readerName].(*BaseDefinition)
+		if !ok {
+			c.add(readerName, nil, "changed from %s to %s", writerDefinition.Type,
+				definitionKind(c.reader.Definitions[readerName]))
+			return
+		}
+
+		if message := c.checkType(&writerDefinition.Type, &readerDefinition.Type,
+			false); len(message) > 0 {
+			c.add(readerName, nil, message)
+		}
+	}
+}
+
+// definitionKind returns the kind of a definition for incompatibility messages.
+func definitionKind(definition Definition) string {
+	switch d := definition.(type) {
+	case *StructDefinition:
+		return "struct"
+	case *UnionDefinition:
+		return "union"
+	case *BaseDefinition:
+		return d.Type.String()
+	default:
+		return "unknown"
+	}
+}
+
+func (c *compatibilityChecker) checkStruct(typeName string, writer, reader *StructDefinition) {
+	for _, writerField := range writer.Fields {
+		readerField := reader.FindField(writerField.ID)
+		if readerField == nil {
+			if c.allowUnknownFields {
+				continue
+			}
+
+			if c.forward {
+				c.add(typeName, writerField, "field added")
+			} else {
+				c.add(typeName, writerField, "field removed")
+			}
+			continue
+		}
+
+		if message := c.checkType(&writerField.Type, &readerField.Type,
+			false); len(message) > 0 {
+			c.add(typeName, readerField, message)
+		}
+	}
+}
+
+func (c *compatibilityChecker) checkUnion(typeName string, writer, reader *UnionDefinition) {
+	for _, writerVariant := range writer.Variants {
+		readerVariant := reader.FindVariant(writerVariant.ID)
+		if readerVariant == nil {
+			if c.forward {
+				c.add(typeName, writerVariant, "variant added")
+			} else {
+				c.add(typeName, writerVariant, "variant removed")
+			}
+			continue
+		}
+
+		if message := c.checkType(&writerVariant.Type, &readerVariant.Type,
+			false); len(message) > 0 {
+			c.add(typeName, readerVariant, message)
+		}
+	}
+}
+
+// checkType returns a message describing why values of the writer type can't be decoded as the
+// reader type, or an empty string if they can. Struct types are checked separately and their
+// incompatibilities are added under their own type names.
+func (c *compatibilityChecker) checkType(writer, reader *Type, inArray bool) string {
+	writer = c.writer.resolveType(writer)
+	reader = c.reader.resolveType(reader)
+
+	// Pointers are only encoded differently in arrays and maps where they are preceded by a value
+	// that specifies if they are nil.
+	if inArray && writer.IsPointer != reader.IsPointer {
+		if writer.IsPointer {
+			return fmt.Sprintf("changed from pointer: %s to %s", writer, reader)
+		}
+		return fmt.Sprintf("changed to pointer: %s to %s", writer, reader)
+	}
+
+	if writer.IsArray != reader.IsArray {
+		if writer.IsArray {
+			return fmt.Sprintf("changed from array: %s to %s", writer, reader)
+		}
+		return fmt.Sprintf("changed to array: %s to %s", writer, reader)
+	}
+
+	if writer.IsArray {
+		if writer.FixedSize != reader.FixedSize {
+			return fmt.Sprintf("array size changed: %s to %s", writer, reader)
+		}
+
+		if writer.ElementType == nil || reader.ElementType == nil {
+			return "missing array element type"
+		}
+
+		if message := c.checkType(writer.ElementType, reader.ElementType,
+			true); len(message) > 0 {
+			return "array item " + message
+		}
+
+		return ""
+	}
+
+	switch {
+	case writer.Type == BaseTypeStruct && reader.Type == BaseTypeStruct:
+		if _, exists := c.reader.Definitions[reader.TypeName]; !exists {
+			return fmt.Sprintf("missing type definition: %s", reader.TypeName)
+		}
+
+		c.checkNamed(writer.TypeName, reader.TypeName)
+		return ""
+
+	case writer.Type == BaseTypeMap && reader.Type == BaseTypeMap:
+		if writer.KeyType == nil || writer.ElementType == nil || reader.KeyType == nil ||
+			reader.ElementType == nil {
+			return "missing map key or value type"
+		}
+
+		if message := c.checkType(writer.KeyType, reader.KeyType, true); len(message) > 0 {
+			return "map key " + message
+		}
+
+		if message := c.checkType(writer.ElementType, reader.ElementType,
+			true); len(message) > 0 {
+			return "map value " + message
+		}
+
+		return ""
+
+	case isPushDataType(writer.Type) && isPushDataType(reader.Type):
+		if reader.FixedSize != 0 && reader.FixedSize != writer.FixedSize {
+			return fmt.Sprintf("fixed size changed: %s to %s", writer, reader)
+		}
+
+		return ""
+
+	case writer.Type == reader.Type:
+		return ""
+
+	case isIntegerConversion(writer.Type, reader.Type):
+		return ""
+
+	case reader.Type == BaseTypeBigInt && isIntegerType(writer.Type):
+		return ""
+
+	default:
+		return fmt.Sprintf("type changed: %s to %s", writer, reader)
+	}
+}
+
+// resolveType returns the type that a reference to a named non-struct definition represents.
+func (v *Definitions) resolveType(typ *Type) *Type {
+	if typ.Type != BaseTypeStruct || typ.IsArray {
+		return typ
+	}
+
+	definition, ok := v.Definitions[typ.TypeName].(*BaseDefinition)
+	if !ok {
+		return typ
+	}
+
+	result := definition.Type
+	result.IsPointer = result.IsPointer || typ.IsPointer
+	return &result
+}
+
+// isPushDataType returns true for types that are encoded as a single push data.
+func isPushDataType(baseType BaseType) bool {
+	return baseType == BaseTypeString || baseType == BaseTypeBinary
+}
+
+// isIntegerConversion returns true when all values of the writer integer type fit in the reader
+// integer type.
+func isIntegerConversion(writer, reader BaseType) bool {
+	writerSigned, writerSize := integerSize(writer)
+	readerSigned, readerSize := integerSize(reader)
+	if writerSize == 0 || readerSize == 0 {
+		return false
+	}
+
+	if writerSigned == readerSigned {
+		return readerSize >= writerSize
+	}
+
+	// Unsigned values fit in a larger signed integer.
+	return readerSigned && readerSize > writerSize
+}
+
+// isIntegerType returns true for integer types that can be decoded as a big integer.
+func isIntegerType(baseType BaseType) bool {
+	_, size := integerSize(baseType)
+	return size != 0
+}
+
+// integerSize returns the size in bits of integer types, or zero for other types.
+func integerSize(baseType BaseType) (bool, int) {
+	switch {
+	case baseType >= BaseTypeInt8 && baseType <= BaseTypeInt64:
+		return true, 8 << (baseType - BaseTypeInt8)
+	case baseType >= BaseTypeUint8 && baseType <= BaseTypeUint64:
+		return false, 8 << (baseType - BaseTypeUint8)
+	default:
+		return false, 0
+	}
+}
+
+func (v Incompatibility) String() string {
+	if v.FieldID == 0 {
+		return fmt.Sprintf("%s: %s", v.TypeName, v.Message)
+	}
+
+	return fmt.Sprintf("%s.%s (id %d): %s", v.TypeName, v.FieldName, v.FieldID, v.Message)
+}
+
+func (l Incompatibilities) String() string {
+	lines := make([]string, len(l))
+	for i, incompatibility := range l {
+		lines[i] = incompatibility.String()
+	}
+
+	return strings.Join(lines, "\n")
+}
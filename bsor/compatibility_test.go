@@ -0,0 +1,325 @@
+package bsor
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func Test_CheckCompatibility(t *testing.T) {
+	old := `
+Struct {
+  1 IntField    int32
+  2 StringField string(4)
+  3 SubStruct   SubStruct
+  4 SubStructs  []*SubStruct
+  5 Values      map[string]uint8
+  6 Removed     bool
+}
+
+SubStruct {
+  1 Name string
+}
+`
+
+	tests := []struct {
+		name     string
+		new      string
+		options  CompatibilityOptions
+		messages []string
+	}{
+		{
+			name: "renamed and widened",
+			new: `
+Struct {
+  1 Int64Field  int64
+  2 StringField binary(4)
+  3 SubStruct   Renamed
+  4 SubStructs  []*Renamed
+  5 Values      map[string]int16
+  6 Removed     bool
+}
+
+Renamed {
+  1 Text string
+}
+
+SubStruct {
+  1 Name string
+}
+`,
+		},
+		{
+			name: "pointer field",
+			new: `
+Struct {
+  1 IntField    *int32
+  2 StringField *string(4)
+  3 SubStruct   *SubStruct
+  4 SubStructs  []*SubStruct
+  5 Values      map[string]uint8
+  6 Removed     bool
+}
+
+SubStruct {
+  1 Name string
+}
+`,
+		},
+		{
+			name: "breaking",
+			new: `
+Struct {
+  1 IntField    int8
+  2 StringField string(5)
+  3 SubStruct   SubStruct
+  4 SubStructs  []SubStruct
+  5 Values      map[string]int8
+  7 Added       bool
+}
+
+SubStruct {
+  1 Name uint64
+}
+`,
+			messages: []string{
+				"Struct.IntField (id 1): type changed: int32 to int8",
+				"Struct.StringField (id 2): fixed size changed: string(4) to string(5)",
+				"SubStruct.Name (id 1): type changed: string to uint64",
+				"Struct.SubStructs (id 4): array item changed from pointer: *SubStruct to SubStruct",
+				"Struct.Values (id 5): map value type changed: uint8 to int8",
+				"Struct.Removed (id 6): field removed",
+			},
+		},
+		{
+			name: "forward",
+			new: `
+Struct {
+  1 IntField    int64
+  2 StringField string(4)
+  3 SubStruct   SubStruct
+  4 SubStructs  []*SubStruct
+  5 Values      map[string]uint8
+  6 Removed     bool
+  7 Added       [2]bool
+}
+
+SubStruct {
+  1 Name string
+}
+`,
+			options: CompatibilityOptions{
+				Forward: true,
+			},
+			messages: []string{
+				"Struct.IntField (id 1): forward: type changed: int64 to int32",
+				"Struct.Added (id 7): forward: field added",
+			},
+		},
+		{
+			name: "unknown fields",
+			new: `
+Struct {
+  1 IntField    int32
+  2 StringField string(4)
+  3 SubStruct   SubStruct
+  4 SubStructs  []*SubStruct
+  5 Values      map[string]uint8
+  7 Added       []string
+}
+
+SubStruct {
+  1 Name string
+}
+`,
+			options: CompatibilityOptions{
+				Forward:            true,
+				AllowUnknownFields: true,
+			},
+		},
+		{
+			name: "removed type",
+			new: `
+Struct {
+  1 IntField    int32
+  2 StringField string(4)
+  3 SubStruct   Other
+  4 SubStructs  [2]*Other
+  5 Values      map[string]uint8
+  6 Removed     bool
+}
+
+Other {
+  1 Name string
+}
+`,
+			messages: []string{
+				"Struct.SubStructs (id 4): array size changed: []*SubStruct to [2]*Other",
+				"SubStruct: type removed",
+			},
+		},
+		{
+			name: "changed to union",
+			new: `
+Struct {
+  1 IntField    int32
+  2 StringField string(4)
+  3 SubStruct   SubStruct
+  4 SubStructs  []*SubStruct
+  5 Values      map[string]uint8
+  6 Removed     bool
+}
+
+SubStruct union {
+  1 Name string
+}
+`,
+			messages: []string{
+				"SubStruct: changed from struct to union",
+			},
+		},
+	}
+
+	oldDefinitions, err := ParseDefinitions([]byte(old))
+	if err != nil {
+		t.Fatalf("Failed to parse old definitions : %s", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newDefinitions, err := ParseDefinitions([]byte(tt.new))
+			if err != nil {
+				t.Fatalf("Failed to parse new definitions : %s", err)
+			}
+
+			incompatibilities := CheckCompatibility(oldDefinitions, newDefinitions, tt.options)
+			t.Logf("Incompatibilities :\n%s", incompatibilities)
+
+			if len(incompatibilities) != len(tt.messages) {
+				t.Fatalf("Wrong incompatibility count : got %d, want %d", len(incompatibilities),
+					len(tt.messages))
+			}
+
+			for i, incompatibility := range incompatibilities {
+				if incompatibility.String() != tt.messages[i] {
+					t.Errorf("Wrong incompatibility %d : \n  got  : %s\n  want : %s", i,
+						incompatibility, tt.messages[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_CheckCompatibility_File(t *testing.T) {
+	data, err := ioutil.ReadFile("test_files/definitions.bsor")
+	if err != nil {
+		t.Fatalf("Failed to read file : %s", err)
+	}
+
+	old, err := ParseDefinitions(data)
+	if err != nil {
+		t.Fatalf("Failed to parse definitions : %s", err)
+	}
+
+	new, err := BuildDefinitions(
+		reflect.TypeOf(TestStruct{}),
+		reflect.TypeOf(TestStructSimple{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	if incompatibilities := CheckCompatibility(old, &new, CompatibilityOptions{
+		Forward: true,
+	}); len(incompatibilities) != 0 {
+		t.Errorf("Definitions not compatible :\n%s", incompatibilities)
+	}
+}
+
+func Test_CheckCompatibility_Types(t *testing.T) {
+	old := `
+Struct {
+  1 Amount  int64
+  2 Created time
+  3 Action  Action
+}
+
+Action union {
+  1 Transfer *Transfer
+  2 Note     string
+}
+
+Transfer {
+  1 Amount uint64
+}
+
+Hash binary(32)
+
+Kind union {
+  1 Name string
+}
+`
+
+	new := `
+Struct {
+  1 Amount  bigint
+  2 Created int64
+  3 Action  Action
+}
+
+Action union {
+  1 Transfer *Transfer
+  3 Offer    binary
+}
+
+Transfer {
+  1 Amount bigint
+}
+
+Hash {
+  1 Value binary(32)
+}
+
+Kind uint8
+`
+
+	oldDefinitions, err := ParseDefinitions([]byte(old))
+	if err != nil {
+		t.Fatalf("Failed to parse old definitions : %s", err)
+	}
+
+	newDefinitions, err := ParseDefinitions([]byte(new))
+	if err != nil {
+		t.Fatalf("Failed to parse new definitions : %s", err)
+	}
+
+	incompatibilities := CheckCompatibility(oldDefinitions, newDefinitions, CompatibilityOptions{
+		Forward: true,
+	})
+	t.Logf("Incompatibilities :\n%s", incompatibilities)
+
+	want := []string{
+		"Action.Note (id 2): variant removed",
+		"Hash: changed from binary(32) to struct",
+		"Kind: changed from union to uint8",
+		"Struct.Created (id 2): type changed: time to int64",
+		"Transfer.Amount (id 1): forward: type changed: bigint to uint64",
+		"Action.Offer (id 3): forward: variant added",
+		"Hash: forward: changed from struct to binary(32)",
+		"Kind: forward: changed from uint8 to union",
+		"Struct.Amount (id 1): forward: type changed: bigint to int64",
+		"Struct.Created (id 2): forward: type changed: int64 to time",
+	}
+
+	if len(incompatibilities) != len(want) {
+		t.Fatalf("Wrong incompatibility count : got %d, want %d", len(incompatibilities),
+			len(want))
+	}
+
+	for i, incompatibility := range incompatibilities {
+		if incompatibility.String() != want[i] {
+			t.Errorf("Wrong incompatibility %d : \n  got  : %s\n  want : %s", i, incompatibility,
+				want[i])
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -26,10 +27,14 @@ const (
 	BaseTypeUint64  = BaseType(12)
 	BaseTypeFloat32 = BaseType(13)
 	BaseTypeFloat64 = BaseType(14)
+	BaseTypeMap     = BaseType(15)
+	BaseTypeTime    = BaseType(16)
+	BaseTypeBigInt  = BaseType(17)
 )
 
 var (
 	binaryMarshalerType      = reflect.TypeOf(new(BinaryMarshaler)).Elem()
+	binaryUnmarshalerType    = reflect.TypeOf(new(BinaryUnmarshaler)).Elem()
 	fixedBinaryMarshalerType = reflect.TypeOf(new(FixedBinaryMarshaler)).Elem()
 )
 
@@ -42,6 +47,12 @@ type StructDefinition struct {
 	Fields []*Field `json:"fields"`
 }
 
+// UnionDefinition is an interface type. Its values are encoded as the id of a variant followed by
+// the value of the variant's type. Variant names are the names of the registered concrete types.
+type UnionDefinition struct {
+	Variants []*Field `json:"variants"`
+}
+
 type Field struct {
 	Name string `json:"name,omitempty"`
 	ID   uint   `json:"id,omitempty"`
@@ -56,12 +67,15 @@ type Definition interface {
 	String() string
 }
 
+// Type describes the encoding of a value. For maps KeyType is the type of the keys and ElementType
+// is the type of the values.
 type Type struct {
 	Type        BaseType `json:"base_type"`
 	TypeName    string   `json:"type_name,omitempty"`
 	IsArray     bool     `json:"is_array,omitempty"`
 	IsPointer   bool     `json:"is_pointer,omitempty"`
 	FixedSize   uint     `json:"fixed_size,omitempty"`
+	KeyType     *Type    `json:"key_type,omitempty"`
 	ElementType *Type    `json:"element_type,omitempty"`
 }
 
@@ -120,6 +134,10 @@ func buildStructDefinition(typ reflect.Type, definitions *Definitions) error {
 			continue // not exported, "private" lower case field name
 		}
 
+		if field.Type == unknownFieldsType {
+			continue // holds fields that were skipped when decoding
+		}
+
 		idString := field.Tag.Get("bsor")
 		if len(idString) == 0 {
 			return errors.Wrap(ErrInvalidID, "missing \"bsor\" tag")
@@ -164,6 +182,41 @@ func buildStructDefinition(typ reflect.Type, definitions *Definitions) error {
 	return nil
 }
 
+// buildUnionDefinition builds the definition of an interface from the types registered for it with
+// RegisterType.
+func buildUnionDefinition(typ reflect.Type, definitions *Definitions) error {
+	variants := unionVariants(typ)
+	if len(variants) == 0 {
+		return errors.Wrapf(ErrUnregisteredType, "no types registered for %s", typ)
+	}
+
+	definition := &UnionDefinition{}
+	definitions.Definitions[typ.Name()] = definition
+
+	for _, variant := range variants {
+		variantType, err := buildType(variant.typ, 0, definitions)
+		if err != nil {
+			return errors.Wrapf(err, "variant %d", variant.id)
+		}
+
+		name := variant.typ.Name()
+		if variant.typ.Kind() == reflect.Ptr {
+			name = variant.typ.Elem().Name()
+		}
+		if len(name) == 0 {
+			name = variantType.String()
+		}
+
+		definition.Variants = append(definition.Variants, &Field{
+			Name: name,
+			ID:   uint(variant.id),
+			Type: *variantType,
+		})
+	}
+
+	return nil
+}
+
 func (definitions *Definitions) FindType(typ reflect.Type) *Type {
 	for {
 		if typ.Kind() == reflect.Ptr {
@@ -212,6 +265,19 @@ func buildType(typ reflect.Type, fixedSize uint,
 		return ptrType, nil
 	}
 
+	// Time implements BinaryMarshaler, but has its own encoding.
+	switch typ {
+	case timeType:
+		return &Type{
+			Type: BaseTypeTime,
+		}, nil
+
+	case bigIntType:
+		return &Type{
+			Type: BaseTypeBigInt,
+		}, nil
+	}
+
 	if typ.Implements(fixedBinaryMarshalerType) {
 		v := reflect.New(typ)
 		fixedBinaryMarshaler := v.Interface().(FixedBinaryMarshaler)
@@ -250,6 +316,23 @@ func buildType(typ reflect.Type, fixedSize uint,
 			TypeName: name,
 		}, nil
 
+	case reflect.Interface:
+		name := typ.Name()
+		if len(name) == 0 {
+			return nil, errors.Wrapf(ErrValueConversion, "unnamed interface: %s", typ)
+		}
+
+		if _, exists := definitions.Definitions[name]; !exists {
+			if err := buildUnionDefinition(typ, definitions); err != nil {
+				return nil, errors.Wrapf(err, "union %s", name)
+			}
+		}
+
+		return &Type{
+			Type:     BaseTypeStruct,
+			TypeName: name,
+		}, nil
+
 	case reflect.String:
 		return &Type{
 			Type:      BaseTypeString,
@@ -361,6 +444,27 @@ func buildType(typ reflect.Type, fixedSize uint,
 			ElementType: elementType,
 		}, nil
 
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.Ptr {
+			return nil, errors.Wrapf(ErrValueConversion, "pointer map key: %s", typeName(typ))
+		}
+
+		keyType, err := buildType(typ.Key(), 0, definitions)
+		if err != nil {
+			return nil, errors.Wrap(err, "map key")
+		}
+
+		elementType, err := buildType(typ.Elem(), 0, definitions)
+		if err != nil {
+			return nil, errors.Wrap(err, "map value")
+		}
+
+		return &Type{
+			Type:        BaseTypeMap,
+			KeyType:     keyType,
+			ElementType: elementType,
+		}, nil
+
 	default:
 		return nil, errors.Wrapf(ErrValueConversion, "unknown type: %s", typeName(typ))
 	}
@@ -371,8 +475,15 @@ func (v Definitions) String() string {
 
 	buf.Write([]byte(fmt.Sprintf("version %d\n\n", v.Version)))
 
-	for name, def := range v.Definitions {
-		b := def.String()
+	// Sort the names so the text is the same every time.
+	names := make([]string, 0, len(v.Definitions))
+	for name := range v.Definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		b := v.Definitions[name].String()
 
 		buf.Write([]byte(fmt.Sprintf("%s ", name)))
 
@@ -383,9 +494,18 @@ func (v Definitions) String() string {
 }
 
 func (v StructDefinition) String() string {
+	return "{\n" + Indent(fieldsString(v.Fields), 2) + "\n}\n"
+}
+
+func (v UnionDefinition) String() string {
+	return "union {\n" + Indent(fieldsString(v.Variants), 2) + "\n}\n"
+}
+
+// fieldsString returns the fields on separate lines with their ids and names aligned.
+func fieldsString(fields []*Field) string {
 	buf := &bytes.Buffer{}
 	var nameLength, idLength int
-	for _, field := range v.Fields {
+	for _, field := range fields {
 		if len(field.Name) > nameLength {
 			nameLength = len(field.Name)
 		}
@@ -396,14 +516,14 @@ func (v StructDefinition) String() string {
 		}
 	}
 
-	for i, field := range v.Fields {
+	for i, field := range fields {
 		if i > 0 {
 			buf.Write([]byte("\n"))
 		}
 		buf.Write([]byte(field.PaddedString(nameLength, idLength)))
 	}
 
-	return "{\n" + Indent(string(buf.Bytes()), 2) + "\n}\n"
+	return string(buf.Bytes())
 }
 
 func (v BaseDefinition) String() string {
@@ -427,7 +547,9 @@ func (v Type) String() string {
 		result = v.Type.String()
 	}
 
-	if v.ElementType != nil {
+	if v.Type == BaseTypeMap && v.KeyType != nil && v.ElementType != nil {
+		result = fmt.Sprintf("map[%s]%s", v.KeyType, v.ElementType)
+	} else if v.ElementType != nil {
 		result = v.ElementType.String()
 	}
 
@@ -462,6 +584,11 @@ func Indent(s string, count int) string {
 }
 
 func (v *BaseType) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*v = BaseTypeInvalid
+		return nil
+	}
+
 	if len(data) < 2 {
 		return fmt.Errorf("Too short for BaseType : %d", len(data))
 	}
@@ -493,6 +620,8 @@ func (v *BaseType) UnmarshalText(text []byte) error {
 
 func (v *BaseType) SetString(s string) error {
 	switch s {
+	case "invalid":
+		*v = BaseTypeInvalid // arrays don't have a base type
 	case "struct":
 		*v = BaseTypeStruct
 	case "string":
@@ -521,6 +650,12 @@ func (v *BaseType) SetString(s string) error {
 		*v = BaseTypeFloat32
 	case "float64":
 		*v = BaseTypeFloat64
+	case "map":
+		*v = BaseTypeMap
+	case "time":
+		*v = BaseTypeTime
+	case "bigint":
+		*v = BaseTypeBigInt
 	default:
 		*v = BaseTypeInvalid
 		return fmt.Errorf("Unknown BaseType value \"%s\"", s)
@@ -559,6 +694,12 @@ func (v BaseType) String() string {
 		return "float32"
 	case BaseTypeFloat64:
 		return "float64"
+	case BaseTypeMap:
+		return "map"
+	case BaseTypeTime:
+		return "time"
+	case BaseTypeBigInt:
+		return "bigint"
 	default:
 		return "invalid"
 	}
@@ -0,0 +1,348 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidDefinition = errors.New("Invalid Definition")
+	ErrUnknownType       = errors.New("Unknown Type")
+)
+
+// ParseDefinitions parses definitions from either the JSON form or the text form created by
+// Definitions.String.
+func ParseDefinitions(data []byte) (*Definitions, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		result := &Definitions{}
+		if err := json.Unmarshal(trimmed, result); err != nil {
+			return nil, errors.Wrap(err, "json")
+		}
+
+		return result, nil
+	}
+
+	return parseDefinitionsText(string(data))
+}
+
+func parseDefinitionsText(text string) (*Definitions, error) {
+	result := &Definitions{
+		Definitions: make(map[string]Definition),
+	}
+
+	// fields are the fields of the struct or the variants of the union being parsed.
+	var fields *[]*Field
+	var currentName string
+	ids := make(map[uint]bool)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lineNumber := i + 1
+		parts := strings.Fields(line)
+
+		if fields != nil {
+			if line == "}" {
+				fields = nil
+				continue
+			}
+
+			if len(parts) != 3 {
+				return nil, errors.Wrapf(ErrInvalidDefinition, "line %d: field in %s: %s",
+					lineNumber, currentName, line)
+			}
+
+			id, err := strconv.ParseUint(parts[0], 10, 64)
+			if err != nil || id == 0 {
+				return nil, errors.Wrapf(ErrInvalidID, "line %d: %s", lineNumber, parts[0])
+			}
+
+			if ids[uint(id)] {
+				return nil, errors.Wrapf(ErrDuplicateID, "line %d: %d", lineNumber, id)
+			}
+			ids[uint(id)] = true
+
+			typ, err := ParseType(parts[2])
+			if err != nil {
+				return nil, errors.Wrapf(err, "line %d", lineNumber)
+			}
+
+			*fields = append(*fields, &Field{
+				Name: parts[1],
+				ID:   uint(id),
+				Type: *typ,
+			})
+			continue
+		}
+
+		if len(parts) == 3 && parts[1] == "union" && parts[2] == "{" {
+			name := parts[0]
+			if _, exists := result.Definitions[name]; exists {
+				return nil, errors.Wrapf(ErrInvalidDefinition,
+					"line %d: duplicate definition: %s", lineNumber, name)
+			}
+
+			union := &UnionDefinition{}
+			fields = &union.Variants
+			currentName = name
+			ids = make(map[uint]bool)
+			result.Definitions[name] = union
+			continue
+		}
+
+		if len(parts) != 2 {
+			return nil, errors.Wrapf(ErrInvalidDefinition, "line %d: %s", lineNumber, line)
+		}
+
+		if parts[0] == "version" {
+			version, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return nil, errors.Wrapf(ErrInvalidDefinition, "line %d: version: %s",
+					lineNumber, parts[1])
+			}
+
+			result.Version = uint(version)
+			continue
+		}
+
+		name := parts[0]
+		if _, exists := result.Definitions[name]; exists {
+			return nil, errors.Wrapf(ErrInvalidDefinition, "line %d: duplicate definition: %s",
+				lineNumber, name)
+		}
+
+		if parts[1] == "{" {
+			current := &StructDefinition{}
+			fields = &current.Fields
+			currentName = name
+			ids = make(map[uint]bool)
+			result.Definitions[name] = current
+			continue
+		}
+
+		typ, err := ParseType(parts[1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", lineNumber)
+		}
+
+		result.Definitions[name] = &BaseDefinition{
+			Type: *typ,
+		}
+	}
+
+	if fields != nil {
+		return nil, errors.Wrapf(ErrInvalidDefinition, "missing \"}\" for %s", currentName)
+	}
+
+	return result, nil
+}
+
+// ParseType parses the text form of a type created by Type.String.
+func ParseType(s string) (*Type, error) {
+	result, remaining, err := parseType(s)
+	if err != nil {
+		return nil, errors.Wrapf(err, "type \"%s\"", s)
+	}
+
+	if len(remaining) > 0 {
+		return nil, errors.Wrapf(ErrInvalidDefinition, "type \"%s\": extra text: %s", s,
+			remaining)
+	}
+
+	return result, nil
+}
+
+func parseType(s string) (*Type, string, error) {
+	if len(s) == 0 {
+		return nil, s, errors.Wrap(ErrInvalidDefinition, "missing type")
+	}
+
+	if s[0] == '*' {
+		result, remaining, err := parseType(s[1:])
+		if err != nil {
+			return nil, remaining, err
+		}
+
+		result.IsPointer = true
+		return result, remaining, nil
+	}
+
+	if s[0] == '[' {
+		end := strings.IndexByte(s, ']')
+		if end == -1 {
+			return nil, s, errors.Wrap(ErrInvalidDefinition, "missing \"]\"")
+		}
+
+		var fixedSize uint64
+		if end > 1 {
+			size, err := strconv.ParseUint(s[1:end], 10, 64)
+			if err != nil || size == 0 {
+				return nil, s, errors.Wrapf(ErrInvalidDefinition, "array size: %s", s[1:end])
+			}
+			fixedSize = size
+		}
+
+		elementType, remaining, err := parseType(s[end+1:])
+		if err != nil {
+			return nil, remaining, errors.Wrap(err, "array")
+		}
+
+		return &Type{
+			IsArray:     true,
+			FixedSize:   uint(fixedSize),
+			ElementType: elementType,
+		}, remaining, nil
+	}
+
+	if strings.HasPrefix(s, "map[") {
+		keyType, remaining, err := parseType(s[4:])
+		if err != nil {
+			return nil, remaining, errors.Wrap(err, "map key")
+		}
+
+		if len(remaining) == 0 || remaining[0] != ']' {
+			return nil, remaining, errors.Wrap(ErrInvalidDefinition, "map missing \"]\"")
+		}
+
+		valueType, remaining, err := parseType(remaining[1:])
+		if err != nil {
+			return nil, remaining, errors.Wrap(err, "map value")
+		}
+
+		return &Type{
+			Type:        BaseTypeMap,
+			KeyType:     keyType,
+			ElementType: valueType,
+		}, remaining, nil
+	}
+
+	end := 0
+	for end < len(s) && isNameCharacter(s[end]) {
+		end++
+	}
+
+	if end == 0 {
+		return nil, s, errors.Wrapf(ErrInvalidDefinition, "invalid character: %c", s[0])
+	}
+
+	name := s[:end]
+	remaining := s[end:]
+
+	result := &Type{}
+	if err := result.Type.SetString(name); err != nil || result.Type == BaseTypeStruct {
+		result.Type = BaseTypeStruct
+		result.TypeName = name
+	}
+
+	if len(remaining) > 0 && remaining[0] == '(' {
+		sizeEnd := strings.IndexByte(remaining, ')')
+		if sizeEnd == -1 {
+			return nil, remaining, errors.Wrap(ErrInvalidDefinition, "missing \")\"")
+		}
+
+		if result.Type != BaseTypeBinary && result.Type != BaseTypeString {
+			return nil, remaining, errors.Wrapf(ErrInvalidDefinition, "fixed size %s", name)
+		}
+
+		size, err := strconv.ParseUint(remaining[1:sizeEnd], 10, 64)
+		if err != nil || size == 0 {
+			return nil, remaining, errors.Wrapf(ErrInvalidDefinition, "fixed size: %s",
+				remaining[1:sizeEnd])
+		}
+
+		result.FixedSize = uint(size)
+		remaining = remaining[sizeEnd+1:]
+	}
+
+	return result, remaining, nil
+}
+
+func isNameCharacter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') ||
+		c == '_' || c == '.'
+}
+
+func (v *Definitions) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Version     uint                       `json:"version"`
+		Definitions map[string]json.RawMessage `json:"definitions"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	v.Version = raw.Version
+	v.Definitions = make(map[string]Definition)
+	for name, rawDefinition := range raw.Definitions {
+		var definition struct {
+			Fields   []*Field `json:"fields"`
+			Variants []*Field `json:"variants"`
+			Type     *Type    `json:"type"`
+		}
+
+		if err := json.Unmarshal(rawDefinition, &definition); err != nil {
+			return errors.Wrap(err, name)
+		}
+
+		if definition.Type != nil {
+			v.Definitions[name] = &BaseDefinition{
+				Type: *definition.Type,
+			}
+			continue
+		}
+
+		if definition.Variants != nil {
+			v.Definitions[name] = &UnionDefinition{
+				Variants: definition.Variants,
+			}
+			continue
+		}
+
+		v.Definitions[name] = &StructDefinition{
+			Fields: definition.Fields,
+		}
+	}
+
+	return nil
+}
+
+// FindField returns the field with the specified id or nil if there isn't one.
+func (v StructDefinition) FindField(id uint) *Field {
+	for _, field := range v.Fields {
+		if field.ID == id {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// FindFieldByName returns the field with the specified name or nil if there isn't one.
+func (v StructDefinition) FindFieldByName(name string) *Field {
+	for _, field := range v.Fields {
+		if field.Name == name {
+			return field
+		}
+	}
+
+	return nil
+}
+
+// FindVariant returns the variant with the specified type id or nil if there isn't one.
+func (v UnionDefinition) FindVariant(id uint) *Field {
+	for _, variant := range v.Variants {
+		if variant.ID == id {
+			return variant
+		}
+	}
+
+	return nil
+}
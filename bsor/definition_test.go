@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
@@ -33,19 +34,33 @@ func Test_CreateDefinitions(t *testing.T) {
 		reflect.TypeOf(TestStructSimple{}),
 	)
 	if err != nil {
-		fmt.Printf("Failed to create definitions : %s\n", err)
-		return
+		t.Fatalf("Failed to create definitions : %s", err)
 	}
 
-	file, err := os.Create("test_files/definitions.bsor")
+	// Write to a temporary directory so the checked in test_files/definitions.bsor, which other
+	// tests read, isn't changed by running the tests.
+	path := filepath.Join(t.TempDir(), "definitions.bsor")
+	if err := os.WriteFile(path, []byte(defs.String()+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file : %s", err)
+	}
+
+	data, err := os.ReadFile(path)
 	if err != nil {
-		fmt.Printf("Failed to create file : %s", err)
-		return
+		t.Fatalf("Failed to read file : %s", err)
 	}
 
-	if _, err := file.Write([]byte(defs.String() + "\n")); err != nil {
-		fmt.Printf("Failed to write file : %s", err)
-		return
+	if string(data) != defs.String()+"\n" {
+		t.Fatalf("Definitions text not deterministic")
+	}
+
+	read, err := ParseDefinitions(data)
+	if err != nil {
+		t.Fatalf("Failed to parse definitions : %s", err)
+	}
+
+	if read.String() != defs.String() {
+		t.Errorf("Wrong parsed definitions : \n  got  : %s\n  want : %s", read.String(),
+			defs.String())
 	}
 }
 
@@ -65,3 +80,65 @@ func Test_CreateDefinition_TestPublicKeyArray(t *testing.T) {
 
 	t.Logf("Definitions : %s", defs.String())
 }
+
+func Test_Definition_TestMapStruct(t *testing.T) {
+	definitions, err := BuildDefinitions(reflect.TypeOf(TestMapStruct{}))
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	t.Logf("User Definitions : \n%s", definitions.String())
+
+	structDefinition, ok := definitions.Definitions["TestMapStruct"].(*StructDefinition)
+	if !ok {
+		t.Fatalf("Missing struct definition")
+	}
+
+	want := map[string]string{
+		"StringMapField":    "map[string]string",
+		"ObjectPtrMapField": "map[uint32]*TestSubStruct",
+		"BinaryKeyMapField": "map[binary(20)]bool",
+		"ArrayMapField":     "map[string][]string",
+		"NestedMapField":    "map[string]map[string]int64",
+		"MapArrayField":     "[]map[int64]string",
+		"FixedKeyMapField":  "map[binary(2)]*binary(33)",
+	}
+
+	for _, field := range structDefinition.Fields {
+		if w, exists := want[field.Name]; exists && field.Type.String() != w {
+			t.Errorf("Wrong type for %s : got %s, want %s", field.Name, field.Type.String(), w)
+		}
+	}
+
+	js, err := json.Marshal(definitions)
+	if err != nil {
+		t.Fatalf("Failed to marshal definitions : %s", err)
+	}
+
+	var readType Type
+	if err := json.Unmarshal([]byte(`{"base_type":"map","key_type":{"base_type":"string"},`+
+		`"element_type":{"base_type":"int64"}}`), &readType); err != nil {
+		t.Fatalf("Failed to unmarshal type : %s", err)
+	}
+
+	if readType.String() != "map[string]int64" {
+		t.Errorf("Wrong json type : got %s, want %s", readType.String(), "map[string]int64")
+	}
+
+	t.Logf("Definitions : %s", js)
+}
+
+type TestPointerKeyMap struct {
+	Field map[*string]string `bsor:"1"`
+}
+
+func Test_Definition_PointerKeyMap(t *testing.T) {
+	if _, err := BuildDefinitions(reflect.TypeOf(TestPointerKeyMap{})); err == nil {
+		t.Fatalf("Pointer map keys should not be supported")
+	}
+
+	s := "key"
+	if _, err := Marshal(TestPointerKeyMap{Field: map[*string]string{&s: "value"}}); err == nil {
+		t.Fatalf("Pointer map keys should not be marshalled")
+	}
+}
@@ -0,0 +1,743 @@
+package bsor
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+// Object is a struct decoded using definitions instead of a go type. Fields are in the order they
+// are encoded. Field values are nil for nil pointers, bool, int64, uint64, float32, float64,
+// string, []byte for binary, time.Time, *big.Int, []interface{} for arrays, Map for maps, *Union
+// for unions, and *Object for structs.
+type Object struct {
+	TypeName string
+	Fields   []*ObjectField
+
+	// UnknownFields are fields that were skipped because they are not in the definition. They are
+	// only skipped in EncodingVersionSkippable.
+	UnknownFields UnknownFields
+}
+
+type ObjectField struct {
+	ID    uint
+	Name  string
+	Value interface{}
+}
+
+// Union is an interface value decoded using definitions. ID is the id of the variant that contains
+// the type of the value.
+type Union struct {
+	ID    uint
+	Value interface{}
+}
+
+// Map is a map decoded using definitions. The entries are in the order they are encoded.
+type Map []*MapEntry
+
+type MapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// Field returns the value of the field with the specified name and true, or false if the field
+// isn't in the object.
+func (o Object) Field(name string) (interface{}, bool) {
+	for _, field := range o.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+
+	return nil, false
+}
+
+// UnmarshalDynamic decodes the named type from the script items without a go type and returns any
+// script items remaining after the value has been parsed.
+func (v *Definitions) UnmarshalDynamic(scriptItems bitcoin.ScriptItems, typeName string,
+	options UnmarshalOptions) (interface{}, bitcoin.ScriptItems, error) {
+
+	definition, exists := v.Definitions[typeName]
+	if !exists {
+		return nil, nil, errors.Wrap(ErrUnknownType, typeName)
+	}
+
+	decodeOptions := &DecodeOptions{
+		AllowUnknownFields: options.AllowUnknownFields,
+	}
+
+	reader := NewScriptItemReader(scriptItems)
+	if _, isStruct := definition.(*StructDefinition); isStruct {
+		version, err := readVersionHeader(reader)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "version")
+		}
+		decodeOptions.Version = version
+	}
+
+	result, err := v.decodeNamed(reader, typeName, false, decodeOptions)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, typeName)
+	}
+
+	return result, reader.ScriptItems(), nil
+}
+
+func (v *Definitions) decodeNamed(r *ScriptItemReader, typeName string, inArray bool,
+	options *DecodeOptions) (interface{}, error) {
+
+	switch definition := v.Definitions[typeName].(type) {
+	case *StructDefinition:
+		return v.decodeStruct(r, typeName, definition, options)
+	case *UnionDefinition:
+		return v.decodeUnion(r, typeName, definition, options)
+	case *BaseDefinition:
+		return v.decodeType(r, &definition.Type, inArray, options)
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typeName)
+	}
+}
+
+func (v *Definitions) decodeStruct(r *ScriptItemReader, typeName string,
+	definition *StructDefinition, options *DecodeOptions) (*Object, error) {
+
+	fieldCount, err := ReadCount(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "field count")
+	}
+
+	result := &Object{
+		TypeName: typeName,
+	}
+
+	for i := uint64(0); i < fieldCount; i++ {
+		id, err := ReadUnsignedInteger(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "field id number")
+		}
+
+		fieldReader := r
+		if options.Version >= EncodingVersionSkippable {
+			size, err := ReadCount(r)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d size", id)
+			}
+
+			fieldReader, err = r.limit(size)
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d", id)
+			}
+		}
+
+		field := definition.FindField(uint(id))
+		if field == nil {
+			if options.Version < EncodingVersionSkippable || !options.AllowUnknownFields {
+				return nil, errors.Wrapf(ErrUnknownField, "%d in %s", id, typeName)
+			}
+
+			scriptItems, err := fieldReader.readAll()
+			if err != nil {
+				return nil, errors.Wrapf(err, "field %d", id)
+			}
+
+			result.UnknownFields = append(result.UnknownFields, &UnknownField{
+				ID:          id,
+				ScriptItems: scriptItems,
+			})
+			continue
+		}
+
+		value, err := v.decodeType(fieldReader, &field.Type, false, options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field: %s (id %d) (%s)", field.Name, id, field.Type)
+		}
+
+		if fieldReader != r {
+			if unused, _ := fieldReader.available(); unused != 0 {
+				return nil, errors.Wrapf(ErrValueConversion,
+					"field %d has %d unused script items", id, unused)
+			}
+		}
+
+		result.Fields = append(result.Fields, &ObjectField{
+			ID:    field.ID,
+			Name:  field.Name,
+			Value: value,
+		})
+	}
+
+	return result, nil
+}
+
+func (v *Definitions) decodeUnion(r *ScriptItemReader, typeName string,
+	definition *UnionDefinition, options *DecodeOptions) (interface{}, error) {
+
+	id, err := ReadUnsignedInteger(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "union type")
+	}
+
+	if id == 0 {
+		return nil, nil // nil interface
+	}
+
+	variant := definition.FindVariant(uint(id))
+	if variant == nil {
+		return nil, errors.Wrapf(ErrUnregisteredType, "id %d for %s", id, typeName)
+	}
+
+	value, err := v.decodeType(r, &variant.Type, false, options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "variant: %s (id %d) (%s)", variant.Name, id,
+			variant.Type)
+	}
+
+	return &Union{
+		ID:    variant.ID,
+		Value: value,
+	}, nil
+}
+
+func (v *Definitions) decodeType(r *ScriptItemReader, typ *Type, inArray bool,
+	options *DecodeOptions) (interface{}, error) {
+
+	if typ.IsPointer && inArray {
+		notNil, err := ReadUnsignedInteger(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "not nil")
+		}
+
+		if notNil == 0 {
+			return nil, nil
+		}
+	}
+
+	if typ.IsArray {
+		if typ.ElementType == nil {
+			return nil, errors.Wrap(ErrInvalidDefinition, "missing array element type")
+		}
+
+		count := uint64(typ.FixedSize)
+		if count == 0 {
+			c, err := ReadCount(r)
+			if err != nil {
+				return nil, errors.Wrap(err, "count")
+			}
+			count = c
+		}
+
+		if available, known := r.available(); known && count > available {
+			return nil, errors.Wrapf(ErrValueConversion, "count %d more than remaining %d",
+				count, available)
+		}
+
+		result := make([]interface{}, count)
+		for i := range result {
+			item, err := v.decodeType(r, typ.ElementType, true, options)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d", i)
+			}
+			result[i] = item
+		}
+
+		return result, nil
+	}
+
+	switch typ.Type {
+	case BaseTypeStruct:
+		return v.decodeNamed(r, typ.TypeName, inArray, options)
+
+	case BaseTypeMap:
+		if typ.KeyType == nil || typ.ElementType == nil {
+			return nil, errors.Wrap(ErrInvalidDefinition, "missing map key or value type")
+		}
+
+		count, err := ReadCount(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "count")
+		}
+
+		if available, known := r.available(); known && count > available {
+			return nil, errors.Wrapf(ErrValueConversion, "count %d more than remaining %d",
+				count, available)
+		}
+
+		result := make(Map, count)
+		for i := range result {
+			key, err := v.decodeType(r, typ.KeyType, true, options)
+			if err != nil {
+				return nil, errors.Wrapf(err, "key %d", i)
+			}
+
+			value, err := v.decodeType(r, typ.ElementType, true, options)
+			if err != nil {
+				return nil, errors.Wrapf(err, "value %d", i)
+			}
+
+			result[i] = &MapEntry{
+				Key:   key,
+				Value: value,
+			}
+		}
+
+		return result, nil
+
+	case BaseTypeBinary, BaseTypeString:
+		b, err := ReadBytes(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "bytes")
+		}
+
+		if typ.FixedSize > 0 && uint(len(b)) != typ.FixedSize {
+			return nil, errors.Wrapf(ErrValueConversion, "Fixed %s wrong size : got %d, want %d",
+				typ.Type, len(b), typ.FixedSize)
+		}
+
+		if typ.Type == BaseTypeString {
+			return string(b), nil
+		}
+		return b, nil
+
+	case BaseTypeBool:
+		value, err := ReadUnsignedInteger(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "bool")
+		}
+
+		return value != 0, nil
+
+	case BaseTypeInt8, BaseTypeInt16, BaseTypeInt32, BaseTypeInt64:
+		value, err := ReadInteger(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "integer")
+		}
+
+		return value, nil
+
+	case BaseTypeUint8, BaseTypeUint16, BaseTypeUint32, BaseTypeUint64:
+		value, err := ReadUnsignedInteger(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "integer")
+		}
+
+		return value, nil
+
+	case BaseTypeFloat32:
+		value, err := ReadFloat32(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "float32")
+		}
+
+		return value, nil
+
+	case BaseTypeFloat64:
+		value, err := ReadFloat64(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "float64")
+		}
+
+		return value, nil
+
+	case BaseTypeTime:
+		value, err := ReadTime(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "time")
+		}
+
+		return value, nil
+
+	case BaseTypeBigInt:
+		value, err := ReadBigInt(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "big int")
+		}
+
+		return value, nil
+
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typ.String())
+	}
+}
+
+// MarshalDynamic encodes a value, as returned by UnmarshalDynamic, as the named type.
+func (v *Definitions) MarshalDynamic(value interface{}, typeName string,
+	options MarshalOptions) (bitcoin.ScriptItems, error) {
+
+	if options.Version > EncodingVersionSkippable {
+		return nil, errors.Wrapf(ErrUnsupportedVersion, "%d", options.Version)
+	}
+
+	definition, exists := v.Definitions[typeName]
+	if !exists {
+		return nil, errors.Wrap(ErrUnknownType, typeName)
+	}
+
+	var result bitcoin.ScriptItems
+	if _, isStruct := definition.(*StructDefinition); isStruct &&
+		options.Version > EncodingVersionInitial {
+		result = append(result, bitcoin.PushNumberScriptItem(-int64(options.Version)))
+	}
+
+	scriptItems, err := v.encodeNamed(value, typeName, false, options.Version)
+	if err != nil {
+		return nil, errors.Wrap(err, typeName)
+	}
+
+	return append(result, scriptItems...), nil
+}
+
+func (v *Definitions) encodeNamed(value interface{}, typeName string, inArray bool,
+	version uint8) (bitcoin.ScriptItems, error) {
+
+	switch definition := v.Definitions[typeName].(type) {
+	case *StructDefinition:
+		return v.encodeStruct(value, typeName, definition, version)
+	case *UnionDefinition:
+		return v.encodeUnion(value, typeName, definition, version)
+	case *BaseDefinition:
+		return v.encodeType(value, &definition.Type, inArray, version)
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typeName)
+	}
+}
+
+func (v *Definitions) encodeStruct(value interface{}, typeName string,
+	definition *StructDefinition, version uint8) (bitcoin.ScriptItems, error) {
+
+	var object *Object
+	switch o := value.(type) {
+	case *Object:
+		object = o
+	case Object:
+		object = &o
+	case nil:
+		object = &Object{}
+	default:
+		return nil, errors.Wrapf(ErrValueConversion, "%s not an object: %T", typeName, value)
+	}
+
+	var ids []uint64
+	var fieldScriptItems []bitcoin.ScriptItems
+	for _, objectField := range object.Fields {
+		if objectField.Value == nil {
+			continue // nil pointer
+		}
+
+		var field *Field
+		if objectField.ID != 0 {
+			field = definition.FindField(objectField.ID)
+		} else {
+			field = definition.FindFieldByName(objectField.Name)
+		}
+		if field == nil {
+			return nil, errors.Wrapf(ErrUnknownField, "%s in %s", objectField.Name, typeName)
+		}
+
+		scriptItems, err := v.encodeType(objectField.Value, &field.Type, false, version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field: %s (id %d) (%s)", field.Name, field.ID,
+				field.Type)
+		}
+
+		ids = append(ids, uint64(field.ID))
+		fieldScriptItems = append(fieldScriptItems, scriptItems)
+	}
+
+	writer := &ScriptItemWriter{}
+	encoder := NewObjectEncoder(writer, len(ids)+len(object.UnknownFields),
+		&EncodeOptions{Version: version})
+	for i, id := range ids {
+		encoder.StartField(id).AddItems(fieldScriptItems[i])
+		encoder.EndField()
+	}
+
+	if err := encoder.WriteUnknownFields(object.UnknownFields); err != nil {
+		return nil, errors.Wrap(err, "unknown fields")
+	}
+
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+
+	return writer.ScriptItems(), nil
+}
+
+func (v *Definitions) encodeUnion(value interface{}, typeName string,
+	definition *UnionDefinition, version uint8) (bitcoin.ScriptItems, error) {
+
+	var union *Union
+	switch u := value.(type) {
+	case *Union:
+		union = u
+	case Union:
+		union = &u
+	case nil:
+		return bitcoin.ScriptItems{bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE)}, nil
+	default:
+		return nil, errors.Wrapf(ErrValueConversion, "%s not a union: %T", typeName, value)
+	}
+
+	variant := definition.FindVariant(union.ID)
+	if variant == nil {
+		return nil, errors.Wrapf(ErrUnregisteredType, "id %d for %s", union.ID, typeName)
+	}
+
+	scriptItems, err := v.encodeType(union.Value, &variant.Type, false, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "variant: %s (id %d) (%s)", variant.Name, variant.ID,
+			variant.Type)
+	}
+
+	result := bitcoin.ScriptItems{bitcoin.PushNumberScriptItemUnsigned(uint64(variant.ID))}
+	return append(result, scriptItems...), nil
+}
+
+func (v *Definitions) encodeType(value interface{}, typ *Type, inArray bool,
+	version uint8) (bitcoin.ScriptItems, error) {
+
+	var result bitcoin.ScriptItems
+	if typ.IsPointer {
+		if value == nil {
+			return bitcoin.ScriptItems{bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE)}, nil
+		}
+
+		if inArray {
+			result = append(result, bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+		}
+	}
+
+	if typ.IsArray {
+		if typ.ElementType == nil {
+			return nil, errors.Wrap(ErrInvalidDefinition, "missing array element type")
+		}
+
+		var items []interface{}
+		if value != nil {
+			a, ok := value.([]interface{})
+			if !ok {
+				return nil, errors.Wrapf(ErrValueConversion, "not an array: %T", value)
+			}
+			items = a
+		}
+
+		if typ.FixedSize > 0 {
+			if uint(len(items)) != typ.FixedSize {
+				return nil, errors.Wrapf(ErrValueConversion,
+					"Fixed array wrong size : got %d, want %d", len(items), typ.FixedSize)
+			}
+		} else {
+			result = append(result, bitcoin.PushNumberScriptItem(int64(len(items))))
+		}
+
+		for i, item := range items {
+			scriptItems, err := v.encodeType(item, typ.ElementType, true, version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d", i)
+			}
+			result = append(result, scriptItems...)
+		}
+
+		return result, nil
+	}
+
+	switch typ.Type {
+	case BaseTypeStruct:
+		scriptItems, err := v.encodeNamed(value, typ.TypeName, inArray, version)
+		if err != nil {
+			return nil, err
+		}
+		return append(result, scriptItems...), nil
+
+	case BaseTypeMap:
+		if typ.KeyType == nil || typ.ElementType == nil {
+			return nil, errors.Wrap(ErrInvalidDefinition, "missing map key or value type")
+		}
+
+		var m Map
+		if value != nil {
+			mv, ok := value.(Map)
+			if !ok {
+				return nil, errors.Wrapf(ErrValueConversion, "not a map: %T", value)
+			}
+			m = mv
+		}
+
+		encoder := NewMapEncoder(len(m))
+		for i, entry := range m {
+			keyScriptItems, err := v.encodeType(entry.Key, typ.KeyType, true, version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "key %d", i)
+			}
+
+			valueScriptItems, err := v.encodeType(entry.Value, typ.ElementType, true, version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "value %d", i)
+			}
+
+			if err := encoder.Add(keyScriptItems, valueScriptItems); err != nil {
+				return nil, errors.Wrapf(err, "entry %d", i)
+			}
+		}
+
+		writer := &ScriptItemWriter{}
+		if err := encoder.Write(writer); err != nil {
+			return nil, err
+		}
+		scriptItems := writer.ScriptItems()
+		return append(result, scriptItems...), nil
+
+	case BaseTypeBinary, BaseTypeString:
+		var b []byte
+		switch bv := value.(type) {
+		case []byte:
+			b = bv
+		case string:
+			b = []byte(bv)
+		case nil:
+		default:
+			return nil, errors.Wrapf(ErrValueConversion, "not %s: %T", typ.Type, value)
+		}
+
+		if typ.FixedSize > 0 && uint(len(b)) != typ.FixedSize {
+			return nil, errors.Wrapf(ErrValueConversion, "Fixed %s wrong size : got %d, want %d",
+				typ.Type, len(b), typ.FixedSize)
+		}
+
+		return append(result, bitcoin.NewPushDataScriptItem(b)), nil
+
+	case BaseTypeBool:
+		b, ok := value.(bool)
+		if !ok && value != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "not bool: %T", value)
+		}
+
+		if b {
+			return append(result, bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE)), nil
+		}
+		return append(result, bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE)), nil
+
+	case BaseTypeInt8, BaseTypeInt16, BaseTypeInt32, BaseTypeInt64:
+		i, err := dynamicInt64(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(result, bitcoin.PushNumberScriptItem(i)), nil
+
+	case BaseTypeUint8, BaseTypeUint16, BaseTypeUint32, BaseTypeUint64:
+		u, err := dynamicUint64(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(result, bitcoin.PushNumberScriptItemUnsigned(u)), nil
+
+	case BaseTypeFloat32, BaseTypeFloat64:
+		var f float64
+		switch fv := value.(type) {
+		case float32:
+			f = float64(fv)
+		case float64:
+			f = fv
+		case nil:
+		default:
+			return nil, errors.Wrapf(ErrValueConversion, "not float: %T", value)
+		}
+
+		if typ.Type == BaseTypeFloat32 {
+			return append(result, Float32ScriptItem(float32(f))), nil
+		}
+		return append(result, Float64ScriptItem(f)), nil
+
+	case BaseTypeTime:
+		var t time.Time
+		switch tv := value.(type) {
+		case time.Time:
+			t = tv
+		case *time.Time:
+			t = *tv
+		case nil:
+		default:
+			return nil, errors.Wrapf(ErrValueConversion, "not time: %T", value)
+		}
+
+		item, err := TimeScriptItem(t)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(result, item), nil
+
+	case BaseTypeBigInt:
+		i, err := dynamicBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(result, BigIntScriptItem(i)), nil
+
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typ.String())
+	}
+}
+
+func dynamicInt64(value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint64:
+		if int64(v) < 0 {
+			return 0, errors.Wrapf(ErrValueConversion, "integer overflow: %d", v)
+		}
+		return int64(v), nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, errors.Wrapf(ErrValueConversion, "not integer: %T", value)
+	}
+}
+
+func dynamicUint64(value interface{}) (uint64, error) {
+	switch v := value.(type) {
+	case uint64:
+		return v, nil
+	case int64:
+		if v < 0 {
+			return 0, errors.Wrapf(ErrValueConversion, "negative unsigned integer: %d", v)
+		}
+		return uint64(v), nil
+	case int:
+		if v < 0 {
+			return 0, errors.Wrapf(ErrValueConversion, "negative unsigned integer: %d", v)
+		}
+		return uint64(v), nil
+	case nil:
+		return 0, nil
+	default:
+		return 0, errors.Wrapf(ErrValueConversion, "not unsigned integer: %T", value)
+	}
+}
+
+func dynamicBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case int64:
+		return big.NewInt(v), nil
+	case int:
+		return big.NewInt(int64(v)), nil
+	case uint64:
+		return new(big.Int).SetUint64(v), nil
+	case nil:
+		return new(big.Int), nil
+	default:
+		return nil, errors.Wrapf(ErrValueConversion, "not integer: %T", value)
+	}
+}
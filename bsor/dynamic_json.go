@@ -0,0 +1,545 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DynamicToJSON converts a value returned by UnmarshalDynamic to JSON. Binary values are hex
+// encoded. Maps with string or integer keys are JSON objects and other maps are arrays of objects
+// with "key" and "value". Unions are objects with the variant "id" and "value". Times are RFC 3339
+// strings. Unknown fields are not included.
+func DynamicToJSON(value interface{}) ([]byte, error) {
+	return json.Marshal(dynamicJSONValue(value))
+}
+
+// DynamicFromJSON converts JSON, in the form created by DynamicToJSON, to a value of the named
+// type that can be encoded with MarshalDynamic. Fields with zero values are excluded the same as
+// Marshal would exclude them.
+func (v *Definitions) DynamicFromJSON(data []byte, typeName string) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, errors.Wrap(err, "json")
+	}
+
+	result, err := v.fromJSONNamed(raw, typeName)
+	if err != nil {
+		return nil, errors.Wrap(err, typeName)
+	}
+
+	return result, nil
+}
+
+func dynamicJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return hex.EncodeToString(v)
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = dynamicJSONValue(item)
+		}
+		return result
+	default:
+		return value
+	}
+}
+
+func (o Object) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, field := range o.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name := field.Name
+		if len(name) == 0 {
+			name = strconv.FormatUint(uint64(field.ID), 10)
+		}
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "name")
+		}
+
+		value, err := json.Marshal(dynamicJSONValue(field.Value))
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (u Union) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID    uint        `json:"id"`
+		Value interface{} `json:"value"`
+	}{
+		ID:    u.ID,
+		Value: dynamicJSONValue(u.Value),
+	})
+}
+
+func (m Map) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+
+	keysAreText := true
+	for _, entry := range m {
+		switch entry.Key.(type) {
+		case string, int64, uint64:
+		default:
+			keysAreText = false
+		}
+	}
+
+	if !keysAreText {
+		type jsonMapEntry struct {
+			Key   interface{} `json:"key"`
+			Value interface{} `json:"value"`
+		}
+
+		entries := make([]jsonMapEntry, len(m))
+		for i, entry := range m {
+			entries[i] = jsonMapEntry{
+				Key:   dynamicJSONValue(entry.Key),
+				Value: dynamicJSONValue(entry.Value),
+			}
+		}
+
+		return json.Marshal(entries)
+	}
+
+	buf.WriteByte('{')
+	for i, entry := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		var name string
+		switch k := entry.Key.(type) {
+		case string:
+			name = k
+		case int64:
+			name = strconv.FormatInt(k, 10)
+		case uint64:
+			name = strconv.FormatUint(k, 10)
+		}
+
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "key")
+		}
+
+		value, err := json.Marshal(dynamicJSONValue(entry.Value))
+		if err != nil {
+			return nil, errors.Wrap(err, name)
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+func (v *Definitions) fromJSONNamed(raw interface{}, typeName string) (interface{}, error) {
+	switch definition := v.Definitions[typeName].(type) {
+	case *StructDefinition:
+		return v.fromJSONStruct(raw, typeName, definition)
+	case *UnionDefinition:
+		return v.fromJSONUnion(raw, typeName, definition)
+	case *BaseDefinition:
+		return v.fromJSONType(raw, &definition.Type)
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typeName)
+	}
+}
+
+func (v *Definitions) fromJSONStruct(raw interface{}, typeName string,
+	definition *StructDefinition) (interface{}, error) {
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrapf(ErrValueConversion, "%s not an object: %T", typeName, raw)
+	}
+
+	result := &Object{
+		TypeName: typeName,
+	}
+
+	used := 0
+	for _, field := range definition.Fields {
+		fieldRaw, exists := values[field.Name]
+		if !exists {
+			fieldRaw, exists = values[strconv.FormatUint(uint64(field.ID), 10)]
+			if !exists {
+				continue
+			}
+		}
+		used++
+
+		value, err := v.fromJSONType(fieldRaw, &field.Type)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field: %s (id %d) (%s)", field.Name, field.ID,
+				field.Type)
+		}
+
+		if v.isZeroDynamic(value, &field.Type) {
+			continue
+		}
+
+		result.Fields = append(result.Fields, &ObjectField{
+			ID:    field.ID,
+			Name:  field.Name,
+			Value: value,
+		})
+	}
+
+	if used != len(values) {
+		for name := range values {
+			if definition.FindFieldByName(name) == nil {
+				return nil, errors.Wrapf(ErrUnknownField, "%s in %s", name, typeName)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (v *Definitions) fromJSONUnion(raw interface{}, typeName string,
+	definition *UnionDefinition) (interface{}, error) {
+
+	if raw == nil {
+		return nil, nil
+	}
+
+	values, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrapf(ErrValueConversion, "%s not an object: %T", typeName, raw)
+	}
+
+	number, ok := values["id"].(json.Number)
+	if !ok {
+		return nil, errors.Wrapf(ErrValueConversion, "%s missing variant id", typeName)
+	}
+
+	id, err := strconv.ParseUint(number.String(), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(ErrValueConversion, "%s variant id: %s", typeName, err)
+	}
+
+	variant := definition.FindVariant(uint(id))
+	if variant == nil {
+		return nil, errors.Wrapf(ErrUnregisteredType, "id %d for %s", id, typeName)
+	}
+
+	value, err := v.fromJSONType(values["value"], &variant.Type)
+	if err != nil {
+		return nil, errors.Wrapf(err, "variant: %s (id %d) (%s)", variant.Name, variant.ID,
+			variant.Type)
+	}
+
+	return &Union{
+		ID:    variant.ID,
+		Value: value,
+	}, nil
+}
+
+func (v *Definitions) fromJSONType(raw interface{}, typ *Type) (interface{}, error) {
+	if raw == nil {
+		return nil, nil
+	}
+
+	if typ.IsArray {
+		if typ.ElementType == nil {
+			return nil, errors.Wrap(ErrInvalidDefinition, "missing array element type")
+		}
+
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "not an array: %T", raw)
+		}
+
+		if typ.FixedSize > 0 && uint(len(items)) != typ.FixedSize {
+			return nil, errors.Wrapf(ErrValueConversion,
+				"Fixed array wrong size : got %d, want %d", len(items), typ.FixedSize)
+		}
+
+		result := make([]interface{}, len(items))
+		for i, item := range items {
+			value, err := v.fromJSONType(item, typ.ElementType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "item %d", i)
+			}
+			result[i] = value
+		}
+
+		return result, nil
+	}
+
+	switch typ.Type {
+	case BaseTypeStruct:
+		return v.fromJSONNamed(raw, typ.TypeName)
+
+	case BaseTypeMap:
+		return v.fromJSONMap(raw, typ)
+
+	case BaseTypeBinary:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "binary not hex string: %T", raw)
+		}
+
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "binary hex: %s", err)
+		}
+
+		if typ.FixedSize > 0 && uint(len(b)) != typ.FixedSize {
+			return nil, errors.Wrapf(ErrValueConversion,
+				"Fixed binary wrong size : got %d, want %d", len(b), typ.FixedSize)
+		}
+
+		return b, nil
+
+	case BaseTypeString:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "not string: %T", raw)
+		}
+
+		if typ.FixedSize > 0 && uint(len(s)) != typ.FixedSize {
+			return nil, errors.Wrapf(ErrValueConversion,
+				"Fixed string wrong size : got %d, want %d", len(s), typ.FixedSize)
+		}
+
+		return s, nil
+
+	case BaseTypeBool:
+		b, ok := raw.(bool)
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "not bool: %T", raw)
+		}
+
+		return b, nil
+
+	case BaseTypeInt8, BaseTypeInt16, BaseTypeInt32, BaseTypeInt64,
+		BaseTypeUint8, BaseTypeUint16, BaseTypeUint32, BaseTypeUint64,
+		BaseTypeFloat32, BaseTypeFloat64:
+
+		var s string
+		switch n := raw.(type) {
+		case json.Number:
+			s = n.String()
+		case string:
+			s = n // map keys
+		default:
+			return nil, errors.Wrapf(ErrValueConversion, "not number: %T", raw)
+		}
+
+		return parseDynamicNumber(s, typ.Type)
+
+	case BaseTypeTime:
+		s, ok := raw.(string)
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "time not string: %T", raw)
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "time: %s", err)
+		}
+
+		return t, nil
+
+	case BaseTypeBigInt:
+		var s string
+		switch n := raw.(type) {
+		case json.Number:
+			s = n.String()
+		case string:
+			s = n // map keys
+		default:
+			return nil, errors.Wrapf(ErrValueConversion, "not number: %T", raw)
+		}
+
+		value, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return nil, errors.Wrapf(ErrValueConversion, "%s: invalid integer: %s", typ.Type, s)
+		}
+
+		return value, nil
+
+	default:
+		return nil, errors.Wrap(ErrUnknownType, typ.String())
+	}
+}
+
+func (v *Definitions) fromJSONMap(raw interface{}, typ *Type) (interface{}, error) {
+	if typ.KeyType == nil || typ.ElementType == nil {
+		return nil, errors.Wrap(ErrInvalidDefinition, "missing map key or value type")
+	}
+
+	var result Map
+	switch m := raw.(type) {
+	case map[string]interface{}:
+		result = make(Map, 0, len(m))
+		for k, rawValue := range m {
+			key, err := v.fromJSONType(k, typ.KeyType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "key %s", k)
+			}
+
+			value, err := v.fromJSONType(rawValue, typ.ElementType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "value %s", k)
+			}
+
+			result = append(result, &MapEntry{
+				Key:   key,
+				Value: value,
+			})
+		}
+
+	case []interface{}:
+		result = make(Map, 0, len(m))
+		for i, rawEntry := range m {
+			entry, ok := rawEntry.(map[string]interface{})
+			if !ok {
+				return nil, errors.Wrapf(ErrValueConversion, "map entry %d not an object: %T", i,
+					rawEntry)
+			}
+
+			key, err := v.fromJSONType(entry["key"], typ.KeyType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "key %d", i)
+			}
+
+			value, err := v.fromJSONType(entry["value"], typ.ElementType)
+			if err != nil {
+				return nil, errors.Wrapf(err, "value %d", i)
+			}
+
+			result = append(result, &MapEntry{
+				Key:   key,
+				Value: value,
+			})
+		}
+
+	default:
+		return nil, errors.Wrapf(ErrValueConversion, "not a map: %T", raw)
+	}
+
+	return result, nil
+}
+
+func parseDynamicNumber(s string, baseType BaseType) (interface{}, error) {
+	switch baseType {
+	case BaseTypeInt8, BaseTypeInt16, BaseTypeInt32, BaseTypeInt64:
+		bitSize := 8 << (baseType - BaseTypeInt8)
+		value, err := strconv.ParseInt(s, 10, bitSize)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "%s: %s", baseType, err)
+		}
+		return value, nil
+
+	case BaseTypeUint8, BaseTypeUint16, BaseTypeUint32, BaseTypeUint64:
+		bitSize := 8 << (baseType - BaseTypeUint8)
+		value, err := strconv.ParseUint(s, 10, bitSize)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "%s: %s", baseType, err)
+		}
+		return value, nil
+
+	case BaseTypeFloat32:
+		value, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "%s: %s", baseType, err)
+		}
+		return float32(value), nil
+
+	default:
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Wrapf(ErrValueConversion, "%s: %s", baseType, err)
+		}
+		return value, nil
+	}
+}
+
+// isZeroDynamic returns true if the value is one that Marshal excludes from the encoding.
+func (v *Definitions) isZeroDynamic(value interface{}, typ *Type) bool {
+	if value == nil {
+		return true
+	}
+
+	if typ.IsPointer {
+		return false
+	}
+
+	if typ.IsArray {
+		if typ.FixedSize == 0 {
+			return false
+		}
+
+		items, _ := value.([]interface{})
+		for _, item := range items {
+			if !v.isZeroDynamic(item, typ.ElementType) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch val := value.(type) {
+	case *Object:
+		return len(val.Fields) == 0 && len(val.UnknownFields) == 0
+	case []byte:
+		for _, b := range val {
+			if b != 0 {
+				return false
+			}
+		}
+		return true
+	case string:
+		return len(val) == 0
+	case bool:
+		return !val
+	case int64:
+		return val == 0
+	case uint64:
+		return val == 0
+	case float32:
+		return val == 0
+	case float64:
+		return val == 0
+	case time.Time:
+		return val.IsZero()
+	case *big.Int:
+		return val.Sign() == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,308 @@
+package bsor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/go-test/deep"
+	"github.com/pkg/errors"
+)
+
+func Test_ParseDefinitions(t *testing.T) {
+	definitions, err := BuildDefinitions(
+		reflect.TypeOf(TestStruct{}),
+		reflect.TypeOf(TestMapStruct{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	js, err := json.Marshal(definitions)
+	if err != nil {
+		t.Fatalf("Failed to marshal definitions : %s", err)
+	}
+
+	for _, data := range [][]byte{[]byte(definitions.String()), js} {
+		read, err := ParseDefinitions(data)
+		if err != nil {
+			t.Fatalf("Failed to parse definitions : %s", err)
+		}
+
+		if len(read.Definitions) != len(definitions.Definitions) {
+			t.Fatalf("Wrong definition count : got %d, want %d", len(read.Definitions),
+				len(definitions.Definitions))
+		}
+
+		for name, definition := range definitions.Definitions {
+			readDefinition, exists := read.Definitions[name]
+			if !exists {
+				t.Fatalf("Missing definition %s", name)
+			}
+
+			if readDefinition.String() != definition.String() {
+				t.Errorf("Wrong definition %s : \n  got  : %s\n  want : %s", name,
+					readDefinition.String(), definition.String())
+			}
+		}
+	}
+}
+
+func Test_ParseDefinitions_File(t *testing.T) {
+	data, err := ioutil.ReadFile("test_files/definitions.bsor")
+	if err != nil {
+		t.Fatalf("Failed to read file : %s", err)
+	}
+
+	definitions, err := ParseDefinitions(data)
+	if err != nil {
+		t.Fatalf("Failed to parse definitions : %s", err)
+	}
+
+	if _, exists := definitions.Definitions["TestStruct"]; !exists {
+		t.Fatalf("Missing TestStruct definition")
+	}
+}
+
+func Test_ParseType(t *testing.T) {
+	tests := []string{
+		"int64",
+		"*string",
+		"binary(33)",
+		"[]*binary(33)",
+		"[2]TestSubStruct",
+		"map[string]map[int64]*TestSubStruct",
+		"[]map[binary(2)][]string",
+	}
+
+	for _, tt := range tests {
+		typ, err := ParseType(tt)
+		if err != nil {
+			t.Fatalf("Failed to parse type %s : %s", tt, err)
+		}
+
+		if typ.String() != tt {
+			t.Errorf("Wrong type : got %s, want %s", typ.String(), tt)
+		}
+	}
+
+	invalid := []string{"", "[2", "map[string", "string(", "int64(4)", "string]"}
+	for _, tt := range invalid {
+		if _, err := ParseType(tt); errors.Cause(err) != ErrInvalidDefinition {
+			t.Errorf("Wrong error for \"%s\" : got %v, want %s", tt, err, ErrInvalidDefinition)
+		}
+	}
+}
+
+func Test_Dynamic(t *testing.T) {
+	stringValue := "string value"
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	pubKey := key.PublicKey()
+	intValue := 500
+	intZeroValue := 0
+
+	tests := []struct {
+		typeName string
+		value    interface{}
+	}{
+		{
+			typeName: "TestStruct",
+			value: TestStruct{
+				IntField:    10,
+				StringField: "test",
+				SubStruct: TestSubStruct{
+					SubIntField:    20,
+					SubStringField: "sub_string",
+				},
+				SubStructPtr: &TestSubStruct{
+					SubIntField: 21,
+				},
+				BinaryField:              []byte{0x45, 0xcd},
+				FixedBinaryField:         [4]byte{0x10, 0x11, 0x12, 0x13},
+				PointerField:             &stringValue,
+				ArrayPrimitiveField:      []string{"string1", "string2"},
+				FixedArrayPrimitiveField: [2]int{4, 5},
+				FixedArrayObjectField: [2]TestSubStruct{
+					{SubIntField: 23},
+					{SubStringField: "sub_string_array3"},
+				},
+				ArrayObjectPtrField: []*TestSubStruct{
+					nil,
+					{SubIntField: 25},
+				},
+				ArrayStringPtrField:         []*string{nil, &stringValue},
+				PublicKeyField:              pubKey,
+				PublicKeyPtrFixedArrayField: [2]*bitcoin.PublicKey{nil, &pubKey},
+				IntPtrField:                 &intValue,
+				IntPtrZeroField:             &intZeroValue,
+				FixedStringField:            "12345",
+			},
+		},
+		{
+			typeName: "TestMapStruct",
+			value: TestMapStruct{
+				StringMapField: map[string]string{"one": "1", "two": "2"},
+				IntMapField:    map[int]int{-1: 0, 1000: -1000},
+				ObjectPtrMapField: map[uint32]*TestSubStruct{
+					1: nil,
+					2: {SubIntField: 2},
+				},
+				BinaryKeyMapField: map[bitcoin.Hash20]bool{
+					bitcoin.Hash20{0x01}: true,
+					bitcoin.Hash20{0x02}: false,
+				},
+				StructKeyMapField: map[TestSubStruct]string{
+					{SubIntField: 1}: "int",
+				},
+				BoolMapField: map[bool]map[int]map[string]float64{
+					true: {1: {"pi": 3.14159}},
+				},
+			},
+		},
+	}
+
+	definitions, err := BuildDefinitions(
+		reflect.TypeOf(TestStruct{}),
+		reflect.TypeOf(TestMapStruct{}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	for i, tt := range tests {
+		for _, version := range []uint8{EncodingVersionInitial, EncodingVersionSkippable} {
+			t.Run(fmt.Sprintf("Test %d version %d", i, version), func(t *testing.T) {
+				scriptItems, err := MarshalWithOptions(tt.value, MarshalOptions{Version: version})
+				if err != nil {
+					t.Fatalf("Failed to marshal struct : %s", err)
+				}
+
+				script, err := scriptItems.Script()
+				if err != nil {
+					t.Fatalf("Failed to create script : %s", err)
+				}
+
+				value, remaining, err := definitions.UnmarshalDynamic(scriptItems, tt.typeName,
+					UnmarshalOptions{})
+				if err != nil {
+					t.Fatalf("Failed to unmarshal dynamic : %s", err)
+				}
+
+				if len(remaining) != 0 {
+					t.Errorf("No script items should be remaining : %d", len(remaining))
+				}
+
+				js, err := DynamicToJSON(value)
+				if err != nil {
+					t.Fatalf("Failed to convert to json : %s", err)
+				}
+				t.Logf("JSON : %s", js)
+
+				readValue, err := definitions.DynamicFromJSON(js, tt.typeName)
+				if err != nil {
+					t.Fatalf("Failed to convert from json : %s", err)
+				}
+
+				rescriptItems, err := definitions.MarshalDynamic(readValue, tt.typeName,
+					MarshalOptions{Version: version})
+				if err != nil {
+					t.Fatalf("Failed to marshal dynamic : %s", err)
+				}
+
+				rescript, err := rescriptItems.Script()
+				if err != nil {
+					t.Fatalf("Failed to create script : %s", err)
+				}
+
+				if !bytes.Equal(rescript, script) {
+					t.Fatalf("Wrong script : \n  got  : %s\n  want : %s", rescript, script)
+				}
+			})
+		}
+	}
+}
+
+func Test_Dynamic_UnknownFields(t *testing.T) {
+	value := TestVersionedStructNew{
+		IntField: 1,
+		SubStruct: TestVersionedSubStructNew{
+			SubIntField:    2,
+			SubStringField: "sub",
+		},
+		StringField:   "string",
+		NewArrayField: []string{"new"},
+	}
+
+	scriptItems, err := MarshalWithOptions(value, MarshalOptions{
+		Version: EncodingVersionSkippable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal struct : %s", err)
+	}
+
+	script, err := scriptItems.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	definitions, err := BuildDefinitions(reflect.TypeOf(TestVersionedStruct{}))
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	if _, _, err := definitions.UnmarshalDynamic(scriptItems, "TestVersionedStruct",
+		UnmarshalOptions{}); errors.Cause(err) != ErrUnknownField {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrUnknownField)
+	}
+
+	read, _, err := definitions.UnmarshalDynamic(scriptItems, "TestVersionedStruct",
+		UnmarshalOptions{AllowUnknownFields: true})
+	if err != nil {
+		t.Fatalf("Failed to unmarshal dynamic : %s", err)
+	}
+
+	object := read.(*Object)
+	if len(object.UnknownFields) != 1 {
+		t.Fatalf("Wrong unknown field count : got %d, want %d", len(object.UnknownFields), 1)
+	}
+
+	subStruct, _ := object.Field("SubStruct")
+	if len(subStruct.(*Object).UnknownFields) != 1 {
+		t.Fatalf("Wrong sub struct unknown field count : got %d, want %d",
+			len(subStruct.(*Object).UnknownFields), 1)
+	}
+
+	if stringValue, _ := object.Field("StringField"); stringValue != "string" {
+		t.Errorf("Wrong string field : got %v, want %s", stringValue, "string")
+	}
+
+	// Unknown fields are retained when encoding again.
+	rescriptItems, err := definitions.MarshalDynamic(read, "TestVersionedStruct",
+		MarshalOptions{Version: EncodingVersionSkippable})
+	if err != nil {
+		t.Fatalf("Failed to marshal dynamic : %s", err)
+	}
+
+	rescript, err := rescriptItems.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	readNew := &TestVersionedStructNew{}
+	if _, err := UnmarshalBinary(rescript, readNew); err != nil {
+		t.Fatalf("Failed to unmarshal script : %s", err)
+	}
+
+	if !bytes.Equal(rescript, script) {
+		t.Errorf("Wrong script : \n  got  : %s\n  want : %s", rescript, script)
+	}
+
+	if !reflect.DeepEqual(*readNew, value) {
+		t.Errorf("Unmarshalled value not equal : %v", deep.Equal(*readNew, value))
+	}
+}
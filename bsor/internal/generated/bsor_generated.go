@@ -0,0 +1,1061 @@
+// Code generated by "bsor generate". DO NOT EDIT.
+
+package generated
+
+import (
+	"math"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+
+	"github.com/pkg/errors"
+)
+
+// MarshalBSOR writes the field count followed by the fields of Struct.
+func (v Struct) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := len(v.UnknownFields)
+	if v.Int != 0 {
+		fieldCount++
+	}
+	if v.Uint8 != 0 {
+		fieldCount++
+	}
+	if v.Bool {
+		fieldCount++
+	}
+	if math.Float32bits(float32(v.Float32)) != 0 {
+		fieldCount++
+	}
+	if math.Float64bits(float64(v.Float64)) != 0 {
+		fieldCount++
+	}
+	if v.String != "" {
+		fieldCount++
+	}
+	if v.FixedString != "" {
+		fieldCount++
+	}
+	if v.Bytes != nil {
+		fieldCount++
+	}
+	if v.FixedBytes != ([4]byte{}) {
+		fieldCount++
+	}
+	if v.Hash != (bitcoin.Hash32{}) {
+		fieldCount++
+	}
+	if v.Script != nil {
+		fieldCount++
+	}
+	if !reflect.ValueOf(v.PublicKey).IsZero() {
+		fieldCount++
+	}
+	if v.PublicKeyPtr != nil {
+		fieldCount++
+	}
+	if v.PublicKeys != nil {
+		fieldCount++
+	}
+	if !reflect.ValueOf(v.Sub).IsZero() {
+		fieldCount++
+	}
+	if v.SubPtr != nil {
+		fieldCount++
+	}
+	if v.Subs != nil {
+		fieldCount++
+	}
+	if v.SubValues != nil {
+		fieldCount++
+	}
+	if v.Ints != nil {
+		fieldCount++
+	}
+	if v.IntPtrs != nil {
+		fieldCount++
+	}
+	if v.Strings != ([2]string{}) {
+		fieldCount++
+	}
+	if v.Map != nil {
+		fieldCount++
+	}
+	if v.IntMap != nil {
+		fieldCount++
+	}
+	if v.KeyMap != nil {
+		fieldCount++
+	}
+	if v.Other != nil {
+		fieldCount++
+	}
+	if v.Others != nil {
+		fieldCount++
+	}
+	if v.Nested != nil {
+		fieldCount++
+	}
+	if v.Time != (time.Time{}) {
+		fieldCount++
+	}
+	if v.Times != nil {
+		fieldCount++
+	}
+	if v.Amount != nil {
+		fieldCount++
+	}
+	if v.Amounts != nil {
+		fieldCount++
+	}
+	if v.Action != nil {
+		fieldCount++
+	}
+	if v.Actions != nil {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Int != 0 {
+		fieldWriter := encoder.StartField(1)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(v.Int)))
+		encoder.EndField()
+	}
+
+	if v.Uint8 != 0 {
+		fieldWriter := encoder.StartField(2)
+		fieldWriter.Add(bitcoin.PushNumberScriptItemUnsigned(uint64(v.Uint8)))
+		encoder.EndField()
+	}
+
+	if v.Bool {
+		fieldWriter := encoder.StartField(3)
+		if v.Bool {
+			fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+		} else {
+			fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+		}
+		encoder.EndField()
+	}
+
+	if math.Float32bits(float32(v.Float32)) != 0 {
+		fieldWriter := encoder.StartField(4)
+		fieldWriter.Add(bsor.Float32ScriptItem(float32(v.Float32)))
+		encoder.EndField()
+	}
+
+	if math.Float64bits(float64(v.Float64)) != 0 {
+		fieldWriter := encoder.StartField(5)
+		fieldWriter.Add(bsor.Float64ScriptItem(float64(v.Float64)))
+		encoder.EndField()
+	}
+
+	if v.String != "" {
+		fieldWriter := encoder.StartField(6)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.String)))
+		encoder.EndField()
+	}
+
+	if v.FixedString != "" {
+		fieldWriter := encoder.StartField(7)
+		if len(v.FixedString) != 4 {
+			return errors.Wrapf(bsor.ErrValueConversion, "FixedString: Fixed string wrong size : got %d, want %d", len(v.FixedString), 4)
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.FixedString)))
+		encoder.EndField()
+	}
+
+	if v.Bytes != nil {
+		fieldWriter := encoder.StartField(8)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.Bytes)))
+		encoder.EndField()
+	}
+
+	if v.FixedBytes != ([4]byte{}) {
+		fieldWriter := encoder.StartField(9)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(append([]byte{}, v.FixedBytes[:]...)))
+		encoder.EndField()
+	}
+
+	if v.Hash != (bitcoin.Hash32{}) {
+		fieldWriter := encoder.StartField(10)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(append([]byte{}, v.Hash[:]...)))
+		encoder.EndField()
+	}
+
+	if v.Script != nil {
+		fieldWriter := encoder.StartField(11)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.Script)))
+		encoder.EndField()
+	}
+
+	if !reflect.ValueOf(v.PublicKey).IsZero() {
+		fieldWriter := encoder.StartField(12)
+		b1, err := v.PublicKey.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "PublicKey binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b1))
+		encoder.EndField()
+	}
+
+	if v.PublicKeyPtr != nil {
+		fieldWriter := encoder.StartField(13)
+		b2, err := v.PublicKeyPtr.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "PublicKeyPtr binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b2))
+		encoder.EndField()
+	}
+
+	if v.PublicKeys != nil {
+		fieldWriter := encoder.StartField(14)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.PublicKeys))))
+		for i3, item4 := range v.PublicKeys {
+			if item4 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				b5, err := item4.MarshalBinary()
+				if err != nil {
+					return errors.Wrapf(err, "PublicKeys item %d binary marshal", i3)
+				}
+				fieldWriter.Add(bitcoin.NewPushDataScriptItem(b5))
+			}
+		}
+		encoder.EndField()
+	}
+
+	if !reflect.ValueOf(v.Sub).IsZero() {
+		fieldWriter := encoder.StartField(15)
+		if err := v.Sub.MarshalBSOR(fieldWriter, options); err != nil {
+			return errors.Wrap(err, "Sub")
+		}
+		encoder.EndField()
+	}
+
+	if v.SubPtr != nil {
+		fieldWriter := encoder.StartField(16)
+		if err := v.SubPtr.MarshalBSOR(fieldWriter, options); err != nil {
+			return errors.Wrap(err, "SubPtr")
+		}
+		encoder.EndField()
+	}
+
+	if v.Subs != nil {
+		fieldWriter := encoder.StartField(17)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Subs))))
+		for i6, item7 := range v.Subs {
+			if item7 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				if err := item7.MarshalBSOR(fieldWriter, options); err != nil {
+					return errors.Wrapf(err, "Subs item %d", i6)
+				}
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.SubValues != nil {
+		fieldWriter := encoder.StartField(18)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.SubValues))))
+		for i8, item9 := range v.SubValues {
+			if err := item9.MarshalBSOR(fieldWriter, options); err != nil {
+				return errors.Wrapf(err, "SubValues item %d", i8)
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.Ints != nil {
+		fieldWriter := encoder.StartField(19)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Ints))))
+		for _, item11 := range v.Ints {
+			fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(item11)))
+		}
+		encoder.EndField()
+	}
+
+	if v.IntPtrs != nil {
+		fieldWriter := encoder.StartField(20)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.IntPtrs))))
+		for _, item13 := range v.IntPtrs {
+			if item13 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				fieldWriter.Add(bitcoin.PushNumberScriptItem(int64((*item13))))
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.Strings != ([2]string{}) {
+		fieldWriter := encoder.StartField(21)
+		for _, item15 := range v.Strings {
+			fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(item15)))
+		}
+		encoder.EndField()
+	}
+
+	if v.Map != nil {
+		fieldWriter := encoder.StartField(22)
+		mapEncoder16 := bsor.NewMapEncoder(len(v.Map))
+		for key17, value18 := range v.Map {
+			keyWriter19 := &bsor.ScriptItemWriter{}
+			keyWriter19.Add(bitcoin.NewPushDataScriptItem([]byte(key17)))
+			valueWriter20 := &bsor.ScriptItemWriter{}
+			if value18 == nil {
+				valueWriter20.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				valueWriter20.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				if err := value18.MarshalBSOR(valueWriter20, options); err != nil {
+					return errors.Wrap(err, "Map value")
+				}
+			}
+			if err := mapEncoder16.Add(keyWriter19.ScriptItems(), valueWriter20.ScriptItems()); err != nil {
+				return errors.Wrap(err, "Map entry")
+			}
+		}
+		if err := mapEncoder16.Write(fieldWriter); err != nil {
+			return errors.Wrap(err, "Map")
+		}
+		encoder.EndField()
+	}
+
+	if v.IntMap != nil {
+		fieldWriter := encoder.StartField(23)
+		mapEncoder21 := bsor.NewMapEncoder(len(v.IntMap))
+		for key22, value23 := range v.IntMap {
+			keyWriter24 := &bsor.ScriptItemWriter{}
+			keyWriter24.Add(bitcoin.PushNumberScriptItem(int64(key22)))
+			valueWriter25 := &bsor.ScriptItemWriter{}
+			valueWriter25.Add(bitcoin.NewPushDataScriptItem([]byte(value23)))
+			if err := mapEncoder21.Add(keyWriter24.ScriptItems(), valueWriter25.ScriptItems()); err != nil {
+				return errors.Wrap(err, "IntMap entry")
+			}
+		}
+		if err := mapEncoder21.Write(fieldWriter); err != nil {
+			return errors.Wrap(err, "IntMap")
+		}
+		encoder.EndField()
+	}
+
+	if v.KeyMap != nil {
+		fieldWriter := encoder.StartField(24)
+		mapEncoder26 := bsor.NewMapEncoder(len(v.KeyMap))
+		for key27, value28 := range v.KeyMap {
+			keyWriter29 := &bsor.ScriptItemWriter{}
+			if err := bsor.MarshalValue(keyWriter29, key27, false, options); err != nil {
+				return errors.Wrap(err, "KeyMap key")
+			}
+			valueWriter30 := &bsor.ScriptItemWriter{}
+			valueWriter30.Add(bitcoin.NewPushDataScriptItem([]byte(value28)))
+			if err := mapEncoder26.Add(keyWriter29.ScriptItems(), valueWriter30.ScriptItems()); err != nil {
+				return errors.Wrap(err, "KeyMap entry")
+			}
+		}
+		if err := mapEncoder26.Write(fieldWriter); err != nil {
+			return errors.Wrap(err, "KeyMap")
+		}
+		encoder.EndField()
+	}
+
+	if v.Other != nil {
+		fieldWriter := encoder.StartField(25)
+		if err := bsor.MarshalValue(fieldWriter, v.Other, false, options); err != nil {
+			return errors.Wrap(err, "Other")
+		}
+		encoder.EndField()
+	}
+
+	if v.Others != nil {
+		fieldWriter := encoder.StartField(26)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Others))))
+		for i31, item32 := range v.Others {
+			if err := bsor.MarshalValue(fieldWriter, item32, false, options); err != nil {
+				return errors.Wrapf(err, "Others item %d", i31)
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.Nested != nil {
+		fieldWriter := encoder.StartField(27)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Nested))))
+		for _, item34 := range v.Nested {
+			fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(item34))))
+			for _, item36 := range item34 {
+				fieldWriter.Add(bitcoin.PushNumberScriptItemUnsigned(uint64(item36)))
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.Time != (time.Time{}) {
+		fieldWriter := encoder.StartField(28)
+		item37, err := bsor.TimeScriptItem(v.Time)
+		if err != nil {
+			return errors.Wrap(err, "Time")
+		}
+		fieldWriter.Add(item37)
+		encoder.EndField()
+	}
+
+	if v.Times != nil {
+		fieldWriter := encoder.StartField(29)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Times))))
+		for i38, item39 := range v.Times {
+			if item39 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				item40, err := bsor.TimeScriptItem((*item39))
+				if err != nil {
+					return errors.Wrapf(err, "Times item %d", i38)
+				}
+				fieldWriter.Add(item40)
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.Amount != nil {
+		fieldWriter := encoder.StartField(30)
+		fieldWriter.Add(bsor.BigIntScriptItem(v.Amount))
+		encoder.EndField()
+	}
+
+	if v.Amounts != nil {
+		fieldWriter := encoder.StartField(31)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Amounts))))
+		for _, item42 := range v.Amounts {
+			fieldWriter.Add(bsor.BigIntScriptItem(&item42))
+		}
+		encoder.EndField()
+	}
+
+	if v.Action != nil {
+		fieldWriter := encoder.StartField(32)
+		if err := bsor.MarshalUnion(fieldWriter, &v.Action, options); err != nil {
+			return errors.Wrap(err, "Action")
+		}
+		encoder.EndField()
+	}
+
+	if v.Actions != nil {
+		fieldWriter := encoder.StartField(33)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Actions))))
+		for i43, item44 := range v.Actions {
+			if err := bsor.MarshalUnion(fieldWriter, &item44, options); err != nil {
+				return errors.Wrapf(err, "Actions item %d", i43)
+			}
+		}
+		encoder.EndField()
+	}
+
+	if err := encoder.WriteUnknownFields(v.UnknownFields); err != nil {
+		return errors.Wrap(err, "unknown fields")
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of Struct.
+func (v *Struct) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	unknownFields, err := bsor.UnmarshalFields(r, options, "Struct",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				var value int
+				value45, err := bsor.ReadInteger(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Int integer")
+				}
+				value = int(value45)
+				v.Int = value
+
+			case 2:
+				var value uint8
+				value46, err := bsor.ReadUnsignedInteger(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Uint8 integer")
+				}
+				value = uint8(value46)
+				v.Uint8 = value
+
+			case 3:
+				var value bool
+				value47, err := bsor.ReadUnsignedInteger(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Bool bool")
+				}
+				value = value47 != 0
+				v.Bool = value
+
+			case 4:
+				var value float32
+				value48, err := bsor.ReadFloat32(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Float32 float32")
+				}
+				value = float32(value48)
+				v.Float32 = value
+
+			case 5:
+				var value float64
+				value49, err := bsor.ReadFloat64(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Float64 float64")
+				}
+				value = float64(value49)
+				v.Float64 = value
+
+			case 6:
+				var value string
+				value50, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "String bytes")
+				}
+				value = string(value50)
+				v.String = value
+
+			case 7:
+				var value string
+				value51, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "FixedString bytes")
+				}
+				if len(value51) != 4 {
+					return true, errors.Wrapf(bsor.ErrValueConversion, "FixedString: Fixed string wrong size : got %d, want %d", len(value51), 4)
+				}
+				value = string(value51)
+				v.FixedString = value
+
+			case 8:
+				var value []byte
+				b52, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Bytes bytes")
+				}
+				value = []byte(b52)
+				v.Bytes = value
+
+			case 9:
+				var value [4]byte
+				b53, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "FixedBytes fixed bytes")
+				}
+				copy(value[:], b53)
+				v.FixedBytes = value
+
+			case 10:
+				var value bitcoin.Hash32
+				b54, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Hash fixed bytes")
+				}
+				copy(value[:], b54)
+				v.Hash = value
+
+			case 11:
+				var value bitcoin.Script
+				b55, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Script bytes")
+				}
+				value = bitcoin.Script(b55)
+				v.Script = value
+
+			case 12:
+				var value bitcoin.PublicKey
+				b56, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "PublicKey bytes")
+				}
+				if err := value.UnmarshalBinary(b56); err != nil {
+					return true, errors.Wrap(err, "PublicKey binary unmarshal")
+				}
+				v.PublicKey = value
+
+			case 13:
+				value := new(bitcoin.PublicKey)
+				b57, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "PublicKeyPtr bytes")
+				}
+				if err := (*value).UnmarshalBinary(b57); err != nil {
+					return true, errors.Wrap(err, "PublicKeyPtr binary unmarshal")
+				}
+				v.PublicKeyPtr = value
+
+			case 14:
+				var value []*bitcoin.PublicKey
+				count58, capacity59, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "PublicKeys count")
+				}
+				value = make([]*bitcoin.PublicKey, 0, capacity59)
+				for i60 := uint64(0); i60 < count58; i60++ {
+					var item61 *bitcoin.PublicKey
+					notNil62, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "PublicKeys item %d not nil", i60)
+					}
+					if notNil62 != 0 {
+						b64, err := bsor.ReadBytes(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "PublicKeys item %d bytes", i60)
+						}
+						item63 := new(bitcoin.PublicKey)
+						if err := item63.UnmarshalBinary(b64); err != nil {
+							return true, errors.Wrapf(err, "PublicKeys item %d binary unmarshal", i60)
+						}
+						item61 = item63
+					}
+					value = append(value, item61)
+				}
+				v.PublicKeys = value
+
+			case 15:
+				var value SubStruct
+				if err := value.UnmarshalBSOR(fieldReader, options); err != nil {
+					return true, errors.Wrap(err, "Sub")
+				}
+				v.Sub = value
+
+			case 16:
+				value := new(SubStruct)
+				if err := (*value).UnmarshalBSOR(fieldReader, options); err != nil {
+					return true, errors.Wrap(err, "SubPtr")
+				}
+				v.SubPtr = value
+
+			case 17:
+				var value []*SubStruct
+				count65, capacity66, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Subs count")
+				}
+				value = make([]*SubStruct, 0, capacity66)
+				for i67 := uint64(0); i67 < count65; i67++ {
+					var item68 *SubStruct
+					notNil69, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Subs item %d not nil", i67)
+					}
+					if notNil69 != 0 {
+						empty71, err := bsor.SkipEmptyObject(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "Subs item %d", i67)
+						}
+						if !empty71 {
+							item70 := new(SubStruct)
+							if err := item70.UnmarshalBSOR(fieldReader, options); err != nil {
+								return true, errors.Wrapf(err, "Subs item %d", i67)
+							}
+							item68 = item70
+						}
+					}
+					value = append(value, item68)
+				}
+				v.Subs = value
+
+			case 18:
+				var value []SubStruct
+				count72, capacity73, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "SubValues count")
+				}
+				value = make([]SubStruct, 0, capacity73)
+				for i74 := uint64(0); i74 < count72; i74++ {
+					var item75 SubStruct
+					if err := item75.UnmarshalBSOR(fieldReader, options); err != nil {
+						return true, errors.Wrapf(err, "SubValues item %d", i74)
+					}
+					value = append(value, item75)
+				}
+				v.SubValues = value
+
+			case 19:
+				var value []int
+				count76, capacity77, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Ints count")
+				}
+				value = make([]int, 0, capacity77)
+				for i78 := uint64(0); i78 < count76; i78++ {
+					var item79 int
+					value80, err := bsor.ReadInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Ints item %d integer", i78)
+					}
+					item79 = int(value80)
+					value = append(value, item79)
+				}
+				v.Ints = value
+
+			case 20:
+				var value []*int
+				count81, capacity82, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "IntPtrs count")
+				}
+				value = make([]*int, 0, capacity82)
+				for i83 := uint64(0); i83 < count81; i83++ {
+					var item84 *int
+					notNil85, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "IntPtrs item %d not nil", i83)
+					}
+					if notNil85 != 0 {
+						item86 := new(int)
+						value87, err := bsor.ReadInteger(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "IntPtrs item %d integer", i83)
+						}
+						(*item86) = int(value87)
+						item84 = item86
+					}
+					value = append(value, item84)
+				}
+				v.IntPtrs = value
+
+			case 21:
+				var value [2]string
+				for i88 := range value {
+					value89, err := bsor.ReadBytes(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Strings item %d bytes", i88)
+					}
+					value[i88] = string(value89)
+				}
+				v.Strings = value
+
+			case 22:
+				var value map[string]*SubStruct
+				count90, capacity95, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Map count")
+				}
+				m91 := make(map[string]*SubStruct, capacity95)
+				for i92 := uint64(0); i92 < count90; i92++ {
+					var key93 string
+					value96, err := bsor.ReadBytes(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Map key %d bytes", i92)
+					}
+					key93 = string(value96)
+					if _, exists := m91[key93]; exists {
+						return true, errors.Wrapf(bsor.ErrValueConversion, "Map: duplicate map key %d", i92)
+					}
+					var value94 *SubStruct
+					notNil97, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Map value %d not nil", i92)
+					}
+					if notNil97 != 0 {
+						empty99, err := bsor.SkipEmptyObject(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "Map value %d", i92)
+						}
+						if !empty99 {
+							item98 := new(SubStruct)
+							if err := item98.UnmarshalBSOR(fieldReader, options); err != nil {
+								return true, errors.Wrapf(err, "Map value %d", i92)
+							}
+							value94 = item98
+						}
+					}
+					m91[key93] = value94
+				}
+				value = m91
+				v.Map = value
+
+			case 23:
+				var value map[int][]byte
+				count100, capacity105, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "IntMap count")
+				}
+				m101 := make(map[int][]byte, capacity105)
+				for i102 := uint64(0); i102 < count100; i102++ {
+					var key103 int
+					value106, err := bsor.ReadInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "IntMap key %d integer", i102)
+					}
+					key103 = int(value106)
+					if _, exists := m101[key103]; exists {
+						return true, errors.Wrapf(bsor.ErrValueConversion, "IntMap: duplicate map key %d", i102)
+					}
+					var value104 []byte
+					b107, err := bsor.ReadBytes(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "IntMap value %d bytes", i102)
+					}
+					value104 = []byte(b107)
+					m101[key103] = value104
+				}
+				value = m101
+				v.IntMap = value
+
+			case 24:
+				var value map[Key]string
+				count108, capacity113, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "KeyMap count")
+				}
+				m109 := make(map[Key]string, capacity113)
+				for i110 := uint64(0); i110 < count108; i110++ {
+					var key111 Key
+					if err := bsor.UnmarshalValue(fieldReader, &key111, true, options); err != nil {
+						return true, errors.Wrapf(err, "KeyMap key %d", i110)
+					}
+					if _, exists := m109[key111]; exists {
+						return true, errors.Wrapf(bsor.ErrValueConversion, "KeyMap: duplicate map key %d", i110)
+					}
+					var value112 string
+					value114, err := bsor.ReadBytes(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "KeyMap value %d bytes", i110)
+					}
+					value112 = string(value114)
+					m109[key111] = value112
+				}
+				value = m109
+				v.KeyMap = value
+
+			case 25:
+				value := new(Other)
+				if err := bsor.UnmarshalValue(fieldReader, &(*value), false, options); err != nil {
+					return true, errors.Wrap(err, "Other")
+				}
+				v.Other = value
+
+			case 26:
+				var value []Other
+				count115, capacity116, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Others count")
+				}
+				value = make([]Other, 0, capacity116)
+				for i117 := uint64(0); i117 < count115; i117++ {
+					var item118 Other
+					if err := bsor.UnmarshalValue(fieldReader, &item118, true, options); err != nil {
+						return true, errors.Wrapf(err, "Others item %d", i117)
+					}
+					value = append(value, item118)
+				}
+				v.Others = value
+
+			case 27:
+				var value [][]uint32
+				count119, capacity120, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Nested count")
+				}
+				value = make([][]uint32, 0, capacity120)
+				for i121 := uint64(0); i121 < count119; i121++ {
+					var item122 []uint32
+					count123, capacity124, err := bsor.ReadItemCount(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Nested item %d count", i121)
+					}
+					item122 = make([]uint32, 0, capacity124)
+					for i125 := uint64(0); i125 < count123; i125++ {
+						var item126 uint32
+						value127, err := bsor.ReadUnsignedInteger(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "Nested item %d item %d integer", i121, i125)
+						}
+						item126 = uint32(value127)
+						item122 = append(item122, item126)
+					}
+					value = append(value, item122)
+				}
+				v.Nested = value
+
+			case 28:
+				var value time.Time
+				value128, err := bsor.ReadTime(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Time time")
+				}
+				value = value128
+				v.Time = value
+
+			case 29:
+				var value []*time.Time
+				count129, capacity130, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Times count")
+				}
+				value = make([]*time.Time, 0, capacity130)
+				for i131 := uint64(0); i131 < count129; i131++ {
+					var item132 *time.Time
+					notNil133, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Times item %d not nil", i131)
+					}
+					if notNil133 != 0 {
+						item134 := new(time.Time)
+						value135, err := bsor.ReadTime(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "Times item %d time", i131)
+						}
+						(*item134) = value135
+						item132 = item134
+					}
+					value = append(value, item132)
+				}
+				v.Times = value
+
+			case 30:
+				value, err := bsor.ReadBigInt(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Amount big int")
+				}
+				v.Amount = value
+
+			case 31:
+				var value []big.Int
+				count136, capacity137, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Amounts count")
+				}
+				value = make([]big.Int, 0, capacity137)
+				for i138 := uint64(0); i138 < count136; i138++ {
+					var item139 big.Int
+					value140, err := bsor.ReadBigInt(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Amounts item %d big int", i138)
+					}
+					item139 = *value140
+					value = append(value, item139)
+				}
+				v.Amounts = value
+
+			case 32:
+				var value Action
+				if err := bsor.UnmarshalValue(fieldReader, &value, false, options); err != nil {
+					return true, errors.Wrap(err, "Action")
+				}
+				v.Action = value
+
+			case 33:
+				var value []Action
+				count141, capacity142, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Actions count")
+				}
+				value = make([]Action, 0, capacity142)
+				for i143 := uint64(0); i143 < count141; i143++ {
+					var item144 Action
+					if err := bsor.UnmarshalValue(fieldReader, &item144, true, options); err != nil {
+						return true, errors.Wrapf(err, "Actions item %d", i143)
+					}
+					value = append(value, item144)
+				}
+				v.Actions = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(unknownFields) > 0 {
+		v.UnknownFields = unknownFields
+	}
+
+	return nil
+}
+
+// MarshalBSOR writes the field count followed by the fields of SubStruct.
+func (v SubStruct) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := len(v.UnknownFields)
+	if v.Name != "" {
+		fieldCount++
+	}
+	if v.Value != 0 {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Name != "" {
+		fieldWriter := encoder.StartField(1)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.Name)))
+		encoder.EndField()
+	}
+
+	if v.Value != 0 {
+		fieldWriter := encoder.StartField(2)
+		fieldWriter.Add(bitcoin.PushNumberScriptItemUnsigned(uint64(v.Value)))
+		encoder.EndField()
+	}
+
+	if err := encoder.WriteUnknownFields(v.UnknownFields); err != nil {
+		return errors.Wrap(err, "unknown fields")
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of SubStruct.
+func (v *SubStruct) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	unknownFields, err := bsor.UnmarshalFields(r, options, "SubStruct",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				var value string
+				value145, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Name bytes")
+				}
+				value = string(value145)
+				v.Name = value
+
+			case 2:
+				var value uint64
+				value146, err := bsor.ReadUnsignedInteger(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Value integer")
+				}
+				value = uint64(value146)
+				v.Value = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(unknownFields) > 0 {
+		v.UnknownFields = unknownFields
+	}
+
+	return nil
+}
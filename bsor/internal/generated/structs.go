@@ -0,0 +1,93 @@
+// Package generated contains structs with generated BSOR methods that are used to test the
+// generator against the reflection based encoding.
+package generated
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+)
+
+//go:generate go run github.com/tokenized/pkg/bsor/cmd generate -type Struct,SubStruct
+
+type Struct struct {
+	Int           int                   `bsor:"1"`
+	Uint8         uint8                 `bsor:"2"`
+	Bool          bool                  `bsor:"3"`
+	Float32       float32               `bsor:"4"`
+	Float64       float64               `bsor:"5"`
+	String        string                `bsor:"6"`
+	FixedString   string                `bsor:"7" bsor_fixed_size:"4"`
+	Bytes         []byte                `bsor:"8"`
+	FixedBytes    [4]byte               `bsor:"9"`
+	Hash          bitcoin.Hash32        `bsor:"10"`
+	Script        bitcoin.Script        `bsor:"11"`
+	PublicKey     bitcoin.PublicKey     `bsor:"12"`
+	PublicKeyPtr  *bitcoin.PublicKey    `bsor:"13"`
+	PublicKeys    []*bitcoin.PublicKey  `bsor:"14"`
+	Sub           SubStruct             `bsor:"15"`
+	SubPtr        *SubStruct            `bsor:"16"`
+	Subs          []*SubStruct          `bsor:"17"`
+	SubValues     []SubStruct           `bsor:"18"`
+	Ints          []int                 `bsor:"19"`
+	IntPtrs       []*int                `bsor:"20"`
+	Strings       [2]string             `bsor:"21"`
+	Map           map[string]*SubStruct `bsor:"22"`
+	IntMap        map[int][]byte        `bsor:"23"`
+	KeyMap        map[Key]string        `bsor:"24"`
+	Other         *Other                `bsor:"25"`
+	Others        []Other               `bsor:"26"`
+	Nested        [][]uint32            `bsor:"27"`
+	Time          time.Time             `bsor:"28"`
+	Times         []*time.Time          `bsor:"29"`
+	Amount        *big.Int              `bsor:"30"`
+	Amounts       []big.Int             `bsor:"31"`
+	Action        Action                `bsor:"32"`
+	Actions       []Action              `bsor:"33"`
+	Excluded      string                `bsor:"-"`
+	UnknownFields bsor.UnknownFields    `bsor:"-"`
+}
+
+type SubStruct struct {
+	Name          string             `bsor:"1"`
+	Value         uint64             `bsor:"2"`
+	UnknownFields bsor.UnknownFields `bsor:"-"`
+}
+
+// Key is a map key that is encoded with reflection.
+type Key struct {
+	ID   uint32 `bsor:"1"`
+	Name string `bsor:"2"`
+}
+
+// Other is encoded with reflection because it doesn't have generated methods.
+type Other struct {
+	Values map[uint8]bool `bsor:"1"`
+	Sub    *SubStruct     `bsor:"2"`
+}
+
+// Action is encoded as a union of the types registered for it.
+type Action interface {
+	ActionName() string
+}
+
+type Transfer struct {
+	Amount uint64 `bsor:"1"`
+}
+
+type Message string
+
+func init() {
+	bsor.RegisterType((*Action)(nil), 1, &Transfer{})
+	bsor.RegisterType((*Action)(nil), 2, Message(""))
+}
+
+func (*Transfer) ActionName() string {
+	return "transfer"
+}
+
+func (Message) ActionName() string {
+	return "message"
+}
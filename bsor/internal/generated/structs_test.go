@@ -0,0 +1,215 @@
+package generated
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+
+	"github.com/go-test/deep"
+)
+
+func testStruct(t *testing.T) Struct {
+	key, err := bitcoin.GenerateKey(bitcoin.MainNet)
+	if err != nil {
+		t.Fatalf("Failed to generate key : %s", err)
+	}
+	publicKey := key.PublicKey()
+	lockingScript, _ := key.LockingScript()
+	intValue := 5
+	timeValue := time.Unix(1600000000, 123).UTC()
+	large, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+
+	return Struct{
+		Int:          -10,
+		Uint8:        200,
+		Bool:         true,
+		Float32:      1.5,
+		Float64:      -2.25,
+		String:       "string",
+		FixedString:  "abcd",
+		Bytes:        []byte{1, 2, 3},
+		FixedBytes:   [4]byte{4, 5, 6, 7},
+		Hash:         bitcoin.Hash32{1, 2, 3},
+		Script:       lockingScript,
+		PublicKey:    publicKey,
+		PublicKeyPtr: &publicKey,
+		PublicKeys:   []*bitcoin.PublicKey{&publicKey, nil},
+		Sub: SubStruct{
+			Name: "sub",
+		},
+		SubPtr: &SubStruct{
+			Value: 10,
+		},
+		Subs: []*SubStruct{
+			{
+				Name:  "first",
+				Value: 1,
+			},
+			nil,
+		},
+		SubValues: []SubStruct{
+			{
+				Name: "value",
+			},
+			{},
+		},
+		Ints:    []int{1, -2, 0},
+		IntPtrs: []*int{&intValue, nil},
+		Strings: [2]string{"a", ""},
+		Map: map[string]*SubStruct{
+			"b": {
+				Value: 2,
+			},
+			"a": nil,
+		},
+		IntMap: map[int][]byte{
+			-1: {1},
+			1:  nil,
+		},
+		KeyMap: map[Key]string{
+			{ID: 1}:         "one",
+			{Name: "named"}: "two",
+		},
+		Other: &Other{
+			Values: map[uint8]bool{
+				1: true,
+				2: false,
+			},
+		},
+		Others: []Other{
+			{
+				Sub: &SubStruct{
+					Name: "other",
+				},
+			},
+		},
+		Nested:  [][]uint32{{1, 2}, nil, {3}},
+		Time:    timeValue,
+		Times:   []*time.Time{&timeValue, nil},
+		Amount:  large,
+		Amounts: []big.Int{*big.NewInt(10), {}},
+		Action: &Transfer{
+			Amount: 100,
+		},
+		Actions: []Action{Message("hello"), nil, &Transfer{Amount: 1}},
+	}
+}
+
+func Test_Generated(t *testing.T) {
+	value := testStruct(t)
+
+	versions := []uint8{0, bsor.EncodingVersionSkippable}
+	for _, version := range versions {
+		generatedScript, err := bsor.MarshalBinaryWithOptions(value, bsor.MarshalOptions{
+			Version: version,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal generated version %d : %s", version, err)
+		}
+
+		reflectScript, err := bsor.MarshalBinaryWithOptions(value, bsor.MarshalOptions{
+			Version: version,
+			Reflect: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to marshal reflect version %d : %s", version, err)
+		}
+
+		if !bytes.Equal(generatedScript, reflectScript) {
+			t.Fatalf("Generated script doesn't match reflection version %d :\ngot  : %s\nwant : %s",
+				version, generatedScript, reflectScript)
+		}
+
+		generatedRead := &Struct{}
+		if _, err := bsor.UnmarshalBinary(generatedScript, generatedRead); err != nil {
+			t.Fatalf("Failed to unmarshal generated version %d : %s", version, err)
+		}
+
+		reflectRead := &Struct{}
+		if _, err := bsor.UnmarshalBinaryWithOptions(generatedScript, reflectRead,
+			bsor.UnmarshalOptions{Reflect: true}); err != nil {
+			t.Fatalf("Failed to unmarshal reflect version %d : %s", version, err)
+		}
+
+		if !reflect.DeepEqual(generatedRead, reflectRead) {
+			t.Errorf("Generated value doesn't match reflection version %d : %v", version,
+				deep.Equal(generatedRead, reflectRead))
+		}
+	}
+}
+
+func Test_Generated_UnknownFields(t *testing.T) {
+	value := testStruct(t)
+	value.UnknownFields = bsor.UnknownFields{
+		{
+			ID: 100,
+			ScriptItems: bitcoin.ScriptItems{
+				bitcoin.PushNumberScriptItem(7),
+			},
+		},
+	}
+	value.Sub.UnknownFields = bsor.UnknownFields{
+		{
+			ID: 50,
+			ScriptItems: bitcoin.ScriptItems{
+				bitcoin.NewPushDataScriptItem([]byte("sub")),
+			},
+		},
+	}
+
+	if _, err := bsor.Marshal(value); err == nil {
+		t.Fatalf("Marshal unknown fields in initial version should fail")
+	}
+
+	script, err := bsor.MarshalBinaryWithOptions(value, bsor.MarshalOptions{
+		Version: bsor.EncodingVersionSkippable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	read := &Struct{}
+	if _, err := bsor.UnmarshalBinary(script, read); err == nil {
+		t.Fatalf("Unmarshal unknown fields should fail without allowing them")
+	}
+
+	read = &Struct{}
+	if _, err := bsor.UnmarshalBinaryWithOptions(script, read, bsor.UnmarshalOptions{
+		AllowUnknownFields: true,
+	}); err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	reflectRead := &Struct{}
+	if _, err := bsor.UnmarshalBinaryWithOptions(script, reflectRead, bsor.UnmarshalOptions{
+		AllowUnknownFields: true,
+		Reflect:            true,
+	}); err != nil {
+		t.Fatalf("Failed to unmarshal reflect : %s", err)
+	}
+
+	if !reflect.DeepEqual(read, reflectRead) {
+		t.Errorf("Generated value doesn't match reflection : %v", deep.Equal(read, reflectRead))
+	}
+
+	if len(read.UnknownFields) != 1 || len(read.Sub.UnknownFields) != 1 {
+		t.Fatalf("Wrong unknown fields : got %d and %d, want 1 and 1", len(read.UnknownFields),
+			len(read.Sub.UnknownFields))
+	}
+
+	reScript, err := bsor.MarshalBinaryWithOptions(*read, bsor.MarshalOptions{
+		Version: bsor.EncodingVersionSkippable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal again : %s", err)
+	}
+
+	if !bytes.Equal(script, reScript) {
+		t.Errorf("Script with unknown fields changed :\ngot  : %s\nwant : %s", reScript, script)
+	}
+}
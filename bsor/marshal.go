@@ -4,23 +4,28 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"math"
+	"math/big"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/tokenized/pkg/bitcoin"
 
 	"github.com/pkg/errors"
 )
 
-func marshalObject(object interface{}, inArray bool) (bitcoin.ScriptItems, error) {
+func marshalObject(w *ScriptItemWriter, object interface{}, inArray bool,
+	options *EncodeOptions) error {
+
 	binaryMarshaler, isBinaryMarshaler := object.(BinaryMarshaler)
 	value := reflect.ValueOf(object)
 	typ := value.Type()
 	kind := typ.Kind()
-	var result bitcoin.ScriptItems
 	if kind == reflect.Ptr {
 		if value.IsNil() {
-			return bitcoin.ScriptItems{bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE)}, nil
+			w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			return nil
 		}
 
 		typ = typ.Elem()
@@ -28,53 +33,93 @@ func marshalObject(object interface{}, inArray bool) (bitcoin.ScriptItems, error
 		value = value.Elem()
 
 		if inArray {
-			result = append(result, bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+			w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
 		}
 	}
 
+	switch typ {
+	case timeType:
+		item, err := TimeScriptItem(value.Interface().(time.Time))
+		if err != nil {
+			return err
+		}
+		w.Add(item)
+		return nil
+
+	case bigIntType:
+		v := value.Interface().(big.Int)
+		w.Add(BigIntScriptItem(&v))
+		return nil
+	}
+
 	if isBinaryMarshaler {
 		b, err := binaryMarshaler.MarshalBinary()
 		if err != nil {
-			return nil, errors.Wrapf(err, "binary marshal")
+			return errors.Wrapf(err, "binary marshal")
 		}
 
 		// if len(b) == 0 {
 		// 	return pushOpCount, nil
 		// }
 
-		return append(result, bitcoin.NewPushDataScriptItem(b)), nil
+		w.Add(bitcoin.NewPushDataScriptItem(b))
+		return nil
 	}
 
 	if kind != reflect.Struct {
-		primitiveScriptItems, err := marshalPrimitive(value, 0, inArray)
-		if err != nil {
-			return nil, errors.Wrap(err, "primitive")
+		if err := marshalPrimitive(w, value, 0, inArray, options); err != nil {
+			return errors.Wrap(err, "primitive")
 		}
 
-		return append(result, primitiveScriptItems...), nil
+		return nil
 	}
 
-	objectFieldCount := typ.NumField()
+	if marshaler, ok := value.Interface().(Marshaler); ok && !options.reflect {
+		if err := marshaler.MarshalBSOR(w, options); err != nil {
+			return errors.Wrap(err, "marshal bsor")
+		}
 
-	var fieldCount int64 // number of fields marshalled into the script
-	var fieldsScriptItems bitcoin.ScriptItems
+		return nil
+	}
+
+	// The fields are found first because the field count precedes them.
+	var fields []*encodeField
+	var unknownFields UnknownFields
+	objectFieldCount := typ.NumField()
 	for i := 0; i < objectFieldCount; i++ {
 		field := typ.Field(i)
 		fieldValue := value.Field(i)
 
-		fieldScriptItems, err := marshalField(field, fieldValue)
+		if field.Type == unknownFieldsType {
+			if fieldValue.CanInterface() {
+				unknownFields = fieldValue.Interface().(UnknownFields)
+			}
+			continue
+		}
+
+		encoded, err := newEncodeField(field, fieldValue)
 		if err != nil {
-			return nil, errors.Wrapf(err, "marshal field: %s (%s)", field.Name,
-				typeName(field.Type))
-		} else if len(fieldScriptItems) > 0 {
-			fieldCount++
-			fieldsScriptItems = append(fieldsScriptItems, fieldScriptItems...)
+			return errors.Wrapf(err, "marshal field: %s (%s)", field.Name, typeName(field.Type))
+		} else if encoded != nil {
+			fields = append(fields, encoded)
+		}
+	}
+
+	encoder := NewObjectEncoder(w, len(fields)+len(unknownFields), options)
+	for _, field := range fields {
+		if err := marshalField(encoder.StartField(field.id), field.value, field.fixedSize,
+			options); err != nil {
+			return errors.Wrapf(err, "marshal field: %s (%s)", field.field.Name,
+				typeName(field.field.Type))
 		}
+		encoder.EndField()
+	}
+
+	if err := encoder.WriteUnknownFields(unknownFields); err != nil {
+		return errors.Wrap(err, "unknown fields")
 	}
 
-	result = append(result, bitcoin.PushNumberScriptItem(fieldCount))
-	result = append(result, fieldsScriptItems...)
-	return result, nil
+	return encoder.Close()
 }
 
 func typeName(typ reflect.Type) string {
@@ -82,6 +127,8 @@ func typeName(typ reflect.Type) string {
 	switch kind {
 	case reflect.Ptr, reflect.Slice, reflect.Array:
 		return fmt.Sprintf("%s:%s", kind, typeName(typ.Elem()))
+	case reflect.Map:
+		return fmt.Sprintf("%s:%s:%s", kind, typeName(typ.Key()), typeName(typ.Elem()))
 	case reflect.Struct:
 		return typ.Name()
 	default:
@@ -89,13 +136,19 @@ func typeName(typ reflect.Type) string {
 	}
 }
 
-func marshalField(field reflect.StructField,
-	fieldValue reflect.Value) (bitcoin.ScriptItems, error) {
+// encodeField is a struct field that has a value to encode.
+type encodeField struct {
+	field     reflect.StructField
+	value     reflect.Value
+	id        uint64
+	fixedSize uint
+}
 
+// newEncodeField returns the field's id and value, or nil if the field isn't encoded.
+func newEncodeField(field reflect.StructField, fieldValue reflect.Value) (*encodeField, error) {
 	if !fieldValue.CanInterface() {
 		return nil, nil // not exported, "private" lower case field name
 	}
-	iface := fieldValue.Interface()
 
 	idString := field.Tag.Get("bsor")
 	if len(idString) == 0 {
@@ -131,92 +184,102 @@ func marshalField(field reflect.StructField,
 		fixedSize = uint(value)
 	}
 
-	typ := fieldValue.Type()
-	switch typ.Kind() {
-	case reflect.Ptr:
-		elem := fieldValue.Elem()
-		if !elem.CanInterface() {
-			return nil, nil // not exported, "private" lower case field name
-		}
+	if fieldValue.Kind() == reflect.Ptr && !fieldValue.Elem().CanInterface() {
+		return nil, nil // not exported, "private" lower case field name
+	}
 
-		if fieldValue.IsNil() {
-			return nil, nil // null
-		}
+	return &encodeField{
+		field:     field,
+		value:     fieldValue,
+		id:        id,
+		fixedSize: fixedSize,
+	}, nil
+}
 
-		result := bitcoin.ScriptItems{bitcoin.PushNumberScriptItem(int64(id))}
+func marshalField(w *ScriptItemWriter, fieldValue reflect.Value, fixedSize uint,
+	options *EncodeOptions) error {
 
-		objectScriptItems, err := marshalObject(fieldValue.Interface(), false)
-		if err != nil {
-			return nil, errors.Wrap(err, "ptr object")
+	switch fieldValue.Kind() {
+	case reflect.Interface:
+		if err := marshalUnion(w, fieldValue, options); err != nil {
+			return errors.Wrap(err, "union")
 		}
 
-		return append(result, objectScriptItems...), nil
+		return nil
+
+	case reflect.Ptr:
+		if err := marshalObject(w, fieldValue.Interface(), false, options); err != nil {
+			return errors.Wrap(err, "ptr object")
+		}
 
-	// case reflect.Map: // TODO Add map support --ce
+		return nil
 
 	case reflect.Struct:
-		objectScriptItems, err := marshalObject(iface, false)
-		if err != nil {
-			return nil, errors.Wrap(err, "struct")
+		if err := marshalObject(w, fieldValue.Interface(), false, options); err != nil {
+			return errors.Wrap(err, "struct")
 		}
 
-		return append(bitcoin.ScriptItems{bitcoin.PushNumberScriptItem(int64(id))},
-			objectScriptItems...), nil
+		return nil
 
 	default:
-		result := bitcoin.ScriptItems{bitcoin.PushNumberScriptItem(int64(id))}
-
-		primitiveScriptItems, err := marshalPrimitive(fieldValue, fixedSize, false)
-		if err != nil {
-			return nil, errors.Wrap(err, "primitive")
+		if err := marshalPrimitive(w, fieldValue, fixedSize, false, options); err != nil {
+			return errors.Wrap(err, "primitive")
 		}
 
-		return append(result, primitiveScriptItems...), nil
+		return nil
 	}
 }
 
-func marshalPrimitive(value reflect.Value, fixedSize uint,
-	inArray bool) (bitcoin.ScriptItems, error) {
+func marshalPrimitive(w *ScriptItemWriter, value reflect.Value, fixedSize uint, inArray bool,
+	options *EncodeOptions) error {
 
-	var result bitcoin.ScriptItems
 	typ := value.Type()
 	switch typ.Kind() {
 	case reflect.Ptr:
 		if !value.IsNil() && inArray {
-			result = append(result, bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+			w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
 		}
 
-		primitiveScriptItems, err := marshalPrimitive(value, fixedSize, inArray)
-		if err != nil {
-			return nil, errors.Wrap(err, "ptr")
+		if err := marshalPrimitive(w, value, fixedSize, inArray, options); err != nil {
+			return errors.Wrap(err, "ptr")
 		}
 
-		return append(result, primitiveScriptItems...), err
+		return nil
 
 	case reflect.String:
 		s := value.String()
 		if fixedSize > 0 && uint(len(s)) != fixedSize {
-			return nil, errors.Wrapf(ErrValueConversion,
+			return errors.Wrapf(ErrValueConversion,
 				"Fixed string wrong size : got %d, want %d", len(s), fixedSize)
 		}
 
-		return bitcoin.ScriptItems{bitcoin.NewPushDataScriptItem([]byte(s))}, nil
+		w.Add(bitcoin.NewPushDataScriptItem([]byte(s)))
+		return nil
 
 	case reflect.Bool:
-		// IsZero was already checked above so we know it is a true boolean value.
-		return bitcoin.ScriptItems{bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE)}, nil
+		// Fields are zero checked above, but array and map items can be false.
+		if !value.Bool() {
+			w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+		} else {
+			w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+		}
+		return nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		return bitcoin.ScriptItems{bitcoin.PushNumberScriptItem(value.Int())}, nil
+		w.Add(bitcoin.PushNumberScriptItem(value.Int()))
+		return nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		return bitcoin.ScriptItems{bitcoin.PushNumberScriptItemUnsigned(value.Uint())}, nil
+		w.Add(bitcoin.PushNumberScriptItemUnsigned(value.Uint()))
+		return nil
 
 	case reflect.Float32:
-		return bitcoin.ScriptItems{float32ScriptItem(float32(value.Float()))}, nil
+		w.Add(Float32ScriptItem(float32(value.Float())))
+		return nil
 
 	case reflect.Float64:
-		return bitcoin.ScriptItems{float64ScriptItem(value.Float())}, nil
+		w.Add(Float64ScriptItem(value.Float()))
+		return nil
 
 	case reflect.Array:
 		elem := typ.Elem()
@@ -225,7 +288,7 @@ func marshalPrimitive(value reflect.Value, fixedSize uint,
 			// Convert to byte slice
 			l := value.Len()
 			if fixedSize > 0 && uint(l) != fixedSize {
-				return nil, errors.Wrapf(ErrValueConversion,
+				return errors.Wrapf(ErrValueConversion,
 					"Fixed string wrong size : got %d, want %d", l, fixedSize)
 			}
 
@@ -235,12 +298,13 @@ func marshalPrimitive(value reflect.Value, fixedSize uint,
 				indexInterface := index.Interface()
 				val, ok := indexInterface.(byte)
 				if !ok {
-					return nil, errors.Wrap(ErrValueConversion, "byte array index")
+					return errors.Wrap(ErrValueConversion, "byte array index")
 				}
 				b[i] = val
 			}
 
-			return append(result, bitcoin.NewPushDataScriptItem(b)), nil
+			w.Add(bitcoin.NewPushDataScriptItem(b))
+			return nil
 		}
 
 		// Fixed Size Array encoding
@@ -248,15 +312,12 @@ func marshalPrimitive(value reflect.Value, fixedSize uint,
 		l := value.Len()
 		for i := 0; i < l; i++ {
 			index := value.Index(i)
-			objectScriptItems, err := marshalObject(index.Interface(), true)
-			if err != nil {
-				return nil, errors.Wrapf(err, "write item %d", i)
+			if err := marshalValue(w, index, true, options); err != nil {
+				return errors.Wrapf(err, "write item %d", i)
 			}
-
-			result = append(result, objectScriptItems...)
 		}
 
-		return result, nil
+		return nil
 
 	case reflect.Slice:
 		elem := typ.Elem()
@@ -264,42 +325,119 @@ func marshalPrimitive(value reflect.Value, fixedSize uint,
 		case reflect.Uint8: // byte slice (Binary Data)
 			b := value.Bytes()
 			if fixedSize > 0 && uint(len(b)) != fixedSize {
-				return nil, errors.Wrapf(ErrValueConversion,
+				return errors.Wrapf(ErrValueConversion,
 					"Fixed string wrong size : got %d, want %d", len(b), fixedSize)
 			}
 
-			return append(result, bitcoin.NewPushDataScriptItem(b)), nil
+			w.Add(bitcoin.NewPushDataScriptItem(b))
+			return nil
 		}
 
 		// Array encoding
-		result = append(result, bitcoin.PushNumberScriptItem(int64(value.Len())))
+		w.Add(bitcoin.PushNumberScriptItem(int64(value.Len())))
 
 		l := value.Len()
 		for i := 0; i < l; i++ {
 			index := value.Index(i)
-			objectScriptItems, err := marshalObject(index.Interface(), true)
-			if err != nil {
-				return nil, errors.Wrapf(err, "write item %d", i)
+			if err := marshalValue(w, index, true, options); err != nil {
+				return errors.Wrapf(err, "write item %d", i)
 			}
-
-			result = append(result, objectScriptItems...)
 		}
 
-		return result, nil
+		return nil
+
+	case reflect.Map:
+		return marshalMap(w, value, options)
+
+	case reflect.Interface:
+		return marshalUnion(w, value, options)
 
 	default:
-		return nil, errors.Wrapf(ErrValueConversion, "unknown type: %s", typeName(value.Type()))
+		return errors.Wrapf(ErrValueConversion, "unknown type: %s", typeName(value.Type()))
+	}
+}
+
+// marshalMap encodes the number of entries followed by each key and value. The entries are sorted
+// by the encoded bytes of their keys so the same map always produces the same script.
+func marshalMap(w *ScriptItemWriter, value reflect.Value, options *EncodeOptions) error {
+	if value.Type().Key().Kind() == reflect.Ptr {
+		return errors.Wrapf(ErrValueConversion, "pointer map key: %s", typeName(value.Type()))
+	}
+
+	encoder := NewMapEncoder(value.Len())
+	iter := value.MapRange()
+	for iter.Next() {
+		keyWriter := &ScriptItemWriter{}
+		if err := marshalValue(keyWriter, iter.Key(), true, options); err != nil {
+			return errors.Wrap(err, "write key")
+		}
+
+		valueWriter := &ScriptItemWriter{}
+		if err := marshalValue(valueWriter, iter.Value(), true, options); err != nil {
+			return errors.Wrap(err, "write value")
+		}
+
+		if err := encoder.Add(keyWriter.ScriptItems(), valueWriter.ScriptItems()); err != nil {
+			return errors.Wrap(err, "entry")
+		}
 	}
+
+	return encoder.Write(w)
 }
 
-func float32ScriptItem(value float32) *bitcoin.ScriptItem {
+// Float32ScriptItem returns a push data containing the little endian encoding of the value.
+func Float32ScriptItem(value float32) *bitcoin.ScriptItem {
 	buf := &bytes.Buffer{}
 	binary.Write(buf, binary.LittleEndian, value)
 	return bitcoin.NewPushDataScriptItem(buf.Bytes())
 }
 
-func float64ScriptItem(value float64) *bitcoin.ScriptItem {
+// Float64ScriptItem returns a push data containing the little endian encoding of the value.
+func Float64ScriptItem(value float64) *bitcoin.ScriptItem {
 	buf := &bytes.Buffer{}
 	binary.Write(buf, binary.LittleEndian, value)
 	return bitcoin.NewPushDataScriptItem(buf.Bytes())
 }
+
+// TimeScriptItem returns a script number containing the nanoseconds since the unix epoch. The zero
+// time is encoded as a negative zero, which isn't the encoding of any number. Times that can't be
+// represented in nanoseconds by an int64, before 1678 or after 2262, return an error.
+func TimeScriptItem(value time.Time) (*bitcoin.ScriptItem, error) {
+	if value.IsZero() {
+		return bitcoin.NewPushDataScriptItem(zeroTimeData), nil
+	}
+
+	if value.Before(minTime) || value.After(maxTime) {
+		return nil, errors.Wrapf(ErrValueConversion, "time out of range: %s", value)
+	}
+
+	return bitcoin.PushNumberScriptItem(value.UnixNano()), nil
+}
+
+// BigIntScriptItem returns a script number containing the value. Values that fit in an int64 are
+// encoded the same as an int64 so integer fields can be changed to big integers. Larger values are
+// a push data of the little endian magnitude with the sign in the high bit of the last byte.
+func BigIntScriptItem(value *big.Int) *bitcoin.ScriptItem {
+	// The minimum int64 can't be negated so it uses the general encoding, which is the same.
+	if value.IsInt64() && value.Int64() != math.MinInt64 {
+		return bitcoin.PushNumberScriptItem(value.Int64())
+	}
+
+	b := value.Bytes() // big endian magnitude
+	l := len(b)
+	result := make([]byte, l, l+1)
+	for i, v := range b {
+		result[l-1-i] = v
+	}
+
+	if result[l-1]&0x80 != 0 {
+		// The high bit is used by the magnitude so add a byte for the sign.
+		result = append(result, 0x00)
+	}
+
+	if value.Sign() < 0 {
+		result[len(result)-1] |= 0x80
+	}
+
+	return bitcoin.NewPushDataScriptItem(result)
+}
@@ -0,0 +1,440 @@
+package bsor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/validate"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxPreallocateSize is the largest push data that is allocated before it is read from a
+	// stream that doesn't know its length. Larger push datas grow as they are read so a corrupt
+	// size can't allocate more memory than the stream contains.
+	maxPreallocateSize = 1 << 16
+
+	// maxPreallocateCount is the largest number of array or map items that are allocated before
+	// they are read from a stream that doesn't know how many items it contains.
+	maxPreallocateCount = 1 << 10
+)
+
+// Encoder writes BSOR encoded objects to a stream. Each item is written as it is encoded, without
+// building the script items of the whole object first. Fields of EncodingVersionSkippable are
+// preceded by their size so each field of the top level struct is buffered before it is written.
+type Encoder struct {
+	writer  *ScriptItemWriter
+	options MarshalOptions
+}
+
+// Decoder reads BSOR encoded objects from a stream. Items are read as they are decoded, without
+// parsing the whole script first. The Decoder may read data beyond the objects it decodes when the
+// reader isn't an io.ByteReader.
+type Decoder struct {
+	reader  *ScriptItemReader
+	options UnmarshalOptions
+}
+
+// ScriptItemWriter receives encoded script items. The zero value collects the items in a slice.
+// An Encoder's writer writes them to a stream instead and keeps the first error, which is returned
+// by Err.
+type ScriptItemWriter struct {
+	items bitcoin.ScriptItems
+
+	stream   io.Writer
+	buffered *bufio.Writer
+	err      error
+}
+
+// ScriptItemReader provides script items to decode, either from a slice of items or by reading
+// them from a stream as they are needed.
+type ScriptItemReader struct {
+	items bitcoin.ScriptItems
+
+	stream streamReader
+	peeked *bitcoin.ScriptItem
+
+	// parent provides the items when the reader is limited to the size of a field.
+	parent    *ScriptItemReader
+	remaining uint64
+}
+
+type streamReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	writer := &ScriptItemWriter{}
+
+	// Buffers in memory are written to directly.
+	if buf, ok := w.(*bytes.Buffer); ok {
+		writer.stream = buf
+	} else {
+		writer.buffered = bufio.NewWriter(w)
+		writer.stream = writer.buffered
+	}
+
+	return &Encoder{
+		writer: writer,
+	}
+}
+
+func (e *Encoder) SetOptions(options MarshalOptions) {
+	e.options = options
+}
+
+// Encode writes the encoding of the object, preceded by a version header for versions above zero,
+// and flushes it to the stream.
+func (e *Encoder) Encode(object interface{}) error {
+	if e.options.Version > EncodingVersionSkippable {
+		return errors.Wrapf(ErrUnsupportedVersion, "%d", e.options.Version)
+	}
+
+	if err := marshal(e.writer, object, e.options); err != nil {
+		return err
+	}
+
+	if e.writer.err != nil {
+		return errors.Wrap(e.writer.err, "write")
+	}
+
+	if e.writer.buffered != nil {
+		if err := e.writer.buffered.Flush(); err != nil {
+			return errors.Wrap(err, "flush")
+		}
+	}
+
+	return nil
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		reader: newStreamScriptItemReader(r),
+	}
+}
+
+func (d *Decoder) SetOptions(options UnmarshalOptions) {
+	d.options = options
+}
+
+// Decode reads the next object from the stream into the value pointed to by object. The encoding
+// version is detected from the stream. It returns io.EOF when there are no more objects.
+func (d *Decoder) Decode(object interface{}) error {
+	if _, err := d.reader.Peek(); err != nil {
+		return err
+	}
+
+	return unmarshal(d.reader, object, d.options)
+}
+
+// Add adds an item.
+func (w *ScriptItemWriter) Add(item *bitcoin.ScriptItem) {
+	if w.stream == nil {
+		w.items = append(w.items, item)
+		return
+	}
+
+	if w.err != nil {
+		return
+	}
+
+	w.err = item.Write(w.stream)
+}
+
+// AddItems adds the items in order.
+func (w *ScriptItemWriter) AddItems(items bitcoin.ScriptItems) {
+	if w.stream == nil {
+		w.items = append(w.items, items...)
+		return
+	}
+
+	for _, item := range items {
+		w.Add(item)
+	}
+}
+
+// ScriptItems returns the items collected by a writer that doesn't write to a stream.
+func (w *ScriptItemWriter) ScriptItems() bitcoin.ScriptItems {
+	return w.items
+}
+
+// Err returns the first error from writing to the stream.
+func (w *ScriptItemWriter) Err() error {
+	return w.err
+}
+
+func NewScriptItemReader(items bitcoin.ScriptItems) *ScriptItemReader {
+	return &ScriptItemReader{
+		items: items,
+	}
+}
+
+func newStreamScriptItemReader(r io.Reader) *ScriptItemReader {
+	stream, ok := r.(streamReader)
+	if !ok {
+		stream = bufio.NewReader(r)
+	}
+
+	return &ScriptItemReader{
+		stream: stream,
+	}
+}
+
+// Read returns the next item. It returns io.EOF when there are no more items.
+func (r *ScriptItemReader) Read() (*bitcoin.ScriptItem, error) {
+	item, err := r.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	r.advance()
+	return item, nil
+}
+
+// Peek returns the next item without consuming it. It returns io.EOF when there are no more items.
+func (r *ScriptItemReader) Peek() (*bitcoin.ScriptItem, error) {
+	switch {
+	case r.parent != nil:
+		if r.remaining == 0 {
+			return nil, io.EOF
+		}
+		return r.parent.Peek()
+
+	case r.stream != nil:
+		if r.peeked == nil {
+			item, err := readScriptItem(r.stream)
+			if err != nil {
+				return nil, err
+			}
+			r.peeked = item
+		}
+		return r.peeked, nil
+
+	default:
+		if len(r.items) == 0 {
+			return nil, io.EOF
+		}
+		return r.items[0], nil
+	}
+}
+
+func (r *ScriptItemReader) advance() {
+	switch {
+	case r.parent != nil:
+		r.remaining--
+		r.parent.advance()
+	case r.stream != nil:
+		r.peeked = nil
+	default:
+		r.items = r.items[1:]
+	}
+}
+
+// ScriptItems returns the items that haven't been read from a reader that doesn't read from a
+// stream.
+func (r *ScriptItemReader) ScriptItems() bitcoin.ScriptItems {
+	return r.items
+}
+
+// available returns the number of items that haven't been read and true, or false if the reader
+// doesn't know how many items remain in its stream.
+func (r *ScriptItemReader) available() (uint64, bool) {
+	switch {
+	case r.parent != nil:
+		return r.remaining, true
+	case r.stream != nil:
+		return 0, false
+	default:
+		return uint64(len(r.items)), true
+	}
+}
+
+// limit returns a reader containing the next size items and advances past them.
+func (r *ScriptItemReader) limit(size uint64) (*ScriptItemReader, error) {
+	if available, known := r.available(); known && size > available {
+		return nil, errors.Wrapf(ErrValueConversion, "size %d more than remaining %d", size,
+			available)
+	}
+
+	if r.parent == nil && r.stream == nil {
+		result := &ScriptItemReader{
+			items: r.items[:size],
+		}
+		r.items = r.items[size:]
+		return result, nil
+	}
+
+	// Items of streams are read through the parent so it is advanced as the items are read.
+	return &ScriptItemReader{
+		parent:    r,
+		remaining: size,
+	}, nil
+}
+
+// readAll reads the remaining items of a limited reader.
+func (r *ScriptItemReader) readAll() (bitcoin.ScriptItems, error) {
+	if r.parent == nil && r.stream == nil {
+		result := r.items
+		r.items = nil
+		return result, nil
+	}
+
+	var result bitcoin.ScriptItems
+	for r.remaining > 0 {
+		item, err := r.Read()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// readScriptItem reads the next item from a stream. It matches bitcoin.ParseScript, but doesn't
+// need to know the length of the stream.
+func readScriptItem(r streamReader) (*bitcoin.ScriptItem, error) {
+	opCode, err := r.ReadByte()
+	if err != nil {
+		return nil, err // io.EOF between items is the end of the stream
+	}
+
+	var dataSize uint64
+	switch {
+	case opCode == bitcoin.OP_FALSE:
+		return bitcoin.NewOpCodeScriptItem(opCode), nil
+
+	case opCode <= bitcoin.OP_MAX_SINGLE_BYTE_PUSH_DATA:
+		dataSize = uint64(opCode)
+
+	case opCode == bitcoin.OP_PUSH_DATA_1:
+		size, err := r.ReadByte()
+		if err != nil {
+			return nil, errors.Wrap(unexpectedEOF(err), "push data size")
+		}
+		dataSize = uint64(size)
+
+	case opCode == bitcoin.OP_PUSH_DATA_2:
+		var size uint16
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, errors.Wrap(unexpectedEOF(err), "push data size")
+		}
+		dataSize = uint64(size)
+
+	case opCode == bitcoin.OP_PUSH_DATA_4:
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return nil, errors.Wrap(unexpectedEOF(err), "push data size")
+		}
+		dataSize = uint64(size)
+
+	default:
+		return bitcoin.NewOpCodeScriptItem(opCode), nil
+	}
+
+	item := &bitcoin.ScriptItem{
+		Type:   bitcoin.ScriptItemTypePushData,
+		OpCode: opCode,
+	}
+	if dataSize == 0 {
+		return item, nil
+	}
+
+	if lr, ok := r.(interface{ Len() int }); ok {
+		if dataSize > uint64(lr.Len()) {
+			return nil, errors.Wrap(bitcoin.ErrInvalidScript,
+				fmt.Sprintf("Push data size past end of script : %d/%d", dataSize, lr.Len()))
+		}
+	} else if dataSize > maxPreallocateSize {
+		buf := &bytes.Buffer{}
+		if _, err := io.CopyN(buf, r, int64(dataSize)); err != nil {
+			return nil, errors.Wrap(unexpectedEOF(err), "push data")
+		}
+		item.Data = buf.Bytes()
+		return item, nil
+	}
+
+	item.Data = make([]byte, dataSize)
+	if _, err := io.ReadFull(r, item.Data); err != nil {
+		return nil, errors.Wrap(unexpectedEOF(err), "push data")
+	}
+
+	return item, nil
+}
+
+// scriptItemSize returns the number of bytes an item read by readScriptItem was read from.
+func scriptItemSize(item *bitcoin.ScriptItem) int {
+	if item.Type != bitcoin.ScriptItemTypePushData {
+		return 1
+	}
+
+	switch item.OpCode {
+	case bitcoin.OP_PUSH_DATA_1:
+		return 2 + len(item.Data)
+	case bitcoin.OP_PUSH_DATA_2:
+		return 3 + len(item.Data)
+	case bitcoin.OP_PUSH_DATA_4:
+		return 5 + len(item.Data)
+	default:
+		return 1 + len(item.Data)
+	}
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF for streams that end within an item.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// marshal writes the object preceded by a version header for versions above zero.
+func marshal(w *ScriptItemWriter, object interface{}, options MarshalOptions) error {
+	if options.Version > EncodingVersionInitial && isObjectType(reflect.TypeOf(object)) {
+		w.Add(bitcoin.PushNumberScriptItem(-int64(options.Version)))
+	}
+
+	return marshalObject(w, object, false, &EncodeOptions{
+		Version: options.Version,
+		reflect: options.Reflect,
+	})
+}
+
+// unmarshal reads the object, detecting the encoding version from its version header.
+func unmarshal(r *ScriptItemReader, object interface{}, options UnmarshalOptions) error {
+	objectType := reflect.TypeOf(object)
+	objectValue := reflect.ValueOf(object)
+	if objectType == nil || objectType.Kind() != reflect.Ptr {
+		return fmt.Errorf("Unmarshal object is not a ptr: %T", object)
+	}
+	if objectValue.IsNil() {
+		return errors.New("Unmarshal object is nil")
+	}
+
+	decodeOptions := &DecodeOptions{
+		AllowUnknownFields: options.AllowUnknownFields,
+		reflect:            options.Reflect,
+	}
+
+	if isObjectType(objectType.Elem()) {
+		version, err := readVersionHeader(r)
+		if err != nil {
+			return errors.Wrap(err, "version")
+		}
+		decodeOptions.Version = version
+	}
+
+	if err := unmarshalObject(r, objectValue.Elem(), 0, false, decodeOptions); err != nil {
+		return errors.Wrap(err, "object")
+	}
+
+	// Fields that fail the rules in their validate tags are returned as validate.Errors.
+	return validate.Value(objectValue)
+}
@@ -0,0 +1,220 @@
+package bsor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"testing/iotest"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/go-test/deep"
+	"github.com/pkg/errors"
+)
+
+func Test_Encoder_Decoder(t *testing.T) {
+	stringValue := "string value"
+	values := []TestStructSimple{
+		{
+			IntField:    100,
+			StringField: "test string",
+			SubStruct: TestSubStruct{
+				SubIntField:    101,
+				SubStringField: "sub_string",
+			},
+			ArrayStringPtrField: []*string{
+				nil,
+				&stringValue,
+			},
+		},
+		{},
+		{
+			BinaryField: bytes.Repeat([]byte{0xab}, 100000), // larger than the read buffer
+		},
+	}
+
+	for _, version := range []uint8{EncodingVersionInitial, EncodingVersionSkippable} {
+		t.Run(fmt.Sprintf("Version %d", version), func(t *testing.T) {
+			options := MarshalOptions{Version: version}
+
+			buf := &bytes.Buffer{}
+			encoder := NewEncoder(buf)
+			encoder.SetOptions(options)
+
+			var want bitcoin.Script
+			for i, value := range values {
+				if err := encoder.Encode(value); err != nil {
+					t.Fatalf("Failed to encode value %d : %s", i, err)
+				}
+
+				scriptItems, err := MarshalWithOptions(value, options)
+				if err != nil {
+					t.Fatalf("Failed to marshal value %d : %s", i, err)
+				}
+
+				script, err := scriptItems.Script()
+				if err != nil {
+					t.Fatalf("Failed to create script %d : %s", i, err)
+				}
+				want = append(want, script...)
+			}
+
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("Encoded stream doesn't match marshal")
+			}
+
+			// Read one byte at a time so items are split across reads.
+			decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(buf.Bytes())))
+			for i, value := range values {
+				read := &TestStructSimple{}
+				if err := decoder.Decode(read); err != nil {
+					t.Fatalf("Failed to decode value %d : %s", i, err)
+				}
+
+				if !reflect.DeepEqual(value, *read) {
+					t.Errorf("Decoded value %d not equal : %v", i, deep.Equal(*read, value))
+				}
+			}
+
+			if err := decoder.Decode(&TestStructSimple{}); err != io.EOF {
+				t.Fatalf("Wrong error at end of stream : got %v, want %s", err, io.EOF)
+			}
+		})
+	}
+}
+
+func Test_Decoder_UnknownFields(t *testing.T) {
+	value := TestVersionedStructNew{
+		IntField: 10,
+		SubStructs: []TestVersionedSubStructNew{
+			{
+				SubIntField:    12,
+				SubStringField: "sub array",
+			},
+		},
+		StringField:   "string",
+		NewArrayField: []string{"a", "b"},
+		NewMapField: map[string]int{
+			"a": 1,
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := NewEncoder(buf)
+	encoder.SetOptions(MarshalOptions{Version: EncodingVersionSkippable})
+	if err := encoder.Encode(value); err != nil {
+		t.Fatalf("Failed to encode : %s", err)
+	}
+
+	old := &TestVersionedStruct{}
+	decoder := NewDecoder(bytes.NewReader(buf.Bytes()))
+	decoder.SetOptions(UnmarshalOptions{AllowUnknownFields: true})
+	if err := decoder.Decode(old); err != nil {
+		t.Fatalf("Failed to decode : %s", err)
+	}
+
+	if len(old.UnknownFields) != 2 {
+		t.Errorf("Wrong unknown field count : got %d, want %d", len(old.UnknownFields), 2)
+	}
+
+	// The skipped fields are retained when encoding again.
+	oldBuf := &bytes.Buffer{}
+	oldEncoder := NewEncoder(oldBuf)
+	oldEncoder.SetOptions(MarshalOptions{Version: EncodingVersionSkippable})
+	if err := oldEncoder.Encode(*old); err != nil {
+		t.Fatalf("Failed to encode old : %s", err)
+	}
+
+	read := &TestVersionedStructNew{}
+	if err := NewDecoder(oldBuf).Decode(read); err != nil {
+		t.Fatalf("Failed to decode old : %s", err)
+	}
+
+	if !reflect.DeepEqual(value, *read) {
+		t.Errorf("Decoded value not equal : %v", deep.Equal(*read, value))
+	}
+}
+
+func Test_Decoder_Truncated(t *testing.T) {
+	script, err := MarshalBinary(TestSubStruct{
+		SubIntField:    1,
+		SubStringField: "sub_string",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	// Within the last push data. The length of a bytes.Reader is checked before reading so use a
+	// reader without a length.
+	decoder := NewDecoder(iotest.OneByteReader(bytes.NewReader(script[:len(script)-2])))
+	if err := decoder.Decode(&TestSubStruct{}); errors.Cause(err) != io.ErrUnexpectedEOF {
+		t.Fatalf("Wrong error : got %v, want %s", err, io.ErrUnexpectedEOF)
+	}
+
+	// Before the last push data.
+	decoder = NewDecoder(iotest.OneByteReader(bytes.NewReader(script[:len(script)-11])))
+	if err := decoder.Decode(&TestSubStruct{}); errors.Cause(err) != io.EOF {
+		t.Fatalf("Wrong error : got %v, want %s", err, io.EOF)
+	}
+}
+
+func Test_UnmarshalBinary_Remaining(t *testing.T) {
+	value := TestSubStruct{
+		SubIntField: 1,
+	}
+
+	script, err := MarshalBinary(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	extra := bitcoin.Script{bitcoin.OP_PUSH_DATA_1, 0x02, 0x01, 0x02, bitcoin.OP_RETURN}
+	read := &TestSubStruct{}
+	remaining, err := UnmarshalBinary(append(script, extra...), read)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	if !bytes.Equal(remaining, extra) {
+		t.Errorf("Wrong remaining script : got %s, want %s", remaining, extra)
+	}
+
+	if !reflect.DeepEqual(value, *read) {
+		t.Errorf("Unmarshalled value not equal : %v", deep.Equal(*read, value))
+	}
+}
+
+func Test_Decoder_LargeCount(t *testing.T) {
+	type testStruct struct {
+		Values []uint64         `bsor:"1"`
+		Map    map[string]int64 `bsor:"2"`
+	}
+
+	for _, id := range []byte{bitcoin.OP_1, bitcoin.OP_2} {
+		// One field with a count of 2^36 and one item.
+		script := bitcoin.Script{bitcoin.OP_1, id, 0x05, 0x00, 0x00, 0x00, 0x00, 0x10,
+			bitcoin.OP_1, bitcoin.OP_1}
+
+		decoder := NewDecoder(bytes.NewReader(script))
+		if err := decoder.Decode(&testStruct{}); errors.Cause(err) != io.EOF {
+			t.Errorf("Wrong decode error : got %v, want %s", err, io.EOF)
+		}
+
+		if _, err := UnmarshalBinary(script, &testStruct{}); err == nil {
+			t.Errorf("Unmarshal with large count should fail")
+		}
+
+		// Counts more than the remaining items are rejected when the number of items is known.
+		items, err := bitcoin.ParseScriptItems(bytes.NewReader(script[2:]), -1)
+		if err != nil {
+			t.Fatalf("Failed to parse script items : %s", err)
+		}
+
+		_, _, err = ReadItemCount(NewScriptItemReader(items))
+		if errors.Cause(err) != ErrValueConversion {
+			t.Errorf("Wrong count error : got %v, want %s", err, ErrValueConversion)
+		}
+	}
+}
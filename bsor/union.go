@@ -0,0 +1,202 @@
+package bsor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+// unionTypes contains the concrete types registered for each interface.
+var unionTypes = &unionRegistry{
+	unions: make(map[reflect.Type]*union),
+}
+
+type unionRegistry struct {
+	unions map[reflect.Type]*union
+	lock   sync.RWMutex
+}
+
+// union contains the concrete types that can be encoded in an interface value.
+type union struct {
+	types map[uint64]reflect.Type
+	ids   map[reflect.Type]uint64
+}
+
+// unionVariant is a concrete type of a union and its type id.
+type unionVariant struct {
+	id  uint64
+	typ reflect.Type
+}
+
+// RegisterType registers a concrete type that can be encoded in fields with an interface type.
+// The interface is specified by a nil pointer to it, like (*Action)(nil), and value is a value of
+// the concrete type. Interface values are encoded as the id of their concrete type followed by the
+// encoding of the concrete value. Ids must be above zero because zero is a nil interface. It panics
+// if the id or type is already registered for the interface, like gob.Register.
+func RegisterType(iface interface{}, id uint64, value interface{}) {
+	ifacePtrType := reflect.TypeOf(iface)
+	if ifacePtrType == nil || ifacePtrType.Kind() != reflect.Ptr ||
+		ifacePtrType.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("bsor: RegisterType not a pointer to an interface: %T", iface))
+	}
+	ifaceType := ifacePtrType.Elem()
+
+	typ := reflect.TypeOf(value)
+	if typ == nil {
+		panic("bsor: RegisterType nil value")
+	}
+
+	if !typ.Implements(ifaceType) {
+		panic(fmt.Sprintf("bsor: RegisterType %s doesn't implement %s", typ, ifaceType))
+	}
+
+	if id == 0 {
+		panic(fmt.Sprintf("bsor: RegisterType zero id: %s", typ))
+	}
+
+	unionTypes.lock.Lock()
+	defer unionTypes.lock.Unlock()
+
+	u, exists := unionTypes.unions[ifaceType]
+	if !exists {
+		u = &union{
+			types: make(map[uint64]reflect.Type),
+			ids:   make(map[reflect.Type]uint64),
+		}
+		unionTypes.unions[ifaceType] = u
+	}
+
+	if existing, exists := u.types[id]; exists {
+		panic(fmt.Sprintf("bsor: RegisterType duplicate id %d for %s: %s and %s", id, ifaceType,
+			existing, typ))
+	}
+
+	if existing, exists := u.ids[typ]; exists {
+		panic(fmt.Sprintf("bsor: RegisterType duplicate type %s for %s: %d and %d", typ,
+			ifaceType, existing, id))
+	}
+
+	u.types[id] = typ
+	u.ids[typ] = id
+}
+
+// unionTypeID returns the id registered for the concrete type of the interface.
+func unionTypeID(ifaceType, typ reflect.Type) (uint64, error) {
+	unionTypes.lock.RLock()
+	defer unionTypes.lock.RUnlock()
+
+	if u, exists := unionTypes.unions[ifaceType]; exists {
+		if id, exists := u.ids[typ]; exists {
+			return id, nil
+		}
+	}
+
+	return 0, errors.Wrapf(ErrUnregisteredType, "%s for %s", typ, ifaceType)
+}
+
+// unionType returns the concrete type registered with the id for the interface.
+func unionType(ifaceType reflect.Type, id uint64) (reflect.Type, error) {
+	unionTypes.lock.RLock()
+	defer unionTypes.lock.RUnlock()
+
+	if u, exists := unionTypes.unions[ifaceType]; exists {
+		if typ, exists := u.types[id]; exists {
+			return typ, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrUnregisteredType, "id %d for %s", id, ifaceType)
+}
+
+// unionVariants returns the concrete types registered for the interface sorted by id.
+func unionVariants(ifaceType reflect.Type) []unionVariant {
+	unionTypes.lock.RLock()
+	defer unionTypes.lock.RUnlock()
+
+	u, exists := unionTypes.unions[ifaceType]
+	if !exists {
+		return nil
+	}
+
+	result := make([]unionVariant, 0, len(u.types))
+	for id, typ := range u.types {
+		result = append(result, unionVariant{
+			id:  id,
+			typ: typ,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].id < result[j].id
+	})
+
+	return result
+}
+
+// marshalValue encodes a value that might be an interface. Values of interface types, like array
+// items, must be encoded from their reflect.Value because the interface type is lost when they are
+// converted to an interface{}.
+func marshalValue(w *ScriptItemWriter, value reflect.Value, inArray bool,
+	options *EncodeOptions) error {
+
+	if value.Kind() == reflect.Interface {
+		return marshalUnion(w, value, options)
+	}
+
+	return marshalObject(w, value.Interface(), inArray, options)
+}
+
+// marshalUnion encodes the type id of the interface's concrete value followed by the value. A nil
+// interface is encoded as a zero type id.
+func marshalUnion(w *ScriptItemWriter, value reflect.Value, options *EncodeOptions) error {
+	if value.IsNil() {
+		w.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+		return nil
+	}
+
+	concrete := value.Elem()
+	id, err := unionTypeID(value.Type(), concrete.Type())
+	if err != nil {
+		return err
+	}
+
+	w.Add(bitcoin.PushNumberScriptItemUnsigned(id))
+
+	if err := marshalObject(w, concrete.Interface(), false, options); err != nil {
+		return errors.Wrapf(err, "union type %d", id)
+	}
+
+	return nil
+}
+
+// unmarshalUnion reads the type id of an interface value and decodes the registered concrete type
+// into it.
+func unmarshalUnion(r *ScriptItemReader, value reflect.Value, options *DecodeOptions) error {
+	id, err := ReadUnsignedInteger(r)
+	if err != nil {
+		return errors.Wrap(err, "union type")
+	}
+
+	if id == 0 {
+		value.Set(reflect.Zero(value.Type()))
+		return nil
+	}
+
+	typ, err := unionType(value.Type(), id)
+	if err != nil {
+		return err
+	}
+
+	concrete := reflect.New(typ).Elem()
+	if err := unmarshalObject(r, concrete, 0, false, options); err != nil {
+		return errors.Wrapf(err, "union type %d", id)
+	}
+
+	value.Set(concrete)
+	return nil
+}
@@ -0,0 +1,435 @@
+package bsor
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/go-test/deep"
+	"github.com/pkg/errors"
+)
+
+type TestTypesStruct struct {
+	Time      time.Time             `bsor:"1"`
+	TimePtr   *time.Time            `bsor:"2"`
+	Times     []time.Time           `bsor:"3"`
+	Int       *big.Int              `bsor:"4"`
+	Ints      []*big.Int            `bsor:"5"`
+	Value     big.Int               `bsor:"6"`
+	Action    TestAction            `bsor:"7"`
+	Actions   []TestAction          `bsor:"8"`
+	ActionMap map[string]TestAction `bsor:"9"`
+}
+
+type TestAction interface {
+	Name() string
+}
+
+type TestTransfer struct {
+	Amount    uint64 `bsor:"1"`
+	Recipient string `bsor:"2"`
+}
+
+type TestNote string
+
+func init() {
+	RegisterType((*TestAction)(nil), 1, &TestTransfer{})
+	RegisterType((*TestAction)(nil), 2, TestNote(""))
+}
+
+func (*TestTransfer) Name() string {
+	return "transfer"
+}
+
+func (TestNote) Name() string {
+	return "note"
+}
+
+func testTypesStruct() TestTypesStruct {
+	now := time.Unix(1650000000, 987654321).UTC()
+	large, _ := new(big.Int).SetString("123456789012345678901234567890", 10)
+	negative, _ := new(big.Int).SetString("-98765432109876543210", 10)
+
+	return TestTypesStruct{
+		Time:    now,
+		TimePtr: &now,
+		Times:   []time.Time{now, {}},
+		Int:     large,
+		Ints: []*big.Int{
+			negative,
+			nil,
+			big.NewInt(-1),
+			new(big.Int).Lsh(big.NewInt(1), 63), // one more than max int64
+		},
+		Value: *big.NewInt(1000),
+		Action: &TestTransfer{
+			Amount:    100,
+			Recipient: "recipient",
+		},
+		Actions: []TestAction{TestNote("note"), nil, &TestTransfer{Amount: 1}},
+		ActionMap: map[string]TestAction{
+			"a": TestNote("a"),
+			"b": nil,
+		},
+	}
+}
+
+func Test_Marshal_Types(t *testing.T) {
+	value := testTypesStruct()
+
+	for _, version := range []uint8{EncodingVersionInitial, EncodingVersionSkippable} {
+		script, err := MarshalBinaryWithOptions(value, MarshalOptions{Version: version})
+		if err != nil {
+			t.Fatalf("Failed to marshal version %d : %s", version, err)
+		}
+
+		t.Logf("Script version %d : %s", version, script)
+
+		read := &TestTypesStruct{}
+		if _, err := UnmarshalBinary(script, read); err != nil {
+			t.Fatalf("Failed to unmarshal version %d : %s", version, err)
+		}
+
+		if !reflect.DeepEqual(value, *read) {
+			t.Errorf("Unmarshalled value not equal version %d : %v", version,
+				deep.Equal(*read, value))
+		}
+	}
+}
+
+func Test_BigInt_Encoding(t *testing.T) {
+	tests := []string{
+		"0",
+		"1",
+		"-1",
+		"127",
+		"128",
+		"-128",
+		"9223372036854775807",
+		"-9223372036854775808",
+		"9223372036854775808",
+		"18446744073709551615",
+		"-18446744073709551616",
+		"340282366920938463463374607431768211456",
+	}
+
+	for _, test := range tests {
+		value, _ := new(big.Int).SetString(test, 10)
+		item := BigIntScriptItem(value)
+
+		read, err := ReadBigInt(NewScriptItemReader(bitcoin.ScriptItems{item}))
+		if err != nil {
+			t.Fatalf("Failed to read %s : %s", test, err)
+		}
+
+		if read.Cmp(value) != 0 {
+			t.Errorf("Wrong value : got %s, want %s", read, value)
+		}
+
+		// Values that fit are encoded the same as integers.
+		if value.IsInt64() && value.Int64() != math.MinInt64 {
+			want := bitcoin.PushNumberScriptItem(value.Int64())
+			if !item.Equal(*want) {
+				t.Errorf("Wrong item for %s : got %s, want %s", test, item, want)
+			}
+		} else if value.IsUint64() {
+			want := bitcoin.PushNumberScriptItemUnsigned(value.Uint64())
+			if !item.Equal(*want) {
+				t.Errorf("Wrong item for %s : got %s, want %s", test, item, want)
+			}
+		}
+	}
+}
+
+func Test_Types_IntegerWidening(t *testing.T) {
+	type OldStruct struct {
+		Value  int64  `bsor:"1"`
+		Values []uint `bsor:"2"`
+	}
+
+	type NewStruct struct {
+		Value  *big.Int  `bsor:"1"`
+		Values []big.Int `bsor:"2"`
+	}
+
+	script, err := MarshalBinary(OldStruct{
+		Value:  -500,
+		Values: []uint{1, 0, 1 << 63},
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	read := &NewStruct{}
+	if _, err := UnmarshalBinary(script, read); err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	if read.Value.Int64() != -500 {
+		t.Errorf("Wrong value : got %s, want %d", read.Value, -500)
+	}
+
+	want := []string{"1", "0", "9223372036854775808"}
+	for i, value := range read.Values {
+		if value.String() != want[i] {
+			t.Errorf("Wrong value %d : got %s, want %s", i, value.String(), want[i])
+		}
+	}
+}
+
+func Test_Time_Legacy(t *testing.T) {
+	// Times were encoded with MarshalBinary before they had their own encoding.
+	type LegacyStruct struct {
+		Time []byte `bsor:"1"`
+	}
+
+	now := time.Unix(1650000000, 5).UTC()
+	b, err := now.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Failed to marshal time : %s", err)
+	}
+
+	script, err := MarshalBinary(LegacyStruct{Time: b})
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	read := &TestTypesStruct{}
+	if _, err := UnmarshalBinary(script, read); err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	if !read.Time.Equal(now) {
+		t.Errorf("Wrong time : got %s, want %s", read.Time, now)
+	}
+}
+
+func Test_Time_ZeroEpoch(t *testing.T) {
+	epoch := time.Unix(0, 0).UTC()
+	value := TestTypesStruct{
+		Time:    epoch,
+		TimePtr: &time.Time{},
+		Times:   []time.Time{epoch, {}},
+	}
+
+	script, err := MarshalBinary(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	read := &TestTypesStruct{}
+	if _, err := UnmarshalBinary(script, read); err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	if read.Time.IsZero() || !read.Time.Equal(epoch) {
+		t.Errorf("Wrong time : got %s, want %s", read.Time, epoch)
+	}
+
+	if read.TimePtr == nil || !read.TimePtr.IsZero() {
+		t.Errorf("Wrong time pointer : got %v, want zero time", read.TimePtr)
+	}
+
+	if len(read.Times) != 2 || read.Times[0].IsZero() || !read.Times[0].Equal(epoch) ||
+		!read.Times[1].IsZero() {
+		t.Errorf("Wrong times : got %v, want [%s, zero time]", read.Times, epoch)
+	}
+}
+
+func Test_Time_Range(t *testing.T) {
+	valid := []time.Time{minTime, maxTime, time.Date(2262, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for _, value := range valid {
+		script, err := MarshalBinary(TestTypesStruct{Time: value})
+		if err != nil {
+			t.Fatalf("Failed to marshal %s : %s", value, err)
+		}
+
+		read := &TestTypesStruct{}
+		if _, err := UnmarshalBinary(script, read); err != nil {
+			t.Fatalf("Failed to unmarshal %s : %s", value, err)
+		}
+
+		if !read.Time.Equal(value) {
+			t.Errorf("Wrong time : got %s, want %s", read.Time, value)
+		}
+	}
+
+	invalid := []time.Time{
+		time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(1600, 1, 1, 0, 0, 0, 0, time.UTC),
+		minTime.Add(-time.Nanosecond),
+		maxTime.Add(time.Nanosecond),
+	}
+	for _, value := range invalid {
+		_, err := MarshalBinary(TestTypesStruct{Time: value})
+		if errors.Cause(err) != ErrValueConversion {
+			t.Errorf("Wrong error for %s : got %v, want %s", value, err, ErrValueConversion)
+		}
+
+		if _, err := MarshalBinaryWithOptions(TestTypesStruct{Times: []time.Time{value}},
+			MarshalOptions{Reflect: true}); errors.Cause(err) != ErrValueConversion {
+			t.Errorf("Wrong reflect error for %s : got %v, want %s", value, err,
+				ErrValueConversion)
+		}
+	}
+}
+
+func Test_Union_Unregistered(t *testing.T) {
+	type Unregistered struct {
+		TestNote
+	}
+
+	value := TestTypesStruct{
+		Action: Unregistered{},
+	}
+
+	if _, err := MarshalBinary(value); errors.Cause(err) != ErrUnregisteredType {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrUnregisteredType)
+	}
+
+	// Type id 3 isn't registered.
+	script, err := bitcoin.ScriptItems{
+		bitcoin.PushNumberScriptItem(1), // field count
+		bitcoin.PushNumberScriptItem(7), // field id
+		bitcoin.PushNumberScriptItem(3), // type id
+		bitcoin.NewPushDataScriptItem([]byte("value")),
+	}.Script()
+	if err != nil {
+		t.Fatalf("Failed to create script : %s", err)
+	}
+
+	_, err = UnmarshalBinary(script, &TestTypesStruct{})
+	if errors.Cause(err) != ErrUnregisteredType {
+		t.Fatalf("Wrong error : got %v, want %s", err, ErrUnregisteredType)
+	}
+}
+
+func Test_Definitions_Types(t *testing.T) {
+	definitions, err := BuildDefinitions(reflect.TypeOf(TestTypesStruct{}))
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	s := definitions.String()
+	t.Logf("Definitions : \n%s", s)
+
+	want := map[string]string{
+		"TestTypesStruct": `{
+  1 Time      time
+  2 TimePtr   *time
+  3 Times     []time
+  4 Int       *bigint
+  5 Ints      []*bigint
+  6 Value     bigint
+  7 Action    TestAction
+  8 Actions   []TestAction
+  9 ActionMap map[string]TestAction
+}
+`,
+		"TestAction": `union {
+  1 TestTransfer *TestTransfer
+  2 TestNote     string
+}
+`,
+	}
+
+	for name, text := range want {
+		definition, exists := definitions.Definitions[name]
+		if !exists {
+			t.Fatalf("Missing definition %s", name)
+		}
+
+		if definition.String() != text {
+			t.Errorf("Wrong definition %s : \n  got  : %s\n  want : %s", name,
+				definition.String(), text)
+		}
+	}
+
+	// The text form can be parsed and used to decode values.
+	parsed, err := ParseDefinitions([]byte(s))
+	if err != nil {
+		t.Fatalf("Failed to parse definitions : %s", err)
+	}
+
+	if _, ok := parsed.Definitions["TestAction"].(*UnionDefinition); !ok {
+		t.Fatalf("TestAction not a union : %T", parsed.Definitions["TestAction"])
+	}
+
+	if incompatibilities := CheckCompatibility(parsed, &definitions, CompatibilityOptions{
+		Forward: true,
+	}); len(incompatibilities) != 0 {
+		t.Errorf("Parsed definitions not compatible :\n%s", incompatibilities)
+	}
+}
+
+func Test_Dynamic_Types(t *testing.T) {
+	definitions, err := BuildDefinitions(reflect.TypeOf(TestTypesStruct{}))
+	if err != nil {
+		t.Fatalf("Failed to build definitions : %s", err)
+	}
+
+	// Map entries are sorted when encoded so there is only one entry to compare JSON.
+	value := testTypesStruct()
+	value.ActionMap = map[string]TestAction{
+		"a": TestNote("a"),
+	}
+
+	scriptItems, err := Marshal(value)
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	dynamic, remaining, err := definitions.UnmarshalDynamic(scriptItems, "TestTypesStruct",
+		UnmarshalOptions{})
+	if err != nil {
+		t.Fatalf("Failed to unmarshal dynamic : %s", err)
+	}
+
+	if len(remaining) != 0 {
+		t.Fatalf("Remaining script items : %d", len(remaining))
+	}
+
+	js, err := DynamicToJSON(dynamic)
+	if err != nil {
+		t.Fatalf("Failed to convert to JSON : %s", err)
+	}
+	t.Logf("JSON : %s", js)
+
+	for _, want := range []string{
+		`"Time":"2022-04-15T05:20:00.987654321Z"`,
+		`"Int":123456789012345678901234567890`,
+		`"Action":{"id":1,"value":{"Amount":100,"Recipient":"recipient"}}`,
+	} {
+		if !strings.Contains(string(js), want) {
+			t.Errorf("JSON missing %s", want)
+		}
+	}
+
+	fromJSON, err := definitions.DynamicFromJSON(js, "TestTypesStruct")
+	if err != nil {
+		t.Fatalf("Failed to convert from JSON : %s", err)
+	}
+
+	for name, dynamicValue := range map[string]interface{}{
+		"dynamic": dynamic,
+		"json":    fromJSON,
+	} {
+		encoded, err := definitions.MarshalDynamic(dynamicValue, "TestTypesStruct",
+			MarshalOptions{})
+		if err != nil {
+			t.Fatalf("Failed to marshal %s : %s", name, err)
+		}
+
+		encodedScript, _ := encoded.Script()
+		script, _ := scriptItems.Script()
+		if !bytes.Equal(encodedScript, script) {
+			t.Errorf("Wrong %s script :\n  got  : %s\n  want : %s", name, encodedScript, script)
+		}
+	}
+}
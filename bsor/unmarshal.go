@@ -4,10 +4,10 @@ import (
 	"bytes"
 	"encoding"
 	"encoding/binary"
-	"fmt"
-	"io"
+	"math/big"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/tokenized/pkg/bitcoin"
 
@@ -49,6 +49,10 @@ func NewFieldIndexes(typ reflect.Type, value reflect.Value) (FieldIndexes, error
 	fields := make(FieldIndexes)
 	for i := 0; i < fieldCount; i++ {
 		field := typ.Field(i)
+		if field.Type == unknownFieldsType {
+			continue // holds fields that were skipped when decoding
+		}
+
 		idString := field.Tag.Get("bsor")
 		fieldValue := value.Field(i)
 		if !fieldValue.CanInterface() {
@@ -98,8 +102,8 @@ func NewFieldIndexes(typ reflect.Type, value reflect.Value) (FieldIndexes, error
 	return fields, nil
 }
 
-func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixedSize uint,
-	inArray bool) error {
+func unmarshalObject(r *ScriptItemReader, value reflect.Value, fixedSize uint,
+	inArray bool, options *DecodeOptions) error {
 
 	typ := value.Type()
 	kind := typ.Kind()
@@ -113,7 +117,7 @@ func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixe
 		kind = typ.Kind()
 
 		if inArray {
-			notNil, err := readUnsignedInteger(scriptItems)
+			notNil, err := ReadUnsignedInteger(r)
 			if err != nil {
 				return errors.Wrap(err, "number")
 			}
@@ -124,11 +128,41 @@ func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixe
 		}
 	}
 
+	switch typ {
+	case timeType:
+		t, err := ReadTime(r)
+		if err != nil {
+			return errors.Wrap(err, "time")
+		}
+
+		if isPtr {
+			value.Set(reflect.ValueOf(&t))
+		} else {
+			value.Set(reflect.ValueOf(t))
+		}
+
+		return nil
+
+	case bigIntType:
+		v, err := ReadBigInt(r)
+		if err != nil {
+			return errors.Wrap(err, "big int")
+		}
+
+		if isPtr {
+			value.Set(reflect.ValueOf(v))
+		} else {
+			value.Set(reflect.ValueOf(v).Elem())
+		}
+
+		return nil
+	}
+
 	// Check for pointer unmarshaller
 	val := reflect.New(typ)
 	ifacePtr := val.Interface()
 	if binaryUnmarshaler, ok := ifacePtr.(encoding.BinaryUnmarshaler); ok {
-		b, err := readBytes(scriptItems)
+		b, err := ReadBytes(r)
 		if err != nil {
 			return errors.Wrapf(err, "bytes")
 		}
@@ -147,10 +181,36 @@ func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixe
 	}
 
 	if kind != reflect.Struct {
-		return unmarshalPrimitive(scriptItems, value, fixedSize, inArray)
+		return unmarshalPrimitive(r, value, fixedSize, inArray, options)
+	}
+
+	if unmarshaler, ok := ifacePtr.(Unmarshaler); ok && !options.reflect {
+		if isPtr {
+			// Pointers to objects without fields are left nil.
+			empty, err := SkipEmptyObject(r)
+			if err != nil {
+				return errors.Wrap(err, "empty")
+			}
+
+			if empty {
+				return nil
+			}
+		}
+
+		if err := unmarshaler.UnmarshalBSOR(r, options); err != nil {
+			return errors.Wrap(err, "unmarshal bsor")
+		}
+
+		if isPtr {
+			value.Set(val)
+		} else {
+			value.Set(val.Elem())
+		}
+
+		return nil
 	}
 
-	fieldCount, err := readCount(scriptItems)
+	fieldCount, err := ReadCount(r)
 	if err != nil {
 		return errors.Wrap(err, "field count")
 	}
@@ -170,40 +230,43 @@ func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixe
 		return errors.Wrap(err, "field indexes")
 	}
 
-	for i := 0; i < int(fieldCount); i++ {
-		nextScriptItem, err := nextScriptItem(scriptItems)
-		if err != nil {
-			return errors.Wrap(err, "number")
-		}
+	unknownFieldsIndex := findUnknownFieldsIndex(typ)
 
-		id, err := bitcoin.ScriptNumberValue(nextScriptItem)
-		if err != nil {
-			return errors.Wrap(err, "field id number")
-		}
+	unknownFields, err := unmarshalFields(r, fieldCount, options, typ.Name(),
+		func(id uint64, fieldReader *ScriptItemReader) (bool, error) {
+			fieldIndex := fields.find(id)
+			if fieldIndex == nil {
+				return false, nil
+			}
 
-		fieldIndex := fields.find(uint64(id))
-		if fieldIndex == nil {
-			return fmt.Errorf("Field %d not found in %s", id, typ.Name())
-		}
+			field := typ.Field(fieldIndex.Index)
+			fieldType := field.Type
+			if field.Type.Kind() == reflect.Ptr {
+				// If I use .Elem() here then other objects work, but not binary marshaler objects
+				fieldType = fieldType.Elem()
+			}
+			fieldValue := reflect.New(fieldType) // must use elem to be "assignable"
 
-		field := typ.Field(fieldIndex.Index)
-		fieldType := field.Type
-		if field.Type.Kind() == reflect.Ptr {
-			// If I use .Elem() here then other objects work, but not binary marshaler objects
-			fieldType = fieldType.Elem()
-		}
-		fieldValue := reflect.New(fieldType) // must use elem to be "assignable"
+			if err := unmarshalField(fieldReader, field, fieldValue.Elem(),
+				fieldIndex.FixedSize, options); err != nil {
+				return true, errors.Wrapf(err, "unmarshal field: %s (id %d) (%s)", field.Name, id,
+					typeName(field.Type))
+			}
 
-		if err := unmarshalField(scriptItems, field, fieldValue.Elem(), fieldIndex.FixedSize); err != nil {
-			return errors.Wrapf(err, "unmarshal field: %s (id %d) (%s)", field.Name, id,
-				typeName(field.Type))
-		}
+			if field.Type.Kind() == reflect.Ptr {
+				newValue.Field(fieldIndex.Index).Set(fieldValue)
+			} else {
+				newValue.Field(fieldIndex.Index).Set(fieldValue.Elem())
+			}
 
-		if field.Type.Kind() == reflect.Ptr {
-			newValue.Field(fieldIndex.Index).Set(fieldValue)
-		} else {
-			newValue.Field(fieldIndex.Index).Set(fieldValue.Elem())
-		}
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	if len(unknownFields) > 0 && unknownFieldsIndex != -1 {
+		newValue.Field(unknownFieldsIndex).Set(reflect.ValueOf(unknownFields))
 	}
 
 	if isPtr {
@@ -213,8 +276,8 @@ func unmarshalObject(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixe
 	return nil
 }
 
-func unmarshalField(scriptItems *bitcoin.ScriptItems, field reflect.StructField,
-	fieldValue reflect.Value, fixedSize uint) error {
+func unmarshalField(r *ScriptItemReader, field reflect.StructField,
+	fieldValue reflect.Value, fixedSize uint, options *DecodeOptions) error {
 
 	if !fieldValue.CanInterface() {
 		return nil // not exported, "private" lower case field name
@@ -225,7 +288,7 @@ func unmarshalField(scriptItems *bitcoin.ScriptItems, field reflect.StructField,
 		elem := field.Type.Elem()
 		value := reflect.New(elem).Elem() // must use elem to be "assignable"
 
-		if err := unmarshalObject(scriptItems, value, fixedSize, false); err != nil {
+		if err := unmarshalObject(r, value, fixedSize, false, options); err != nil {
 			return errors.Wrap(err, "ptr object")
 		}
 
@@ -234,27 +297,25 @@ func unmarshalField(scriptItems *bitcoin.ScriptItems, field reflect.StructField,
 	}
 
 	switch kind {
-	// case reflect.Map: // TODO Add map support --ce
-
 	case reflect.Struct:
-		if err := unmarshalObject(scriptItems, fieldValue, fixedSize, false); err != nil {
+		if err := unmarshalObject(r, fieldValue, fixedSize, false, options); err != nil {
 			return errors.Wrap(err, "struct")
 		}
 
 		return nil
 
 	default:
-		return unmarshalPrimitive(scriptItems, fieldValue, fixedSize, false)
+		return unmarshalPrimitive(r, fieldValue, fixedSize, false, options)
 	}
 }
 
-func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, fixedSize uint,
-	inArray bool) error {
+func unmarshalPrimitive(r *ScriptItemReader, value reflect.Value, fixedSize uint,
+	inArray bool, options *DecodeOptions) error {
 
 	typ := value.Type()
 	switch typ.Kind() {
 	case reflect.String:
-		b, err := readBytes(scriptItems)
+		b, err := ReadBytes(r)
 		if err != nil {
 			return errors.Wrap(err, "bytes")
 		}
@@ -268,7 +329,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		return nil
 
 	case reflect.Bool:
-		v, err := readUnsignedInteger(scriptItems)
+		v, err := ReadUnsignedInteger(r)
 		if err != nil {
 			return errors.Wrap(err, "bool")
 		}
@@ -277,7 +338,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		return nil
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		v, err := readInteger(scriptItems)
+		v, err := ReadInteger(r)
 		if err != nil {
 			return errors.Wrap(err, "integer")
 		}
@@ -286,7 +347,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		return nil
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
-		v, err := readUnsignedInteger(scriptItems)
+		v, err := ReadUnsignedInteger(r)
 		if err != nil {
 			return errors.Wrap(err, "integer")
 		}
@@ -295,7 +356,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		return nil
 
 	case reflect.Float32:
-		val, err := readFloat32(scriptItems)
+		val, err := ReadFloat32(r)
 		if err != nil {
 			return errors.Wrap(err, "float32")
 		}
@@ -304,7 +365,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		return nil
 
 	case reflect.Float64:
-		val, err := readFloat64(scriptItems)
+		val, err := ReadFloat64(r)
 		if err != nil {
 			return errors.Wrap(err, "float64")
 		}
@@ -317,7 +378,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		valuePtr := reflect.New(typ.Elem())
 		newValue := valuePtr.Elem()
 
-		if err := unmarshalObject(scriptItems, newValue, fixedSize, inArray); err != nil {
+		if err := unmarshalObject(r, newValue, fixedSize, inArray, options); err != nil {
 			return errors.Wrap(err, "pointer")
 		}
 
@@ -331,7 +392,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		elem := typ.Elem()
 		switch elem.Kind() {
 		case reflect.Uint8: // byte array (Binary Data)
-			b, err := readBytes(scriptItems)
+			b, err := ReadBytes(r)
 			if err != nil {
 				return errors.Wrap(err, "fixed bytes")
 			}
@@ -349,7 +410,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		ptr := reflect.New(typ)
 		array := ptr.Elem()
 		for i := 0; i < value.Len(); i++ {
-			if err := unmarshalObject(scriptItems, array.Index(int(i)), 0, true); err != nil {
+			if err := unmarshalObject(r, array.Index(int(i)), 0, true, options); err != nil {
 				return errors.Wrapf(err, "item %d", i)
 			}
 		}
@@ -361,7 +422,7 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		elem := typ.Elem()
 		switch elem.Kind() {
 		case reflect.Uint8: // byte slice (Binary Data)
-			b, err := readBytes(scriptItems)
+			b, err := ReadBytes(r)
 			if err != nil {
 				return errors.Wrap(err, "bytes")
 			}
@@ -376,38 +437,69 @@ func unmarshalPrimitive(scriptItems *bitcoin.ScriptItems, value reflect.Value, f
 		}
 
 		// Array encoding
-		count, err := readCount(scriptItems)
+		count, capacity, err := ReadItemCount(r)
 		if err != nil {
 			return errors.Wrap(err, "count")
 		}
 
-		slice := reflect.MakeSlice(typ, int(count), int(count))
+		slice := reflect.MakeSlice(typ, 0, capacity)
 		for i := uint64(0); i < count; i++ {
-			if err := unmarshalObject(scriptItems, slice.Index(int(i)), 0, true); err != nil {
+			item := reflect.New(typ.Elem()).Elem()
+			if err := unmarshalObject(r, item, 0, true, options); err != nil {
 				return errors.Wrapf(err, "item %d", i)
 			}
+			slice = reflect.Append(slice, item)
 		}
 
 		value.Set(slice)
 		return nil
 
+	case reflect.Map:
+		return unmarshalMap(r, value, options)
+
+	case reflect.Interface:
+		return unmarshalUnion(r, value, options)
+
 	default:
 		return errors.Wrap(ErrValueConversion, "unknown type")
 	}
 }
 
-func nextScriptItem(scriptItems *bitcoin.ScriptItems) (*bitcoin.ScriptItem, error) {
-	if len(*scriptItems) == 0 {
-		return nil, io.EOF
+func unmarshalMap(r *ScriptItemReader, value reflect.Value,
+	options *DecodeOptions) error {
+
+	typ := value.Type()
+	count, capacity, err := ReadItemCount(r)
+	if err != nil {
+		return errors.Wrap(err, "count")
 	}
 
-	result := (*scriptItems)[0]
-	*scriptItems = (*scriptItems)[1:]
-	return result, nil
+	result := reflect.MakeMapWithSize(typ, capacity)
+	for i := uint64(0); i < count; i++ {
+		key := reflect.New(typ.Key()).Elem()
+		if err := unmarshalObject(r, key, 0, true, options); err != nil {
+			return errors.Wrapf(err, "key %d", i)
+		}
+
+		if result.MapIndex(key).IsValid() {
+			return errors.Wrapf(ErrValueConversion, "duplicate map key %d", i)
+		}
+
+		item := reflect.New(typ.Elem()).Elem()
+		if err := unmarshalObject(r, item, 0, true, options); err != nil {
+			return errors.Wrapf(err, "value %d", i)
+		}
+
+		result.SetMapIndex(key, item)
+	}
+
+	value.Set(result)
+	return nil
 }
 
-func readCount(scriptItems *bitcoin.ScriptItems) (uint64, error) {
-	item, err := nextScriptItem(scriptItems)
+// ReadCount reads a count, like the number of fields or items, from the next script item.
+func ReadCount(r *ScriptItemReader) (uint64, error) {
+	item, err := r.Read()
 	if err != nil {
 		return 0, err
 	}
@@ -420,8 +512,35 @@ func readCount(scriptItems *bitcoin.ScriptItems) (uint64, error) {
 	return uint64(count), nil
 }
 
-func readBytes(scriptItems *bitcoin.ScriptItems) ([]byte, error) {
-	item, err := nextScriptItem(scriptItems)
+// ReadItemCount reads the number of items in an array or map and returns it with the number of
+// items to allocate before they are read. Each item is at least one script item, so a count more
+// than the number of remaining items is an error when the reader knows how many remain. Otherwise
+// the allocation is limited so a corrupt count can't allocate more memory than the stream contains.
+func ReadItemCount(r *ScriptItemReader) (uint64, int, error) {
+	count, err := ReadCount(r)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if available, known := r.available(); known {
+		if count > available {
+			return 0, 0, errors.Wrapf(ErrValueConversion, "count %d more than remaining %d",
+				count, available)
+		}
+
+		return count, int(count), nil
+	}
+
+	if count > maxPreallocateCount {
+		return count, maxPreallocateCount, nil
+	}
+
+	return count, int(count), nil
+}
+
+// ReadBytes reads the next script item as bytes. Small values may be encoded as op codes.
+func ReadBytes(r *ScriptItemReader) ([]byte, error) {
+	item, err := r.Read()
 	if err != nil {
 		return nil, err
 	}
@@ -442,8 +561,9 @@ func readBytes(scriptItems *bitcoin.ScriptItems) ([]byte, error) {
 	}
 }
 
-func readInteger(scriptItems *bitcoin.ScriptItems) (int64, error) {
-	item, err := nextScriptItem(scriptItems)
+// ReadInteger reads a signed integer from the next script item.
+func ReadInteger(r *ScriptItemReader) (int64, error) {
+	item, err := r.Read()
 	if err != nil {
 		return 0, err
 	}
@@ -456,8 +576,9 @@ func readInteger(scriptItems *bitcoin.ScriptItems) (int64, error) {
 	return value, nil
 }
 
-func readUnsignedInteger(scriptItems *bitcoin.ScriptItems) (uint64, error) {
-	item, err := nextScriptItem(scriptItems)
+// ReadUnsignedInteger reads an unsigned integer from the next script item.
+func ReadUnsignedInteger(r *ScriptItemReader) (uint64, error) {
+	item, err := r.Read()
 	if err != nil {
 		return 0, err
 	}
@@ -470,8 +591,9 @@ func readUnsignedInteger(scriptItems *bitcoin.ScriptItems) (uint64, error) {
 	return value, nil
 }
 
-func readFloat32(scriptItems *bitcoin.ScriptItems) (float32, error) {
-	b, err := readBytes(scriptItems)
+// ReadFloat32 reads a little endian float32 from the bytes of the next script item.
+func ReadFloat32(r *ScriptItemReader) (float32, error) {
+	b, err := ReadBytes(r)
 	if err != nil {
 		return 0.0, errors.Wrap(err, "bytes")
 	}
@@ -484,8 +606,9 @@ func readFloat32(scriptItems *bitcoin.ScriptItems) (float32, error) {
 	return val, nil
 }
 
-func readFloat64(scriptItems *bitcoin.ScriptItems) (float64, error) {
-	b, err := readBytes(scriptItems)
+// ReadFloat64 reads a little endian float64 from the bytes of the next script item.
+func ReadFloat64(r *ScriptItemReader) (float64, error) {
+	b, err := ReadBytes(r)
 	if err != nil {
 		return 0.0, errors.Wrap(err, "bytes")
 	}
@@ -497,3 +620,70 @@ func readFloat64(scriptItems *bitcoin.ScriptItems) (float64, error) {
 
 	return val, nil
 }
+
+// ReadTime reads a time encoded as nanoseconds since the unix epoch from the next script item. A
+// negative zero is the zero time. Push datas longer than 8 bytes are times encoded by
+// time.MarshalBinary, which was used before times had their own encoding.
+func ReadTime(r *ScriptItemReader) (time.Time, error) {
+	item, err := r.Read()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if item.Type == bitcoin.ScriptItemTypePushData && bytes.Equal(item.Data, zeroTimeData) {
+		return time.Time{}, nil
+	}
+
+	if item.Type == bitcoin.ScriptItemTypePushData && len(item.Data) > 8 {
+		var result time.Time
+		if err := result.UnmarshalBinary(item.Data); err != nil {
+			return time.Time{}, errors.Wrap(err, "binary")
+		}
+
+		return result, nil
+	}
+
+	nanoseconds, err := bitcoin.ScriptNumberValue(item)
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "number")
+	}
+
+	return time.Unix(0, nanoseconds).UTC(), nil
+}
+
+// ReadBigInt reads an arbitrary size script number from the next script item.
+func ReadBigInt(r *ScriptItemReader) (*big.Int, error) {
+	item, err := r.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	if item.Type != bitcoin.ScriptItemTypePushData {
+		value, err := bitcoin.ScriptNumberValue(item)
+		if err != nil {
+			return nil, errors.Wrap(err, "number")
+		}
+
+		return big.NewInt(value), nil
+	}
+
+	l := len(item.Data)
+	if l == 0 {
+		return new(big.Int), nil
+	}
+
+	b := make([]byte, l) // big endian magnitude
+	for i, v := range item.Data {
+		b[l-1-i] = v
+	}
+
+	negative := b[0]&0x80 != 0
+	b[0] &= 0x7f
+
+	result := new(big.Int).SetBytes(b)
+	if negative {
+		result.Neg(result)
+	}
+
+	return result, nil
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/json"
+	"github.com/tokenized/pkg/validate"
 	"github.com/tokenized/pkg/wire"
 
 	"github.com/pkg/errors"
@@ -159,12 +160,12 @@ func (c *HTTPClient) GetPaymentDestination(ctx context.Context, senderName, send
 			return nil, errors.Wrap(err, "signature hash")
 		}
 
-		sig, err := senderKey.Sign(sigHash)
+		sig, err := senderKey.SignCompact(sigHash)
 		if err != nil {
 			return nil, errors.Wrap(err, "sign")
 		}
 
-		request.Signature = sig.ToCompact()
+		request.Signature = sig.String()
 	}
 
 	url = strings.ReplaceAll(url, "{alias}", c.Alias)
@@ -213,12 +214,12 @@ func (c *HTTPClient) GetPaymentRequest(ctx context.Context, senderName, senderHa
 			return nil, errors.Wrap(err, "signature hash")
 		}
 
-		sig, err := senderKey.Sign(sigHash)
+		sig, err := senderKey.SignCompact(sigHash)
 		if err != nil {
 			return nil, errors.Wrap(err, "sign")
 		}
 
-		request.Signature = sig.ToCompact()
+		request.Signature = sig.String()
 	}
 
 	url = strings.ReplaceAll(url, "{alias}", c.Alias)
@@ -255,6 +256,10 @@ func (c *HTTPClient) GetPaymentRequest(ctx context.Context, senderName, senderHa
 		result.Outputs = append(result.Outputs, output)
 	}
 
+	if err := validate.Struct(result); err != nil {
+		return nil, errors.Wrap(err, "payment request")
+	}
+
 	if len(result.Tx.TxIn) != len(result.Outputs) {
 		return nil, ErrWrongOutputCount
 	}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"github.com/tokenized/pkg/json"
 )
 
 func Test_parseCacheControl(t *testing.T) {
@@ -58,3 +60,25 @@ func Test_parseCacheControl(t *testing.T) {
 		})
 	}
 }
+
+func Test_PaymentRequestRequest_Unsigned(t *testing.T) {
+	// The signature is only included when the sender has a key.
+	b, err := json.Marshal(PaymentRequestRequest{
+		SenderHandle: "john@bitcoin.com",
+		DateTime:     "2024-01-01T00:00:00Z",
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal request : %s", err)
+	}
+
+	var request PaymentRequestRequest
+	if err := json.Unmarshal(b, &request); err != nil {
+		t.Fatalf("Failed to unmarshal unsigned request : %s", err)
+	}
+
+	var missingHandle PaymentRequestRequest
+	if err := json.Unmarshal([]byte(`{"dt":"2024-01-01T00:00:00Z","signature":""}`),
+		&missingHandle); err == nil {
+		t.Fatalf("Request without sender handle should fail")
+	}
+}
@@ -88,12 +88,12 @@ func (r *PaymentDestinationRequest) Sign(key bitcoin.Key) error {
 		return errors.Wrap(err, "signature hash")
 	}
 
-	sig, err := key.Sign(sigHash)
+	sig, err := key.SignCompact(sigHash)
 	if err != nil {
 		return errors.Wrap(err, "sign")
 	}
 
-	r.Signature = sig.ToCompact()
+	r.Signature = sig.String()
 	return nil
 }
 
@@ -143,12 +143,12 @@ func (r *P2PTransactionRequest) Sign(key bitcoin.Key) error {
 		return errors.Wrap(err, "signature hash")
 	}
 
-	sig, err := key.Sign(sigHash)
+	sig, err := key.SignCompact(sigHash)
 	if err != nil {
 		return errors.Wrap(err, "sign txid")
 	}
 
-	r.MetaData.Signature = sig.ToCompact()
+	r.MetaData.Signature = sig.String()
 
 	publicKey := key.PublicKey()
 	r.MetaData.Key = &publicKey
@@ -205,8 +205,8 @@ type P2PTransactionResponse struct {
 // PaymentRequestRequest is the data structure sent to request a payment request.
 type PaymentRequestRequest struct {
 	SenderName   string `json:"senderName"`
-	SenderHandle string `json:"senderHandle"`
-	DateTime     string `json:"dt"`
+	SenderHandle string `json:"senderHandle" tkvalidate:"required"`
+	DateTime     string `json:"dt" tkvalidate:"required"`
 	InstrumentID string `json:"instrumentID"`
 	Amount       uint64 `json:"amount"`
 	Purpose      string `json:"purpose"`
@@ -221,12 +221,12 @@ func (r *PaymentRequestRequest) Sign(key bitcoin.Key) error {
 		return errors.Wrap(err, "signature hash")
 	}
 
-	sig, err := key.Sign(sigHash)
+	sig, err := key.SignCompact(sigHash)
 	if err != nil {
 		return errors.Wrap(err, "sign")
 	}
 
-	r.Signature = sig.ToCompact()
+	r.Signature = sig.String()
 	return nil
 }
 
@@ -251,14 +251,14 @@ func (r PaymentRequestRequest) CheckSignature(publicKey bitcoin.PublicKey) error
 
 // PaymentRequestResponse is the raw response from a PaymentRequest endpoint.
 type PaymentRequestResponse struct {
-	PaymentRequest string   `json:"paymentRequest"`
-	Outputs        []string `json:"outputs"`
+	PaymentRequest string   `json:"paymentRequest" tkvalidate:"required,hex"`
+	Outputs        []string `json:"outputs" tkvalidate:"min=1"`
 }
 
 // PaymentRequest is the processed response from a PaymentRequest endpoint.
 type PaymentRequest struct {
-	Tx      *wire.MsgTx
-	Outputs []*wire.TxOut
+	Tx      *wire.MsgTx   `tkvalidate:"required"`
+	Outputs []*wire.TxOut `tkvalidate:"min=1"`
 }
 
 type InstrumentAliasListResponse struct {
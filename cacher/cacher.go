@@ -6,6 +6,13 @@ import (
 	"reflect"
 
 	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrLeaseNotHeld is returned by a Coordinator when releasing a path that it doesn't hold.
+	ErrLeaseNotHeld = errors.New("Lease not held")
 )
 
 // Cacher is an interface for a system that pulls items from storage and retains them in the cache
@@ -91,3 +98,24 @@ type SetValue interface {
 	Lock()
 	Unlock()
 }
+
+// Coordinator coordinates which cacher instance holds a path in memory when multiple cacher
+// instances share the same storage. A path must only be acquired by one instance at a time so that
+// an instance never reads a value from storage while another instance holds a copy that it may
+// still modify and write back.
+type Coordinator interface {
+	// Acquire blocks until the path is held by this instance or the context is done. Acquire is
+	// not reentrant and will not be called again for a path until it has been released.
+	Acquire(ctx context.Context, path string) error
+
+	// Release releases a path previously acquired by this instance so that other instances can
+	// acquire it. It is called after any modifications have been written to storage.
+	Release(ctx context.Context, path string) error
+}
+
+// LeaseLossNotifier is implemented by coordinators whose leases can be lost while they are held,
+// for example when they expire before they are renewed. The handler is called when this instance
+// no longer holds a path it acquired, and the path is not released afterward.
+type LeaseLossNotifier interface {
+	SetLeaseLostHandler(handler func(ctx context.Context, path string))
+}
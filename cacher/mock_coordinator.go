@@ -0,0 +1,120 @@
+package cacher
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// MockLeases holds path leases in memory so that multiple cacher instances in the same process can
+// be coordinated in tests. Each cacher instance should use its own MockCoordinator created from the
+// same MockLeases.
+type MockLeases struct {
+	owners       map[string]uuid.UUID
+	coordinators map[uuid.UUID]*MockCoordinator
+	changed      chan interface{} // closed and replaced whenever a lease is released
+	lock         sync.Mutex
+}
+
+// MockCoordinator implements the Coordinator interface for one cacher instance using leases held
+// in memory.
+type MockCoordinator struct {
+	id     uuid.UUID
+	leases *MockLeases
+
+	lostHandler func(ctx context.Context, path string)
+}
+
+func NewMockLeases() *MockLeases {
+	return &MockLeases{
+		owners:       make(map[string]uuid.UUID),
+		coordinators: make(map[uuid.UUID]*MockCoordinator),
+		changed:      make(chan interface{}),
+	}
+}
+
+func NewMockCoordinator(leases *MockLeases) *MockCoordinator {
+	result := &MockCoordinator{
+		id:     uuid.New(),
+		leases: leases,
+	}
+
+	leases.lock.Lock()
+	leases.coordinators[result.id] = result
+	leases.lock.Unlock()
+
+	return result
+}
+
+// Holder returns the id of the coordinator holding the path and true, or false if the path is not
+// held.
+func (l *MockLeases) Holder(path string) (uuid.UUID, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	id, exists := l.owners[path]
+	return id, exists
+}
+
+// Expire removes the lease on a path, as if it expired without being renewed, and notifies the
+// coordinator that held it.
+func (l *MockLeases) Expire(ctx context.Context, path string) {
+	l.lock.Lock()
+	id, exists := l.owners[path]
+	if !exists {
+		l.lock.Unlock()
+		return
+	}
+
+	delete(l.owners, path)
+	close(l.changed)
+	l.changed = make(chan interface{})
+	coordinator := l.coordinators[id]
+	l.lock.Unlock()
+
+	if coordinator != nil && coordinator.lostHandler != nil {
+		coordinator.lostHandler(ctx, path)
+	}
+}
+
+func (c *MockCoordinator) ID() uuid.UUID {
+	return c.id
+}
+
+func (c *MockCoordinator) Acquire(ctx context.Context, path string) error {
+	for {
+		c.leases.lock.Lock()
+		if _, exists := c.leases.owners[path]; !exists {
+			c.leases.owners[path] = c.id
+			c.leases.lock.Unlock()
+			return nil
+		}
+		changed := c.leases.changed
+		c.leases.lock.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *MockCoordinator) Release(ctx context.Context, path string) error {
+	c.leases.lock.Lock()
+	defer c.leases.lock.Unlock()
+
+	if id, exists := c.leases.owners[path]; !exists || id != c.id {
+		return ErrLeaseNotHeld
+	}
+
+	delete(c.leases.owners, path)
+	close(c.leases.changed)
+	c.leases.changed = make(chan interface{})
+	return nil
+}
+
+func (c *MockCoordinator) SetLeaseLostHandler(handler func(ctx context.Context, path string)) {
+	c.lostHandler = handler
+}
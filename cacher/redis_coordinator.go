@@ -0,0 +1,213 @@
+package cacher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tokenized/logger"
+	"github.com/tokenized/threads"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultLeaseDuration = 30 * time.Second
+	DefaultRetryDelay    = 100 * time.Millisecond
+)
+
+var (
+	// releaseScript deletes the lease key only if it is still held by this instance.
+	releaseScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	// renewScript extends the lease key expiration only if it is still held by this instance.
+	renewScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// RedisCoordinator implements the Coordinator interface with leases held in Redis so that cacher
+// instances in different processes can share the same storage. Leases expire so that paths held by
+// an instance that stops unexpectedly become available again, so Run must be running to renew
+// leases for items retained longer than the lease duration.
+type RedisCoordinator struct {
+	pool      *redis.Pool
+	id        string
+	keyPrefix string
+
+	leaseDuration time.Duration
+	retryDelay    time.Duration
+
+	held        map[string]bool
+	lostHandler func(ctx context.Context, path string)
+	heldLock    sync.Mutex
+}
+
+// NewRedisCoordinator creates a new coordinator. Lease keys are the path with keyPrefix prepended.
+func NewRedisCoordinator(pool *redis.Pool, keyPrefix string, leaseDuration,
+	retryDelay time.Duration) *RedisCoordinator {
+
+	if leaseDuration == 0 {
+		leaseDuration = DefaultLeaseDuration
+	}
+	if retryDelay == 0 {
+		retryDelay = DefaultRetryDelay
+	}
+
+	return &RedisCoordinator{
+		pool:          pool,
+		id:            uuid.New().String(),
+		keyPrefix:     keyPrefix,
+		leaseDuration: leaseDuration,
+		retryDelay:    retryDelay,
+		held:          make(map[string]bool),
+	}
+}
+
+func (c *RedisCoordinator) Acquire(ctx context.Context, path string) error {
+	key := c.keyPrefix + path
+	start := time.Now()
+	for {
+		acquired, err := c.tryAcquire(key)
+		if err != nil {
+			return errors.Wrap(err, "redis")
+		}
+
+		if acquired {
+			c.heldLock.Lock()
+			c.held[path] = true
+			c.heldLock.Unlock()
+
+			logger.VerboseWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+				logger.MillisecondsFromNano("elapsed_ms", time.Since(start).Nanoseconds()),
+			}, "Acquired cache path lease")
+			return nil
+		}
+
+		select {
+		case <-time.After(c.retryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *RedisCoordinator) tryAcquire(key string) (bool, error) {
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	resp, err := conn.Do("SET", key, c.id, "NX", "PX", c.leaseDuration.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	return resp != nil, nil
+}
+
+func (c *RedisCoordinator) Release(ctx context.Context, path string) error {
+	c.heldLock.Lock()
+	delete(c.held, path)
+	c.heldLock.Unlock()
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	deleted, err := redis.Int(releaseScript.Do(conn, c.keyPrefix+path, c.id))
+	if err != nil {
+		return errors.Wrap(err, "redis")
+	}
+
+	if deleted == 0 {
+		return ErrLeaseNotHeld
+	}
+
+	return nil
+}
+
+// SetLeaseLostHandler sets a function that is called when a lease expired before it was renewed, so
+// another instance may have acquired the path.
+func (c *RedisCoordinator) SetLeaseLostHandler(handler func(ctx context.Context, path string)) {
+	c.heldLock.Lock()
+	c.lostHandler = handler
+	c.heldLock.Unlock()
+}
+
+// Run renews the leases held by this instance until interrupted. Failures to renew are logged and
+// retried on the next renewal so that a temporary Redis error doesn't stop renewal.
+func (c *RedisCoordinator) Run(ctx context.Context, interrupt <-chan interface{}) error {
+	renewFrequency := c.leaseDuration / 3
+	for {
+		select {
+		case <-time.After(renewFrequency):
+			c.renew(ctx)
+
+		case <-interrupt:
+			return threads.Interrupted
+		}
+	}
+}
+
+// renew extends the leases held by this instance and notifies the lost handler of any that have
+// expired.
+func (c *RedisCoordinator) renew(ctx context.Context) {
+	c.heldLock.Lock()
+	paths := make([]string, 0, len(c.held))
+	for path := range c.held {
+		paths = append(paths, path)
+	}
+	c.heldLock.Unlock()
+
+	if len(paths) == 0 {
+		return
+	}
+
+	conn := c.pool.Get()
+	defer conn.Close()
+
+	for _, path := range paths {
+		renewed, err := redis.Int(renewScript.Do(conn, c.keyPrefix+path, c.id,
+			c.leaseDuration.Milliseconds()))
+		if err != nil {
+			logger.ErrorWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+			}, "Failed to renew cache path lease : %s", err)
+			continue
+		}
+
+		if renewed == 0 {
+			// The lease expired before it was renewed so another instance may have acquired the
+			// path.
+			c.lost(ctx, path)
+		}
+	}
+}
+
+// lost stops holding a path whose lease expired and notifies the lost handler.
+func (c *RedisCoordinator) lost(ctx context.Context, path string) {
+	c.heldLock.Lock()
+	held := c.held[path]
+	delete(c.held, path)
+	handler := c.lostHandler
+	c.heldLock.Unlock()
+
+	if !held {
+		return // released while being renewed
+	}
+
+	logger.ErrorWithFields(ctx, []logger.Field{
+		logger.String("path", path),
+	}, "Cache path lease lost")
+
+	if handler != nil {
+		handler(ctx, path)
+	}
+}
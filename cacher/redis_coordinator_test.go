@@ -0,0 +1,115 @@
+package cacher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/scottjbarr/redis"
+)
+
+func Test_RedisCoordinator(t *testing.T) {
+	ctx := context.Background()
+
+	uri := os.Getenv("REDIS_URL")
+	if len(uri) == 0 {
+		t.Skip("REDIS_URL not set")
+	}
+
+	pool, err := redis.NewPool(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefix := fmt.Sprintf("test-%v-", time.Now().UnixNano())
+	leaseDuration := 300 * time.Millisecond
+	coordinator1 := NewRedisCoordinator(pool, prefix, leaseDuration, 10*time.Millisecond)
+	coordinator2 := NewRedisCoordinator(pool, prefix, leaseDuration, 10*time.Millisecond)
+
+	lost := make(chan string, 1)
+	coordinator1.SetLeaseLostHandler(func(ctx context.Context, path string) {
+		lost <- path
+	})
+
+	// Acquire
+	if err := coordinator1.Acquire(ctx, "path"); err != nil {
+		t.Fatalf("Failed to acquire : %s", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	err = coordinator2.Acquire(timeoutCtx, "path")
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Second acquire should time out : got %v", err)
+	}
+
+	// Release
+	if err := coordinator2.Release(ctx, "path"); err != ErrLeaseNotHeld {
+		t.Fatalf("Wrong release error for path not held : got %v, want %v", err,
+			ErrLeaseNotHeld)
+	}
+
+	if err := coordinator1.Release(ctx, "path"); err != nil {
+		t.Fatalf("Failed to release : %s", err)
+	}
+
+	if err := coordinator2.Acquire(ctx, "path"); err != nil {
+		t.Fatalf("Failed to acquire released path : %s", err)
+	}
+
+	if err := coordinator2.Release(ctx, "path"); err != nil {
+		t.Fatalf("Failed to release : %s", err)
+	}
+
+	// Renew keeps the lease past its original expiration.
+	if err := coordinator1.Acquire(ctx, "renewed"); err != nil {
+		t.Fatalf("Failed to acquire : %s", err)
+	}
+
+	for i := 0; i < 4; i++ {
+		time.Sleep(leaseDuration / 3)
+		coordinator1.renew(ctx)
+	}
+
+	timeoutCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	err = coordinator2.Acquire(timeoutCtx, "renewed")
+	cancel()
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Renewed lease should still be held : got %v", err)
+	}
+
+	select {
+	case path := <-lost:
+		t.Fatalf("Renewed lease reported lost : %s", path)
+	default:
+	}
+
+	// A lease that expires is acquired by another instance and reported lost when renewed.
+	time.Sleep(leaseDuration + 50*time.Millisecond)
+
+	if err := coordinator2.Acquire(ctx, "renewed"); err != nil {
+		t.Fatalf("Failed to acquire expired path : %s", err)
+	}
+
+	coordinator1.renew(ctx)
+
+	select {
+	case path := <-lost:
+		if path != "renewed" {
+			t.Errorf("Wrong lost path : got %s, want %s", path, "renewed")
+		}
+	default:
+		t.Fatalf("Expired lease not reported lost")
+	}
+
+	// The lost path is no longer held by the first instance.
+	if err := coordinator1.Release(ctx, "renewed"); err != ErrLeaseNotHeld {
+		t.Fatalf("Wrong release error for lost path : got %v, want %v", err, ErrLeaseNotHeld)
+	}
+
+	if err := coordinator2.Release(ctx, "renewed"); err != nil {
+		t.Fatalf("Failed to release : %s", err)
+	}
+}
@@ -0,0 +1,186 @@
+package cacher
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/tokenized/pkg/bitcoin"
+
+	"github.com/pkg/errors"
+)
+
+// IndexedSetValue is a SetValue that can also be retrieved by keys in secondary indexes. Indexes
+// are unique, so if two values in a set have the same key then only the first value added will be
+// found by that key. The index keys of a value must not change after it is added to a set.
+type IndexedSetValue interface {
+	SetValue
+
+	// IndexKey returns the value's key in the named index, or nil if it isn't in the index.
+	IndexKey(index string) []byte
+}
+
+// indexEntry is a set value stored in an index set that maps the hash of an index key to the hash
+// of the set value with that key.
+type indexEntry struct {
+	keyHash   bitcoin.Hash32
+	valueHash bitcoin.Hash32
+
+	sync.Mutex
+}
+
+// RegisterSetIndex adds a secondary index for set values of the type. The type must implement
+// IndexedSetValue. It must be called before the cacher is used. Values added before the index was
+// registered will not be found by it until ReindexSet is called.
+func (c *SimpleCacher) RegisterSetIndex(typ reflect.Type, index string) error {
+	if !typ.Implements(reflect.TypeOf((*IndexedSetValue)(nil)).Elem()) {
+		return fmt.Errorf("%s doesn't implement IndexedSetValue", typ)
+	}
+
+	c.indexes[typ] = append(c.indexes[typ], index)
+	return nil
+}
+
+// GetSetValueByIndex returns the set value with the key in the named index, or nil if there isn't
+// one. Like GetSetValue, the value must be released with ReleaseSetValue using its hash.
+func (c *SimpleCacher) GetSetValueByIndex(ctx context.Context, typ reflect.Type, pathPrefix,
+	index string, key []byte) (SetValue, error) {
+
+	indexPathPrefix := setIndexPathPrefix(pathPrefix, index)
+	keyHash := indexKeyHash(key)
+	entryValue, err := c.GetSetValue(ctx, c.indexEntryType, indexPathPrefix, keyHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "index entry")
+	}
+
+	if entryValue == nil {
+		return nil, nil
+	}
+
+	entry := entryValue.(*indexEntry)
+	entry.Lock()
+	valueHash := entry.valueHash
+	entry.Unlock()
+
+	if err := c.ReleaseSetValue(ctx, c.indexEntryType, indexPathPrefix, keyHash); err != nil {
+		return nil, errors.Wrap(err, "release index entry")
+	}
+
+	return c.GetSetValue(ctx, typ, pathPrefix, valueHash)
+}
+
+// ReindexSet adds all values of a set to its registered indexes. It is used to build indexes for
+// values that were added before the index was registered.
+func (c *SimpleCacher) ReindexSet(ctx context.Context, typ reflect.Type, pathPrefix string) error {
+	values, err := c.ListMultiSetValue(ctx, typ, pathPrefix)
+	if err != nil {
+		return errors.Wrap(err, "list")
+	}
+
+	indexErr := c.addIndexEntries(ctx, typ, pathPrefix, values)
+
+	if err := c.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(values)); err != nil {
+		return errors.Wrap(err, "release")
+	}
+
+	if indexErr != nil {
+		return errors.Wrap(indexErr, "index")
+	}
+
+	return nil
+}
+
+// addIndexEntries adds the values to the indexes registered for the type.
+func (c *SimpleCacher) addIndexEntries(ctx context.Context, typ reflect.Type, pathPrefix string,
+	values []SetValue) error {
+
+	indexes := c.indexes[typ]
+	if len(indexes) == 0 || len(values) == 0 {
+		return nil
+	}
+
+	for _, index := range indexes {
+		var entries []SetValue
+		for _, value := range values {
+			indexedValue := value.(IndexedSetValue)
+			indexedValue.Lock()
+			key := indexedValue.IndexKey(index)
+			hash := indexedValue.Hash()
+			indexedValue.Unlock()
+
+			if key == nil {
+				continue
+			}
+
+			entries = append(entries, &indexEntry{
+				keyHash:   indexKeyHash(key),
+				valueHash: hash,
+			})
+		}
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		indexPathPrefix := setIndexPathPrefix(pathPrefix, index)
+		if _, err := c.AddMultiSetValue(ctx, c.indexEntryType, indexPathPrefix,
+			entries); err != nil {
+			return errors.Wrapf(err, "add: %s", index)
+		}
+
+		if err := c.ReleaseMultiSetValue(ctx, c.indexEntryType, indexPathPrefix,
+			hashes(entries)); err != nil {
+			return errors.Wrapf(err, "release: %s", index)
+		}
+	}
+
+	return nil
+}
+
+func setIndexPathPrefix(pathPrefix, index string) string {
+	return fmt.Sprintf("%s/index/%s", pathPrefix, index)
+}
+
+func indexKeyHash(key []byte) bitcoin.Hash32 {
+	return bitcoin.Hash32(sha256.Sum256(key))
+}
+
+func (e *indexEntry) ProvideMarkModified(markModified MarkModified) {}
+
+func (e *indexEntry) Hash() bitcoin.Hash32 {
+	return e.keyHash
+}
+
+func (e *indexEntry) CacheSetCopy() SetValue {
+	return &indexEntry{
+		keyHash:   e.keyHash,
+		valueHash: e.valueHash,
+	}
+}
+
+func (e *indexEntry) Serialize(w io.Writer) error {
+	if err := e.keyHash.Serialize(w); err != nil {
+		return errors.Wrap(err, "key hash")
+	}
+
+	if err := e.valueHash.Serialize(w); err != nil {
+		return errors.Wrap(err, "value hash")
+	}
+
+	return nil
+}
+
+func (e *indexEntry) Deserialize(r io.Reader) error {
+	if err := e.keyHash.Deserialize(r); err != nil {
+		return errors.Wrap(err, "key hash")
+	}
+
+	if err := e.valueHash.Deserialize(r); err != nil {
+		return errors.Wrap(err, "value hash")
+	}
+
+	return nil
+}
@@ -0,0 +1,337 @@
+package cacher
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/storage"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSetPrefixLength is the number of bytes of a set value's hash used to determine the
+	// partition it is stored in by default.
+	DefaultSetPrefixLength = 2
+
+	partitionLayoutVersion = uint8(0)
+
+	// partitionLayoutName is the name of the storage object, within a set's path prefix, that
+	// contains the partition layout of a SplitPartitioner.
+	partitionLayoutName = "partitions"
+)
+
+var (
+	// ErrSplitNotSupported is returned by a SetPartitioner that doesn't support splitting
+	// partitions.
+	ErrSplitNotSupported = errors.New("Split not supported")
+)
+
+// SetPartitioner determines which partition (storage object) each value of a set is stored in.
+type SetPartitioner interface {
+	// PartitionID returns the id of the partition that contains the value with the hash. The
+	// partition id must be a prefix of the hash.
+	PartitionID(ctx context.Context, pathPrefix string, hash bitcoin.Hash32) ([]byte, error)
+
+	// ShouldSplit returns true if a partition containing count values should be split into
+	// smaller partitions.
+	ShouldSplit(pathPrefix string, partitionID []byte, count int) bool
+
+	// Split records that a partition has been split so that PartitionID will return longer ids for
+	// the hashes that were previously in it.
+	Split(ctx context.Context, pathPrefix string, partitionID []byte) error
+
+	// Reload discards any partitions of the set retained in memory and returns true if they
+	// changed. It is called when another instance sharing the storage may have split a partition.
+	Reload(ctx context.Context, pathPrefix string) (bool, error)
+}
+
+// PrefixPartitioner partitions sets by a fixed length prefix of the value hashes. A prefix length
+// of 2 results in up to 65,536 partitions per set.
+type PrefixPartitioner struct {
+	length int
+}
+
+func NewPrefixPartitioner(length int) *PrefixPartitioner {
+	if length < 1 {
+		length = 1
+	} else if length > bitcoin.Hash32Size {
+		length = bitcoin.Hash32Size
+	}
+
+	return &PrefixPartitioner{
+		length: length,
+	}
+}
+
+func (p *PrefixPartitioner) PartitionID(ctx context.Context, pathPrefix string,
+	hash bitcoin.Hash32) ([]byte, error) {
+
+	return copyBytes(hash[:p.length]), nil
+}
+
+func (p *PrefixPartitioner) ShouldSplit(pathPrefix string, partitionID []byte, count int) bool {
+	return false
+}
+
+func (p *PrefixPartitioner) Split(ctx context.Context, pathPrefix string,
+	partitionID []byte) error {
+	return ErrSplitNotSupported
+}
+
+func (p *PrefixPartitioner) Reload(ctx context.Context, pathPrefix string) (bool, error) {
+	return false, nil
+}
+
+// SplitPartitioner partitions sets by a prefix of the value hashes that starts at a minimum length
+// and adds a byte to the prefix of a partition when it grows past a threshold. The partitions that
+// have been split are stored in a layout object within each set's path prefix. The layout is
+// retained in memory and reloaded when the cacher finds that another instance sharing the storage
+// may have split a partition.
+type SplitPartitioner struct {
+	store     storage.Storage
+	minLength int
+	maxLength int
+	threshold int
+
+	layouts     map[string]*partitionLayout
+	layoutsLock sync.Mutex
+}
+
+// partitionLayout contains the ids of the partitions of a set that have been split.
+type partitionLayout struct {
+	split map[string]bool // hex partition id
+	sync.Mutex
+}
+
+// NewSplitPartitioner creates a partitioner that starts with partitions of minLength bytes and
+// splits any partition with more than threshold values until the partition ids are maxLength bytes.
+func NewSplitPartitioner(store storage.Storage, minLength, maxLength,
+	threshold int) *SplitPartitioner {
+
+	if minLength < 1 {
+		minLength = 1
+	}
+	if maxLength > bitcoin.Hash32Size {
+		maxLength = bitcoin.Hash32Size
+	}
+	if maxLength < minLength {
+		maxLength = minLength
+	}
+
+	return &SplitPartitioner{
+		store:     store,
+		minLength: minLength,
+		maxLength: maxLength,
+		threshold: threshold,
+		layouts:   make(map[string]*partitionLayout),
+	}
+}
+
+func (p *SplitPartitioner) PartitionID(ctx context.Context, pathPrefix string,
+	hash bitcoin.Hash32) ([]byte, error) {
+
+	layout, err := p.getLayout(ctx, pathPrefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "layout")
+	}
+
+	layout.Lock()
+	defer layout.Unlock()
+
+	length := p.minLength
+	for length < p.maxLength && layout.split[hex.EncodeToString(hash[:length])] {
+		length++
+	}
+
+	return copyBytes(hash[:length]), nil
+}
+
+func (p *SplitPartitioner) ShouldSplit(pathPrefix string, partitionID []byte, count int) bool {
+	return count > p.threshold && len(partitionID) < p.maxLength
+}
+
+func (p *SplitPartitioner) Split(ctx context.Context, pathPrefix string,
+	partitionID []byte) error {
+
+	if len(partitionID) >= p.maxLength {
+		return fmt.Errorf("Partition at max length : %x", partitionID)
+	}
+
+	layout, err := p.getLayout(ctx, pathPrefix)
+	if err != nil {
+		return errors.Wrap(err, "layout")
+	}
+
+	layout.Lock()
+	defer layout.Unlock()
+
+	// Reload the layout so that splits by other instances are retained.
+	split, err := p.readLayout(ctx, pathPrefix)
+	if err != nil {
+		return errors.Wrap(err, "read")
+	}
+	layout.split = split
+
+	layout.split[hex.EncodeToString(partitionID)] = true
+
+	if err := saveValue(ctx, p.store, partitionLayoutPath(pathPrefix), layout); err != nil {
+		return errors.Wrap(err, "save")
+	}
+
+	return nil
+}
+
+func (p *SplitPartitioner) Reload(ctx context.Context, pathPrefix string) (bool, error) {
+	layout, err := p.getLayout(ctx, pathPrefix)
+	if err != nil {
+		return false, errors.Wrap(err, "layout")
+	}
+
+	layout.Lock()
+	defer layout.Unlock()
+
+	split, err := p.readLayout(ctx, pathPrefix)
+	if err != nil {
+		return false, errors.Wrap(err, "read")
+	}
+
+	changed := len(split) != len(layout.split)
+	for id := range split {
+		if !layout.split[id] {
+			changed = true
+		}
+	}
+
+	layout.split = split
+	return changed, nil
+}
+
+// Reset removes the layout of a set so that it starts with no split partitions.
+func (p *SplitPartitioner) Reset(ctx context.Context, pathPrefix string) error {
+	p.layoutsLock.Lock()
+	defer p.layoutsLock.Unlock()
+
+	delete(p.layouts, pathPrefix)
+	if err := p.store.Remove(ctx, partitionLayoutPath(pathPrefix)); err != nil &&
+		errors.Cause(err) != storage.ErrNotFound {
+		return errors.Wrap(err, "remove")
+	}
+
+	return nil
+}
+
+func (p *SplitPartitioner) getLayout(ctx context.Context,
+	pathPrefix string) (*partitionLayout, error) {
+
+	p.layoutsLock.Lock()
+	defer p.layoutsLock.Unlock()
+
+	if layout, exists := p.layouts[pathPrefix]; exists {
+		return layout, nil
+	}
+
+	split, err := p.readLayout(ctx, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	layout := &partitionLayout{
+		split: split,
+	}
+
+	p.layouts[pathPrefix] = layout
+	return layout, nil
+}
+
+// readLayout reads the ids of the split partitions of a set from storage.
+func (p *SplitPartitioner) readLayout(ctx context.Context,
+	pathPrefix string) (map[string]bool, error) {
+
+	layout := &partitionLayout{
+		split: make(map[string]bool),
+	}
+
+	b, err := p.store.Read(ctx, partitionLayoutPath(pathPrefix))
+	if err == nil {
+		if err := layout.Deserialize(bytes.NewReader(b)); err != nil {
+			return nil, errors.Wrap(err, "deserialize")
+		}
+	} else if errors.Cause(err) != storage.ErrNotFound {
+		return nil, errors.Wrap(err, "read")
+	}
+
+	return layout.split, nil
+}
+
+func (l *partitionLayout) Serialize(w io.Writer) error {
+	if err := binary.Write(w, endian, partitionLayoutVersion); err != nil {
+		return errors.Wrap(err, "version")
+	}
+
+	if err := binary.Write(w, endian, uint32(len(l.split))); err != nil {
+		return errors.Wrap(err, "count")
+	}
+
+	for id := range l.split {
+		b, _ := hex.DecodeString(id)
+		if err := binary.Write(w, endian, uint8(len(b))); err != nil {
+			return errors.Wrap(err, "size")
+		}
+
+		if _, err := w.Write(b); err != nil {
+			return errors.Wrap(err, "id")
+		}
+	}
+
+	return nil
+}
+
+func (l *partitionLayout) Deserialize(r io.Reader) error {
+	var version uint8
+	if err := binary.Read(r, endian, &version); err != nil {
+		return errors.Wrap(err, "version")
+	}
+
+	if version != 0 {
+		return fmt.Errorf("Unsupported version : %d", version)
+	}
+
+	var count uint32
+	if err := binary.Read(r, endian, &count); err != nil {
+		return errors.Wrap(err, "count")
+	}
+
+	l.split = make(map[string]bool)
+	for i := uint32(0); i < count; i++ {
+		var size uint8
+		if err := binary.Read(r, endian, &size); err != nil {
+			return errors.Wrap(err, "size")
+		}
+
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return errors.Wrap(err, "id")
+		}
+
+		l.split[hex.EncodeToString(b)] = true
+	}
+
+	return nil
+}
+
+func partitionLayoutPath(pathPrefix string) string {
+	return fmt.Sprintf("%s/%s", pathPrefix, partitionLayoutName)
+}
+
+func copyBytes(b []byte) []byte {
+	result := make([]byte, len(b))
+	copy(result, b)
+	return result
+}
@@ -23,21 +23,70 @@ type SimpleCacher struct {
 	items     map[string]*SimpleItem
 	itemsLock sync.Mutex
 
+	// splitting contains a channel for each set partition that is being split, which is closed when
+	// the split completes. splitGeneration is incremented after each split so that partition ids
+	// determined before a split are not used. Both are protected by itemsLock.
+	splitting       map[string]chan interface{}
+	splitGeneration uint64
+
+	// lost contains items whose path leases were lost. They are never saved and are removed when
+	// their current users release them. Protected by itemsLock.
+	lost map[string]*SimpleItem
+
 	store storage.Storage
 
-	cacheSetType reflect.Type
+	coordinator Coordinator
+	leases      map[string]*pathLease
+	leasesLock  sync.Mutex
+
+	partitioner SetPartitioner
+	indexes     map[reflect.Type][]string
+
+	stats *cacherStats
+
+	cacheSetType   reflect.Type
+	indexEntryType reflect.Type
 }
 
 type SimpleItem struct {
 	value Value
 	users uint
+
+	typ       reflect.Type // type used for statistics
+	heldSince time.Time
+}
+
+// pathLease tracks the local users of a path acquired from the coordinator so that the coordinator
+// is only called once per path even when there are concurrent requests for it in this instance.
+type pathLease struct {
+	count    uint
+	acquired chan interface{} // closed when the acquire completes
+	err      error
 }
 
 func NewSimpleCache(store storage.Storage) *SimpleCacher {
 	return &SimpleCacher{
-		items:        make(map[string]*SimpleItem),
-		store:        store,
-		cacheSetType: reflect.TypeOf(&cacheSet{}),
+		items:          make(map[string]*SimpleItem),
+		splitting:      make(map[string]chan interface{}),
+		lost:           make(map[string]*SimpleItem),
+		store:          store,
+		leases:         make(map[string]*pathLease),
+		partitioner:    NewPrefixPartitioner(DefaultSetPrefixLength),
+		indexes:        make(map[reflect.Type][]string),
+		stats:          newCacherStats(),
+		cacheSetType:   reflect.TypeOf(&cacheSet{}),
+		indexEntryType: reflect.TypeOf(&indexEntry{}),
+	}
+}
+
+// SetCoordinator sets a coordinator that is used to ensure that only one cacher instance holds a
+// path at a time when multiple instances share the same storage. It must be called before the
+// cacher is used.
+func (c *SimpleCacher) SetCoordinator(coordinator Coordinator) {
+	c.coordinator = coordinator
+
+	if notifier, ok := coordinator.(LeaseLossNotifier); ok {
+		notifier.SetLeaseLostHandler(c.leaseLost)
 	}
 }
 
@@ -48,7 +97,7 @@ func (c *SimpleCacher) Add(ctx context.Context, typ reflect.Type, path string,
 	emptyValueInterface := emptyTypeValue.Interface()
 	emptyValue := emptyValueInterface.(Value)
 	emptyValue.Initialize()
-	return c.addValue(ctx, typ, path, emptyValue, value)
+	return c.addValue(ctx, typ, path, emptyValue, value, nil)
 }
 
 func (c *SimpleCacher) AddMulti(ctx context.Context, typ reflect.Type, paths []string,
@@ -61,7 +110,7 @@ func (c *SimpleCacher) AddMulti(ctx context.Context, typ reflect.Type, paths []s
 		emptyValue := emptyValueInterface.(Value)
 		emptyValue.Initialize()
 
-		v, err := c.addValue(ctx, typ, paths[i], emptyValue, value)
+		v, err := c.addValue(ctx, typ, paths[i], emptyValue, value, nil)
 		if err != nil {
 			return nil, errors.Wrapf(err, "add %d", i)
 		}
@@ -77,7 +126,7 @@ func (c *SimpleCacher) Get(ctx context.Context, typ reflect.Type, path string) (
 	emptyValueInterface := emptyTypeValue.Interface()
 	emptyValue := emptyValueInterface.(Value)
 	emptyValue.Initialize()
-	return c.getValue(ctx, typ, path, emptyValue)
+	return c.getValue(ctx, typ, path, emptyValue, nil)
 }
 
 func (c *SimpleCacher) GetMulti(ctx context.Context, typ reflect.Type,
@@ -90,7 +139,7 @@ func (c *SimpleCacher) GetMulti(ctx context.Context, typ reflect.Type,
 		emptyValue := emptyValueInterface.(Value)
 		emptyValue.Initialize()
 
-		v, err := c.getValue(ctx, typ, path, emptyValue)
+		v, err := c.getValue(ctx, typ, path, emptyValue, nil)
 		if err != nil {
 			return nil, errors.Wrapf(err, "get %d", i)
 		}
@@ -162,19 +211,39 @@ func (c *SimpleCacher) CopyRecursive(ctx context.Context, fromPathPrefix,
 			continue
 		}
 
-		toPath := toPathPrefix + path[fromPathPrefixLength:]
 		item.value.Lock()
-		copyItem := &SimpleItem{
-			value: item.value.CacheCopy(),
-			users: 1,
-		}
-		copyItem.value.MarkModified()
+		values[path] = item.value.CacheCopy()
+		values[path].MarkModified()
 		item.value.Unlock()
-		c.items[toPath] = copyItem
-		values[path] = copyItem.value
 	}
 	c.itemsLock.Unlock()
 
+	// Add copies of items in the cache. The destination paths must be acquired before they are
+	// added to the cache. They are released when the copy is complete.
+	var toPaths []string
+	defer func() {
+		for _, toPath := range toPaths {
+			c.release(ctx, toPath)
+		}
+	}()
+
+	for path, value := range values {
+		toPath := toPathPrefix + path[fromPathPrefixLength:]
+		if err := c.acquirePath(ctx, toPath); err != nil {
+			return errors.Wrapf(err, "acquire: %s", toPath)
+		}
+		toPaths = append(toPaths, toPath)
+
+		c.itemsLock.Lock()
+		c.items[toPath] = &SimpleItem{
+			value:     value,
+			users:     1,
+			typ:       statsType(value),
+			heldSince: time.Now(),
+		}
+		c.itemsLock.Unlock()
+	}
+
 	// Copy any items only in storage.
 	paths, err := c.store.List(ctx, fromPathPrefix)
 	if err != nil {
@@ -187,13 +256,15 @@ func (c *SimpleCacher) CopyRecursive(ctx context.Context, fromPathPrefix,
 		}
 
 		toPath := toPathPrefix + path[fromPathPrefixLength:]
-		if err := c.store.Copy(ctx, path, toPath); err != nil {
-			return errors.Wrapf(err, "copy: %s", path)
+		if err := c.acquirePath(ctx, toPath); err != nil {
+			return errors.Wrapf(err, "acquire: %s", toPath)
 		}
-	}
 
-	for path, _ := range values {
-		c.release(ctx, path)
+		err := c.store.Copy(ctx, path, toPath)
+		c.releasePath(ctx, toPath)
+		if err != nil {
+			return errors.Wrapf(err, "copy: %s", path)
+		}
 	}
 
 	return nil
@@ -217,7 +288,7 @@ func (c *SimpleCacher) Release(ctx context.Context, path string) {
 
 func (c *SimpleCacher) IsEmpty(ctx context.Context) bool {
 	c.itemsLock.Lock()
-	count := len(c.items)
+	count := len(c.items) + len(c.lost)
 	c.itemsLock.Unlock()
 
 	return count == 0
@@ -234,47 +305,89 @@ func (c *SimpleCacher) ListCached(ctx context.Context) []string {
 	return result
 }
 
+// getValue returns the value at the path, reading it from storage if it isn't in the cache, or nil
+// if it doesn't exist. claim must be provided for set partitions and errPartitionSplit is returned
+// if the partition was split after the claim was made.
 func (c *SimpleCacher) getValue(ctx context.Context, typ reflect.Type, path string,
-	emptyValue Value) (Value, error) {
+	emptyValue Value, claim *partitionClaim) (Value, error) {
 
+	valueType := statsType(emptyValue)
 	c.itemsLock.Lock()
 	if item, exists := c.items[path]; exists {
 		// Item already exists in the cache so just increment the user count and return the value.
 		item.users++
 		value := item.value
 		c.itemsLock.Unlock()
+		c.stats.hit(valueType)
 		return value, nil
 	}
-	c.itemsLock.Unlock()
+
+	if claim != nil {
+		if err := c.checkClaim(ctx, path, claim); err != nil {
+			return nil, err
+		}
+	} else {
+		c.itemsLock.Unlock()
+	}
+	c.stats.miss(valueType)
+
+	// Ensure no other instance holds the item before reading it from storage.
+	if err := c.acquirePath(ctx, path); err != nil {
+		return nil, errors.Wrap(err, "acquire")
+	}
 
 	// Check if the item is in storage.
 	var readValue Value
 	b, err := c.store.Read(ctx, path)
 	if err == nil {
 		// Deserialize read value.
+		start := time.Now()
 		readValue = emptyValue
 		if err := readValue.Deserialize(bytes.NewReader(b)); err != nil {
+			c.releasePath(ctx, path)
 			return nil, errors.Wrap(err, "deserialize")
 		}
+		c.stats.read(valueType, time.Since(start))
 	} else if errors.Cause(err) != storage.ErrNotFound {
+		c.releasePath(ctx, path)
 		return nil, errors.Wrap(err, "read")
+	} else {
+		c.stats.notFound(valueType)
+
+		if claim != nil {
+			// Another instance may have split the partition and removed it from storage.
+			if err := c.reloadPartitions(ctx, claim); err != nil {
+				c.releasePath(ctx, path)
+				return nil, err
+			}
+		}
 	}
 
 	c.itemsLock.Lock()
+	if claim != nil && !c.claimValid(path, claim) {
+		// The partition was split while it was read from storage so the value read is stale.
+		c.itemsLock.Unlock()
+		c.releasePath(ctx, path)
+		return nil, errPartitionSplit
+	}
+
 	if item, exists := c.items[path]; exists {
 		// Item was added since original check so discard the value read from storage and return
-		// the value in the item set.
+		// the value in the item set. The existing item already holds the path.
 		item.users++
 		value := item.value
 		c.itemsLock.Unlock()
+		c.releasePath(ctx, path)
 		return value, nil
 	}
 
 	if readValue != nil {
 		// Add new item read from storage.
 		newItem := &SimpleItem{
-			value: readValue,
-			users: 1,
+			value:     readValue,
+			users:     1,
+			typ:       valueType,
+			heldSince: time.Now(),
 		}
 		c.items[path] = newItem
 		c.itemsLock.Unlock()
@@ -283,52 +396,95 @@ func (c *SimpleCacher) getValue(ctx context.Context, typ reflect.Type, path stri
 	}
 
 	c.itemsLock.Unlock()
+	c.releasePath(ctx, path)
 
 	// Item is not in storage
 	return nil, nil
 }
 
+// addValue returns the value at the path, reading it from storage if it isn't in the cache, or adds
+// newValue if it doesn't exist. claim must be provided for set partitions and errPartitionSplit is
+// returned if the partition was split after the claim was made.
 func (c *SimpleCacher) addValue(ctx context.Context, typ reflect.Type, path string,
-	emptyValue, newValue Value) (Value, error) {
+	emptyValue, newValue Value, claim *partitionClaim) (Value, error) {
 
+	valueType := statsType(emptyValue)
 	c.itemsLock.Lock()
 	if item, exists := c.items[path]; exists {
 		// Item already exists in the cache so just increment the user count and return the value.
 		item.users++
 		value := item.value
 		c.itemsLock.Unlock()
+		c.stats.hit(valueType)
 		return value, nil
 	}
-	c.itemsLock.Unlock()
+
+	if claim != nil {
+		if err := c.checkClaim(ctx, path, claim); err != nil {
+			return nil, err
+		}
+	} else {
+		c.itemsLock.Unlock()
+	}
+	c.stats.miss(valueType)
+
+	// Ensure no other instance holds the item before reading it from storage.
+	if err := c.acquirePath(ctx, path); err != nil {
+		return nil, errors.Wrap(err, "acquire")
+	}
 
 	// Check if the item is in storage.
 	var readValue Value
 	b, err := c.store.Read(ctx, path)
 	if err == nil {
 		// Deserialize read value.
+		start := time.Now()
 		readValue = emptyValue
 		if err := readValue.Deserialize(bytes.NewReader(b)); err != nil {
+			c.releasePath(ctx, path)
 			return nil, errors.Wrap(err, "deserialize")
 		}
+		c.stats.read(valueType, time.Since(start))
 	} else if errors.Cause(err) != storage.ErrNotFound {
+		c.releasePath(ctx, path)
 		return nil, errors.Wrap(err, "read")
+	} else {
+		c.stats.notFound(valueType)
+
+		if claim != nil {
+			// Another instance may have split the partition and removed it from storage.
+			if err := c.reloadPartitions(ctx, claim); err != nil {
+				c.releasePath(ctx, path)
+				return nil, err
+			}
+		}
 	}
 
 	c.itemsLock.Lock()
+	if claim != nil && !c.claimValid(path, claim) {
+		// The partition was split while it was read from storage so the value read is stale.
+		c.itemsLock.Unlock()
+		c.releasePath(ctx, path)
+		return nil, errPartitionSplit
+	}
+
 	if item, exists := c.items[path]; exists {
 		// Item was added since original check so discard the value read from storage and return
-		// the value in the item set.
+		// the value in the item set. The existing item already holds the path.
 		item.users++
 		value := item.value
 		c.itemsLock.Unlock()
+		c.releasePath(ctx, path)
 		return value, nil
 	}
 
 	if readValue != nil {
 		// Add new item read from storage.
 		newItem := &SimpleItem{
-			value: readValue,
-			users: 1,
+			value:     readValue,
+			users:     1,
+			typ:       valueType,
+			heldSince: time.Now(),
 		}
 		c.items[path] = newItem
 		c.itemsLock.Unlock()
@@ -341,8 +497,10 @@ func (c *SimpleCacher) addValue(ctx context.Context, typ reflect.Type, path stri
 	newValue.MarkModified()
 	newValue.Unlock()
 	newItem := &SimpleItem{
-		value: newValue,
-		users: 1,
+		value:     newValue,
+		users:     1,
+		typ:       valueType,
+		heldSince: time.Now(),
 	}
 	c.items[path] = newItem
 	c.itemsLock.Unlock()
@@ -353,6 +511,16 @@ func (c *SimpleCacher) addValue(ctx context.Context, typ reflect.Type, path stri
 func (c *SimpleCacher) release(ctx context.Context, path string) {
 	c.itemsLock.Lock()
 
+	// Users of an item whose lease was lost release it first. Its changes are discarded.
+	if item, isLost := c.lost[path]; isLost {
+		item.users--
+		if item.users == 0 {
+			delete(c.lost, path)
+		}
+		c.itemsLock.Unlock()
+		return
+	}
+
 	item, exists := c.items[path]
 	if !exists {
 		c.itemsLock.Unlock()
@@ -369,10 +537,136 @@ func (c *SimpleCacher) release(ctx context.Context, path string) {
 	value := item.value
 	delete(c.items, path)
 
+	if set, isSet := value.(*cacheSet); isSet &&
+		c.partitioner.ShouldSplit(set.pathPrefix, set.pathID, len(set.values)) {
+		// Requests for the partition wait until the split completes and then determine their
+		// partition ids again.
+		done := make(chan interface{})
+		c.splitting[path] = done
+		c.itemsLock.Unlock()
+
+		err := c.splitSet(ctx, set)
+		if err != nil {
+			logger.ErrorWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+			}, "Failed to split set partition : %s", err)
+
+			// Save the partition before other requests can read it from storage.
+			c.saveItem(ctx, path, value)
+		}
+
+		c.itemsLock.Lock()
+		delete(c.splitting, path)
+		if err == nil {
+			c.splitGeneration++
+		}
+		close(done)
+		c.itemsLock.Unlock()
+
+		c.releasePath(ctx, path)
+		return
+	}
+
 	c.itemsLock.Unlock()
 
-	// Save item
+	// Save item before releasing the path so other instances will read the latest value.
 	c.saveItem(ctx, path, value)
+	c.releasePath(ctx, path)
+}
+
+// leaseLost evicts the item for a path whose lease was lost so that it isn't written over changes
+// made by the instance that now holds the path. New requests for the path acquire it again and read
+// it from storage.
+func (c *SimpleCacher) leaseLost(ctx context.Context, path string) {
+	c.leasesLock.Lock()
+	delete(c.leases, path)
+	c.leasesLock.Unlock()
+
+	c.itemsLock.Lock()
+	item, exists := c.items[path]
+	if exists {
+		delete(c.items, path)
+		if previous, isLost := c.lost[path]; isLost {
+			item.users += previous.users
+		}
+		c.lost[path] = item
+	}
+	c.itemsLock.Unlock()
+
+	logger.ErrorWithFields(ctx, []logger.Field{
+		logger.String("path", path),
+		logger.Bool("in_cache", exists),
+	}, "Cache path lease lost so changes to the item will be discarded")
+}
+
+// acquirePath acquires the path from the coordinator, if there is one. Each successful call must
+// be matched by a call to releasePath.
+func (c *SimpleCacher) acquirePath(ctx context.Context, path string) error {
+	if c.coordinator == nil {
+		return nil
+	}
+
+	c.leasesLock.Lock()
+	if lease, exists := c.leases[path]; exists {
+		// The path is already held, or being acquired, by this instance.
+		lease.count++
+		c.leasesLock.Unlock()
+
+		<-lease.acquired
+		if lease.err != nil {
+			return lease.err
+		}
+		return nil
+	}
+
+	lease := &pathLease{
+		count:    1,
+		acquired: make(chan interface{}),
+	}
+	c.leases[path] = lease
+	c.leasesLock.Unlock()
+
+	err := c.coordinator.Acquire(ctx, path)
+
+	c.leasesLock.Lock()
+	if err != nil {
+		lease.err = err
+		delete(c.leases, path)
+	}
+	close(lease.acquired)
+	c.leasesLock.Unlock()
+
+	return err
+}
+
+// releasePath releases a path acquired with acquirePath and releases it from the coordinator when
+// there are no more local users.
+func (c *SimpleCacher) releasePath(ctx context.Context, path string) {
+	if c.coordinator == nil {
+		return
+	}
+
+	c.leasesLock.Lock()
+	lease, exists := c.leases[path]
+	if !exists {
+		c.leasesLock.Unlock()
+		return
+	}
+
+	lease.count--
+	if lease.count > 0 {
+		c.leasesLock.Unlock()
+		return
+	}
+
+	delete(c.leases, path)
+	c.leasesLock.Unlock()
+
+	if err := c.coordinator.Release(ctx, path); err != nil {
+		logger.ErrorWithFields(ctx, []logger.Field{
+			logger.String("path", path),
+		}, "Failed to release path from coordinator : %s", err)
+	}
 }
 
 func (c *SimpleCacher) saveItem(ctx context.Context, path string, value Value) error {
@@ -390,6 +684,7 @@ func (c *SimpleCacher) saveItem(ctx context.Context, path string, value Value) e
 		return err
 	}
 
+	c.stats.write(statsType(value))
 	return nil
 }
 
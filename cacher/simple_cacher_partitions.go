@@ -0,0 +1,355 @@
+package cacher
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/tokenized/logger"
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/storage"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// errPartitionSplit is returned when retrieving a set partition that was split after its id was
+	// determined. The partition id must be determined again.
+	errPartitionSplit = errors.New("Partition split")
+)
+
+// partitionClaim is made before determining the id of a set partition so that the partition isn't
+// used if it is split before it is retrieved.
+type partitionClaim struct {
+	pathPrefix      string
+	splitGeneration uint64
+}
+
+// SetPartitioning sets the partitioner used to determine which storage object each set value is
+// stored in. It must be called before the cacher is used. Sets that were written with a different
+// partitioner must be rewritten with MigrateSet.
+func (c *SimpleCacher) SetPartitioning(partitioner SetPartitioner) {
+	c.partitioner = partitioner
+}
+
+// newPartitionClaim returns a claim that must be made before determining set partition ids.
+func (c *SimpleCacher) newPartitionClaim(pathPrefix string) *partitionClaim {
+	c.itemsLock.Lock()
+	defer c.itemsLock.Unlock()
+
+	return &partitionClaim{
+		pathPrefix:      pathPrefix,
+		splitGeneration: c.splitGeneration,
+	}
+}
+
+// checkClaim returns errPartitionSplit if the partition is being split, after the split completes,
+// or if a partition was split after the claim was made. It must be called while itemsLock is held
+// and unlocks it.
+func (c *SimpleCacher) checkClaim(ctx context.Context, path string, claim *partitionClaim) error {
+	done, isSplitting := c.splitting[path]
+	isValid := claim.splitGeneration == c.splitGeneration
+	c.itemsLock.Unlock()
+
+	if isSplitting {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		return errPartitionSplit
+	}
+
+	if !isValid {
+		return errPartitionSplit
+	}
+
+	return nil
+}
+
+// claimValid returns true if no partitions have been split since the claim was made. It must be
+// called while itemsLock is held.
+func (c *SimpleCacher) claimValid(path string, claim *partitionClaim) bool {
+	_, isSplitting := c.splitting[path]
+	return !isSplitting && claim.splitGeneration == c.splitGeneration
+}
+
+// reloadPartitions reloads the partitions of a set from storage and invalidates any claims if they
+// changed.
+func (c *SimpleCacher) reloadPartitions(ctx context.Context, claim *partitionClaim) error {
+	changed, err := c.partitioner.Reload(ctx, claim.pathPrefix)
+	if err != nil {
+		return errors.Wrap(err, "reload partitions")
+	}
+
+	if changed {
+		c.itemsLock.Lock()
+		c.splitGeneration++
+		c.itemsLock.Unlock()
+	}
+
+	return nil
+}
+
+// splitSet writes the values of a set partition to partitions with ids one byte longer, then
+// records the split with the partitioner and removes the original partition. It is called while
+// the partition's path is held, but not in the cache, so the partition isn't retrieved again until
+// the split completes. The new partitions and the partition layout are acquired from the
+// coordinator so no other instance holds them while they are written.
+func (c *SimpleCacher) splitSet(ctx context.Context, set *cacheSet) error {
+	set.Lock()
+	defer set.Unlock()
+
+	childLength := len(set.pathID) + 1
+	children := make(map[string]*cacheSet)
+	for hash, value := range set.values {
+		childID := hash[:childLength]
+		child, exists := children[string(childID)]
+		if !exists {
+			child = &cacheSet{
+				typ:        set.typ,
+				pathPrefix: set.pathPrefix,
+				pathID:     copyBytes(childID),
+				values:     make(map[bitcoin.Hash32]SetValue),
+			}
+			children[string(childID)] = child
+		}
+
+		child.values[hash] = value
+	}
+
+	for _, child := range children {
+		path := child.path()
+		if err := c.acquirePath(ctx, path); err != nil {
+			return errors.Wrapf(err, "acquire %x", child.pathID)
+		}
+
+		err := saveValue(ctx, c.store, path, child)
+		c.releasePath(ctx, path)
+		if err != nil {
+			return errors.Wrapf(err, "save %x", child.pathID)
+		}
+	}
+
+	layoutPath := partitionLayoutPath(set.pathPrefix)
+	if err := c.acquirePath(ctx, layoutPath); err != nil {
+		return errors.Wrap(err, "acquire layout")
+	}
+
+	err := c.partitioner.Split(ctx, set.pathPrefix, set.pathID)
+	c.releasePath(ctx, layoutPath)
+	if err != nil {
+		return errors.Wrap(err, "split")
+	}
+
+	if err := c.store.Remove(ctx, set.path()); err != nil &&
+		errors.Cause(err) != storage.ErrNotFound {
+		return errors.Wrap(err, "remove")
+	}
+
+	logger.InfoWithFields(ctx, []logger.Field{
+		logger.String("path", set.path()),
+		logger.Int("value_count", len(set.values)),
+		logger.Int("partition_count", len(children)),
+	}, "Split set partition")
+	return nil
+}
+
+// MigrateSet rewrites all of the values of a set in storage into the partitions specified by the
+// current partitioner. It is used after changing the partitioner of an existing set. None of the
+// set's values can be in use while it is migrated. The existing partitions, the partition layout,
+// and the new partitions are acquired from the coordinator so no other instance uses them during
+// the migration.
+func (c *SimpleCacher) MigrateSet(ctx context.Context, typ reflect.Type, pathPrefix string) error {
+	acquired := make(map[string]bool)
+	defer func() {
+		for path := range acquired {
+			c.releasePath(ctx, path)
+		}
+	}()
+
+	// Acquire the existing partitions. A partition can be split by another instance between when
+	// the partitions are listed and when they are acquired, so list them again until they don't
+	// change.
+	var paths []string
+	for attempt := 1; ; attempt++ {
+		listed, err := listPartitionPaths(ctx, c.store, pathPrefix)
+		if err != nil {
+			return errors.Wrap(err, "list")
+		}
+
+		for _, path := range listed {
+			if acquired[path] {
+				continue
+			}
+
+			if err := c.acquirePath(ctx, path); err != nil {
+				return errors.Wrapf(err, "acquire: %s", path)
+			}
+			acquired[path] = true
+		}
+
+		current, err := listPartitionPaths(ctx, c.store, pathPrefix)
+		if err != nil {
+			return errors.Wrap(err, "list")
+		}
+
+		if equalPaths(listed, current) {
+			paths = current
+			break
+		}
+
+		if attempt >= maxPartitionSplitRetries {
+			return errors.New("Set partitions changed during migration")
+		}
+	}
+
+	layoutPath := partitionLayoutPath(pathPrefix)
+	if err := c.acquirePath(ctx, layoutPath); err != nil {
+		return errors.Wrap(err, "acquire layout")
+	}
+	acquired[layoutPath] = true
+
+	c.itemsLock.Lock()
+	for path := range c.items {
+		if _, isPartition := partitionIDFromPath(pathPrefix, path); isPartition {
+			c.itemsLock.Unlock()
+			return fmt.Errorf("Set partition in use : %s", path)
+		}
+	}
+	c.itemsLock.Unlock()
+
+	// Read all values from existing partitions.
+	oldPaths := make(map[string]bool)
+	values := make(map[bitcoin.Hash32]SetValue)
+	for _, path := range paths {
+		pathID, _ := partitionIDFromPath(pathPrefix, path)
+		oldPaths[path] = true
+
+		b, err := c.store.Read(ctx, path)
+		if err != nil {
+			return errors.Wrapf(err, "read: %s", path)
+		}
+
+		set := &cacheSet{
+			typ:        typ,
+			pathPrefix: pathPrefix,
+			pathID:     pathID,
+		}
+		if err := set.Deserialize(bytes.NewReader(b)); err != nil {
+			return errors.Wrapf(err, "deserialize: %s", path)
+		}
+
+		for hash, value := range set.values {
+			values[hash] = value
+		}
+	}
+
+	// Group values by new partition, splitting partitions as needed.
+	var sets map[string]*cacheSet
+	for {
+		sets = make(map[string]*cacheSet)
+		for hash, value := range values {
+			pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, hash)
+			if err != nil {
+				return errors.Wrap(err, "partition")
+			}
+
+			set, exists := sets[string(pathID)]
+			if !exists {
+				set = &cacheSet{
+					typ:        typ,
+					pathPrefix: pathPrefix,
+					pathID:     pathID,
+					values:     make(map[bitcoin.Hash32]SetValue),
+				}
+				sets[string(pathID)] = set
+			}
+
+			set.values[hash] = value
+		}
+
+		splitCount := 0
+		for _, set := range sets {
+			if !c.partitioner.ShouldSplit(pathPrefix, set.pathID, len(set.values)) {
+				continue
+			}
+
+			if err := c.partitioner.Split(ctx, pathPrefix, set.pathID); err != nil {
+				return errors.Wrapf(err, "split %x", set.pathID)
+			}
+			splitCount++
+		}
+
+		if splitCount == 0 {
+			break
+		}
+	}
+
+	// Write new partitions before removing old partitions so values are never missing from
+	// storage.
+	for _, set := range sets {
+		path := set.path()
+		if !acquired[path] {
+			if err := c.acquirePath(ctx, path); err != nil {
+				return errors.Wrapf(err, "acquire: %s", path)
+			}
+			acquired[path] = true
+		}
+
+		if err := saveValue(ctx, c.store, path, set); err != nil {
+			return errors.Wrapf(err, "save: %s", path)
+		}
+		delete(oldPaths, path)
+	}
+
+	for path := range oldPaths {
+		if err := c.store.Remove(ctx, path); err != nil {
+			return errors.Wrapf(err, "remove: %s", path)
+		}
+	}
+
+	logger.InfoWithFields(ctx, []logger.Field{
+		logger.String("path_prefix", pathPrefix),
+		logger.Int("value_count", len(values)),
+		logger.Int("partition_count", len(sets)),
+	}, "Migrated set partitions")
+	return nil
+}
+
+// listPartitionPaths returns the sorted paths of the partitions of a set in storage.
+func listPartitionPaths(ctx context.Context, store storage.List,
+	pathPrefix string) ([]string, error) {
+
+	paths, err := store.List(ctx, pathPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for _, path := range paths {
+		if _, isPartition := partitionIDFromPath(pathPrefix, path); isPartition {
+			result = append(result, path)
+		}
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+func equalPaths(l, r []string) bool {
+	if len(l) != len(r) {
+		return false
+	}
+
+	for i := range l {
+		if l[i] != r[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -19,6 +19,10 @@ import (
 
 const (
 	cacheSetVersion = uint8(0)
+
+	// maxPartitionSplitRetries is the number of times the partitions of a set are listed again
+	// because they were split by another request while they were being retrieved.
+	maxPartitionSplitRetries = 10
 )
 
 var (
@@ -30,20 +34,34 @@ func (c *SimpleCacher) AddSetValue(ctx context.Context, typ reflect.Type, pathPr
 	value SetValue) (SetValue, error) {
 
 	hash := value.Hash()
-	pathID := hashPathID(hash)
-	emptySet := &cacheSet{
-		typ:        typ,
-		pathPrefix: pathPrefix,
-		pathID:     pathID,
-		values:     make(map[bitcoin.Hash32]SetValue),
-	}
-	emptySet.isModified.Store(true)
+	var path string
+	var item Value
+	for {
+		claim := c.newPartitionClaim(pathPrefix)
+		pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, hash)
+		if err != nil {
+			return nil, errors.Wrap(err, "partition")
+		}
 
-	path := setPath(pathPrefix, pathID)
+		emptySet := &cacheSet{
+			typ:        typ,
+			pathPrefix: pathPrefix,
+			pathID:     pathID,
+			values:     make(map[bitcoin.Hash32]SetValue),
+		}
+		emptySet.isModified.Store(true)
 
-	item, err := c.addValue(ctx, c.cacheSetType, path, emptySet, emptySet)
-	if err != nil {
-		return nil, errors.Wrap(err, "add")
+		path = setPath(pathPrefix, pathID)
+
+		item, err = c.addValue(ctx, c.cacheSetType, path, emptySet, emptySet, claim)
+		if errors.Cause(err) == errPartitionSplit {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "add")
+		}
+
+		break
 	}
 
 	set := item.(*cacheSet)
@@ -63,43 +81,87 @@ func (c *SimpleCacher) AddSetValue(ctx context.Context, typ reflect.Type, pathPr
 	set.MarkModified()
 	set.Unlock()
 
+	if err := c.addIndexEntries(ctx, typ, pathPrefix, []SetValue{value}); err != nil {
+		c.release(ctx, path)
+		return nil, errors.Wrap(err, "index")
+	}
+
 	return value, nil
 }
 
 func (c *SimpleCacher) AddMultiSetValue(ctx context.Context, typ reflect.Type, pathPrefix string,
 	values []SetValue) ([]SetValue, error) {
 
-	var createSets cacheSets
-	for _, value := range values {
-		createSets.add(pathPrefix, typ, value)
+	pathIDs := make([][]byte, len(values))
+	created := make([]bool, len(values)) // value was in a new set that was added to the cache
+	var sets cacheSets
+
+	// Values are partitioned again if their partition is split before it is retrieved. Partitions
+	// that have been retrieved can't be split until they are released.
+	pending := make([]int, len(values))
+	for i := range values {
+		pending[i] = i
 	}
 
-	sets := make(cacheSets, len(createSets))
-	paths := make([]string, len(createSets))
-	for i, set := range createSets {
-		emptySet := &cacheSet{
-			typ:        typ,
-			pathPrefix: pathPrefix,
-			pathID:     set.pathID,
-			values:     make(map[bitcoin.Hash32]SetValue),
+	for len(pending) > 0 {
+		claim := c.newPartitionClaim(pathPrefix)
+		var createSets cacheSets
+		for _, i := range pending {
+			pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, values[i].Hash())
+			if err != nil {
+				return nil, errors.Wrapf(err, "partition %d", i)
+			}
+			pathIDs[i] = pathID
+
+			if set, _ := sets.getSet(pathID); set == nil {
+				createSets.add(pathPrefix, pathID, typ, values[i])
+			}
 		}
-		emptySet.isModified.Store(true)
-		paths[i] = set.path()
 
-		v, err := c.addValue(ctx, c.cacheSetType, paths[i], emptySet, set)
-		if err != nil {
-			return nil, errors.Wrapf(err, "add %d", i)
+		var retry []int
+		for _, set := range createSets {
+			emptySet := &cacheSet{
+				typ:        typ,
+				pathPrefix: pathPrefix,
+				pathID:     set.pathID,
+				values:     make(map[bitcoin.Hash32]SetValue),
+			}
+			emptySet.isModified.Store(true)
+
+			v, err := c.addValue(ctx, c.cacheSetType, set.path(), emptySet, set, claim)
+			if errors.Cause(err) == errPartitionSplit {
+				for _, i := range pending {
+					if bytes.Equal(pathIDs[i], set.pathID) {
+						retry = append(retry, i)
+					}
+				}
+				continue
+			}
+			if err != nil {
+				return nil, errors.Wrapf(err, "add %x", set.pathID)
+			}
+
+			cached := v.(*cacheSet)
+			if cached == set {
+				for _, i := range pending {
+					if bytes.Equal(pathIDs[i], set.pathID) {
+						created[i] = true
+					}
+				}
+			}
+			sets = append(sets, cached)
 		}
-		sets[i] = v.(*cacheSet)
+
+		pending = retry
 	}
 
 	// Build resulting values from sets.
 	result := make([]SetValue, len(values))
 	setsUsed := make([]bool, len(sets))
+	var addedValues []SetValue
 	for i, value := range values {
 		hash := value.Hash()
-		pathID := hashPathID(hash)
-		set, setIndex := sets.getSet(pathID)
+		set, setIndex := sets.getSet(pathIDs[i])
 		if set == nil {
 			// This shouldn't be possible if AddMulti is functioning properly.
 			return nil, errors.New("Value Set Missing") // value set not within sets
@@ -109,11 +171,12 @@ func (c *SimpleCacher) AddMultiSetValue(ctx context.Context, typ reflect.Type, p
 		setsUsed[setIndex] = true
 
 		valueAdded := false
-		if createSets[setIndex] == set {
+		if created[i] {
 			// The entire set is new and already added so the value doesn't need to be added to the
 			// set.
 			valueAdded = true
 			result[i] = value
+			addedValues = append(addedValues, value)
 		}
 
 		set.Lock()
@@ -130,6 +193,7 @@ func (c *SimpleCacher) AddMultiSetValue(ctx context.Context, typ reflect.Type, p
 				set.values[hash] = value
 				value.ProvideMarkModified(set.MarkModified)
 				set.MarkModified()
+				addedValues = append(addedValues, value)
 			}
 		}
 
@@ -140,25 +204,44 @@ func (c *SimpleCacher) AddMultiSetValue(ctx context.Context, typ reflect.Type, p
 		set.Unlock()
 	}
 
+	if err := c.addIndexEntries(ctx, typ, pathPrefix, addedValues); err != nil {
+		c.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(values))
+		return nil, errors.Wrap(err, "index")
+	}
+
 	return result, nil
 }
 
 func (c *SimpleCacher) GetSetValue(ctx context.Context, typ reflect.Type, pathPrefix string,
 	hash bitcoin.Hash32) (SetValue, error) {
 
-	pathID := hashPathID(hash)
-	path := setPath(pathPrefix, pathID)
-	emptySet := &cacheSet{
-		typ:        typ,
-		pathPrefix: pathPrefix,
-		pathID:     pathID,
-		values:     make(map[bitcoin.Hash32]SetValue),
-	}
-	emptySet.isModified.Store(false)
+	var path string
+	var setValue Value
+	for {
+		claim := c.newPartitionClaim(pathPrefix)
+		pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, hash)
+		if err != nil {
+			return nil, errors.Wrap(err, "partition")
+		}
 
-	setValue, err := c.getValue(ctx, c.cacheSetType, path, emptySet)
-	if err != nil {
-		return nil, errors.Wrap(err, "response")
+		path = setPath(pathPrefix, pathID)
+		emptySet := &cacheSet{
+			typ:        typ,
+			pathPrefix: pathPrefix,
+			pathID:     pathID,
+			values:     make(map[bitcoin.Hash32]SetValue),
+		}
+		emptySet.isModified.Store(false)
+
+		setValue, err = c.getValue(ctx, c.cacheSetType, path, emptySet, claim)
+		if errors.Cause(err) == errPartitionSplit {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "response")
+		}
+
+		break
 	}
 
 	if setValue == nil {
@@ -169,7 +252,6 @@ func (c *SimpleCacher) GetSetValue(ctx context.Context, typ reflect.Type, pathPr
 	set.Lock()
 	value, exists := set.values[hash]
 	set.Unlock()
-	value.ProvideMarkModified(set.MarkModified)
 
 	if !exists {
 		// If a set didn't have the value requested then we aren't returning a value, so there will
@@ -178,6 +260,7 @@ func (c *SimpleCacher) GetSetValue(ctx context.Context, typ reflect.Type, pathPr
 		return nil, nil // value not within set
 	}
 
+	value.ProvideMarkModified(set.MarkModified)
 	return value, nil
 }
 
@@ -185,15 +268,26 @@ func (c *SimpleCacher) GetMultiSetValue(ctx context.Context, typ reflect.Type, p
 	hashes []bitcoin.Hash32) ([]SetValue, error) {
 
 	count := len(hashes)
-	pathIDs := make([][2]byte, count)
+	pathIDs := make([][]byte, count)
 	var getPaths []string
 	var sets cacheSets
 	for i, hash := range hashes {
-		pathID := hashPathID(hash)
-		path := setPath(pathPrefix, pathID)
+		for {
+			claim := c.newPartitionClaim(pathPrefix)
+			pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, hash)
+			if err != nil {
+				for _, set := range sets {
+					c.release(ctx, set.path())
+				}
+				return nil, errors.Wrap(err, "partition")
+			}
+			path := setPath(pathPrefix, pathID)
+
+			pathIDs[i] = pathID
+			if stringExists(getPaths, path) {
+				break
+			}
 
-		pathIDs[i] = pathID
-		if !stringExists(getPaths, path) {
 			emptySet := &cacheSet{
 				typ:        typ,
 				pathPrefix: pathPrefix,
@@ -202,10 +296,13 @@ func (c *SimpleCacher) GetMultiSetValue(ctx context.Context, typ reflect.Type, p
 			}
 			emptySet.isModified.Store(false)
 
-			v, err := c.getValue(ctx, c.cacheSetType, path, emptySet)
+			v, err := c.getValue(ctx, c.cacheSetType, path, emptySet, claim)
+			if errors.Cause(err) == errPartitionSplit {
+				continue
+			}
 			if err != nil {
-				for _, path := range getPaths {
-					c.release(ctx, path)
+				for _, set := range sets {
+					c.release(ctx, set.path())
 				}
 				return nil, errors.Wrap(err, "get set")
 			}
@@ -214,6 +311,7 @@ func (c *SimpleCacher) GetMultiSetValue(ctx context.Context, typ reflect.Type, p
 			if v != nil {
 				sets = append(sets, v.(*cacheSet))
 			}
+			break
 		}
 	}
 
@@ -255,12 +353,29 @@ func (c *SimpleCacher) GetMultiSetValue(ctx context.Context, typ reflect.Type, p
 func (c *SimpleCacher) ListMultiSetValue(ctx context.Context, typ reflect.Type,
 	pathPrefix string) ([]SetValue, error) {
 
+	for attempt := 1; ; attempt++ {
+		result, err := c.listMultiSetValue(ctx, typ, pathPrefix)
+		if errors.Cause(err) == errPartitionSplit && attempt < maxPartitionSplitRetries {
+			// A partition was split after the partitions were listed so list them again.
+			continue
+		}
+
+		return result, err
+	}
+}
+
+// listMultiSetValue returns all of the values in a set. errPartitionSplit is returned if a
+// partition was split after the partitions were listed.
+func (c *SimpleCacher) listMultiSetValue(ctx context.Context, typ reflect.Type,
+	pathPrefix string) ([]SetValue, error) {
+
 	sets := make(map[string]*cacheSet)
+	claim := c.newPartitionClaim(pathPrefix)
 
 	// Get any items that are in the cache.
 	c.itemsLock.Lock()
 	for path, item := range c.items {
-		if !strings.HasPrefix(path, pathPrefix) {
+		if _, isPartition := partitionIDFromPath(pathPrefix, path); !isPartition {
 			continue
 		}
 
@@ -287,28 +402,29 @@ func (c *SimpleCacher) ListMultiSetValue(ctx context.Context, typ reflect.Type,
 			continue // don't get paths that are already in sets.
 		}
 
-		pathID, err := pathIDFromPath(path)
-		if err != nil {
-			// Release all current items
-			for path := range sets {
-				c.release(ctx, path)
-			}
-			return nil, errors.Wrapf(err, "path id: %s", path)
+		pathID, isPartition := partitionIDFromPath(pathPrefix, path)
+		if !isPartition {
+			continue // not a set partition (index or layout)
 		}
 
 		emptySet := &cacheSet{
 			typ:        typ,
-			pathPrefix: path,
+			pathPrefix: pathPrefix,
 			pathID:     pathID,
 			values:     make(map[bitcoin.Hash32]SetValue),
 		}
 		emptySet.isModified.Store(false)
 
-		v, err := c.getValue(ctx, c.cacheSetType, path, emptySet)
+		v, err := c.getValue(ctx, c.cacheSetType, path, emptySet, claim)
 		if err != nil {
 			for path := range sets {
 				c.release(ctx, path)
 			}
+
+			if errors.Cause(err) == errPartitionSplit {
+				return nil, err
+			}
+
 			return nil, errors.Wrap(err, "get set")
 		}
 
@@ -343,7 +459,10 @@ func (c *SimpleCacher) ListMultiSetValue(ctx context.Context, typ reflect.Type,
 func (c *SimpleCacher) ReleaseSetValue(ctx context.Context, typ reflect.Type, pathPrefix string,
 	hash bitcoin.Hash32) error {
 
-	pathID := hashPathID(hash)
+	pathID, err := c.partitioner.PartitionID(ctx, pathPrefix, hash)
+	if err != nil {
+		return errors.Wrap(err, "partition")
+	}
 	path := setPath(pathPrefix, pathID)
 
 	c.itemsLock.Lock()
@@ -387,7 +506,7 @@ type cacheSet struct {
 	typ reflect.Type
 
 	pathPrefix string
-	pathID     [2]byte
+	pathID     []byte
 
 	values map[bitcoin.Hash32]SetValue
 
@@ -492,9 +611,8 @@ func (set *cacheSet) Deserialize(r io.Reader) error {
 	return nil
 }
 
-func (sets *cacheSets) add(pathPrefix string, typ reflect.Type, value SetValue) {
+func (sets *cacheSets) add(pathPrefix string, pathID []byte, typ reflect.Type, value SetValue) {
 	hash := value.Hash()
-	pathID := hashPathID(hash)
 
 	for _, set := range *sets {
 		set.Lock()
@@ -525,7 +643,7 @@ func (sets *cacheSets) add(pathPrefix string, typ reflect.Type, value SetValue)
 	*sets = append(*sets, set)
 }
 
-func (sets *cacheSets) getSet(pathID [2]byte) (*cacheSet, int) {
+func (sets *cacheSets) getSet(pathID []byte) (*cacheSet, int) {
 	for i, set := range *sets {
 		set.Lock()
 		if !bytes.Equal(set.pathID[:], pathID[:]) {
@@ -540,37 +658,36 @@ func (sets *cacheSets) getSet(pathID [2]byte) (*cacheSet, int) {
 	return nil, 0
 }
 
-func hashPathID(hash bitcoin.Hash32) [2]byte {
-	var pathID [2]byte
-	copy(pathID[:], hash[:])
-	return pathID
-}
-
-func setPath(pathPrefix string, pathID [2]byte) string {
+func setPath(pathPrefix string, pathID []byte) string {
 	return fmt.Sprintf("%s/%x", pathPrefix, pathID)
 }
 
-func pathIDFromPath(path string) ([2]byte, error) {
-	var result [2]byte
+// partitionIDFromPath returns the partition id of a set partition path and true, or false if the
+// path is not a partition directly within the path prefix.
+func partitionIDFromPath(pathPrefix, path string) ([]byte, bool) {
+	if !strings.HasPrefix(path, pathPrefix+"/") {
+		return nil, false
+	}
 
-	parts := strings.Split(path, "/")
-	l := len(parts)
-	if l < 2 {
-		return result, fmt.Errorf("Not enough parts: %s", path)
+	name := path[len(pathPrefix)+1:]
+	if len(name) == 0 || strings.Contains(name, "/") {
+		return nil, false
 	}
 
-	lastPart := parts[l-1]
-	b, err := hex.DecodeString(lastPart)
+	b, err := hex.DecodeString(name)
 	if err != nil {
-		return result, errors.Wrap(err, "hex")
+		return nil, false
 	}
 
-	if len(b) != 2 {
-		fmt.Errorf("Wrong size path ID: %s", path)
-	}
+	return b, true
+}
 
-	copy(result[:], b)
-	return result, nil
+func hashes(values []SetValue) []bitcoin.Hash32 {
+	result := make([]bitcoin.Hash32, len(values))
+	for i, value := range values {
+		result[i] = value.Hash()
+	}
+	return result
 }
 
 func stringExists(list []string, value string) bool {
@@ -0,0 +1,180 @@
+package cacher
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tokenized/logger"
+)
+
+// TypeStats contains statistics about the cacher's use of values of one type. Set values are
+// reported by the type of the values in the set.
+type TypeStats struct {
+	Hits            uint64        `json:"hits"`             // requests for values already cached
+	Misses          uint64        `json:"misses"`           // requests for values not cached
+	NotFound        uint64        `json:"not_found"`        // misses that were not in storage
+	StorageReads    uint64        `json:"storage_reads"`    // successful reads from storage
+	StorageWrites   uint64        `json:"storage_writes"`   // successful writes to storage
+	DeserializeTime time.Duration `json:"deserialize_time"` // total time deserializing reads
+
+	// Current state of the cache.
+	CachedCount int  `json:"cached_count"` // number of items in memory
+	Users       uint `json:"users"`        // total users of items in memory
+}
+
+// CachedItem describes an item that is currently held in memory by the cacher.
+type CachedItem struct {
+	Path      string    `json:"path"`
+	Type      string    `json:"type"`
+	Users     uint      `json:"users"`
+	HeldSince time.Time `json:"held_since"` // when the item's user count became non-zero
+}
+
+type cacherStats struct {
+	types map[reflect.Type]*TypeStats
+	sync.Mutex
+}
+
+func newCacherStats() *cacherStats {
+	return &cacherStats{
+		types: make(map[reflect.Type]*TypeStats),
+	}
+}
+
+// Stats returns a snapshot of the statistics for each type of value used with the cacher, keyed by
+// type name.
+func (c *SimpleCacher) Stats() map[string]TypeStats {
+	result := make(map[string]TypeStats)
+
+	c.stats.Lock()
+	for typ, stats := range c.stats.types {
+		result[typ.String()] = *stats
+	}
+	c.stats.Unlock()
+
+	for _, item := range c.CachedItems() {
+		stats := result[item.Type]
+		stats.CachedCount++
+		stats.Users += item.Users
+		result[item.Type] = stats
+	}
+
+	return result
+}
+
+// CachedItems returns the items currently held in memory, sorted by path.
+func (c *SimpleCacher) CachedItems() []CachedItem {
+	c.itemsLock.Lock()
+	result := make([]CachedItem, 0, len(c.items))
+	for path, item := range c.items {
+		users := item.users
+		if set, isSet := item.value.(*cacheSet); isSet {
+			set.Lock()
+			users += set.extraUsers
+			set.Unlock()
+		}
+
+		result = append(result, CachedItem{
+			Path:      path,
+			Type:      item.typ.String(),
+			Users:     users,
+			HeldSince: item.heldSince,
+		})
+	}
+	c.itemsLock.Unlock()
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+
+	return result
+}
+
+// LongHeldItems returns the items that have had a non-zero user count for longer than threshold,
+// oldest first. These are usually the result of a Get or AddUser without a matching Release.
+func (c *SimpleCacher) LongHeldItems(threshold time.Duration) []CachedItem {
+	now := time.Now()
+	var result []CachedItem
+	for _, item := range c.CachedItems() {
+		if now.Sub(item.HeldSince) > threshold {
+			result = append(result, item)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].HeldSince.Before(result[j].HeldSince)
+	})
+
+	return result
+}
+
+// LogLongHeldItems logs a warning for each item that has had a non-zero user count for longer than
+// threshold and returns the number of items logged.
+func (c *SimpleCacher) LogLongHeldItems(ctx context.Context, threshold time.Duration) int {
+	items := c.LongHeldItems(threshold)
+	for _, item := range items {
+		logger.WarnWithFields(ctx, []logger.Field{
+			logger.String("path", item.Path),
+			logger.String("type", item.Type),
+			logger.Uint64("users", uint64(item.Users)),
+			logger.Timestamp("held_since", item.HeldSince.UnixNano()),
+			logger.MillisecondsFromNano("held_ms", time.Since(item.HeldSince).Nanoseconds()),
+		}, "Cache item held longer than threshold")
+	}
+
+	return len(items)
+}
+
+func (s *cacherStats) get(typ reflect.Type) *TypeStats {
+	stats, exists := s.types[typ]
+	if !exists {
+		stats = &TypeStats{}
+		s.types[typ] = stats
+	}
+	return stats
+}
+
+func (s *cacherStats) hit(typ reflect.Type) {
+	s.Lock()
+	s.get(typ).Hits++
+	s.Unlock()
+}
+
+func (s *cacherStats) miss(typ reflect.Type) {
+	s.Lock()
+	s.get(typ).Misses++
+	s.Unlock()
+}
+
+func (s *cacherStats) notFound(typ reflect.Type) {
+	s.Lock()
+	s.get(typ).NotFound++
+	s.Unlock()
+}
+
+func (s *cacherStats) read(typ reflect.Type, deserializeTime time.Duration) {
+	s.Lock()
+	stats := s.get(typ)
+	stats.StorageReads++
+	stats.DeserializeTime += deserializeTime
+	s.Unlock()
+}
+
+func (s *cacherStats) write(typ reflect.Type) {
+	s.Lock()
+	s.get(typ).StorageWrites++
+	s.Unlock()
+}
+
+// statsType returns the type used for statistics about a value. Sets are reported by the type of
+// the values they contain.
+func statsType(value Value) reflect.Type {
+	if set, isSet := value.(*cacheSet); isSet {
+		return set.typ
+	}
+
+	return reflect.TypeOf(value)
+}
@@ -2,11 +2,16 @@ package cacher
 
 import (
 	"context"
+	"reflect"
 	"testing"
 	"time"
 
 	"github.com/tokenized/logger"
+	"github.com/tokenized/pkg/bitcoin"
 	"github.com/tokenized/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
 )
 
 func Test_NotFound(t *testing.T) {
@@ -58,3 +63,641 @@ func Test_ListSets(t *testing.T) {
 
 	RunTest_ListSets(ctx, t, cache)
 }
+
+// Test_Coordinated tests that a second cacher instance sharing the same storage waits for the first
+// instance to release an item before reading it, so it sees the first instance's modifications.
+func Test_Coordinated(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	leases := NewMockLeases()
+
+	cache1 := NewSimpleCache(store)
+	coordinator1 := NewMockCoordinator(leases)
+	cache1.SetCoordinator(coordinator1)
+
+	cache2 := NewSimpleCache(store)
+	cache2.SetCoordinator(NewMockCoordinator(leases))
+
+	typ := reflect.TypeOf(&TestItem{})
+	item := &TestItem{
+		Value: "first value",
+	}
+	item.isModified.Store(true)
+	path := item.path()
+
+	if _, err := cache1.Add(ctx, typ, path, item); err != nil {
+		t.Fatalf("Failed to add item : %s", err)
+	}
+
+	if id, held := leases.Holder(path); !held || id != coordinator1.ID() {
+		t.Fatalf("Path should be held by first instance")
+	}
+
+	got := make(chan Value, 1)
+	errs := make(chan error, 1)
+	go func() {
+		value, err := cache2.Get(ctx, typ, path)
+		if err != nil {
+			errs <- err
+			return
+		}
+		got <- value
+	}()
+
+	select {
+	case <-got:
+		t.Fatalf("Second instance should not get item while first instance holds it")
+	case err := <-errs:
+		t.Fatalf("Failed to get item : %s", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	item.Lock()
+	item.Value = "second value"
+	item.MarkModified()
+	item.Unlock()
+
+	cache1.Release(ctx, path)
+
+	var gotValue Value
+	select {
+	case gotValue = <-got:
+	case err := <-errs:
+		t.Fatalf("Failed to get item : %s", err)
+	case <-time.After(time.Second):
+		t.Fatalf("Second instance didn't get item after first instance released it")
+	}
+
+	if gotValue == nil {
+		t.Fatalf("Item not found")
+	}
+
+	gotItem := gotValue.(*TestItem)
+	if gotItem.Value != "second value" {
+		t.Errorf("Wrong item value : got %s, want %s", gotItem.Value, "second value")
+	}
+
+	cache2.Release(ctx, path)
+
+	if _, held := leases.Holder(path); held {
+		t.Errorf("Path should not be held after release")
+	}
+}
+
+func Test_LeaseLost(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	leases := NewMockLeases()
+
+	cache1 := NewSimpleCache(store)
+	cache1.SetCoordinator(NewMockCoordinator(leases))
+
+	cache2 := NewSimpleCache(store)
+	coordinator2 := NewMockCoordinator(leases)
+	cache2.SetCoordinator(coordinator2)
+
+	typ := reflect.TypeOf(&TestItem{})
+	item := &TestItem{
+		Value: "first value",
+	}
+	item.isModified.Store(true)
+	path := item.path()
+
+	if _, err := cache1.Add(ctx, typ, path, item); err != nil {
+		t.Fatalf("Failed to add item : %s", err)
+	}
+	cache1.Save(ctx, path, item)
+
+	leases.Expire(ctx, path)
+
+	// The second instance acquires the path and modifies the item.
+	gotValue, err := cache2.Get(ctx, typ, path)
+	if err != nil {
+		t.Fatalf("Failed to get item : %s", err)
+	}
+	if gotValue == nil {
+		t.Fatalf("Item not found")
+	}
+
+	gotItem := gotValue.(*TestItem)
+	gotItem.Lock()
+	gotItem.Value = "second value"
+	gotItem.MarkModified()
+	gotItem.Unlock()
+
+	// The first instance's changes to the item it lost are discarded.
+	item.Lock()
+	item.Value = "stale value"
+	item.MarkModified()
+	item.Unlock()
+	cache1.Release(ctx, path)
+
+	cache2.Release(ctx, path)
+
+	if !cache1.IsEmpty(ctx) {
+		t.Errorf("Lost item should be removed after release")
+	}
+
+	if id, held := leases.Holder(path); held {
+		t.Errorf("Path should not be held after release : %s", id)
+	}
+
+	// Both instances read the second instance's value.
+	for i, cache := range []*SimpleCacher{cache1, cache2} {
+		value, err := cache.Get(ctx, typ, path)
+		if err != nil {
+			t.Fatalf("Failed to get item : %s", err)
+		}
+
+		if got := value.(*TestItem).Value; got != "second value" {
+			t.Errorf("Wrong value in instance %d : got %s, want %s", i+1, got, "second value")
+		}
+		cache.Release(ctx, path)
+	}
+}
+
+func Test_CopyRecursive_Coordinated(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	leases := NewMockLeases()
+
+	cache1 := NewSimpleCache(store)
+	coordinator1 := NewMockCoordinator(leases)
+	cache1.SetCoordinator(coordinator1)
+
+	cache2 := NewSimpleCache(store)
+	cache2.SetCoordinator(NewMockCoordinator(leases))
+
+	typ := reflect.TypeOf(&TestItem{})
+	names := []string{"a", "b"}
+	for _, name := range names {
+		item := &TestItem{
+			Value: "value " + name,
+		}
+		item.isModified.Store(true)
+
+		if _, err := cache1.Add(ctx, typ, "from/"+name, item); err != nil {
+			t.Fatalf("Failed to add item : %s", err)
+		}
+	}
+
+	if err := cache1.CopyRecursive(ctx, "from/", "to/"); err != nil {
+		t.Fatalf("Failed to copy : %s", err)
+	}
+
+	for _, name := range names {
+		// The source items are still held by the first instance.
+		if id, held := leases.Holder("from/" + name); !held || id != coordinator1.ID() {
+			t.Errorf("Source path should still be held by first instance : %s", name)
+		}
+
+		got := make(chan Value, 1)
+		errs := make(chan error, 1)
+		go func() {
+			value, err := cache2.Get(ctx, typ, "to/"+name)
+			if err != nil {
+				errs <- err
+				return
+			}
+			got <- value
+		}()
+
+		var gotValue Value
+		select {
+		case gotValue = <-got:
+		case err := <-errs:
+			t.Fatalf("Failed to get item : %s", err)
+		case <-time.After(time.Second):
+			t.Fatalf("Second instance couldn't get copied item : %s", name)
+		}
+
+		if gotValue == nil {
+			t.Fatalf("Copied item not found : %s", name)
+		}
+
+		if gotItem := gotValue.(*TestItem); gotItem.Value != "value "+name {
+			t.Errorf("Wrong copied value : got %s, want %s", gotItem.Value, "value "+name)
+		}
+
+		cache2.Release(ctx, "to/"+name)
+		cache1.Release(ctx, "from/"+name)
+	}
+}
+
+func Test_ListSets_Split(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	cache := NewSimpleCache(store)
+	cache.SetPartitioning(NewSplitPartitioner(store, 1, 3, 10))
+
+	RunTest_ListSets(ctx, t, cache)
+
+	paths, err := store.List(ctx, "sets")
+	if err != nil {
+		t.Fatalf("Failed to list storage : %s", err)
+	}
+
+	splitCount := 0
+	for _, path := range paths {
+		pathID, isPartition := partitionIDFromPath("sets", path)
+		if !isPartition {
+			continue
+		}
+
+		if len(pathID) > 1 {
+			splitCount++
+		}
+	}
+
+	if splitCount == 0 {
+		t.Errorf("No partitions were split")
+	}
+	t.Logf("%d split partitions", splitCount)
+}
+
+func Test_Split_Coordinated(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	leases := NewMockLeases()
+
+	cache1 := NewSimpleCache(store)
+	cache1.SetCoordinator(NewMockCoordinator(leases))
+	cache1.SetPartitioning(NewSplitPartitioner(store, 1, 3, 10))
+
+	cache2 := NewSimpleCache(store)
+	cache2.SetCoordinator(NewMockCoordinator(leases))
+	cache2.SetPartitioning(NewSplitPartitioner(store, 1, 3, 10))
+
+	typ := reflect.TypeOf(&TestSetValue{})
+	pathPrefix := "sets"
+
+	// Create values that are all in the same partition.
+	var values []SetValue
+	for len(values) < 21 {
+		value := &TestSetValue{
+			Name:  uuid.New().String(),
+			Value: uuid.New().String(),
+		}
+		if hash := value.Hash(); hash[0] == 0x01 {
+			values = append(values, value)
+		}
+	}
+	parentPath := setPath(pathPrefix, []byte{0x01})
+
+	// The second instance loads the layout before the partition is split.
+	notFound, err := cache2.GetSetValue(ctx, typ, pathPrefix, values[20].Hash())
+	if err != nil {
+		t.Fatalf("Failed to get set value : %s", err)
+	}
+	if notFound != nil {
+		t.Fatalf("Set value should not be found")
+	}
+
+	if _, err := cache1.AddMultiSetValue(ctx, typ, pathPrefix, values[:20]); err != nil {
+		t.Fatalf("Failed to add set values : %s", err)
+	}
+	cache1.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(values[:20]))
+
+	if _, err := store.Read(ctx, parentPath); errors.Cause(err) != storage.ErrNotFound {
+		t.Fatalf("Split partition should be removed : %v", err)
+	}
+
+	// The second instance must use the new partitions even though it loaded the layout before the
+	// split.
+	if _, err := cache2.AddSetValue(ctx, typ, pathPrefix, values[20]); err != nil {
+		t.Fatalf("Failed to add set value : %s", err)
+	}
+	cache2.ReleaseSetValue(ctx, typ, pathPrefix, values[20].Hash())
+
+	if _, err := store.Read(ctx, parentPath); errors.Cause(err) != storage.ErrNotFound {
+		t.Fatalf("Split partition should not be recreated : %v", err)
+	}
+
+	for i, cache := range []*SimpleCacher{cache1, cache2} {
+		gotValues, err := cache.GetMultiSetValue(ctx, typ, pathPrefix, hashes(values))
+		if err != nil {
+			t.Fatalf("Failed to get set values : %s", err)
+		}
+
+		for j, value := range gotValues {
+			if value == nil {
+				t.Errorf("Cache %d value %d not found", i, j)
+			}
+		}
+
+		cache.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(values))
+
+		if !cache.IsEmpty(ctx) {
+			t.Errorf("Cache %d should be empty : %v", i, cache.ListCached(ctx))
+		}
+	}
+
+	paths, err := store.List(ctx, pathPrefix)
+	if err != nil {
+		t.Fatalf("Failed to list storage : %s", err)
+	}
+
+	for _, path := range paths {
+		if _, held := leases.Holder(path); held {
+			t.Errorf("Path should not be held : %s", path)
+		}
+	}
+}
+
+func Test_MigrateSet(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	cache := NewSimpleCache(store)
+
+	typ := reflect.TypeOf(&TestSetValue{})
+	pathPrefix := "sets"
+
+	count := 500
+	var hashes []bitcoin.Hash32
+	for i := 0; i < count; i++ {
+		value := &TestSetValue{
+			Name:  uuid.New().String(),
+			Value: uuid.New().String(),
+		}
+		hashes = append(hashes, value.Hash())
+
+		if _, err := cache.AddSetValue(ctx, typ, pathPrefix, value); err != nil {
+			t.Fatalf("Failed to add set value : %s", err)
+		}
+
+		cache.ReleaseSetValue(ctx, typ, pathPrefix, value.Hash())
+	}
+
+	cache.SetPartitioning(NewPrefixPartitioner(1))
+	if err := cache.MigrateSet(ctx, typ, pathPrefix); err != nil {
+		t.Fatalf("Failed to migrate set : %s", err)
+	}
+
+	paths, err := store.List(ctx, pathPrefix)
+	if err != nil {
+		t.Fatalf("Failed to list storage : %s", err)
+	}
+
+	for _, path := range paths {
+		pathID, isPartition := partitionIDFromPath(pathPrefix, path)
+		if isPartition && len(pathID) != 1 {
+			t.Errorf("Wrong partition id size : got %d, want %d", len(pathID), 1)
+		}
+	}
+
+	values, err := cache.GetMultiSetValue(ctx, typ, pathPrefix, hashes)
+	if err != nil {
+		t.Fatalf("Failed to get set values : %s", err)
+	}
+
+	for i, value := range values {
+		if value == nil {
+			t.Errorf("Value %d not found after migrate", i)
+		}
+	}
+
+	cache.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes)
+}
+
+func Test_MigrateSet_Coordinated(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	leases := NewMockLeases()
+
+	cache1 := NewSimpleCache(store)
+	cache1.SetCoordinator(NewMockCoordinator(leases))
+
+	cache2 := NewSimpleCache(store)
+	cache2.SetCoordinator(NewMockCoordinator(leases))
+
+	typ := reflect.TypeOf(&TestSetValue{})
+	pathPrefix := "sets"
+
+	count := 100
+	var hashes []bitcoin.Hash32
+	for i := 0; i < count; i++ {
+		value := &TestSetValue{
+			Name:  uuid.New().String(),
+			Value: uuid.New().String(),
+		}
+		hashes = append(hashes, value.Hash())
+
+		if _, err := cache1.AddSetValue(ctx, typ, pathPrefix, value); err != nil {
+			t.Fatalf("Failed to add set value : %s", err)
+		}
+
+		cache1.ReleaseSetValue(ctx, typ, pathPrefix, value.Hash())
+	}
+
+	// The second instance holds a partition so the migration must wait for it.
+	if _, err := cache2.GetSetValue(ctx, typ, pathPrefix, hashes[0]); err != nil {
+		t.Fatalf("Failed to get set value : %s", err)
+	}
+
+	cache1.SetPartitioning(NewPrefixPartitioner(1))
+	migrated := make(chan error, 1)
+	go func() {
+		migrated <- cache1.MigrateSet(ctx, typ, pathPrefix)
+	}()
+
+	select {
+	case err := <-migrated:
+		t.Fatalf("Migrate should wait for partition held by other instance : %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	cache2.ReleaseSetValue(ctx, typ, pathPrefix, hashes[0])
+
+	select {
+	case err := <-migrated:
+		if err != nil {
+			t.Fatalf("Failed to migrate set : %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Migrate didn't complete after partition was released")
+	}
+
+	paths, err := store.List(ctx, pathPrefix)
+	if err != nil {
+		t.Fatalf("Failed to list storage : %s", err)
+	}
+
+	for _, path := range paths {
+		if _, held := leases.Holder(path); held {
+			t.Errorf("Path should not be held : %s", path)
+		}
+
+		pathID, isPartition := partitionIDFromPath(pathPrefix, path)
+		if isPartition && len(pathID) != 1 {
+			t.Errorf("Wrong partition id size : got %d, want %d", len(pathID), 1)
+		}
+	}
+
+	values, err := cache1.GetMultiSetValue(ctx, typ, pathPrefix, hashes)
+	if err != nil {
+		t.Fatalf("Failed to get set values : %s", err)
+	}
+
+	for i, value := range values {
+		if value == nil {
+			t.Errorf("Value %d not found after migrate", i)
+		}
+	}
+
+	cache1.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes)
+}
+
+func Test_SetIndex(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	cache := NewSimpleCache(store)
+
+	typ := reflect.TypeOf(&TestSetValue{})
+	pathPrefix := "sets"
+
+	if err := cache.RegisterSetIndex(typ, "value"); err != nil {
+		t.Fatalf("Failed to register index : %s", err)
+	}
+
+	var values []SetValue
+	for i := 0; i < 100; i++ {
+		values = append(values, &TestSetValue{
+			Name:  uuid.New().String(),
+			Value: uuid.New().String(),
+		})
+	}
+
+	if _, err := cache.AddMultiSetValue(ctx, typ, pathPrefix, values); err != nil {
+		t.Fatalf("Failed to add set values : %s", err)
+	}
+	cache.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(values))
+
+	for _, value := range values {
+		item := value.(*TestSetValue)
+		gotValue, err := cache.GetSetValueByIndex(ctx, typ, pathPrefix, "value",
+			[]byte(item.Value))
+		if err != nil {
+			t.Fatalf("Failed to get set value by index : %s", err)
+		}
+
+		if gotValue == nil {
+			t.Fatalf("Set value not found by index : %s", item.Value)
+		}
+
+		gotItem := gotValue.(*TestSetValue)
+		if gotItem.Name != item.Name {
+			t.Errorf("Wrong set value name : got %s, want %s", gotItem.Name, item.Name)
+		}
+
+		cache.ReleaseSetValue(ctx, typ, pathPrefix, gotValue.Hash())
+	}
+
+	notFound, err := cache.GetSetValueByIndex(ctx, typ, pathPrefix, "value", []byte("missing"))
+	if err != nil {
+		t.Fatalf("Failed to get set value by index : %s", err)
+	}
+
+	if notFound != nil {
+		t.Errorf("Set value should not be found")
+	}
+
+	// Index sets should not be included when listing the set.
+	listed, err := cache.ListMultiSetValue(ctx, typ, pathPrefix)
+	if err != nil {
+		t.Fatalf("Failed to list set values : %s", err)
+	}
+
+	if len(listed) != len(values) {
+		t.Errorf("Wrong listed value count : got %d, want %d", len(listed), len(values))
+	}
+
+	cache.ReleaseMultiSetValue(ctx, typ, pathPrefix, hashes(listed))
+
+	if !cache.IsEmpty(ctx) {
+		t.Errorf("Cache should be empty : %v", cache.ListCached(ctx))
+	}
+}
+
+func Test_Stats(t *testing.T) {
+	ctx := logger.ContextWithLogger(context.Background(), true, true, "")
+	store := storage.NewMockStorage()
+	cache := NewSimpleCache(store)
+
+	typ := reflect.TypeOf(&TestItem{})
+	item := &TestItem{
+		Value: "test value",
+	}
+	item.isModified.Store(true)
+	path := item.path()
+
+	if _, err := cache.Add(ctx, typ, path, item); err != nil {
+		t.Fatalf("Failed to add item : %s", err)
+	}
+	cache.Release(ctx, path) // written to storage
+
+	if _, err := cache.Get(ctx, typ, path); err != nil { // read from storage
+		t.Fatalf("Failed to get item : %s", err)
+	}
+
+	if _, err := cache.Get(ctx, typ, path); err != nil { // already cached
+		t.Fatalf("Failed to get item : %s", err)
+	}
+
+	if _, err := cache.Get(ctx, typ, GetTestItemPath(bitcoin.Hash32{})); err != nil {
+		t.Fatalf("Failed to get item : %s", err)
+	}
+
+	stats, exists := cache.Stats()[typ.String()]
+	if !exists {
+		t.Fatalf("Missing stats for %s", typ)
+	}
+	t.Logf("Stats : %+v", stats)
+
+	if stats.Hits != 1 {
+		t.Errorf("Wrong hits : got %d, want %d", stats.Hits, 1)
+	}
+	if stats.Misses != 3 {
+		t.Errorf("Wrong misses : got %d, want %d", stats.Misses, 3)
+	}
+	if stats.NotFound != 2 {
+		t.Errorf("Wrong not found : got %d, want %d", stats.NotFound, 2)
+	}
+	if stats.StorageReads != 1 {
+		t.Errorf("Wrong storage reads : got %d, want %d", stats.StorageReads, 1)
+	}
+	if stats.StorageWrites != 1 {
+		t.Errorf("Wrong storage writes : got %d, want %d", stats.StorageWrites, 1)
+	}
+	if stats.CachedCount != 1 {
+		t.Errorf("Wrong cached count : got %d, want %d", stats.CachedCount, 1)
+	}
+	if stats.Users != 2 {
+		t.Errorf("Wrong users : got %d, want %d", stats.Users, 2)
+	}
+
+	if longHeld := cache.LongHeldItems(time.Second); len(longHeld) != 0 {
+		t.Errorf("Item should not be held longer than threshold yet")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	longHeld := cache.LongHeldItems(10 * time.Millisecond)
+	if len(longHeld) != 1 {
+		t.Fatalf("Wrong long held count : got %d, want %d", len(longHeld), 1)
+	}
+
+	if longHeld[0].Path != path {
+		t.Errorf("Wrong long held path : got %s, want %s", longHeld[0].Path, path)
+	}
+
+	if count := cache.LogLongHeldItems(ctx, 10*time.Millisecond); count != 1 {
+		t.Errorf("Wrong logged count : got %d, want %d", count, 1)
+	}
+
+	cache.Release(ctx, path)
+	cache.Release(ctx, path)
+
+	if longHeld := cache.LongHeldItems(0); len(longHeld) != 0 {
+		t.Errorf("No items should be held after release")
+	}
+}
@@ -450,6 +450,15 @@ func (v *TestSetValue) Hash() bitcoin.Hash32 {
 	return bitcoin.Hash32(sha256.Sum256([]byte(v.Name)))
 }
 
+// IndexKey implements IndexedSetValue with an index named "value".
+func (v *TestSetValue) IndexKey(index string) []byte {
+	if index != "value" {
+		return nil
+	}
+
+	return []byte(v.Value)
+}
+
 func (i *TestSetValue) CacheSetCopy() SetValue {
 	return &TestSetValue{
 		Name:  i.Name,
@@ -0,0 +1,432 @@
+// Code generated by "bsor generate". DO NOT EDIT.
+
+package expanded_tx
+
+import (
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+	"github.com/tokenized/pkg/json_envelope"
+	"github.com/tokenized/pkg/merkle_proof"
+	"github.com/tokenized/pkg/wire"
+
+	"github.com/pkg/errors"
+)
+
+// MarshalBSOR writes the field count followed by the fields of ExpandedTx.
+func (v ExpandedTx) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := 0
+	if v.Tx != nil {
+		fieldCount++
+	}
+	if v.Ancestors != nil {
+		fieldCount++
+	}
+	if v.SpentOutputs != nil {
+		fieldCount++
+	}
+	if v.MerkleProofs != nil {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Tx != nil {
+		fieldWriter := encoder.StartField(1)
+		b1, err := v.Tx.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "Tx binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b1))
+		encoder.EndField()
+	}
+
+	if v.Ancestors != nil {
+		fieldWriter := encoder.StartField(2)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.Ancestors))))
+		for i2, item3 := range v.Ancestors {
+			if item3 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				if err := item3.MarshalBSOR(fieldWriter, options); err != nil {
+					return errors.Wrapf(err, "Ancestors item %d", i2)
+				}
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.SpentOutputs != nil {
+		fieldWriter := encoder.StartField(3)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.SpentOutputs))))
+		for i4, item5 := range v.SpentOutputs {
+			if item5 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				if err := item5.MarshalBSOR(fieldWriter, options); err != nil {
+					return errors.Wrapf(err, "SpentOutputs item %d", i4)
+				}
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.MerkleProofs != nil {
+		fieldWriter := encoder.StartField(4)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.MerkleProofs))))
+		for i6, item7 := range v.MerkleProofs {
+			if item7 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				b8, err := item7.MarshalBinary()
+				if err != nil {
+					return errors.Wrapf(err, "MerkleProofs item %d binary marshal", i6)
+				}
+				fieldWriter.Add(bitcoin.NewPushDataScriptItem(b8))
+			}
+		}
+		encoder.EndField()
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of ExpandedTx.
+func (v *ExpandedTx) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	_, err := bsor.UnmarshalFields(r, options, "ExpandedTx",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				value := new(wire.MsgTx)
+				b9, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Tx bytes")
+				}
+				if err := (*value).UnmarshalBinary(b9); err != nil {
+					return true, errors.Wrap(err, "Tx binary unmarshal")
+				}
+				v.Tx = value
+
+			case 2:
+				var value AncestorTxs
+				count10, capacity11, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Ancestors count")
+				}
+				value = make(AncestorTxs, 0, capacity11)
+				for i12 := uint64(0); i12 < count10; i12++ {
+					var item13 *AncestorTx
+					notNil14, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "Ancestors item %d not nil", i12)
+					}
+					if notNil14 != 0 {
+						empty16, err := bsor.SkipEmptyObject(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "Ancestors item %d", i12)
+						}
+						if !empty16 {
+							item15 := new(AncestorTx)
+							if err := item15.UnmarshalBSOR(fieldReader, options); err != nil {
+								return true, errors.Wrapf(err, "Ancestors item %d", i12)
+							}
+							item13 = item15
+						}
+					}
+					value = append(value, item13)
+				}
+				v.Ancestors = value
+
+			case 3:
+				var value Outputs
+				count17, capacity18, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "SpentOutputs count")
+				}
+				value = make(Outputs, 0, capacity18)
+				for i19 := uint64(0); i19 < count17; i19++ {
+					var item20 *Output
+					notNil21, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "SpentOutputs item %d not nil", i19)
+					}
+					if notNil21 != 0 {
+						empty23, err := bsor.SkipEmptyObject(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "SpentOutputs item %d", i19)
+						}
+						if !empty23 {
+							item22 := new(Output)
+							if err := item22.UnmarshalBSOR(fieldReader, options); err != nil {
+								return true, errors.Wrapf(err, "SpentOutputs item %d", i19)
+							}
+							item20 = item22
+						}
+					}
+					value = append(value, item20)
+				}
+				v.SpentOutputs = value
+
+			case 4:
+				var value merkle_proof.MerkleProofs
+				count24, capacity25, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "MerkleProofs count")
+				}
+				value = make(merkle_proof.MerkleProofs, 0, capacity25)
+				for i26 := uint64(0); i26 < count24; i26++ {
+					var item27 *merkle_proof.MerkleProof
+					notNil28, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "MerkleProofs item %d not nil", i26)
+					}
+					if notNil28 != 0 {
+						b30, err := bsor.ReadBytes(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "MerkleProofs item %d bytes", i26)
+						}
+						item29 := new(merkle_proof.MerkleProof)
+						if err := item29.UnmarshalBinary(b30); err != nil {
+							return true, errors.Wrapf(err, "MerkleProofs item %d binary unmarshal", i26)
+						}
+						item27 = item29
+					}
+					value = append(value, item27)
+				}
+				v.MerkleProofs = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarshalBSOR writes the field count followed by the fields of Output.
+func (v Output) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := 0
+	if v.Value != 0 {
+		fieldCount++
+	}
+	if v.LockingScript != nil {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Value != 0 {
+		fieldWriter := encoder.StartField(1)
+		fieldWriter.Add(bitcoin.PushNumberScriptItemUnsigned(uint64(v.Value)))
+		encoder.EndField()
+	}
+
+	if v.LockingScript != nil {
+		fieldWriter := encoder.StartField(2)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.LockingScript)))
+		encoder.EndField()
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of Output.
+func (v *Output) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	_, err := bsor.UnmarshalFields(r, options, "Output",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				var value uint64
+				value31, err := bsor.ReadUnsignedInteger(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Value integer")
+				}
+				value = uint64(value31)
+				v.Value = value
+
+			case 2:
+				var value bitcoin.Script
+				b32, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "LockingScript bytes")
+				}
+				value = bitcoin.Script(b32)
+				v.LockingScript = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// MarshalBSOR writes the field count followed by the fields of AncestorTx.
+func (v AncestorTx) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := 0
+	if v.Tx != nil {
+		fieldCount++
+	}
+	if v.MerkleProofs != nil {
+		fieldCount++
+	}
+	if v.MinerResponses != nil {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Tx != nil {
+		fieldWriter := encoder.StartField(1)
+		b33, err := v.Tx.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "Tx binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b33))
+		encoder.EndField()
+	}
+
+	if v.MerkleProofs != nil {
+		fieldWriter := encoder.StartField(2)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.MerkleProofs))))
+		for i34, item35 := range v.MerkleProofs {
+			if item35 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				b36, err := item35.MarshalBinary()
+				if err != nil {
+					return errors.Wrapf(err, "MerkleProofs item %d binary marshal", i34)
+				}
+				fieldWriter.Add(bitcoin.NewPushDataScriptItem(b36))
+			}
+		}
+		encoder.EndField()
+	}
+
+	if v.MinerResponses != nil {
+		fieldWriter := encoder.StartField(3)
+		fieldWriter.Add(bitcoin.PushNumberScriptItem(int64(len(v.MinerResponses))))
+		for i37, item38 := range v.MinerResponses {
+			if item38 == nil {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_FALSE))
+			} else {
+				fieldWriter.Add(bitcoin.NewOpCodeScriptItem(bitcoin.OP_TRUE))
+				if err := item38.MarshalBSOR(fieldWriter, options); err != nil {
+					return errors.Wrapf(err, "MinerResponses item %d", i37)
+				}
+			}
+		}
+		encoder.EndField()
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of AncestorTx.
+func (v *AncestorTx) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	_, err := bsor.UnmarshalFields(r, options, "AncestorTx",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				value := new(wire.MsgTx)
+				b39, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Tx bytes")
+				}
+				if err := (*value).UnmarshalBinary(b39); err != nil {
+					return true, errors.Wrap(err, "Tx binary unmarshal")
+				}
+				v.Tx = value
+
+			case 2:
+				var value merkle_proof.MerkleProofs
+				count40, capacity41, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "MerkleProofs count")
+				}
+				value = make(merkle_proof.MerkleProofs, 0, capacity41)
+				for i42 := uint64(0); i42 < count40; i42++ {
+					var item43 *merkle_proof.MerkleProof
+					notNil44, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "MerkleProofs item %d not nil", i42)
+					}
+					if notNil44 != 0 {
+						b46, err := bsor.ReadBytes(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "MerkleProofs item %d bytes", i42)
+						}
+						item45 := new(merkle_proof.MerkleProof)
+						if err := item45.UnmarshalBinary(b46); err != nil {
+							return true, errors.Wrapf(err, "MerkleProofs item %d binary unmarshal", i42)
+						}
+						item43 = item45
+					}
+					value = append(value, item43)
+				}
+				v.MerkleProofs = value
+
+			case 3:
+				var value json_envelope.JSONEnvelopes
+				count47, capacity48, err := bsor.ReadItemCount(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "MinerResponses count")
+				}
+				value = make(json_envelope.JSONEnvelopes, 0, capacity48)
+				for i49 := uint64(0); i49 < count47; i49++ {
+					var item50 *json_envelope.JSONEnvelope
+					notNil51, err := bsor.ReadUnsignedInteger(fieldReader)
+					if err != nil {
+						return true, errors.Wrapf(err, "MinerResponses item %d not nil", i49)
+					}
+					if notNil51 != 0 {
+						empty53, err := bsor.SkipEmptyObject(fieldReader)
+						if err != nil {
+							return true, errors.Wrapf(err, "MinerResponses item %d", i49)
+						}
+						if !empty53 {
+							item52 := new(json_envelope.JSONEnvelope)
+							if err := item52.UnmarshalBSOR(fieldReader, options); err != nil {
+								return true, errors.Wrapf(err, "MinerResponses item %d", i49)
+							}
+							item50 = item52
+						}
+					}
+					value = append(value, item50)
+				}
+				v.MinerResponses = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -37,6 +37,8 @@ type TransactionWithOutputs interface {
 	InputOutput(index int) (*wire.TxOut, error) // The output being spent by the input
 }
 
+//go:generate go run github.com/tokenized/pkg/bsor/cmd generate -type ExpandedTx,Output,AncestorTx
+
 // ExpandedTx is a Bitcoin transaction with ancestor information.
 // All ancestor transactions back to merkle proofs should be provided.
 type ExpandedTx struct {
@@ -1,11 +1,18 @@
 package expanded_tx
 
 import (
+	"bytes"
 	"encoding/json"
+	"reflect"
 	"testing"
 
 	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+	"github.com/tokenized/pkg/json_envelope"
+	"github.com/tokenized/pkg/merkle_proof"
 	"github.com/tokenized/pkg/wire"
+
+	"github.com/go-test/deep"
 )
 
 func Test_Unmarshal(t *testing.T) {
@@ -38,3 +45,132 @@ func Test_Unmarshal(t *testing.T) {
 
 	t.Logf("Expanded tx : %s", outEtx)
 }
+
+func mockExpandedTx(t testing.TB) *ExpandedTx {
+	key, _ := bitcoin.GenerateKey(bitcoin.MainNet)
+	ls, _ := key.LockingScript()
+
+	parentTx := wire.NewMsgTx(1)
+	parentTx.AddTxIn(wire.NewTxIn(&wire.OutPoint{}, nil))
+	parentTx.AddTxOut(wire.NewTxOut(1100, ls))
+
+	minerResponse, err := json_envelope.WrapJSON(key, map[string]string{"status": "accepted"})
+	if err != nil {
+		t.Fatalf("Failed to wrap json : %s", err)
+	}
+
+	tx := wire.NewMsgTx(1)
+	tx.AddTxIn(wire.NewTxIn(wire.NewOutPoint(parentTx.TxHash(), 0), ls))
+	tx.AddTxOut(wire.NewTxOut(1000, ls))
+
+	return &ExpandedTx{
+		Tx: tx,
+		Ancestors: AncestorTxs{
+			{
+				Tx: parentTx,
+				MerkleProofs: merkle_proof.MerkleProofs{
+					merkle_proof.MockMerkleProofWithTx(parentTx, 10),
+				},
+				MinerResponses: json_envelope.JSONEnvelopes{minerResponse},
+			},
+		},
+		SpentOutputs: Outputs{
+			{
+				Value:         1100,
+				LockingScript: ls,
+			},
+		},
+	}
+}
+
+func Test_BSOR_Generated(t *testing.T) {
+	etx := mockExpandedTx(t)
+
+	script, err := bsor.MarshalBinary(etx)
+	if err != nil {
+		t.Fatalf("Failed to marshal : %s", err)
+	}
+
+	reflectScript, err := bsor.MarshalBinaryWithOptions(etx, bsor.MarshalOptions{Reflect: true})
+	if err != nil {
+		t.Fatalf("Failed to marshal with reflection : %s", err)
+	}
+
+	if !bytes.Equal(script, reflectScript) {
+		t.Fatalf("Generated script doesn't match reflection :\ngot  : %s\nwant : %s", script,
+			reflectScript)
+	}
+
+	read := &ExpandedTx{}
+	if _, err := bsor.UnmarshalBinary(script, read); err != nil {
+		t.Fatalf("Failed to unmarshal : %s", err)
+	}
+
+	reflectRead := &ExpandedTx{}
+	if _, err := bsor.UnmarshalBinaryWithOptions(script, reflectRead,
+		bsor.UnmarshalOptions{Reflect: true}); err != nil {
+		t.Fatalf("Failed to unmarshal with reflection : %s", err)
+	}
+
+	if !reflect.DeepEqual(read, reflectRead) {
+		t.Errorf("Generated value doesn't match reflection : %v", deep.Equal(read, reflectRead))
+	}
+
+	if !read.Tx.TxHash().Equal(etx.Tx.TxHash()) {
+		t.Errorf("Wrong tx : got %s, want %s", read.Tx.TxHash(), etx.Tx.TxHash())
+	}
+}
+
+func benchmarkMarshal(b *testing.B, options bsor.MarshalOptions) {
+	etx := mockExpandedTx(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bsor.MarshalBinaryWithOptions(etx, options); err != nil {
+			b.Fatalf("Failed to marshal : %s", err)
+		}
+	}
+}
+
+func benchmarkUnmarshal(b *testing.B, options bsor.UnmarshalOptions) {
+	script, err := bsor.MarshalBinary(mockExpandedTx(b))
+	if err != nil {
+		b.Fatalf("Failed to marshal : %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bsor.UnmarshalBinaryWithOptions(script, &ExpandedTx{}, options); err != nil {
+			b.Fatalf("Failed to unmarshal : %s", err)
+		}
+	}
+}
+
+func Benchmark_BSOR_Marshal_Generated(b *testing.B) {
+	benchmarkMarshal(b, bsor.MarshalOptions{})
+}
+
+func Benchmark_BSOR_Marshal_Reflect(b *testing.B) {
+	benchmarkMarshal(b, bsor.MarshalOptions{Reflect: true})
+}
+
+func Benchmark_BSOR_Unmarshal_Generated(b *testing.B) {
+	benchmarkUnmarshal(b, bsor.UnmarshalOptions{})
+}
+
+func Benchmark_BSOR_Unmarshal_Reflect(b *testing.B) {
+	benchmarkUnmarshal(b, bsor.UnmarshalOptions{Reflect: true})
+}
+
+func Test_BSOR_LargeCount(t *testing.T) {
+	// One field, the ancestors, with a count of 2^36 and no items.
+	script := bitcoin.Script{bitcoin.OP_1, bitcoin.OP_2, 0x05, 0x00, 0x00, 0x00, 0x00, 0x10}
+
+	if err := bsor.NewDecoder(bytes.NewReader(script)).Decode(&ExpandedTx{}); err == nil {
+		t.Fatalf("Decode with large count should fail")
+	}
+
+	if _, err := bsor.UnmarshalBinary(script, &ExpandedTx{}); err == nil {
+		t.Fatalf("Unmarshal with large count should fail")
+	}
+}
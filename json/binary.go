@@ -0,0 +1,121 @@
+package json
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// A BinaryEncoding is the text encoding of byte slices within JSON strings.
+//
+// Byte slices are encoded as hex by default. A struct field can use another
+// encoding with a "hex", "base64" or "base58" option in its tag, which
+// applies to the byte slices within that field, but not to the fields of
+// structs within it:
+//
+//	Payload []byte `json:"payload,base64"`
+//
+// The default for fields without an option can be set with
+// Encoder.SetBinaryEncoding and Decoder.SetBinaryEncoding.
+type BinaryEncoding uint8
+
+const (
+	// BinaryEncodingDefault uses the encoding of the Encoder or Decoder, which
+	// is hex unless it was set.
+	BinaryEncodingDefault = BinaryEncoding(0)
+
+	BinaryEncodingHex    = BinaryEncoding(1)
+	BinaryEncodingBase64 = BinaryEncoding(2)
+	BinaryEncodingBase58 = BinaryEncoding(3)
+)
+
+var errInvalidBase58 = errors.New("json: invalid base58 data")
+
+func (e BinaryEncoding) String() string {
+	switch e {
+	case BinaryEncodingDefault:
+		return "default"
+	case BinaryEncodingHex:
+		return "hex"
+	case BinaryEncodingBase64:
+		return "base64"
+	case BinaryEncodingBase58:
+		return "base58"
+	}
+	return "unknown"
+}
+
+// parseBinaryEncoding returns the binary encoding option in a struct field's
+// tag options.
+func parseBinaryEncoding(opts tagOptions) BinaryEncoding {
+	switch {
+	case opts.Contains("hex"):
+		return BinaryEncodingHex
+	case opts.Contains("base64"):
+		return BinaryEncodingBase64
+	case opts.Contains("base58"):
+		return BinaryEncodingBase58
+	}
+	return BinaryEncodingDefault
+}
+
+// selectBinaryEncoding returns the field's encoding if it has one, otherwise
+// the default.
+func selectBinaryEncoding(field, defaultEncoding BinaryEncoding) BinaryEncoding {
+	if field != BinaryEncodingDefault {
+		return field
+	}
+	return defaultEncoding
+}
+
+// encodeBinary appends the encoding of s to dst.
+func encodeBinary(dst []byte, s []byte, encoding BinaryEncoding) []byte {
+	switch encoding {
+	case BinaryEncodingBase64:
+		n := base64.StdEncoding.EncodedLen(len(s))
+		start := len(dst)
+		dst = append(dst, make([]byte, n)...)
+		base64.StdEncoding.Encode(dst[start:], s)
+		return dst
+
+	case BinaryEncodingBase58:
+		return append(dst, base58.Encode(s)...)
+
+	default:
+		n := hex.EncodedLen(len(s))
+		start := len(dst)
+		dst = append(dst, make([]byte, n)...)
+		hex.Encode(dst[start:], s)
+		return dst
+	}
+}
+
+// decodeBinary decodes the text of a JSON string into bytes.
+func decodeBinary(s []byte, encoding BinaryEncoding) ([]byte, error) {
+	switch encoding {
+	case BinaryEncodingBase64:
+		b := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
+		n, err := base64.StdEncoding.Decode(b, s)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+
+	case BinaryEncodingBase58:
+		b := base58.Decode(string(s))
+		if len(b) == 0 && len(s) != 0 {
+			return nil, errInvalidBase58
+		}
+		return b, nil
+
+	default:
+		b := make([]byte, hex.DecodedLen(len(s)))
+		n, err := hex.Decode(b, s)
+		if err != nil {
+			return nil, err
+		}
+		return b[:n], nil
+	}
+}
@@ -0,0 +1,111 @@
+package json
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type binaryFields struct {
+	Default []byte            `json:"default"`
+	Hex     []byte            `json:"hex,hex"`
+	Base64  []byte            `json:"base64,omitempty,base64"`
+	Base58  []byte            `json:"base58,base58"`
+	Slice   [][]byte          `json:"slice,base64"`
+	Map     map[string][]byte `json:"map,base58"`
+	Nested  *binaryFields     `json:"nested,omitempty,base64"`
+}
+
+var binaryValue = binaryFields{
+	Default: []byte{0x00, 0x01, 0xfe},
+	Hex:     []byte{0x0a, 0x0b},
+	Base64:  []byte("hello"),
+	Base58:  []byte{0x00, 0x00, 0x01, 0x02},
+	Slice:   [][]byte{[]byte("a"), nil},
+	Map:     map[string][]byte{"k": []byte("v")},
+	Nested: &binaryFields{
+		Default: []byte{0xff},
+	},
+}
+
+func TestBinaryEncodingTags(t *testing.T) {
+	b, err := Marshal(binaryValue)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// The nested struct's fields use their own options, not the option of the field containing it.
+	want := `{"default":"0001fe","hex":"0a0b","base64":"aGVsbG8=","base58":"115T",` +
+		`"slice":["YQ==",null],"map":{"k":"33"},` +
+		`"nested":{"default":"ff","hex":null,"base58":null,"slice":null,"map":null}}`
+	if string(b) != want {
+		t.Errorf("Marshal:\n got: %s\nwant: %s", b, want)
+	}
+
+	var got binaryFields
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(got, binaryValue) {
+		t.Errorf("Unmarshal:\n got: %#v\nwant: %#v", got, binaryValue)
+	}
+}
+
+func TestBinaryEncodingDefault(t *testing.T) {
+	type value struct {
+		Default []byte `json:"default"`
+		Hex     []byte `json:"hex,hex"`
+	}
+
+	tests := []struct {
+		encoding BinaryEncoding
+		want     string
+	}{
+		{BinaryEncodingDefault, `{"default":"00ff","hex":"00ff"}`},
+		{BinaryEncodingHex, `{"default":"00ff","hex":"00ff"}`},
+		{BinaryEncodingBase64, `{"default":"AP8=","hex":"00ff"}`},
+		{BinaryEncodingBase58, `{"default":"15Q","hex":"00ff"}`},
+	}
+
+	v := value{Default: []byte{0x00, 0xff}, Hex: []byte{0x00, 0xff}}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetBinaryEncoding(tt.encoding)
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("%s Encode: %v", tt.encoding, err)
+		}
+
+		if got := strings.TrimSpace(buf.String()); got != tt.want {
+			t.Errorf("%s Encode = %s, want %s", tt.encoding, got, tt.want)
+		}
+
+		var got value
+		dec := NewDecoder(&buf)
+		dec.SetBinaryEncoding(tt.encoding)
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("%s Decode: %v", tt.encoding, err)
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("%s Decode = %#v, want %#v", tt.encoding, got, v)
+		}
+	}
+}
+
+func TestBinaryEncodingInvalid(t *testing.T) {
+	tests := []string{
+		`{"hex":"zz"}`,
+		`{"hex":"abc"}`,
+		`{"base64":"a"}`,
+		`{"base58":"0OIl"}`,
+		`{"slice":["!"]}`,
+	}
+
+	for _, data := range tests {
+		var v binaryFields
+		if err := Unmarshal([]byte(data), &v); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", data)
+		}
+	}
+}
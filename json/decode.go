@@ -9,7 +9,6 @@ package json
 
 import (
 	"encoding"
-	"encoding/hex"
 	"fmt"
 	"reflect"
 	"strconv"
@@ -17,6 +16,8 @@ import (
 	"unicode"
 	"unicode/utf16"
 	"unicode/utf8"
+
+	"github.com/tokenized/pkg/validate"
 )
 
 // Unmarshal parses the JSON-encoded data and stores the result
@@ -91,6 +92,10 @@ import (
 // invalid UTF-16 surrogate pairs are not treated as an error.
 // Instead, they are replaced by the Unicode replacement
 // character U+FFFD.
+//
+// After the value is unmarshaled without error, the rules in `tkvalidate`
+// struct field tags are checked (see package validate). Fields that fail
+// are returned as validate.Errors.
 func Unmarshal(data []byte, v interface{}) error {
 	// Check for well-formedness.
 	// Avoids filling out half a data structure
@@ -179,7 +184,10 @@ func (d *decodeState) unmarshal(v interface{}) error {
 	if err != nil {
 		return d.addErrorContext(err)
 	}
-	return d.savedError
+	if d.savedError != nil {
+		return d.savedError
+	}
+	return validate.Value(rv)
 }
 
 // A Number represents a JSON number literal.
@@ -211,6 +219,8 @@ type decodeState struct {
 	savedError            error
 	useNumber             bool
 	disallowUnknownFields bool
+	binaryEncoding        BinaryEncoding
+	fieldBinaryEncoding   BinaryEncoding // from the tag of the field being decoded
 }
 
 // readIndex returns the position of the last byte read.
@@ -228,6 +238,7 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.off = 0
 	d.savedError = nil
 	d.errorContext.Struct = nil
+	d.fieldBinaryEncoding = BinaryEncodingDefault
 
 	// Reuse the allocated space for the FieldStack slice.
 	d.errorContext.FieldStack = d.errorContext.FieldStack[:0]
@@ -680,6 +691,9 @@ func (d *decodeState) object(v reflect.Value) error {
 		var subv reflect.Value
 		destring := false // whether the value is wrapped in a string to be decoded first
 
+		// Map values use the binary encoding of the field containing the map.
+		fieldBinaryEncoding := d.fieldBinaryEncoding
+
 		if v.Kind() == reflect.Map {
 			elemType := t.Elem()
 			if !mapElem.IsValid() {
@@ -704,9 +718,11 @@ func (d *decodeState) object(v reflect.Value) error {
 					}
 				}
 			}
+			d.fieldBinaryEncoding = BinaryEncodingDefault
 			if f != nil {
 				subv = v
 				destring = f.quoted
+				d.fieldBinaryEncoding = f.binaryEncoding
 				for _, i := range f.index {
 					if subv.Kind() == reflect.Ptr {
 						if subv.IsNil() {
@@ -763,6 +779,7 @@ func (d *decodeState) object(v reflect.Value) error {
 				return err
 			}
 		}
+		d.fieldBinaryEncoding = fieldBinaryEncoding
 
 		// Write value back to map;
 		// if using struct, subv points into struct already.
@@ -938,13 +955,12 @@ func (d *decodeState) literalStore(item []byte, v reflect.Value, fromQuoted bool
 				d.saveError(&UnmarshalTypeError{Value: "string", Type: v.Type(), Offset: int64(d.readIndex())})
 				break
 			}
-			b := make([]byte, len(s)*2)
-			n, err := hex.Decode(b, s)
+			b, err := decodeBinary(s, selectBinaryEncoding(d.fieldBinaryEncoding, d.binaryEncoding))
 			if err != nil {
 				d.saveError(err)
 				break
 			}
-			v.SetBytes(b[:n])
+			v.SetBytes(b)
 		case reflect.String:
 			v.SetString(string(s))
 		case reflect.Interface:
@@ -18,6 +18,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/tokenized/pkg/validate"
 )
 
 type T struct {
@@ -2370,3 +2372,47 @@ func TestUnmarshalRecursivePointer(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type validated struct {
+	ID      string   `json:"id" tkvalidate:"required,hexlen=2"`
+	Outputs []uint64 `json:"outputs" tkvalidate:"min=1"`
+}
+
+func TestUnmarshalValidate(t *testing.T) {
+	var v validated
+	if err := Unmarshal([]byte(`{"id":"0a0b","outputs":[1]}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	err := Unmarshal([]byte(`{"id":"0a","outputs":[]}`), &v)
+	var fieldErrors validate.Errors
+	if !errors.As(err, &fieldErrors) {
+		t.Fatalf("Unmarshal error = %v, want validate.Errors", err)
+	}
+	if len(fieldErrors) != 2 || fieldErrors[0].Path != "ID" || fieldErrors[1].Path != "Outputs" {
+		t.Errorf("Unmarshal error = %v", err)
+	}
+
+	dec := NewDecoder(strings.NewReader(`{"outputs":[1]}`))
+	if err := dec.Decode(&validated{}); !errors.As(err, &fieldErrors) {
+		t.Errorf("Decode error = %v, want validate.Errors", err)
+	}
+
+	// Syntax and type errors are returned instead of validation errors.
+	err = Unmarshal([]byte(`{"id":1}`), &v)
+	if _, ok := err.(*UnmarshalTypeError); !ok {
+		t.Errorf("Unmarshal error = %v, want UnmarshalTypeError", err)
+	}
+}
+
+// otherValidator has tags for a different validator, which are ignored.
+type otherValidator struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func TestUnmarshalOtherValidateTags(t *testing.T) {
+	var v otherValidator
+	if err := Unmarshal([]byte(`{}`), &v); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+}
@@ -13,7 +13,6 @@ package json
 import (
 	"bytes"
 	"encoding"
-	"encoding/hex"
 	"fmt"
 	"math"
 	"reflect"
@@ -103,6 +102,11 @@ import (
 //
 //	Int64String int64 `json:",string"`
 //
+// The "hex", "base64" and "base58" options set the encoding of the byte
+// slices within a field, overriding the hex default (see BinaryEncoding):
+//
+//	Payload []byte `json:"payload,base64"`
+//
 // The key name will be used if it's a non-empty string consisting of
 // only Unicode letters, digits, and ASCII punctuation except quotation
 // marks, backslash, and comma.
@@ -341,6 +345,11 @@ type encOpts struct {
 	quoted bool
 	// escapeHTML causes '<', '>', and '&' to be escaped in JSON strings.
 	escapeHTML bool
+	// binaryEncoding is the encoding of byte slices.
+	binaryEncoding BinaryEncoding
+	// fieldBinaryEncoding is the encoding of byte slices specified by the
+	// current field's tag. It overrides binaryEncoding.
+	fieldBinaryEncoding BinaryEncoding
 }
 
 type encoderFunc func(e *encodeState, v reflect.Value, opts encOpts)
@@ -720,6 +729,7 @@ FieldLoop:
 			e.WriteString(f.nameNonEsc)
 		}
 		opts.quoted = f.quoted
+		opts.fieldBinaryEncoding = f.binaryEncoding
 		f.encoder(e, fv, opts)
 	}
 	if next == '{' {
@@ -781,27 +791,16 @@ func newMapEncoder(t reflect.Type) encoderFunc {
 	return me.encode
 }
 
-func encodeByteSlice(e *encodeState, v reflect.Value, _ encOpts) {
+func encodeByteSlice(e *encodeState, v reflect.Value, opts encOpts) {
 	if v.IsNil() {
 		e.WriteString("null")
 		return
 	}
 	s := v.Bytes()
 	e.WriteByte('"')
-	encodedLen := len(s) * 2
-	if encodedLen <= len(e.scratch) {
-		// If the encoded bytes fit in e.scratch, avoid an extra
-		// allocation and use the cheaper Encoding.Encode.
-		dst := e.scratch[:encodedLen]
-		hex.Encode(dst, s)
-		e.Write(dst)
-	} else {
-		// The encoded bytes are short enough to allocate for, and
-		// Encoding.Encode is still cheaper.
-		dst := make([]byte, encodedLen)
-		hex.Encode(dst, s)
-		e.Write(dst)
-	}
+	// Encode into e.scratch to avoid an allocation when the encoded bytes fit.
+	e.Write(encodeBinary(e.scratch[:0], s,
+		selectBinaryEncoding(opts.fieldBinaryEncoding, opts.binaryEncoding)))
 	e.WriteByte('"')
 }
 
@@ -1099,6 +1098,8 @@ type field struct {
 	omitEmpty bool
 	quoted    bool
 
+	binaryEncoding BinaryEncoding
+
 	encoder encoderFunc
 }
 
@@ -1214,6 +1215,8 @@ func typeFields(t reflect.Type) structFields {
 						typ:       ft,
 						omitEmpty: opts.Contains("omitempty"),
 						quoted:    quoted,
+
+						binaryEncoding: parseBinaryEncoding(opts),
 					}
 					field.nameBytes = []byte(field.name)
 					field.equalFold = foldFunc(field.nameBytes)
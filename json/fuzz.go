@@ -8,14 +8,29 @@
 package json
 
 import (
+	"bytes"
 	"fmt"
+	"reflect"
 )
 
+// fuzzBinary has byte slices in each binary encoding.
+type fuzzBinary struct {
+	Default   []byte            `json:"default"`
+	Hex       []byte            `json:"hex,hex"`
+	Base64    []byte            `json:"base64,base64"`
+	Base58    []byte            `json:"base58,base58"`
+	Slice     [][]byte          `json:"slice,base64"`
+	Map       map[string][]byte `json:"map,base58"`
+	Nested    *fuzzBinary       `json:"nested,base64"`
+	Interface interface{}       `json:"interface,base58"`
+}
+
 func Fuzz(data []byte) (score int) {
 	for _, ctor := range []func() interface{}{
 		func() interface{} { return new(interface{}) },
 		func() interface{} { return new(map[string]interface{}) },
 		func() interface{} { return new([]interface{}) },
+		func() interface{} { return new(fuzzBinary) },
 	} {
 		v := ctor()
 		err := Unmarshal(data, v)
@@ -39,5 +54,50 @@ func Fuzz(data []byte) (score int) {
 		}
 	}
 
+	if fuzzBinaryEncodings(data) {
+		score = 1
+	}
+
 	return
 }
+
+// fuzzBinaryEncodings checks that values with byte slices are the same after
+// being encoded and decoded with each default binary encoding.
+func fuzzBinaryEncodings(data []byte) bool {
+	var v fuzzBinary
+	if err := Unmarshal(data, &v); err != nil {
+		return false
+	}
+
+	for _, encoding := range []BinaryEncoding{
+		BinaryEncodingDefault,
+		BinaryEncodingHex,
+		BinaryEncodingBase64,
+		BinaryEncodingBase58,
+	} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.SetBinaryEncoding(encoding)
+		if err := enc.Encode(&v); err != nil {
+			fmt.Printf("v=%#v\n", v)
+			panic(err)
+		}
+
+		var u fuzzBinary
+		dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+		dec.SetBinaryEncoding(encoding)
+		if err := dec.Decode(&u); err != nil {
+			fmt.Printf("v=%#v\n", v)
+			fmt.Printf("m=%s\n", buf.Bytes())
+			panic(err)
+		}
+
+		if !reflect.DeepEqual(v, u) {
+			fmt.Printf("v=%#v\n", v)
+			fmt.Printf("u=%#v\n", u)
+			panic(fmt.Sprintf("%s round trip not equal", encoding))
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,329 @@
+package json
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrPointerNotFound is returned when there is no value at a JSON pointer.
+var ErrPointerNotFound = errors.New("json: pointer not found")
+
+// An ArrayIterator decodes the elements of a JSON array from a Decoder one
+// at a time, so large arrays don't have to be held in memory.
+//
+//	it, err := dec.Array()
+//	if err != nil {
+//		return err
+//	}
+//	for it.Next() {
+//		var tx Tx
+//		if err := it.Decode(&tx); err != nil {
+//			return err
+//		}
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type ArrayIterator struct {
+	dec     *Decoder
+	index   int
+	pending bool
+	done    bool
+	err     error
+}
+
+// Array reads the opening bracket of the next JSON value, which must be an
+// array, and returns an iterator over its elements.
+func (dec *Decoder) Array() (*ArrayIterator, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if t != Delim('[') {
+		return nil, &SyntaxError{msg: fmt.Sprintf("expected array, found %v", t),
+			Offset: dec.offset()}
+	}
+
+	return &ArrayIterator{
+		dec:   dec,
+		index: -1,
+	}, nil
+}
+
+// Next advances to the next element and reports whether there is one. An
+// element that wasn't decoded is skipped. After the last element Next reads
+// the closing bracket and returns false.
+func (it *ArrayIterator) Next() bool {
+	if it.done || it.err != nil {
+		return false
+	}
+
+	if it.pending {
+		if err := it.dec.skipValue(); err != nil {
+			it.err = err
+			return false
+		}
+		it.pending = false
+	}
+
+	if it.dec.err != nil {
+		it.err = it.dec.err
+		return false
+	}
+
+	c, err := it.dec.peek()
+	if err != nil {
+		it.err = err
+		return false
+	}
+
+	if c == ']' {
+		if _, err := it.dec.Token(); err != nil {
+			it.err = err
+			return false
+		}
+
+		it.done = true
+		return false
+	}
+
+	// Read the comma before the element so a missing comma stops the iteration.
+	if err := it.dec.tokenPrepareForDecode(); err != nil {
+		it.err = err
+		return false
+	}
+
+	it.index++
+	it.pending = true
+	return true
+}
+
+// Decode decodes the current element into the value pointed to by v, like
+// Decoder.Decode. Iteration can continue after errors unmarshaling the
+// element, like UnmarshalTypeError and validation errors.
+func (it *ArrayIterator) Decode(v interface{}) error {
+	if !it.pending {
+		return errors.New("json: ArrayIterator.Decode called without Next")
+	}
+	it.pending = false
+
+	return it.dec.Decode(v)
+}
+
+// Index returns the index of the current element.
+func (it *ArrayIterator) Index() int {
+	return it.index
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *ArrayIterator) Err() error {
+	return it.err
+}
+
+// skipValue reads the next value without decoding it.
+func (dec *Decoder) skipValue() error {
+	if dec.err != nil {
+		return dec.err
+	}
+
+	if err := dec.tokenPrepareForDecode(); err != nil {
+		return err
+	}
+
+	if !dec.tokenValueAllowed() {
+		return &SyntaxError{msg: "not at beginning of value", Offset: dec.offset()}
+	}
+
+	n, err := dec.readValue()
+	if err != nil {
+		return err
+	}
+	dec.scanp += n
+
+	dec.tokenValueEnd()
+	return nil
+}
+
+// Seek advances the decoder to the value at the JSON pointer (RFC 6901),
+// like "/result/tx/0", within the next JSON value. Values before it are
+// skipped without being decoded. The value can then be read with Decode,
+// Array or Token. It returns an error wrapping ErrPointerNotFound if there is
+// no value at the pointer.
+func (dec *Decoder) Seek(pointer string) error {
+	references, err := parsePointer(pointer)
+	if err != nil {
+		return err
+	}
+
+	for _, reference := range references {
+		// Read the colon or comma before the value.
+		if err := dec.tokenPrepareForDecode(); err != nil {
+			return err
+		}
+
+		c, err := dec.peek()
+		if err != nil {
+			return err
+		}
+
+		switch c {
+		case '{':
+			err = dec.seekKey(reference)
+		case '[':
+			err = dec.seekIndex(reference)
+		default:
+			err = ErrPointerNotFound
+		}
+
+		if err == ErrPointerNotFound {
+			return fmt.Errorf("%w: %s", ErrPointerNotFound, pointer)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seekKey reads an object up to the value of the key.
+func (dec *Decoder) seekKey(key string) error {
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		if t == key {
+			return nil
+		}
+
+		if err := dec.skipValue(); err != nil {
+			return err
+		}
+	}
+
+	return ErrPointerNotFound
+}
+
+// seekIndex reads an array up to the element at the index.
+func (dec *Decoder) seekIndex(reference string) error {
+	index, err := parsePointerIndex(reference)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for i := 0; dec.More(); i++ {
+		if i == index {
+			return nil
+		}
+
+		if err := dec.skipValue(); err != nil {
+			return err
+		}
+	}
+
+	return ErrPointerNotFound
+}
+
+// Get returns the value at the JSON pointer (RFC 6901), like "/result/tx/0",
+// within data. Only the parts of data before the value are scanned, and they
+// are not decoded. It returns an error wrapping ErrPointerNotFound if there is
+// no value at the pointer.
+func Get(data []byte, pointer string) (RawMessage, error) {
+	dec := NewDecoder(bytes.NewReader(data))
+	if err := dec.Seek(pointer); err != nil {
+		return nil, err
+	}
+
+	var result RawMessage
+	if err := dec.Decode(&result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// parsePointer returns the unescaped reference tokens of a JSON pointer.
+func parsePointer(pointer string) ([]string, error) {
+	if len(pointer) == 0 {
+		return nil, nil
+	}
+
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("json: invalid pointer %q: must start with /", pointer)
+	}
+
+	references := strings.Split(pointer[1:], "/")
+	for i, reference := range references {
+		if strings.Contains(reference, "~") {
+			unescaped, err := unescapePointer(reference)
+			if err != nil {
+				return nil, fmt.Errorf("json: invalid pointer %q: %w", pointer, err)
+			}
+			references[i] = unescaped
+		}
+	}
+
+	return references, nil
+}
+
+// unescapePointer replaces ~1 with / and ~0 with ~.
+func unescapePointer(reference string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(reference); i++ {
+		c := reference[i]
+		if c != '~' {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(reference) {
+			return "", errors.New("incomplete escape")
+		}
+
+		switch reference[i] {
+		case '0':
+			b.WriteByte('~')
+		case '1':
+			b.WriteByte('/')
+		default:
+			return "", fmt.Errorf("invalid escape ~%c", reference[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// parsePointerIndex parses an array index reference. References that aren't
+// valid indexes, like "-" for the end of the array, don't match an element.
+func parsePointerIndex(reference string) (int, error) {
+	if len(reference) == 0 || (len(reference) > 1 && reference[0] == '0') {
+		return 0, ErrPointerNotFound
+	}
+
+	for i := 0; i < len(reference); i++ {
+		if reference[i] < '0' || reference[i] > '9' {
+			return 0, ErrPointerNotFound
+		}
+	}
+
+	index, err := strconv.Atoi(reference)
+	if err != nil {
+		return 0, ErrPointerNotFound
+	}
+
+	return index, nil
+}
@@ -0,0 +1,155 @@
+package json
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tokenized/pkg/validate"
+)
+
+const blockJSON = `{
+	"id": 1,
+	"error": null,
+	"result": {
+		"hash": "00ff",
+		"extra": {"a": [1, 2, {"b": "c"}]},
+		"tx": [
+			{"txid": "0a", "size": 100},
+			{"txid": "0b", "size": 200},
+			{"txid": "0c", "size": "bad"},
+			{"txid": "0d", "size": 400}
+		],
+		"a/b": {"m~n": true}
+	}
+}`
+
+type iterateTx struct {
+	TxID []byte `json:"txid" tkvalidate:"len=1"`
+	Size int    `json:"size"`
+}
+
+func TestArrayIterator(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(blockJSON))
+	if err := dec.Seek("/result/tx"); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+
+	it, err := dec.Array()
+	if err != nil {
+		t.Fatalf("Array: %v", err)
+	}
+
+	var sizes []int
+	for it.Next() {
+		if it.Index() == 1 {
+			continue // skipped without decoding
+		}
+
+		var tx iterateTx
+		if err := it.Decode(&tx); err != nil {
+			var typeErr *UnmarshalTypeError
+			if it.Index() != 2 || !errors.As(err, &typeErr) {
+				t.Fatalf("Decode %d: %v", it.Index(), err)
+			}
+			continue
+		}
+		sizes = append(sizes, tx.Size)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	if want := []int{100, 400}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("sizes = %v, want %v", sizes, want)
+	}
+
+	// The decoder continues after the array.
+	if tok, err := dec.Token(); err != nil || tok != "a/b" {
+		t.Errorf("Token after array = %v, %v, want a/b", tok, err)
+	}
+}
+
+func TestArrayIteratorErrors(t *testing.T) {
+	if _, err := NewDecoder(strings.NewReader(`{"a":1}`)).Array(); err == nil {
+		t.Errorf("Array on object succeeded")
+	}
+
+	it, err := NewDecoder(strings.NewReader(`[{"txid":"0a"}, {"txid":"0a0b"}, 1 2]`)).Array()
+	if err != nil {
+		t.Fatalf("Array: %v", err)
+	}
+
+	if err := it.Decode(&iterateTx{}); err == nil {
+		t.Errorf("Decode without Next succeeded")
+	}
+
+	count := 0
+	for it.Next() {
+		count++
+		err := it.Decode(&iterateTx{})
+		var fieldErrors validate.Errors
+		if it.Index() == 1 && !errors.As(err, &fieldErrors) {
+			t.Errorf("Decode error = %v, want validate.Errors", err)
+		}
+	}
+
+	var syntaxErr *SyntaxError
+	if !errors.As(it.Err(), &syntaxErr) {
+		t.Errorf("Err = %v, want SyntaxError", it.Err())
+	}
+	if count != 3 {
+		t.Errorf("count = %d, want 3", count)
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    string
+		err     error
+	}{
+		{pointer: "/id", want: `1`},
+		{pointer: "/error", want: `null`},
+		{pointer: "/result/hash", want: `"00ff"`},
+		{pointer: "/result/extra/a/2/b", want: `"c"`},
+		{pointer: "/result/tx/1", want: `{"txid": "0b", "size": 200}`},
+		{pointer: "/result/tx/3/size", want: `400`},
+		{pointer: "/result/a~1b/m~0n", want: `true`},
+		{pointer: "/result/tx/4", err: ErrPointerNotFound},
+		{pointer: "/result/tx/-", err: ErrPointerNotFound},
+		{pointer: "/result/tx/01", err: ErrPointerNotFound},
+		{pointer: "/result/missing", err: ErrPointerNotFound},
+		{pointer: "/id/value", err: ErrPointerNotFound},
+	}
+
+	for _, tt := range tests {
+		got, err := Get([]byte(blockJSON), tt.pointer)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Get(%q) error = %v, want %v", tt.pointer, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Get(%q): %v", tt.pointer, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("Get(%q) = %s, want %s", tt.pointer, got, tt.want)
+		}
+	}
+
+	whole, err := Get([]byte(` [1, 2] `), "")
+	if err != nil || string(whole) != `[1, 2]` {
+		t.Errorf("Get(\"\") = %s, %v", whole, err)
+	}
+
+	for _, pointer := range []string{"id", "/a~2", "/a~"} {
+		if _, err := Get([]byte(blockJSON), pointer); err == nil ||
+			errors.Is(err, ErrPointerNotFound) {
+			t.Errorf("Get(%q) error = %v, want invalid pointer", pointer, err)
+		}
+	}
+}
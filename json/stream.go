@@ -41,6 +41,12 @@ func (dec *Decoder) UseNumber() { dec.d.useNumber = true }
 // non-ignored, exported fields in the destination.
 func (dec *Decoder) DisallowUnknownFields() { dec.d.disallowUnknownFields = true }
 
+// SetBinaryEncoding sets the encoding of byte slices in struct fields that
+// don't have an encoding option in their tag. The default is hex.
+func (dec *Decoder) SetBinaryEncoding(encoding BinaryEncoding) {
+	dec.d.binaryEncoding = encoding
+}
+
 // Decode reads the next JSON-encoded value from its
 // input and stores it in the value pointed to by v.
 //
@@ -175,9 +181,10 @@ func nonSpace(b []byte) bool {
 
 // An Encoder writes JSON values to an output stream.
 type Encoder struct {
-	w          io.Writer
-	err        error
-	escapeHTML bool
+	w              io.Writer
+	err            error
+	escapeHTML     bool
+	binaryEncoding BinaryEncoding
 
 	indentBuf    *bytes.Buffer
 	indentPrefix string
@@ -199,7 +206,7 @@ func (enc *Encoder) Encode(v interface{}) error {
 		return enc.err
 	}
 	e := newEncodeState()
-	err := e.marshal(v, encOpts{escapeHTML: enc.escapeHTML})
+	err := e.marshal(v, encOpts{escapeHTML: enc.escapeHTML, binaryEncoding: enc.binaryEncoding})
 	if err != nil {
 		return err
 	}
@@ -250,6 +257,12 @@ func (enc *Encoder) SetEscapeHTML(on bool) {
 	enc.escapeHTML = on
 }
 
+// SetBinaryEncoding sets the encoding of byte slices in struct fields that
+// don't have an encoding option in their tag. The default is hex.
+func (enc *Encoder) SetBinaryEncoding(encoding BinaryEncoding) {
+	enc.binaryEncoding = encoding
+}
+
 // RawMessage is a raw encoded JSON value.
 // It implements Marshaler and Unmarshaler and can
 // be used to delay JSON decoding or precompute a JSON encoding.
@@ -0,0 +1,142 @@
+// Code generated by "bsor generate". DO NOT EDIT.
+
+package json_envelope
+
+import (
+	"github.com/tokenized/pkg/bitcoin"
+	"github.com/tokenized/pkg/bsor"
+
+	"github.com/pkg/errors"
+)
+
+// MarshalBSOR writes the field count followed by the fields of JSONEnvelope.
+func (v JSONEnvelope) MarshalBSOR(w *bsor.ScriptItemWriter,
+	options *bsor.EncodeOptions) error {
+
+	fieldCount := 0
+	if v.Payload != "" {
+		fieldCount++
+	}
+	if v.Signature != nil {
+		fieldCount++
+	}
+	if v.PublicKey != nil {
+		fieldCount++
+	}
+	if v.Encoding != "" {
+		fieldCount++
+	}
+	if v.MimeType != "" {
+		fieldCount++
+	}
+	encoder := bsor.NewObjectEncoder(w, fieldCount, options)
+
+	if v.Payload != "" {
+		fieldWriter := encoder.StartField(1)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.Payload)))
+		encoder.EndField()
+	}
+
+	if v.Signature != nil {
+		fieldWriter := encoder.StartField(2)
+		b1, err := v.Signature.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "Signature binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b1))
+		encoder.EndField()
+	}
+
+	if v.PublicKey != nil {
+		fieldWriter := encoder.StartField(3)
+		b2, err := v.PublicKey.MarshalBinary()
+		if err != nil {
+			return errors.Wrap(err, "PublicKey binary marshal")
+		}
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem(b2))
+		encoder.EndField()
+	}
+
+	if v.Encoding != "" {
+		fieldWriter := encoder.StartField(4)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.Encoding)))
+		encoder.EndField()
+	}
+
+	if v.MimeType != "" {
+		fieldWriter := encoder.StartField(5)
+		fieldWriter.Add(bitcoin.NewPushDataScriptItem([]byte(v.MimeType)))
+		encoder.EndField()
+	}
+
+	return encoder.Close()
+}
+
+// UnmarshalBSOR reads the field count followed by the fields of JSONEnvelope.
+func (v *JSONEnvelope) UnmarshalBSOR(r *bsor.ScriptItemReader,
+	options *bsor.DecodeOptions) error {
+
+	_, err := bsor.UnmarshalFields(r, options, "JSONEnvelope",
+		func(id uint64, fieldReader *bsor.ScriptItemReader) (bool, error) {
+			switch id {
+			case 1:
+				var value string
+				value3, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Payload bytes")
+				}
+				value = string(value3)
+				v.Payload = value
+
+			case 2:
+				value := new(bitcoin.Signature)
+				b4, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Signature bytes")
+				}
+				if err := (*value).UnmarshalBinary(b4); err != nil {
+					return true, errors.Wrap(err, "Signature binary unmarshal")
+				}
+				v.Signature = value
+
+			case 3:
+				value := new(bitcoin.PublicKey)
+				b5, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "PublicKey bytes")
+				}
+				if err := (*value).UnmarshalBinary(b5); err != nil {
+					return true, errors.Wrap(err, "PublicKey binary unmarshal")
+				}
+				v.PublicKey = value
+
+			case 4:
+				var value string
+				value6, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "Encoding bytes")
+				}
+				value = string(value6)
+				v.Encoding = value
+
+			case 5:
+				var value string
+				value7, err := bsor.ReadBytes(fieldReader)
+				if err != nil {
+					return true, errors.Wrap(err, "MimeType bytes")
+				}
+				value = string(value7)
+				v.MimeType = value
+
+			default:
+				return false, nil
+			}
+
+			return true, nil
+		})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
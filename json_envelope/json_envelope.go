@@ -15,6 +15,8 @@ var (
 	ErrJSONNotSigned = errors.New("JSON Not Signed")
 )
 
+//go:generate go run github.com/tokenized/pkg/bsor/cmd generate -type JSONEnvelope
+
 type JSONEnvelope struct {
 	Payload   string             `bsor:"1" json:"payload"`
 	Signature *bitcoin.Signature `bsor:"2" json:"signature"`
@@ -266,11 +266,11 @@ func GetFeeQuoteFull(ctx context.Context, baseURL, authToken string,
 }
 
 type SubmitTxRequest struct {
-	Tx                 *wire.MsgTx `json:"rawtx"`
-	CallBackURL        *string     `json:"callBackUrl,omitempty"`
+	Tx                 *wire.MsgTx `json:"rawtx" tkvalidate:"required"`
+	CallBackURL        *string     `json:"callBackUrl,omitempty" tkvalidate:"min=1"`
 	CallBackToken      *string     `json:"callBackToken,omitempty"`
 	SendMerkleProof    bool        `json:"merkleProof,omitempty"`
-	MerkleProofFormat  *string     `json:"merkleFormat,omitempty"`
+	MerkleProofFormat  *string     `json:"merkleFormat,omitempty" tkvalidate:"oneof=TSC"`
 	DoubleSpendCheck   bool        `json:"dsCheck,omitempty"`
 	CallBackEncryption *string     `json:"callBackEncryption,omitempty"`
 }
@@ -0,0 +1,173 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the current time to the scheduler so that schedules can be tested without
+// waiting.
+type Clock interface {
+	Now() time.Time
+
+	// NewTimer returns a timer that sends the time on its channel when the clock reaches t.
+	NewTimer(t time.Time) Timer
+}
+
+// Timer sends the time on its channel when the clock reaches the time it is set to. It can be
+// reset so that a new timer isn't needed every time the wait is changed.
+type Timer interface {
+	C() <-chan time.Time
+
+	// Reset stops the timer and sets it to fire at t. Any unreceived time from before the reset
+	// is discarded. It must not be called concurrently with receives from the channel.
+	Reset(t time.Time)
+
+	// Stop stops the timer so it doesn't fire and releases its resources.
+	Stop()
+}
+
+// SystemClock is a Clock that uses the system time.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) NewTimer(t time.Time) Timer {
+	return &systemTimer{
+		timer: time.NewTimer(time.Until(t)),
+	}
+}
+
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t *systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t *systemTimer) Reset(at time.Time) {
+	t.Stop()
+	t.timer.Reset(time.Until(at))
+}
+
+func (t *systemTimer) Stop() {
+	if !t.timer.Stop() {
+		// Drain the time if it fired and wasn't received.
+		select {
+		case <-t.timer.C:
+		default:
+		}
+	}
+}
+
+// FakeClock is a Clock that only changes when it is advanced so that schedules are deterministic.
+type FakeClock struct {
+	now     time.Time
+	waiters []*fakeTimer
+	lock    sync.Mutex
+}
+
+type fakeTimer struct {
+	clock   *FakeClock
+	at      time.Time
+	channel chan time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now: now,
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(t time.Time) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	timer := &fakeTimer{
+		clock:   c,
+		channel: make(chan time.Time, 1),
+	}
+	c.start(timer, t)
+	return timer
+}
+
+// Advance moves the clock forward and notifies any waiters whose time has been reached.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to a specific time and notifies any waiters whose time has been reached.
+func (c *FakeClock) Set(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.now = now
+
+	var remaining []*fakeTimer
+	for _, waiter := range c.waiters {
+		if waiter.at.After(now) {
+			remaining = append(remaining, waiter)
+			continue
+		}
+
+		waiter.channel <- now
+	}
+	c.waiters = remaining
+}
+
+// start fires the timer if t has been reached, otherwise adds it to the waiters. The clock's lock
+// must be held.
+func (c *FakeClock) start(timer *fakeTimer, t time.Time) {
+	timer.at = t
+	if !t.After(c.now) {
+		timer.channel <- c.now
+		return
+	}
+
+	c.waiters = append(c.waiters, timer)
+}
+
+// stop removes the timer from the waiters and discards any unreceived time. The clock's lock must
+// be held.
+func (c *FakeClock) stop(timer *fakeTimer) {
+	for i, waiter := range c.waiters {
+		if waiter == timer {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			break
+		}
+	}
+
+	select {
+	case <-timer.channel:
+	default:
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.channel
+}
+
+func (t *fakeTimer) Reset(at time.Time) {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.clock.stop(t)
+	t.clock.start(t, at)
+}
+
+func (t *fakeTimer) Stop() {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+
+	t.clock.stop(t)
+}
@@ -0,0 +1,67 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func Test_SystemTimerReset(t *testing.T) {
+	clock := SystemClock{}
+	timer := clock.NewTimer(clock.Now().Add(time.Hour))
+	defer timer.Stop()
+
+	timer.Reset(clock.Now().Add(10 * time.Millisecond))
+	select {
+	case <-timer.C():
+	case <-time.After(time.Second):
+		t.Fatalf("Timer didn't fire after reset")
+	}
+
+	// A time that fired but wasn't received is discarded by the reset.
+	timer.Reset(clock.Now())
+	time.Sleep(10 * time.Millisecond)
+	timer.Reset(clock.Now().Add(time.Hour))
+	select {
+	case <-timer.C():
+		t.Fatalf("Timer fired with time from before reset")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func Test_FakeClockWaitersRemoved(t *testing.T) {
+	ctx := context.Background()
+	start, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+	clock := NewFakeClock(start)
+
+	sch := NewScheduler(1)
+	sch.SetClock(clock)
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	// Each new job wakes the scheduler before its timer fires.
+	ran := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		sch.Schedule(ctx, &testTask{
+			name: "future",
+			at:   start.Add(time.Duration(10-i) * time.Minute),
+			ran:  ran,
+		}, JobOptions{})
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	clock.lock.Lock()
+	waiters := len(clock.waiters)
+	clock.lock.Unlock()
+	if waiters != 1 {
+		t.Errorf("Wrong waiter count : got %d, want %d", waiters, 1)
+	}
+
+	clock.Advance(time.Minute)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Task didn't run")
+	}
+}
@@ -0,0 +1,276 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CronSchedule is a Timing for the times that match a standard five field cron expression
+// (minute, hour, day of month, month, day of week) in a time zone.
+type CronSchedule struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	// When both day of month and day of week are restricted (not "*") a day matches if either of
+	// them match.
+	dayOfMonthRestricted bool
+	dayOfWeekRestricted  bool
+
+	// When the hour is restricted a local time that is repeated because of a daylight saving time
+	// change only matches the first time.
+	hourRestricted bool
+
+	location *time.Location
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+
+	cronMinute     = cronField{name: "minute", min: 0, max: 59}
+	cronHour       = cronField{name: "hour", min: 0, max: 23}
+	cronDayOfMonth = cronField{name: "day of month", min: 1, max: 31}
+	cronMonth      = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week 7 is also Sunday.
+	cronDayOfWeek = cronField{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	// cronSearchLimit is how far ahead Next searches before deciding the expression never matches,
+	// for example "0 0 30 2 *".
+	cronSearchLimit = 5 * 366 * 24 * time.Hour
+)
+
+// ParseCron parses a cron expression like "0 2 * * *" evaluated in the location. A nil location
+// is UTC. The expression can be prefixed with "CRON_TZ=<zone> " to specify the location, and the
+// macros @yearly, @monthly, @weekly, @daily and @hourly are supported.
+func ParseCron(expression string, location *time.Location) (*CronSchedule, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "CRON_TZ=") || strings.HasPrefix(expression, "TZ=") {
+		parts := strings.SplitN(expression, " ", 2)
+		zone := parts[0][strings.Index(parts[0], "=")+1:]
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "location: %s", zone)
+		}
+		location = loc
+
+		if len(parts) < 2 {
+			return nil, errors.New("Missing cron fields")
+		}
+		expression = strings.TrimSpace(parts[1])
+	}
+
+	if macro, exists := cronMacros[strings.ToLower(expression)]; exists {
+		expression = macro
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Wrong cron field count : got %d, want 5", len(fields))
+	}
+
+	result := &CronSchedule{
+		location: location,
+	}
+
+	var err error
+	if result.minute, _, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, errors.Wrap(err, cronMinute.name)
+	}
+	if result.hour, result.hourRestricted, err = parseCronField(fields[1],
+		cronHour); err != nil {
+		return nil, errors.Wrap(err, cronHour.name)
+	}
+	if result.dayOfMonth, result.dayOfMonthRestricted, err = parseCronField(fields[2],
+		cronDayOfMonth); err != nil {
+		return nil, errors.Wrap(err, cronDayOfMonth.name)
+	}
+	if result.month, _, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, errors.Wrap(err, cronMonth.name)
+	}
+	if result.dayOfWeek, result.dayOfWeekRestricted, err = parseCronField(fields[4],
+		cronDayOfWeek); err != nil {
+		return nil, errors.Wrap(err, cronDayOfWeek.name)
+	}
+
+	if result.dayOfWeek&(1<<7) != 0 {
+		result.dayOfWeek |= 1 // Sunday
+	}
+
+	return result, nil
+}
+
+// parseCronField returns a bit set of the values matching the field and true if it doesn't start
+// with "*".
+func parseCronField(text string, field cronField) (uint64, bool, error) {
+	var result uint64
+	for _, item := range strings.Split(text, ",") {
+		rangeText := item
+		step := 1
+		if i := strings.Index(item, "/"); i != -1 {
+			rangeText = item[:i]
+			s, err := strconv.Atoi(item[i+1:])
+			if err != nil || s < 1 {
+				return 0, false, fmt.Errorf("Invalid step : %s", item)
+			}
+			step = s
+		}
+
+		var low, high int
+		if rangeText == "*" {
+			low, high = field.min, field.max
+		} else if i := strings.Index(rangeText, "-"); i != -1 {
+			var err error
+			if low, err = parseCronValue(rangeText[:i], field); err != nil {
+				return 0, false, err
+			}
+			if high, err = parseCronValue(rangeText[i+1:], field); err != nil {
+				return 0, false, err
+			}
+		} else {
+			var err error
+			if low, err = parseCronValue(rangeText, field); err != nil {
+				return 0, false, err
+			}
+			high = low
+			if step != 1 {
+				high = field.max // "a/n" means every n starting at a
+			}
+		}
+
+		if low > high {
+			return 0, false, fmt.Errorf("Invalid range : %s", item)
+		}
+
+		for value := low; value <= high; value += step {
+			result |= 1 << uint(value)
+		}
+	}
+
+	return result, !strings.HasPrefix(text, "*"), nil
+}
+
+func parseCronValue(text string, field cronField) (int, error) {
+	if value, exists := field.names[strings.ToLower(text)]; exists {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(text)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid value : %s", text)
+	}
+
+	if value < field.min || value > field.max {
+		return 0, fmt.Errorf("Value out of range %d-%d : %d", field.min, field.max, value)
+	}
+
+	return value, nil
+}
+
+// Location returns the time zone the schedule is evaluated in.
+func (s *CronSchedule) Location() *time.Location {
+	return s.location
+}
+
+// Next returns the first time after the specified time that matches the schedule, or a zero time
+// if there isn't one. Times that don't exist in the location because of a daylight saving time
+// change are skipped. Times that are repeated only match the first time when the hour is
+// restricted.
+func (s *CronSchedule) Next(after time.Time) time.Time {
+	// Step in absolute time because the local time is ambiguous when it is repeated.
+	t := after.Truncate(time.Minute).Add(time.Minute).In(s.location)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = advanceCron(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location))
+			continue
+		}
+
+		if !s.matchesDay(t) {
+			t = advanceCron(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location))
+			continue
+		}
+
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = advanceCron(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0,
+				s.location))
+			continue
+		}
+
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = advanceCron(t, t.Add(time.Minute))
+			continue
+		}
+
+		if s.hourRestricted && isRepeatedTime(t) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		if !t.After(after) {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if s.dayOfMonthRestricted && s.dayOfWeekRestricted {
+		return dayOfMonth || dayOfWeek
+	}
+	return dayOfMonth && dayOfWeek
+}
+
+// isRepeatedTime returns true if the local time of t already happened earlier because the clocks
+// were set back.
+func isRepeatedTime(t time.Time) bool {
+	first := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(),
+		t.Nanosecond(), t.Location())
+	return first.Before(t)
+}
+
+// advanceCron returns next, unless a daylight saving time change normalized it to a time that
+// isn't after current, in which case it returns the next minute so the search always progresses.
+func advanceCron(current, next time.Time) time.Time {
+	if next.After(current) {
+		return next
+	}
+	return current.Add(time.Minute)
+}
@@ -0,0 +1,273 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_CronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone data not available : %s", err)
+	}
+
+	tests := []struct {
+		expression string
+		location   *time.Location
+		after      string
+		want       string
+	}{
+		{"0 2 * * *", nil, "2024-01-01T00:00:00Z", "2024-01-01T02:00:00Z"},
+		{"0 2 * * *", nil, "2024-01-01T02:00:00Z", "2024-01-02T02:00:00Z"},
+		{"*/15 * * * *", nil, "2024-01-01T00:07:30Z", "2024-01-01T00:15:00Z"},
+		{"30 9 * * mon-fri", nil, "2024-01-05T10:00:00Z", "2024-01-08T09:30:00Z"}, // Fri to Mon
+		{"0 0 1 */3 *", nil, "2024-02-10T00:00:00Z", "2024-04-01T00:00:00Z"},
+		{"0 0 29 2 *", nil, "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"0 12 13 * 5", nil, "2024-01-01T00:00:00Z", "2024-01-05T12:00:00Z"}, // 13th or Friday
+		{"0 0 * * 7", nil, "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},   // 7 is Sunday
+		{"@hourly", nil, "2024-01-01T00:59:00Z", "2024-01-01T01:00:00Z"},
+		{"@weekly", nil, "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},
+		{"0 2 * * *", newYork, "2024-01-01T00:00:00Z", "2024-01-01T07:00:00Z"},
+		{"CRON_TZ=America/New_York 0 2 * * *", nil, "2024-07-01T00:00:00Z",
+			"2024-07-01T06:00:00Z"},
+		// 2:30 doesn't exist on the spring forward day so that day is skipped.
+		{"30 2 * * *", newYork, "2024-03-10T05:00:00Z", "2024-03-11T06:30:00Z"},
+		// 1:00 to 2:00 is repeated on the fall back day, 5:00 to 6:00 EDT then 6:00 to 7:00 EST.
+		{"30 1 * * *", newYork, "2024-11-03T05:00:00Z", "2024-11-03T05:30:00Z"},
+		{"30 1 * * *", newYork, "2024-11-03T05:30:00Z", "2024-11-04T06:30:00Z"},
+		{"30 1 * * *", newYork, "2024-11-03T06:45:00Z", "2024-11-04T06:30:00Z"},
+		{"*/15 * * * *", newYork, "2024-11-03T05:45:00Z", "2024-11-03T06:00:00Z"},
+		{"*/15 * * * *", newYork, "2024-11-03T06:45:00Z", "2024-11-03T07:00:00Z"},
+		{"0 0 30 2 *", nil, "2024-01-01T00:00:00Z", ""}, // never
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expression, tt.location)
+			if err != nil {
+				t.Fatalf("Failed to parse : %s", err)
+			}
+
+			after, _ := time.Parse(time.RFC3339, tt.after)
+			got := schedule.Next(after)
+
+			if len(tt.want) == 0 {
+				if !got.IsZero() {
+					t.Errorf("Wrong next : got %s, want zero", got)
+				}
+				return
+			}
+
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !got.Equal(want) {
+				t.Errorf("Wrong next : got %s, want %s", got.UTC(), want)
+			}
+		})
+	}
+}
+
+func Test_CronParseErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * foo *",
+		"CRON_TZ=Not/AZone * * * * *",
+	} {
+		if _, err := ParseCron(expression, nil); err == nil {
+			t.Errorf("Expression should be invalid : %q", expression)
+		}
+	}
+}
+
+type testProcess struct {
+	runs    int
+	release chan interface{}
+	ran     chan int
+	lock    sync.Mutex
+}
+
+func (p *testProcess) Run(ctx context.Context) {
+	p.lock.Lock()
+	p.runs++
+	runs := p.runs
+	p.lock.Unlock()
+
+	if p.release != nil {
+		<-p.release
+	}
+
+	if p.ran != nil {
+		p.ran <- runs
+	}
+}
+
+func Test_CronTaskFakeClock(t *testing.T) {
+	ctx := context.Background()
+	start, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+	clock := NewFakeClock(start)
+
+	process := &testProcess{ran: make(chan int, 10)}
+	task, err := NewCronTask("nightly", process, "0 2 * * *", time.UTC, PeriodicOptions{
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create task : %s", err)
+	}
+
+	sch := NewScheduler(1)
+	sch.SetClock(clock)
+	if err := sch.ScheduleJob(ctx, task); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	clock.Advance(time.Hour)
+	select {
+	case <-process.ran:
+		t.Fatalf("Task ran early")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case <-process.ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Task didn't run")
+	}
+
+	want, _ := time.Parse(time.RFC3339, "2024-01-02T02:00:00Z")
+	if next := task.NextRun(clock.Now()); !next.Equal(want) {
+		t.Errorf("Wrong next run : got %s, want %s", next, want)
+	}
+
+	clock.Advance(24 * time.Hour)
+	select {
+	case runs := <-process.ran:
+		if runs != 2 {
+			t.Errorf("Wrong run count : got %d, want %d", runs, 2)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Task didn't run the next day")
+	}
+}
+
+func Test_PeriodicJitter(t *testing.T) {
+	start, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+	clock := NewFakeClock(start)
+
+	for i := 0; i < 100; i++ {
+		task := NewScheduledTask("jitter", &testProcess{}, Interval(time.Minute), PeriodicOptions{
+			Jitter: 10 * time.Second,
+			Clock:  clock,
+		})
+
+		next := task.NextRun(clock.Now())
+		if next.Before(start.Add(time.Minute)) || !next.Before(start.Add(70*time.Second)) {
+			t.Fatalf("Next run outside jitter window : %s", next)
+		}
+	}
+}
+
+func Test_PeriodicSkipIfRunning(t *testing.T) {
+	tests := []struct {
+		skipIfRunning bool
+		wantNext      time.Duration // after start, from the start of the last run
+		wantCatchUp   bool
+	}{
+		{skipIfRunning: true, wantNext: 7 * time.Minute},
+		{skipIfRunning: false, wantNext: 7 * time.Minute, wantCatchUp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("skip %t", tt.skipIfRunning), func(t *testing.T) {
+			ctx := context.Background()
+			start, _ := time.Parse(time.RFC3339, "2024-01-01T00:00:00Z")
+			clock := NewFakeClock(start)
+
+			process := &testProcess{
+				release: make(chan interface{}),
+				ran:     make(chan int, 10),
+			}
+			task := NewScheduledTask("skip", process, Interval(time.Minute), PeriodicOptions{
+				SkipIfRunning: tt.skipIfRunning,
+				Clock:         clock,
+			})
+
+			sch := NewScheduler(1)
+			sch.SetClock(clock)
+			if err := sch.ScheduleJob(ctx, task); err != nil {
+				t.Fatalf("Failed to schedule : %s", err)
+			}
+
+			stop := startScheduler(t, sch)
+			defer stop()
+			defer close(process.release)
+
+			clock.Advance(time.Minute)
+			waitForRunStart(t, process, 1)
+
+			// Times pass while the process is running.
+			clock.Advance(5 * time.Minute)
+			process.release <- true
+
+			select {
+			case <-process.ran:
+			case <-time.After(time.Second):
+				t.Fatalf("Task didn't finish")
+			}
+
+			if tt.wantCatchUp {
+				// The missed run starts as soon as the first finishes.
+				waitForRunStart(t, process, 2)
+				process.release <- true
+				<-process.ran
+			} else {
+				select {
+				case <-process.ran:
+					t.Fatalf("Task should not run again until the next time")
+				case <-time.After(50 * time.Millisecond):
+				}
+			}
+
+			process.lock.Lock()
+			runs := process.runs
+			process.lock.Unlock()
+			if tt.wantCatchUp && runs != 2 || !tt.wantCatchUp && runs != 1 {
+				t.Errorf("Wrong run count : got %d", runs)
+			}
+
+			want := start.Add(tt.wantNext)
+			if next := task.NextRun(clock.Now()); !next.Equal(want) {
+				t.Errorf("Wrong next run : got %s, want %s", next, want)
+			}
+		})
+	}
+}
+
+// waitForRunStart waits until the process has started the specified number of runs.
+func waitForRunStart(t *testing.T, process *testProcess, runs int) {
+	for i := 0; i < 100; i++ {
+		process.lock.Lock()
+		started := process.runs
+		process.lock.Unlock()
+
+		if started >= runs {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Run %d didn't start", runs)
+}
@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// JobID identifies a job in the scheduler so that it can be canceled.
+type JobID uint64
+
+// JobOptions specifies how the scheduler runs a task.
+type JobOptions struct {
+	// Priority determines which job is run first when more jobs are ready than there are available
+	// workers. Higher values run first.
+	Priority int `json:"priority"`
+
+	// Timeout is the maximum time the task is given to run before its context is canceled. Zero
+	// means no timeout.
+	Timeout time.Duration `json:"timeout"`
+
+	// Retry specifies how the task is retried when it returns an error. When nil the task is
+	// rescheduled normally after an error.
+	Retry *RetryPolicy `json:"retry,omitempty"`
+}
+
+// RetryPolicy specifies how a failed task is retried with an exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the task is run before it is given up on. Zero means no
+	// limit.
+	MaxAttempts uint `json:"max_attempts"`
+
+	InitialDelay time.Duration `json:"initial_delay"`
+	MaxDelay     time.Duration `json:"max_delay"` // zero means no limit
+	Multiplier   float64       `json:"multiplier"`
+}
+
+// Delay returns the delay before the next attempt after the specified number of consecutive failed
+// attempts, and false if the task should not be retried.
+func (p RetryPolicy) Delay(attempts uint) (time.Duration, bool) {
+	if p.MaxAttempts != 0 && attempts >= p.MaxAttempts {
+		return 0, false
+	}
+
+	multiplier := p.Multiplier
+	if multiplier < 1.0 {
+		multiplier = 1.0
+	}
+
+	delay := float64(p.InitialDelay)
+	for i := uint(1); i < attempts; i++ {
+		delay *= multiplier
+		if p.MaxDelay != 0 && delay > float64(p.MaxDelay) {
+			return p.MaxDelay, true
+		}
+	}
+
+	return time.Duration(delay), true
+}
+
+// job is a task that has been scheduled.
+type job struct {
+	id       JobID
+	task     TimedTask
+	original Task // legacy task used to match cancel requests
+	options  JobOptions
+	next     time.Time
+	attempts uint // consecutive failed attempts
+
+	persistentID string // storage id of persistent jobs
+
+	// storageLock is held while a persistent job is written to or removed from storage so that a
+	// job being canceled isn't written back after it is removed.
+	storageLock sync.Mutex
+
+	isCanceled bool
+
+	timeIndex int // index within the time heap, -1 when not in it
+}
+
+// timeHeap orders jobs by the time they should next run.
+type timeHeap []*job
+
+func (h timeHeap) Len() int { return len(h) }
+
+func (h timeHeap) Less(i, j int) bool {
+	if h[i].next.Equal(h[j].next) {
+		return h[i].options.Priority > h[j].options.Priority
+	}
+	return h[i].next.Before(h[j].next)
+}
+
+func (h timeHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].timeIndex = i
+	h[j].timeIndex = j
+}
+
+func (h *timeHeap) Push(x interface{}) {
+	j := x.(*job)
+	j.timeIndex = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *timeHeap) Pop() interface{} {
+	old := *h
+	l := len(old)
+	j := old[l-1]
+	old[l-1] = nil
+	j.timeIndex = -1
+	*h = old[:l-1]
+	return j
+}
+
+// readyHeap orders jobs that are ready to run by priority, then by the time they were supposed to
+// run.
+type readyHeap []*job
+
+func (h readyHeap) Len() int { return len(h) }
+
+func (h readyHeap) Less(i, j int) bool {
+	if h[i].options.Priority == h[j].options.Priority {
+		return h[i].next.Before(h[j].next)
+	}
+	return h[i].options.Priority > h[j].options.Priority
+}
+
+func (h readyHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *readyHeap) Push(x interface{}) {
+	*h = append(*h, x.(*job))
+}
+
+func (h *readyHeap) Pop() interface{} {
+	old := *h
+	l := len(old)
+	j := old[l-1]
+	old[l-1] = nil
+	*h = old[:l-1]
+	return j
+}
+
+var (
+	_ heap.Interface = (*timeHeap)(nil)
+	_ heap.Interface = (*readyHeap)(nil)
+)
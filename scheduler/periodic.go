@@ -2,6 +2,8 @@ package scheduler
 
 import (
 	"context"
+	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -9,40 +11,137 @@ type PeriodicTaskInterface interface {
 	Run(context.Context)
 }
 
-// PeriodicTask is a Scheduler Task that runs a process at a specified frequency.
+// Timing determines when a PeriodicTask runs.
+type Timing interface {
+	// Next returns the first time the task should run after the specified time, or a zero time if
+	// it should not run again.
+	Next(after time.Time) time.Time
+}
+
+// Interval is a Timing that runs a task at a fixed frequency.
+type Interval time.Duration
+
+// PeriodicOptions specifies optional behavior of a PeriodicTask.
+type PeriodicOptions struct {
+	// Jitter is the maximum random delay added to each run time so that instances with the same
+	// schedule don't all run at once.
+	Jitter time.Duration
+
+	// SkipIfRunning skips the runs that were scheduled while the process was executing, so the
+	// next run is the first scheduled time after it finishes. Otherwise runs that were missed are
+	// caught up by running again as soon as the process finishes.
+	SkipIfRunning bool
+
+	// Clock provides the current time. The system clock is used when nil.
+	Clock Clock
+}
+
+// PeriodicTask is a Scheduler Task that runs a process at a specified frequency or schedule.
 type PeriodicTask struct {
-	name      string
-	process   PeriodicTaskInterface
-	frequency time.Duration
-	next      time.Time
+	name    string
+	process PeriodicTaskInterface
+	timing  Timing
+	options PeriodicOptions
+	next    time.Time
+
+	isRunning bool
+	lock      sync.Mutex
 }
 
 func NewPeriodicTask(name string, process PeriodicTaskInterface, frequency time.Duration) *PeriodicTask {
-	return &PeriodicTask{
-		name:      name,
-		process:   process,
-		frequency: frequency,
-		next:      time.Now().Add(frequency),
+	return NewScheduledTask(name, process, Interval(frequency), PeriodicOptions{})
+}
+
+// NewCronTask creates a task that runs a process at the times matching a cron expression, like
+// "0 2 * * *", in the location.
+func NewCronTask(name string, process PeriodicTaskInterface, expression string,
+	location *time.Location, options PeriodicOptions) (*PeriodicTask, error) {
+
+	schedule, err := ParseCron(expression, location)
+	if err != nil {
+		return nil, err
 	}
+
+	return NewScheduledTask(name, process, schedule, options), nil
+}
+
+// NewScheduledTask creates a task that runs a process at the times specified by the timing.
+func NewScheduledTask(name string, process PeriodicTaskInterface, timing Timing,
+	options PeriodicOptions) *PeriodicTask {
+
+	if options.Clock == nil {
+		options.Clock = SystemClock{}
+	}
+
+	result := &PeriodicTask{
+		name:    name,
+		process: process,
+		timing:  timing,
+		options: options,
+	}
+	result.next = result.nextAfter(options.Clock.Now())
+	return result
+}
+
+// Next implements Timing.
+func (i Interval) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(i))
 }
 
 // IsReady returns true when a job should be executed.
 func (pp *PeriodicTask) IsReady(ctx context.Context) bool {
-	return time.Now().After(pp.next)
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	return !pp.next.IsZero() && pp.options.Clock.Now().After(pp.next)
 }
 
 // Run executes the job.
 func (pp *PeriodicTask) Run(ctx context.Context) {
-	// Schedule next time
-	pp.next = time.Now().Add(pp.frequency)
+	pp.lock.Lock()
+	if pp.isRunning && pp.options.SkipIfRunning {
+		pp.lock.Unlock()
+		return
+	}
+	pp.isRunning = true
+	start := pp.options.Clock.Now()
+	pp.lock.Unlock()
 
 	// Run process
 	pp.process.Run(ctx)
+
+	pp.lock.Lock()
+	pp.isRunning = false
+
+	// Schedule next time
+	if pp.options.SkipIfRunning {
+		pp.next = pp.nextAfter(pp.options.Clock.Now())
+	} else {
+		pp.next = pp.nextAfter(start)
+	}
+	pp.lock.Unlock()
+}
+
+// NextRun returns the next time the job should be executed.
+func (pp *PeriodicTask) NextRun(now time.Time) time.Time {
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	return pp.next
+}
+
+// Execute runs the job for the scheduler.
+func (pp *PeriodicTask) Execute(ctx context.Context) error {
+	pp.Run(ctx)
+	return nil
 }
 
 // IsComplete returns true when a job should be removed from the scheduler.
 func (pp *PeriodicTask) IsComplete(ctx context.Context) bool {
-	return false
+	pp.lock.Lock()
+	defer pp.lock.Unlock()
+
+	return pp.next.IsZero()
 }
 
 // Equal returns true if another job matches it. Used to cancel jobs.
@@ -53,3 +152,14 @@ func (pp *PeriodicTask) Equal(other Task) bool {
 	}
 	return pp.name == otherPP.name
 }
+
+// nextAfter returns the next run time after the specified time including jitter. The lock must be
+// held.
+func (pp *PeriodicTask) nextAfter(after time.Time) time.Time {
+	next := pp.timing.Next(after)
+	if next.IsZero() || pp.options.Jitter <= 0 {
+		return next
+	}
+
+	return next.Add(time.Duration(rand.Int63n(int64(pp.options.Jitter))))
+}
@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/tokenized/logger"
+	"github.com/tokenized/pkg/json"
+	"github.com/tokenized/pkg/storage"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// PersistentTask is a task that can be written to storage so that it is restored when the
+// scheduler restarts.
+type PersistentTask interface {
+	TimedTask
+
+	// TaskType returns the name the task's type was registered with in the Registry.
+	TaskType() string
+
+	Serialize(w io.Writer) error
+	Deserialize(r io.Reader) error
+}
+
+// Registry contains the task types that can be restored from storage.
+type Registry struct {
+	factories map[string]func() PersistentTask
+	lock      sync.Mutex
+}
+
+// jobRecord is the storage representation of a persistent job.
+type jobRecord struct {
+	ID       string     `json:"id"`
+	TaskType string     `json:"task_type"`
+	NextRun  int64      `json:"next_run"` // nanoseconds since epoch
+	Attempts uint       `json:"attempts"`
+	Options  JobOptions `json:"options"`
+	Payload  []byte     `json:"payload"`
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]func() PersistentTask),
+	}
+}
+
+// Register adds a task type. The factory must return a new empty task of that type that the
+// payload is deserialized into.
+func (r *Registry) Register(taskType string, factory func() PersistentTask) {
+	r.lock.Lock()
+	r.factories[taskType] = factory
+	r.lock.Unlock()
+}
+
+func (r *Registry) newTask(taskType string) (PersistentTask, error) {
+	r.lock.Lock()
+	factory, exists := r.factories[taskType]
+	r.lock.Unlock()
+
+	if !exists {
+		return nil, fmt.Errorf("Task type not registered : %s", taskType)
+	}
+
+	return factory(), nil
+}
+
+// SetPersistence sets the storage that persistent jobs are written to under the path prefix. It
+// must be called before persistent jobs are scheduled or restored.
+func (sch *Scheduler) SetPersistence(store storage.Storage, pathPrefix string,
+	registry *Registry) {
+
+	sch.lock.Lock()
+	sch.store = store
+	sch.pathPrefix = pathPrefix
+	sch.registry = registry
+	sch.lock.Unlock()
+}
+
+// SchedulePersistent adds a task to the scheduler and writes it to storage so that it will be
+// restored by Restore after a restart. Tasks are run at least once, so a task that was running when
+// the process stopped will be run again after it is restored.
+func (sch *Scheduler) SchedulePersistent(ctx context.Context, task PersistentTask,
+	options JobOptions) (JobID, error) {
+
+	j := &job{
+		task:         task,
+		options:      options,
+		next:         task.NextRun(sch.now()),
+		persistentID: uuid.New().String(),
+		timeIndex:    -1,
+	}
+
+	if j.next.IsZero() {
+		return 0, nil // already complete
+	}
+
+	if err := sch.saveJob(ctx, j); err != nil {
+		return 0, errors.Wrap(err, "save")
+	}
+
+	return sch.add(j), nil
+}
+
+// Restore reads the persistent jobs from storage and schedules them. It should be called once at
+// startup. Jobs with task types that are not registered, or that can't be decoded, are logged and
+// left in storage so that one bad record doesn't prevent the other jobs from being restored.
+func (sch *Scheduler) Restore(ctx context.Context) error {
+	sch.lock.Lock()
+	store := sch.store
+	pathPrefix := sch.pathPrefix
+	registry := sch.registry
+	sch.lock.Unlock()
+
+	if store == nil {
+		return errors.New("Persistence not set")
+	}
+
+	paths, err := store.List(ctx, pathPrefix+"/")
+	if err != nil {
+		return errors.Wrap(err, "list")
+	}
+
+	for _, path := range paths {
+		b, err := store.Read(ctx, path)
+		if err != nil {
+			return errors.Wrapf(err, "read: %s", path)
+		}
+
+		record := &jobRecord{}
+		if err := json.Unmarshal(b, record); err != nil {
+			logger.WarnWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+			}, "Failed to unmarshal scheduled job : %s", err)
+			continue
+		}
+
+		task, err := registry.newTask(record.TaskType)
+		if err != nil {
+			logger.WarnWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+			}, "Failed to restore scheduled job : %s", err)
+			continue
+		}
+
+		if err := task.Deserialize(bytes.NewReader(record.Payload)); err != nil {
+			logger.WarnWithFields(ctx, []logger.Field{
+				logger.String("path", path),
+			}, "Failed to deserialize scheduled job : %s", err)
+			continue
+		}
+
+		sch.add(&job{
+			task:         task,
+			options:      record.Options,
+			next:         time.Unix(0, record.NextRun),
+			attempts:     record.Attempts,
+			persistentID: record.ID,
+			timeIndex:    -1,
+		})
+	}
+
+	return nil
+}
+
+// saveJob writes a persistent job to storage.
+func (sch *Scheduler) saveJob(ctx context.Context, j *job) error {
+	sch.lock.Lock()
+	store := sch.store
+	pathPrefix := sch.pathPrefix
+	sch.lock.Unlock()
+
+	if store == nil {
+		return errors.New("Persistence not set")
+	}
+
+	task := j.task.(PersistentTask)
+	buf := &bytes.Buffer{}
+	if err := task.Serialize(buf); err != nil {
+		return errors.Wrap(err, "serialize")
+	}
+
+	record := &jobRecord{
+		ID:       j.persistentID,
+		TaskType: task.TaskType(),
+		NextRun:  j.next.UnixNano(),
+		Attempts: j.attempts,
+		Options:  j.options,
+		Payload:  buf.Bytes(),
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "marshal")
+	}
+
+	if err := store.Write(ctx, jobPath(pathPrefix, j.persistentID), b, nil); err != nil {
+		return errors.Wrap(err, "write")
+	}
+
+	return nil
+}
+
+// removeJob removes a persistent job from storage.
+func (sch *Scheduler) removeJob(ctx context.Context, j *job) error {
+	sch.lock.Lock()
+	store := sch.store
+	pathPrefix := sch.pathPrefix
+	sch.lock.Unlock()
+
+	if err := store.Remove(ctx, jobPath(pathPrefix, j.persistentID)); err != nil &&
+		errors.Cause(err) != storage.ErrNotFound {
+		return errors.Wrap(err, "remove")
+	}
+
+	return nil
+}
+
+func jobPath(pathPrefix, id string) string {
+	return fmt.Sprintf("%s/%s", pathPrefix, id)
+}
@@ -0,0 +1,347 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tokenized/pkg/storage"
+)
+
+// testPersistentTask runs once at a specific time and fails until it has been run failCount
+// times.
+type testPersistentTask struct {
+	At        time.Time
+	FailCount uint32
+
+	runs uint32
+	ran  chan uint32
+	lock sync.Mutex
+}
+
+func (t *testPersistentTask) TaskType() string {
+	return "test"
+}
+
+func (t *testPersistentTask) NextRun(now time.Time) time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.runs > t.FailCount {
+		return time.Time{}
+	}
+	return t.At
+}
+
+func (t *testPersistentTask) Execute(ctx context.Context) error {
+	t.lock.Lock()
+	t.runs++
+	runs := t.runs
+	t.lock.Unlock()
+
+	t.ran <- runs
+	if runs <= t.FailCount {
+		return errors.New("Test failure")
+	}
+	return nil
+}
+
+func (t *testPersistentTask) Serialize(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, t.At.UnixNano()); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, t.FailCount)
+}
+
+func (t *testPersistentTask) Deserialize(r io.Reader) error {
+	var at int64
+	if err := binary.Read(r, binary.LittleEndian, &at); err != nil {
+		return err
+	}
+	t.At = time.Unix(0, at)
+	return binary.Read(r, binary.LittleEndian, &t.FailCount)
+}
+
+func Test_PersistentRestore(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMockStorage()
+	ran := make(chan uint32, 10)
+
+	registry := NewRegistry()
+	registry.Register("test", func() PersistentTask {
+		return &testPersistentTask{ran: ran}
+	})
+
+	// Schedule a job then "restart" before it runs.
+	first := NewScheduler(1)
+	first.SetPersistence(store, "jobs", registry)
+	if _, err := first.SchedulePersistent(ctx, &testPersistentTask{
+		At:  time.Now().Add(50 * time.Millisecond),
+		ran: ran,
+	}, JobOptions{}); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	paths, _ := store.List(ctx, "jobs/")
+	if len(paths) != 1 {
+		t.Fatalf("Wrong stored job count : got %d, want %d", len(paths), 1)
+	}
+
+	second := NewScheduler(1)
+	second.SetPersistence(store, "jobs", registry)
+	if err := second.Restore(ctx); err != nil {
+		t.Fatalf("Failed to restore : %s", err)
+	}
+
+	stop := startScheduler(t, second)
+	defer stop()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Restored job didn't run")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	paths, _ = store.List(ctx, "jobs/")
+	if len(paths) != 0 {
+		t.Errorf("Completed job should be removed from storage : %v", paths)
+	}
+}
+
+func Test_PersistentRestoreCorrupt(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMockStorage()
+	ran := make(chan uint32, 10)
+
+	registry := NewRegistry()
+	registry.Register("test", func() PersistentTask {
+		return &testPersistentTask{ran: ran}
+	})
+
+	first := NewScheduler(1)
+	first.SetPersistence(store, "jobs", registry)
+	if _, err := first.SchedulePersistent(ctx, &testPersistentTask{
+		At:  time.Now().Add(50 * time.Millisecond),
+		ran: ran,
+	}, JobOptions{}); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	// A record that isn't json and a record with a payload that can't be deserialized.
+	if err := store.Write(ctx, "jobs/0-not-json", []byte("not json"), nil); err != nil {
+		t.Fatalf("Failed to write : %s", err)
+	}
+	if err := store.Write(ctx, "jobs/1-bad-payload",
+		[]byte(`{"id":"1-bad-payload","task_type":"test","payload":"01"}`), nil); err != nil {
+		t.Fatalf("Failed to write : %s", err)
+	}
+
+	second := NewScheduler(1)
+	second.SetPersistence(store, "jobs", registry)
+	if err := second.Restore(ctx); err != nil {
+		t.Fatalf("Failed to restore : %s", err)
+	}
+
+	stop := startScheduler(t, second)
+	defer stop()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Restored job didn't run")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	paths, _ := store.List(ctx, "jobs/")
+	if len(paths) != 2 {
+		t.Errorf("Bad records should be left in storage : %v", paths)
+	}
+}
+
+func Test_PersistentRetry(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMockStorage()
+	ran := make(chan uint32, 10)
+
+	sch := NewScheduler(1)
+	sch.SetPersistence(store, "jobs", NewRegistry())
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	start := time.Now()
+	if _, err := sch.SchedulePersistent(ctx, &testPersistentTask{
+		At:        start,
+		FailCount: 2,
+		ran:       ran,
+	}, JobOptions{
+		Retry: &RetryPolicy{
+			MaxAttempts:  5,
+			InitialDelay: 20 * time.Millisecond,
+			Multiplier:   2.0,
+		},
+	}); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	for i := uint32(1); i <= 3; i++ {
+		select {
+		case runs := <-ran:
+			if runs != i {
+				t.Errorf("Wrong run count : got %d, want %d", runs, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Job wasn't retried")
+		}
+	}
+
+	// Retry delays of 20ms then 40ms.
+	if elapsed := time.Since(start); elapsed < 60*time.Millisecond {
+		t.Errorf("Retries didn't back off : %s", elapsed)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	paths, _ := store.List(ctx, "jobs/")
+	if len(paths) != 0 {
+		t.Errorf("Completed job should be removed from storage : %v", paths)
+	}
+}
+
+func Test_RetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:  4,
+		InitialDelay: time.Second,
+		MaxDelay:     3 * time.Second,
+		Multiplier:   2.0,
+	}
+
+	wants := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+	for i, want := range wants {
+		got, retry := policy.Delay(uint(i + 1))
+		if !retry {
+			t.Fatalf("Attempt %d should be retried", i+1)
+		}
+		if got != want {
+			t.Errorf("Wrong delay for attempt %d : got %s, want %s", i+1, got, want)
+		}
+	}
+
+	if _, retry := policy.Delay(4); retry {
+		t.Errorf("Attempt 4 should not be retried")
+	}
+}
+
+// blockingStorage blocks writes after they are enabled until they are released.
+type blockingStorage struct {
+	storage.Storage
+
+	block   bool
+	writing chan string
+	release chan interface{}
+	once    sync.Once
+	lock    sync.Mutex
+}
+
+// unblock releases blocked writes and stops blocking new writes.
+func (s *blockingStorage) unblock() {
+	s.once.Do(func() {
+		s.lock.Lock()
+		s.block = false
+		s.lock.Unlock()
+		close(s.release)
+	})
+}
+
+func (s *blockingStorage) Write(ctx context.Context, path string, data []byte,
+	options *storage.Options) error {
+
+	s.lock.Lock()
+	block := s.block
+	s.lock.Unlock()
+
+	if block {
+		s.writing <- path
+		<-s.release
+	}
+
+	return s.Storage.Write(ctx, path, data, options)
+}
+
+func Test_PersistentCancelWhileSaving(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingStorage{
+		Storage: storage.NewMockStorage(),
+		writing: make(chan string, 1),
+		release: make(chan interface{}),
+	}
+	ran := make(chan uint32, 10)
+
+	sch := NewScheduler(1)
+	sch.SetPersistence(store, "jobs", NewRegistry())
+	stop := startScheduler(t, sch)
+	defer stop()
+	defer store.unblock() // the scheduler can't stop while a write is blocked
+
+	// The task fails so it is saved again after it runs.
+	id, err := sch.SchedulePersistent(ctx, &testPersistentTask{
+		At:        time.Now().Add(20 * time.Millisecond),
+		FailCount: 10,
+		ran:       ran,
+	}, JobOptions{
+		Retry: &RetryPolicy{
+			InitialDelay: time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	store.lock.Lock()
+	store.block = true
+	store.lock.Unlock()
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Job didn't run")
+	}
+
+	select {
+	case <-store.writing:
+	case <-time.After(time.Second):
+		t.Fatalf("Job wasn't saved after running")
+	}
+
+	// Cancel while the job is being saved after it ran.
+	canceled := make(chan error, 1)
+	go func() {
+		canceled <- sch.Cancel(ctx, id)
+	}()
+
+	select {
+	case err := <-canceled:
+		t.Fatalf("Cancel should wait for the job to be saved : %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	store.unblock()
+
+	select {
+	case err := <-canceled:
+		if err != nil {
+			t.Fatalf("Failed to cancel : %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Cancel didn't complete")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	paths, _ := store.List(ctx, "jobs/")
+	if len(paths) != 0 {
+		t.Errorf("Canceled job should be removed from storage : %v", paths)
+	}
+}
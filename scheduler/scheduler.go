@@ -1,25 +1,60 @@
 package scheduler
 
 import (
+	"container/heap"
 	"context"
-	"errors"
 	"sync"
 	"time"
 
 	"github.com/tokenized/logger"
+	"github.com/tokenized/pkg/storage"
+
+	"github.com/pkg/errors"
 )
 
 const (
 	SubSystem = "Scheduler" // For logger
+
+	// DefaultWorkerCount is the number of tasks that can run concurrently when the scheduler is
+	// not created with NewScheduler.
+	DefaultWorkerCount = 4
+
+	// DefaultPollFrequency is how often a Task that doesn't implement TimedTask is checked to see
+	// if it is ready.
+	DefaultPollFrequency = 500 * time.Millisecond
+
+	// idleDelay is how long the scheduler waits when there are no jobs. It is woken when a job is
+	// scheduled.
+	idleDelay = time.Hour
 )
 
 var (
 	NotFound = errors.New("Task not found")
+
+	AlreadyRunning = errors.New("Scheduler already running")
 )
 
-// Scheduler provides the ability to schedule tasks to run at when they are ready.
+// Scheduler provides the ability to schedule tasks to run at when they are ready. Tasks are kept
+// in order of when they are next ready and run by a pool of workers so that a slow task doesn't
+// delay other tasks. Scheduling and canceling jobs never waits for tasks to run.
 type Scheduler struct {
-	jobs          []Task
+	workerCount int
+	clock       Clock
+
+	jobs   map[JobID]*job
+	byTime timeHeap
+	ready  readyHeap
+	nextID JobID
+
+	// Persistent jobs are written to the store so they can be restored.
+	store      storage.Storage
+	pathPrefix string
+	registry   *Registry
+
+	wake chan interface{} // signals the scheduler to recheck jobs
+	stop chan interface{}
+	done chan interface{}
+
 	lock          sync.Mutex
 	isRunning     bool
 	stopRequested bool
@@ -40,76 +75,407 @@ type Task interface {
 	Equal(other Task) bool
 }
 
-// ScheduleJob adds a task to the scheduler.
-func (sch *Scheduler) ScheduleJob(ctx context.Context, job Task) error {
+// TimedTask provides an interface that tells Scheduler exactly when to do something so it doesn't
+// have to be polled.
+type TimedTask interface {
+	// NextRun returns the time the task should next run, given the current time, or a zero time
+	// when the task is complete and should be removed from the scheduler.
+	NextRun(now time.Time) time.Time
+
+	// Execute runs the task. The context is canceled when the job's timeout is exceeded.
+	Execute(ctx context.Context) error
+}
+
+// NewScheduler creates a scheduler that runs up to workerCount tasks concurrently.
+func NewScheduler(workerCount int) *Scheduler {
+	result := &Scheduler{
+		workerCount: workerCount,
+	}
+	result.initialize()
+	return result
+}
+
+// initialize sets up a zero value scheduler. The lock must be held.
+func (sch *Scheduler) initialize() {
+	if sch.jobs != nil {
+		return
+	}
+
+	if sch.workerCount < 1 {
+		sch.workerCount = DefaultWorkerCount
+	}
+	if sch.clock == nil {
+		sch.clock = SystemClock{}
+	}
+	sch.jobs = make(map[JobID]*job)
+	sch.wake = make(chan interface{}, 1)
+}
+
+// SetClock sets the clock used to determine when tasks are ready. It must be called before tasks are
+// scheduled.
+func (sch *Scheduler) SetClock(clock Clock) {
 	sch.lock.Lock()
-	defer sch.lock.Unlock()
-	sch.jobs = append(sch.jobs, job)
+	sch.initialize()
+	sch.clock = clock
+	sch.lock.Unlock()
+}
+
+// now returns the current time from the scheduler's clock.
+func (sch *Scheduler) now() time.Time {
+	sch.lock.Lock()
+	sch.initialize()
+	clock := sch.clock
+	sch.lock.Unlock()
+
+	return clock.Now()
+}
+
+// ScheduleJob adds a task to the scheduler. Tasks that also implement TimedTask are run when they
+// specify, otherwise they are checked periodically to see if they are ready.
+func (sch *Scheduler) ScheduleJob(ctx context.Context, task Task) error {
+	timedTask, isTimed := task.(TimedTask)
+	if !isTimed {
+		timedTask = NewTaskAdapter(task, DefaultPollFrequency)
+	}
+
+	sch.schedule(timedTask, task, JobOptions{})
 	return nil
 }
 
+// Schedule adds a task to the scheduler and returns an id that can be used to cancel it.
+func (sch *Scheduler) Schedule(ctx context.Context, task TimedTask, options JobOptions) JobID {
+	return sch.schedule(task, nil, options)
+}
+
+func (sch *Scheduler) schedule(task TimedTask, original Task, options JobOptions) JobID {
+	return sch.add(&job{
+		task:      task,
+		original:  original,
+		options:   options,
+		next:      task.NextRun(sch.now()),
+		timeIndex: -1,
+	})
+}
+
+// add assigns an id to a job and adds it to the jobs waiting to run.
+func (sch *Scheduler) add(j *job) JobID {
+	sch.lock.Lock()
+	sch.initialize()
+
+	sch.nextID++
+	j.id = sch.nextID
+
+	if !j.next.IsZero() {
+		sch.jobs[j.id] = j
+		heap.Push(&sch.byTime, j)
+	}
+	sch.lock.Unlock()
+
+	sch.notify()
+	return j.id
+}
+
 // CancelJob removes a job from the scheduler. The task passed in just needs to be equivalent based
 // on the task's Equal function.
 func (sch *Scheduler) CancelJob(ctx context.Context, task Task) error {
 	sch.lock.Lock()
-	defer sch.lock.Unlock()
-	for i, existing := range sch.jobs {
-		if existing.Equal(task) {
-			sch.jobs = append(sch.jobs[:i], sch.jobs[i+1:]...)
+	for _, j := range sch.jobs {
+		if j.original != nil && j.original.Equal(task) {
+			sch.cancel(j)
+			sch.lock.Unlock()
 			return nil
 		}
 	}
+	sch.lock.Unlock()
+
 	return NotFound
 }
 
-// Run monitors tasks and runs them when they are ready.
+// Cancel removes a job from the scheduler. If the job is currently running it will not be run
+// again.
+func (sch *Scheduler) Cancel(ctx context.Context, id JobID) error {
+	sch.lock.Lock()
+	j, exists := sch.jobs[id]
+	if !exists {
+		sch.lock.Unlock()
+		return NotFound
+	}
+
+	sch.cancel(j)
+	sch.lock.Unlock()
+
+	if len(j.persistentID) > 0 {
+		j.storageLock.Lock()
+		err := sch.removeJob(ctx, j)
+		j.storageLock.Unlock()
+		if err != nil {
+			return errors.Wrap(err, "remove")
+		}
+	}
+
+	return nil
+}
+
+// cancel removes a job. The lock must be held.
+func (sch *Scheduler) cancel(j *job) {
+	delete(sch.jobs, j.id)
+	j.isCanceled = true
+
+	if j.timeIndex >= 0 {
+		heap.Remove(&sch.byTime, j.timeIndex)
+	}
+	// Jobs that are ready are removed when they reach the top of the ready heap. Jobs that are
+	// running are not rescheduled.
+}
+
+// notify wakes the scheduler to recheck jobs without waiting.
+func (sch *Scheduler) notify() {
+	select {
+	case sch.wake <- true:
+	default:
+	}
+}
+
+// Run monitors tasks and runs them when they are ready. It returns immediately if Stop was called
+// before it started.
 func (sch *Scheduler) Run(ctx context.Context) error {
+	ctx = logger.ContextWithLogSubSystem(ctx, SubSystem)
+
 	sch.lock.Lock()
+	sch.initialize()
+	if sch.isRunning {
+		sch.lock.Unlock()
+		return AlreadyRunning
+	}
+	if sch.stopRequested {
+		// Stop was called before Run so the stop request is consumed.
+		sch.stopRequested = false
+		sch.lock.Unlock()
+		return nil
+	}
 	sch.isRunning = true
-	for !sch.stopRequested {
-		// Check and run tasks
-		for i, job := range sch.jobs {
-			if job.IsReady(ctx) {
-				job.Run(ctx)
-				if job.IsComplete(ctx) {
-					sch.jobs = append(sch.jobs[:i], sch.jobs[i+1:]...)
-					break // Modified list being iterated
-				}
+	sch.stop = make(chan interface{})
+	sch.done = make(chan interface{})
+	stop := sch.stop
+	workerCount := sch.workerCount
+	clock := sch.clock
+	sch.lock.Unlock()
+
+	work := make(chan *job)
+	var wait sync.WaitGroup
+	for i := 0; i < workerCount; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := range work {
+				sch.runJob(ctx, j)
 			}
+		}()
+	}
+
+	// One timer is reset on every loop so that waking early doesn't leave a timer behind.
+	timer := clock.NewTimer(clock.Now().Add(idleDelay))
+	defer timer.Stop()
+
+	for {
+		var candidate *job
+		var workChannel chan *job
+
+		sch.lock.Lock()
+		now := clock.Now()
+		for len(sch.byTime) > 0 && !sch.byTime[0].next.After(now) {
+			heap.Push(&sch.ready, heap.Pop(&sch.byTime))
+		}
+
+		for len(sch.ready) > 0 && sch.ready[0].isCanceled {
+			heap.Pop(&sch.ready)
 		}
 
-		// Unlock for sleep
+		if len(sch.ready) > 0 {
+			candidate = sch.ready[0]
+			workChannel = work // enable send to a worker
+		}
+
+		wakeTime := now.Add(idleDelay)
+		if len(sch.byTime) > 0 {
+			wakeTime = sch.byTime[0].next
+		}
 		sch.lock.Unlock()
-		time.Sleep(500 * time.Millisecond)
-		sch.lock.Lock()
+
+		timer.Reset(wakeTime)
+
+		select {
+		case workChannel <- candidate:
+			// Only this loop removes jobs from the ready heap, so the candidate is still at the top.
+			sch.lock.Lock()
+			heap.Pop(&sch.ready)
+			sch.lock.Unlock()
+
+		case <-timer.C():
+		case <-sch.wake:
+
+		case <-stop:
+			close(work)
+			wait.Wait()
+
+			sch.lock.Lock()
+			sch.isRunning = false
+			sch.stopRequested = false
+			close(sch.done)
+			sch.lock.Unlock()
+			return nil
+		}
 	}
-	sch.isRunning = false
+}
+
+// runJob executes a job's task then reschedules it if it isn't complete.
+func (sch *Scheduler) runJob(ctx context.Context, j *job) {
+	sch.lock.Lock()
+	isCanceled := j.isCanceled
 	sch.lock.Unlock()
-	return nil
+	if isCanceled {
+		return // canceled while being sent to the worker
+	}
+
+	taskCtx := ctx
+	if j.options.Timeout > 0 {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithTimeout(ctx, j.options.Timeout)
+		defer cancel()
+	}
+
+	start := sch.now()
+	err := j.task.Execute(taskCtx)
+	now := sch.now()
+
+	var next time.Time
+	if err != nil {
+		logger.ErrorWithFields(ctx, []logger.Field{
+			logger.Uint64("job_id", uint64(j.id)),
+			logger.Uint64("attempts", uint64(j.attempts+1)),
+			logger.MillisecondsFromNano("elapsed_ms", now.Sub(start).Nanoseconds()),
+		}, "Scheduled task failed : %s", err)
+
+		if j.options.Retry != nil {
+			j.attempts++
+			if delay, retry := j.options.Retry.Delay(j.attempts); retry {
+				next = now.Add(delay)
+			} else {
+				logger.ErrorWithFields(ctx, []logger.Field{
+					logger.Uint64("job_id", uint64(j.id)),
+					logger.Uint64("attempts", uint64(j.attempts)),
+				}, "Scheduled task retries exhausted")
+			}
+		} else {
+			next = j.task.NextRun(now)
+		}
+	} else {
+		j.attempts = 0
+		next = j.task.NextRun(now)
+	}
+
+	sch.lock.Lock()
+	j.next = next
+	sch.lock.Unlock()
+
+	// Update storage before rescheduling so a persistent job is never removed from storage while
+	// it is still scheduled, and is only removed when it is complete.
+	if len(j.persistentID) > 0 {
+		if err := sch.updateJob(ctx, j); err != nil {
+			logger.ErrorWithFields(ctx, []logger.Field{
+				logger.Uint64("job_id", uint64(j.id)),
+			}, "Failed to update persistent job : %s", err)
+		}
+	}
+
+	sch.lock.Lock()
+	if j.isCanceled || next.IsZero() {
+		delete(sch.jobs, j.id)
+	} else {
+		heap.Push(&sch.byTime, j)
+	}
+	sch.lock.Unlock()
+
+	sch.notify()
 }
 
-// stillRunning returns true if the scheduler is still running.
-func (sch *Scheduler) stillRunning() bool {
+// updateJob writes a persistent job to storage after it runs, or removes it if it is complete or
+// canceled. The job is checked for cancellation while its storage lock is held so a Cancel that
+// removes the job either waits for the write or is seen here.
+func (sch *Scheduler) updateJob(ctx context.Context, j *job) error {
+	j.storageLock.Lock()
+	defer j.storageLock.Unlock()
+
 	sch.lock.Lock()
-	defer sch.lock.Unlock()
-	return sch.isRunning
+	remove := j.isCanceled || j.next.IsZero()
+	sch.lock.Unlock()
+
+	if remove {
+		return sch.removeJob(ctx, j)
+	}
+
+	return sch.saveJob(ctx, j)
 }
 
-// Stop requests Run finish and waits for it to finish.
+// Stop requests Run finish and waits for it to finish. Tasks that are currently running are
+// allowed to complete. If Run hasn't started yet then it returns as soon as it is called.
 func (sch *Scheduler) Stop(ctx context.Context) error {
 	ctx = logger.ContextWithLogSubSystem(ctx, SubSystem)
+
 	sch.lock.Lock()
-	sch.stopRequested = true
+	if !sch.isRunning {
+		sch.stopRequested = true
+		sch.lock.Unlock()
+		return nil
+	}
+
+	if !sch.stopRequested {
+		sch.stopRequested = true
+		close(sch.stop)
+	}
+	done := sch.done
 	sch.lock.Unlock()
 
-	count := 0
-	for sch.stillRunning() {
-		time.Sleep(200 * time.Millisecond)
-		if count > 30 { // 3 seconds
+	for {
+		select {
+		case <-done:
+			return nil
+		case <-time.After(3 * time.Second):
 			logger.Info(ctx, "Waiting for scheduler to stop")
-			count = 0
 		}
-		count++
 	}
+}
+
+// TaskAdapter runs a Task with the Scheduler by checking if it is ready at a fixed frequency.
+type TaskAdapter struct {
+	task          Task
+	pollFrequency time.Duration
+}
+
+func NewTaskAdapter(task Task, pollFrequency time.Duration) *TaskAdapter {
+	return &TaskAdapter{
+		task:          task,
+		pollFrequency: pollFrequency,
+	}
+}
+
+func (a *TaskAdapter) NextRun(now time.Time) time.Time {
+	ctx := context.Background()
+	if a.task.IsComplete(ctx) {
+		return time.Time{}
+	}
+
+	if a.task.IsReady(ctx) {
+		return now
+	}
+
+	return now.Add(a.pollFrequency)
+}
+
+func (a *TaskAdapter) Execute(ctx context.Context) error {
+	if a.task.IsReady(ctx) {
+		a.task.Run(ctx)
+	}
+
 	return nil
 }
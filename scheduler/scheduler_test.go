@@ -0,0 +1,286 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testTask runs once at a specific time and records when it ran.
+type testTask struct {
+	name     string
+	at       time.Time
+	duration time.Duration
+	ran      chan string
+
+	isComplete bool
+	err        error
+	lock       sync.Mutex
+}
+
+func (t *testTask) NextRun(now time.Time) time.Time {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.isComplete {
+		return time.Time{}
+	}
+	return t.at
+}
+
+func (t *testTask) Execute(ctx context.Context) error {
+	select {
+	case <-time.After(t.duration):
+	case <-ctx.Done():
+		t.lock.Lock()
+		t.err = ctx.Err()
+		t.lock.Unlock()
+	}
+
+	t.lock.Lock()
+	t.isComplete = true
+	t.lock.Unlock()
+
+	t.ran <- t.name
+	return nil
+}
+
+// testLegacyTask implements only the Task interface.
+type testLegacyTask struct {
+	name  string
+	ready bool
+	runs  int
+	lock  sync.Mutex
+}
+
+func (t *testLegacyTask) IsReady(ctx context.Context) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.ready
+}
+
+func (t *testLegacyTask) Run(ctx context.Context) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.runs++
+	t.ready = false
+}
+
+func (t *testLegacyTask) IsComplete(ctx context.Context) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.runs > 0
+}
+
+func (t *testLegacyTask) Equal(other Task) bool {
+	o, ok := other.(*testLegacyTask)
+	return ok && o.name == t.name
+}
+
+func startScheduler(t *testing.T, sch *Scheduler) func() {
+	complete := make(chan error, 1)
+	go func() {
+		complete <- sch.Run(context.Background())
+	}()
+
+	return func() {
+		if err := sch.Stop(context.Background()); err != nil {
+			t.Fatalf("Failed to stop : %s", err)
+		}
+
+		if err := <-complete; err != nil {
+			t.Fatalf("Run failed : %s", err)
+		}
+	}
+}
+
+func Test_SlowTaskDoesNotBlock(t *testing.T) {
+	ctx := context.Background()
+	sch := NewScheduler(2)
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	ran := make(chan string, 2)
+	now := time.Now()
+	sch.Schedule(ctx, &testTask{
+		name:     "slow",
+		at:       now,
+		duration: time.Second,
+		ran:      ran,
+	}, JobOptions{})
+	sch.Schedule(ctx, &testTask{
+		name: "fast",
+		at:   now.Add(10 * time.Millisecond),
+		ran:  ran,
+	}, JobOptions{})
+
+	select {
+	case name := <-ran:
+		if name != "fast" {
+			t.Errorf("Wrong task finished first : got %s, want %s", name, "fast")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("Fast task blocked by slow task")
+	}
+
+	<-ran
+}
+
+func Test_Priority(t *testing.T) {
+	ctx := context.Background()
+	sch := NewScheduler(1)
+
+	// Schedule before running so all tasks are ready at the same time.
+	ran := make(chan string, 3)
+	at := time.Now()
+	sch.Schedule(ctx, &testTask{name: "low", at: at, ran: ran}, JobOptions{Priority: 1})
+	sch.Schedule(ctx, &testTask{name: "high", at: at, ran: ran}, JobOptions{Priority: 10})
+	sch.Schedule(ctx, &testTask{name: "medium", at: at, ran: ran}, JobOptions{Priority: 5})
+
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	for _, want := range []string{"high", "medium", "low"} {
+		select {
+		case got := <-ran:
+			if got != want {
+				t.Errorf("Wrong task order : got %s, want %s", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Task didn't run : %s", want)
+		}
+	}
+}
+
+func Test_Timeout(t *testing.T) {
+	ctx := context.Background()
+	sch := NewScheduler(1)
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	ran := make(chan string, 1)
+	task := &testTask{
+		name:     "timeout",
+		at:       time.Now(),
+		duration: time.Minute,
+		ran:      ran,
+	}
+	sch.Schedule(ctx, task, JobOptions{Timeout: 20 * time.Millisecond})
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Task didn't time out")
+	}
+
+	task.lock.Lock()
+	err := task.err
+	task.lock.Unlock()
+	if err != context.DeadlineExceeded {
+		t.Errorf("Wrong task error : got %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func Test_Cancel(t *testing.T) {
+	ctx := context.Background()
+	sch := NewScheduler(1)
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	ran := make(chan string, 1)
+	id := sch.Schedule(ctx, &testTask{
+		name: "canceled",
+		at:   time.Now().Add(50 * time.Millisecond),
+		ran:  ran,
+	}, JobOptions{})
+
+	if err := sch.Cancel(ctx, id); err != nil {
+		t.Fatalf("Failed to cancel : %s", err)
+	}
+
+	if err := sch.Cancel(ctx, id); err != NotFound {
+		t.Errorf("Wrong cancel error : got %v, want %v", err, NotFound)
+	}
+
+	select {
+	case <-ran:
+		t.Fatalf("Canceled task ran")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func Test_LegacyTask(t *testing.T) {
+	ctx := context.Background()
+	sch := &Scheduler{}
+	stop := startScheduler(t, sch)
+	defer stop()
+
+	task := &testLegacyTask{name: "legacy"}
+	if err := sch.ScheduleJob(ctx, task); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	canceled := &testLegacyTask{name: "canceled"}
+	if err := sch.ScheduleJob(ctx, canceled); err != nil {
+		t.Fatalf("Failed to schedule : %s", err)
+	}
+
+	if err := sch.CancelJob(ctx, &testLegacyTask{name: "canceled"}); err != nil {
+		t.Fatalf("Failed to cancel : %s", err)
+	}
+
+	task.lock.Lock()
+	task.ready = true
+	task.lock.Unlock()
+
+	time.Sleep(DefaultPollFrequency + 100*time.Millisecond)
+
+	task.lock.Lock()
+	runs := task.runs
+	task.lock.Unlock()
+	if runs != 1 {
+		t.Errorf("Wrong run count : got %d, want %d", runs, 1)
+	}
+
+	if err := sch.CancelJob(ctx, task); err != NotFound {
+		t.Errorf("Completed task should be removed : got %v, want %v", err, NotFound)
+	}
+}
+
+func Test_StopBeforeRun(t *testing.T) {
+	ctx := context.Background()
+	sch := NewScheduler(1)
+
+	if err := sch.Stop(ctx); err != nil {
+		t.Fatalf("Failed to stop : %s", err)
+	}
+
+	complete := make(chan error, 1)
+	go func() {
+		complete <- sch.Run(ctx)
+	}()
+
+	select {
+	case err := <-complete:
+		if err != nil {
+			t.Fatalf("Run failed : %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run didn't return after stop")
+	}
+
+	// The stop request is consumed so the scheduler can run again.
+	stop := startScheduler(t, sch)
+
+	ran := make(chan string, 1)
+	sch.Schedule(ctx, &testTask{name: "after", at: time.Now(), ran: ran}, JobOptions{})
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Task didn't run after restart")
+	}
+
+	stop()
+}
@@ -0,0 +1,249 @@
+package validate
+
+import (
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// rule is a parsed validation rule. check returns a message describing the failure or an empty
+// string if the value is valid.
+type rule struct {
+	text  string
+	check func(value reflect.Value) string
+}
+
+// parseRule parses the text of a rule for a field of the type.
+func parseRule(typ reflect.Type, text string) (*rule, error) {
+	name := text
+	param := ""
+	if i := strings.IndexByte(text, '='); i != -1 {
+		name = text[:i]
+		param = text[i+1:]
+	}
+
+	var check func(value reflect.Value) string
+	var err error
+	switch name {
+	case "min":
+		check, err = parseBound(typ, param, true)
+	case "max":
+		check, err = parseBound(typ, param, false)
+	case "len":
+		check, err = parseLength(typ, param)
+	case "oneof":
+		check, err = parseOneOf(typ, param)
+	case "hex":
+		check, err = parseHex(typ, param, -1)
+	case "hexlen":
+		size, parseErr := strconv.Atoi(param)
+		if parseErr != nil || size < 0 {
+			return nil, errors.Wrapf(ErrInvalidTag, "%s: size", text)
+		}
+		check, err = parseHex(typ, "", size)
+	default:
+		return nil, errors.Wrapf(ErrInvalidTag, "unknown rule: %s", text)
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, text)
+	}
+
+	return &rule{
+		text:  text,
+		check: check,
+	}, nil
+}
+
+// length returns the length of the value, in characters for strings, and false if the value
+// doesn't have a length.
+func length(value reflect.Value) (int, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return utf8.RuneCountInString(value.String()), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len(), true
+	}
+
+	return 0, false
+}
+
+func hasLength(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return true
+	}
+
+	return false
+}
+
+// parseBound parses a min or max rule.
+func parseBound(typ reflect.Type, param string, isMin bool) (func(reflect.Value) string, error) {
+	description := "above max"
+	if isMin {
+		description = "below min"
+	}
+
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		bound, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidTag, "integer")
+		}
+
+		return func(value reflect.Value) string {
+			v := value.Int()
+			if (isMin && v < bound) || (!isMin && v > bound) {
+				return fmt.Sprintf("%d %s %d", v, description, bound)
+			}
+			return ""
+		}, nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		bound, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidTag, "unsigned integer")
+		}
+
+		return func(value reflect.Value) string {
+			v := value.Uint()
+			if (isMin && v < bound) || (!isMin && v > bound) {
+				return fmt.Sprintf("%d %s %d", v, description, bound)
+			}
+			return ""
+		}, nil
+
+	case reflect.Float32, reflect.Float64:
+		bound, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidTag, "float")
+		}
+
+		return func(value reflect.Value) string {
+			v := value.Float()
+			if (isMin && v < bound) || (!isMin && v > bound) {
+				return fmt.Sprintf("%v %s %v", v, description, bound)
+			}
+			return ""
+		}, nil
+	}
+
+	if !hasLength(typ) {
+		return nil, errors.Wrapf(ErrInvalidTag, "unsupported type %s", typ)
+	}
+
+	bound, err := strconv.Atoi(param)
+	if err != nil || bound < 0 {
+		return nil, errors.Wrap(ErrInvalidTag, "length")
+	}
+
+	return func(value reflect.Value) string {
+		l, _ := length(value)
+		if (isMin && l < bound) || (!isMin && l > bound) {
+			return fmt.Sprintf("length %d %s %d", l, description, bound)
+		}
+		return ""
+	}, nil
+}
+
+// parseLength parses a len rule.
+func parseLength(typ reflect.Type, param string) (func(reflect.Value) string, error) {
+	if !hasLength(typ) {
+		return nil, errors.Wrapf(ErrInvalidTag, "unsupported type %s", typ)
+	}
+
+	size, err := strconv.Atoi(param)
+	if err != nil || size < 0 {
+		return nil, errors.Wrap(ErrInvalidTag, "length")
+	}
+
+	return func(value reflect.Value) string {
+		if l, _ := length(value); l != size {
+			return fmt.Sprintf("length %d not %d", l, size)
+		}
+		return ""
+	}, nil
+}
+
+// parseOneOf parses a oneof rule.
+func parseOneOf(typ reflect.Type, param string) (func(reflect.Value) string, error) {
+	values := strings.Fields(param)
+	if len(values) == 0 {
+		return nil, errors.Wrap(ErrInvalidTag, "missing values")
+	}
+
+	var text func(value reflect.Value) string
+	switch typ.Kind() {
+	case reflect.String:
+		text = func(value reflect.Value) string {
+			return value.String()
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		for _, v := range values {
+			if _, err := strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, errors.Wrapf(ErrInvalidTag, "integer: %s", v)
+			}
+		}
+
+		text = func(value reflect.Value) string {
+			return strconv.FormatInt(value.Int(), 10)
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Uintptr:
+		for _, v := range values {
+			if _, err := strconv.ParseUint(v, 10, 64); err != nil {
+				return nil, errors.Wrapf(ErrInvalidTag, "unsigned integer: %s", v)
+			}
+		}
+
+		text = func(value reflect.Value) string {
+			return strconv.FormatUint(value.Uint(), 10)
+		}
+
+	default:
+		return nil, errors.Wrapf(ErrInvalidTag, "unsupported type %s", typ)
+	}
+
+	return func(value reflect.Value) string {
+		s := text(value)
+		for _, v := range values {
+			if s == v {
+				return ""
+			}
+		}
+
+		return fmt.Sprintf("\"%s\" not one of %s", s, strings.Join(values, ", "))
+	}, nil
+}
+
+// parseHex parses a hex or hexlen rule. A size of -1 means any size.
+func parseHex(typ reflect.Type, param string, size int) (func(reflect.Value) string, error) {
+	if len(param) > 0 {
+		return nil, errors.Wrap(ErrInvalidTag, "unexpected parameter")
+	}
+
+	if typ.Kind() != reflect.String {
+		return nil, errors.Wrapf(ErrInvalidTag, "unsupported type %s", typ)
+	}
+
+	return func(value reflect.Value) string {
+		s := value.String()
+		if _, err := hex.DecodeString(s); err != nil {
+			return "invalid hex"
+		}
+
+		if size >= 0 && len(s) != size*2 {
+			return fmt.Sprintf("hex size %d not %d", len(s)/2, size)
+		}
+
+		return ""
+	}, nil
+}
@@ -0,0 +1,439 @@
+// Package validate checks values against rules specified in tkvalidate struct field tags. The
+// rules are checked by the json and bsor decoders after a value is decoded. For example:
+//
+//	type Request struct {
+//	    TxID    string   `json:"txid" tkvalidate:"required,hexlen=32"`
+//	    Outputs []Output `json:"outputs" tkvalidate:"min=1,max=100"`
+//	    Format  *string  `json:"format" tkvalidate:"oneof=TSC"`
+//	}
+//
+// Rules are separated by commas:
+//
+//	required  The value must not be zero. Pointers must not be nil and strings, slices and maps
+//	          must not be empty.
+//	omitempty The remaining rules are skipped when the value is zero.
+//	min=N     Numbers must be at least N. Strings (in characters), slices, arrays and maps must
+//	          have a length of at least N.
+//	max=N     Like min, but N is the maximum.
+//	len=N     Strings, slices, arrays and maps must have a length of exactly N.
+//	oneof=A B Strings and integers must equal one of the space separated values.
+//	hex       Strings must be hex.
+//	hexlen=N  Strings must be hex encoding exactly N bytes.
+//
+// Rules other than required are applied to the value a pointer points to and are skipped for nil
+// pointers. Structs within fields, slices, arrays, maps and interfaces are validated recursively.
+// A tag of "-" skips the field.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// TagName is the struct tag containing the rules. It is specific to this package so that tags
+	// for other validators, like go-playground/validator's "validate" tags, are not checked by the
+	// decoders.
+	TagName = "tkvalidate"
+)
+
+var (
+	ErrInvalidTag = errors.New("Invalid Validation Tag")
+
+	types = &typeCache{
+		types:       make(map[reflect.Type]*typeRules),
+		nestedTypes: make(map[reflect.Type]*nestedType),
+	}
+)
+
+// FieldError is a field that failed validation.
+type FieldError struct {
+	// Path is the path of the field from the validated value, like "Outputs[1].Value".
+	Path string
+
+	// Rule is the rule that failed, like "min=1".
+	Rule string
+
+	// Message describes the failure.
+	Message string
+}
+
+// Errors is the list of fields that failed validation.
+type Errors []*FieldError
+
+type typeCache struct {
+	types       map[reflect.Type]*typeRules
+	nestedTypes map[reflect.Type]*nestedType
+	lock        sync.RWMutex
+}
+
+// nestedType is the result of searching a type for structs with rules.
+type nestedType struct {
+	// nested is true when values of the type can contain fields that need to be validated.
+	nested bool
+
+	// err is an invalid tag found in the search.
+	err error
+}
+
+// typeRules are the rules for the fields of a struct type.
+type typeRules struct {
+	fields []*fieldRules
+	err    error
+}
+
+type fieldRules struct {
+	index     int
+	typ       reflect.Type
+	name      string
+	anonymous bool
+	required  bool
+	omitEmpty bool
+	rules     []*rule
+}
+
+// Struct validates the struct, or pointer to a struct, against the rules in its field tags. It
+// returns Errors when fields fail validation.
+func Struct(value interface{}) error {
+	return Value(reflect.ValueOf(value))
+}
+
+// Value validates the value against the rules in its field tags. It returns Errors when fields
+// fail validation.
+func Value(value reflect.Value) error {
+	if !value.IsValid() {
+		return nil
+	}
+
+	nested := types.search(value.Type())
+	if nested.err != nil {
+		return nested.err
+	}
+
+	if !nested.nested {
+		return nil
+	}
+
+	var result Errors
+	if err := validateValue("", value, &result); err != nil {
+		return err
+	}
+
+	if len(result) > 0 {
+		return result
+	}
+
+	return nil
+}
+
+func validateValue(path string, value reflect.Value, result *Errors) error {
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+
+		elem := value.Elem()
+		if !types.nested(elem.Type()) {
+			return nil
+		}
+
+		return validateValue(path, elem, result)
+
+	case reflect.Struct:
+		return validateStruct(path, value, result)
+
+	case reflect.Slice, reflect.Array:
+		if !types.nested(value.Type().Elem()) {
+			return nil
+		}
+
+		length := value.Len()
+		for i := 0; i < length; i++ {
+			if err := validateValue(fmt.Sprintf("%s[%d]", path, i), value.Index(i),
+				result); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if !types.nested(value.Type().Elem()) {
+			return nil
+		}
+
+		iter := value.MapRange()
+		for iter.Next() {
+			if err := validateValue(fmt.Sprintf("%s[%v]", path, iter.Key()), iter.Value(),
+				result); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateStruct(path string, value reflect.Value, result *Errors) error {
+	typ := value.Type()
+	rules := types.get(typ)
+	if rules.err != nil {
+		return rules.err
+	}
+
+	for _, field := range rules.fields {
+		fieldPath := path
+		if !field.anonymous {
+			fieldPath = joinPath(path, field.name)
+		}
+
+		fieldValue := value.Field(field.index)
+		if isEmpty(fieldValue) {
+			if field.required {
+				*result = append(*result, &FieldError{
+					Path:    fieldPath,
+					Rule:    "required",
+					Message: "missing",
+				})
+				continue
+			}
+
+			if field.omitEmpty {
+				continue
+			}
+		}
+
+		ruleValue := fieldValue
+		for ruleValue.Kind() == reflect.Ptr && !ruleValue.IsNil() {
+			ruleValue = ruleValue.Elem()
+		}
+
+		if ruleValue.Kind() != reflect.Ptr {
+			for _, r := range field.rules {
+				if message := r.check(ruleValue); len(message) > 0 {
+					*result = append(*result, &FieldError{
+						Path:    fieldPath,
+						Rule:    r.text,
+						Message: message,
+					})
+				}
+			}
+		}
+
+		if err := validateValue(fieldPath, fieldValue, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// isEmpty returns true if the value is zero or an empty string, slice or map.
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+
+	return value.IsZero()
+}
+
+// get returns the rules for the struct type.
+func (c *typeCache) get(typ reflect.Type) *typeRules {
+	c.lock.RLock()
+	result, exists := c.types[typ]
+	c.lock.RUnlock()
+	if exists {
+		return result
+	}
+
+	result = buildTypeRules(typ)
+
+	c.lock.Lock()
+	c.types[typ] = result
+	c.lock.Unlock()
+
+	return result
+}
+
+// nested returns true if values of the type can contain fields that need to be validated.
+func (c *typeCache) nested(typ reflect.Type) bool {
+	return c.search(typ).nested
+}
+
+// search finds the structs with rules that can be reached from the type.
+func (c *typeCache) search(typ reflect.Type) *nestedType {
+	c.lock.RLock()
+	result, exists := c.nestedTypes[typ]
+	c.lock.RUnlock()
+	if exists {
+		return result
+	}
+
+	// Only the result for the requested type is cached because results for types within a
+	// recursive type aren't complete until the whole type has been searched.
+	result = &nestedType{}
+	c.searchType(typ, make(map[reflect.Type]bool), result)
+
+	c.lock.Lock()
+	c.nestedTypes[typ] = result
+	c.lock.Unlock()
+
+	return result
+}
+
+func (c *typeCache) searchType(typ reflect.Type, visited map[reflect.Type]bool,
+	result *nestedType) {
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		// Empty interfaces hold generic values like decoded JSON that don't have rules, so only
+		// interfaces with methods, like bsor unions, are checked for concrete types with rules.
+		if typ.NumMethod() > 0 {
+			result.nested = true
+		}
+		return
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		c.searchType(typ.Elem(), visited, result)
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	if visited[typ] {
+		return
+	}
+	visited[typ] = true
+
+	rules := c.get(typ)
+	if rules.err != nil {
+		result.nested = true
+		result.err = rules.err
+		return
+	}
+
+	for _, field := range rules.fields {
+		if field.required || len(field.rules) > 0 {
+			result.nested = true
+		}
+
+		// Continue searching after finding rules to find invalid tags.
+		c.searchType(field.typ, visited, result)
+		if result.err != nil {
+			return
+		}
+	}
+}
+
+// buildTypeRules parses the rules for the fields of the struct type. Fields without rules are
+// included if they can contain structs.
+func buildTypeRules(typ reflect.Type) *typeRules {
+	result := &typeRules{}
+
+	fieldCount := typ.NumField()
+	for i := 0; i < fieldCount; i++ {
+		field := typ.Field(i)
+		if !field.IsExported() && !field.Anonymous {
+			continue
+		}
+
+		tag := field.Tag.Get(TagName)
+		if tag == "-" {
+			continue
+		}
+
+		fieldRules, err := parseTag(field, tag)
+		if err != nil {
+			result.err = errors.Wrapf(err, "%s.%s", typ.Name(), field.Name)
+			return result
+		}
+		fieldRules.index = i
+
+		if !fieldRules.required && len(fieldRules.rules) == 0 && !canNest(field.Type) {
+			continue
+		}
+
+		result.fields = append(result.fields, fieldRules)
+	}
+
+	return result
+}
+
+// canNest returns true if values of the type can contain structs.
+func canNest(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Interface, reflect.Struct:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return canNest(typ.Elem())
+	}
+
+	return false
+}
+
+func parseTag(field reflect.StructField, tag string) (*fieldRules, error) {
+	result := &fieldRules{
+		typ:       field.Type,
+		name:      field.Name,
+		anonymous: field.Anonymous && len(tag) == 0,
+	}
+
+	if len(tag) == 0 {
+		return result, nil
+	}
+
+	typ := field.Type
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	for _, text := range strings.Split(tag, ",") {
+		text = strings.TrimSpace(text)
+		switch text {
+		case "":
+			continue
+		case "required":
+			result.required = true
+			continue
+		case "omitempty":
+			result.omitEmpty = true
+			continue
+		}
+
+		r, err := parseRule(typ, text)
+		if err != nil {
+			return nil, err
+		}
+
+		result.rules = append(result.rules, r)
+	}
+
+	return result, nil
+}
+
+func (e FieldError) Error() string {
+	if len(e.Path) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fieldError := range e {
+		parts[i] = fieldError.Error()
+	}
+
+	return "validate: " + strings.Join(parts, ", ")
+}
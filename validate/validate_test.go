@@ -0,0 +1,188 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+	"github.com/pkg/errors"
+)
+
+type TestRequest struct {
+	TxID     string            `tkvalidate:"required,hexlen=4"`
+	Name     *string           `tkvalidate:"min=2,max=5"`
+	Format   string            `tkvalidate:"omitempty,oneof=TSC BRC"`
+	Count    int               `tkvalidate:"min=-1,max=10"`
+	Amount   uint64            `tkvalidate:"required"`
+	Rate     float64           `tkvalidate:"max=0.5"`
+	Code     [3]byte           `tkvalidate:"len=3"`
+	Outputs  []*TestOutput     `tkvalidate:"min=1"`
+	Lookup   map[string]Output `tkvalidate:"max=2"`
+	Action   TestAction
+	Ignored  *TestOutput `tkvalidate:"-"`
+	Embedded             // rules of embedded structs are on the parent's path
+}
+
+type TestOutput struct {
+	Value  uint64 `tkvalidate:"min=1"`
+	Script string `tkvalidate:"hex"`
+}
+
+type Output = TestOutput
+
+type TestAction interface {
+	Name() string
+}
+
+func (*TestOutput) Name() string {
+	return "output"
+}
+
+type Embedded struct {
+	Note string `tkvalidate:"omitempty,len=2"`
+}
+
+type TestNode struct {
+	Value int `tkvalidate:"max=5"`
+	Next  *TestNode
+}
+
+func validRequest() TestRequest {
+	name := "name"
+	return TestRequest{
+		TxID:    "00112233",
+		Name:    &name,
+		Format:  "TSC",
+		Count:   -1,
+		Amount:  1,
+		Rate:    0.5,
+		Outputs: []*TestOutput{{Value: 1, Script: "6a"}},
+		Lookup: map[string]Output{
+			"a": {Value: 1},
+		},
+		Action:  &TestOutput{Value: 1},
+		Ignored: &TestOutput{},
+	}
+}
+
+func Test_Valid(t *testing.T) {
+	request := validRequest()
+	if err := Struct(request); err != nil {
+		t.Fatalf("Failed to validate : %s", err)
+	}
+
+	if err := Struct(&request); err != nil {
+		t.Fatalf("Failed to validate pointer : %s", err)
+	}
+
+	// Nil pointers are only checked by required.
+	request.Name = nil
+	if err := Struct(request); err != nil {
+		t.Fatalf("Failed to validate nil pointer : %s", err)
+	}
+}
+
+func Test_Invalid(t *testing.T) {
+	name := "n"
+	request := validRequest()
+	request.TxID = "001122"
+	request.Name = &name
+	request.Format = "XYZ"
+	request.Count = 11
+	request.Amount = 0
+	request.Rate = 0.75
+	request.Outputs = append(request.Outputs, &TestOutput{Script: "zz"})
+	request.Lookup["b"] = Output{}
+	request.Action = &TestOutput{}
+	request.Note = "a"
+
+	err := Struct(request)
+	if err == nil {
+		t.Fatalf("Invalid request passed validation")
+	}
+	t.Logf("Error : %s", err)
+
+	var fieldErrors Errors
+	if !errors.As(err, &fieldErrors) {
+		t.Fatalf("Wrong error type : %T", err)
+	}
+
+	var paths []string
+	for _, fieldError := range fieldErrors {
+		paths = append(paths, fieldError.Path+" "+fieldError.Rule)
+	}
+
+	want := []string{
+		"TxID hexlen=4",
+		"Name min=2",
+		"Format oneof=TSC BRC",
+		"Count max=10",
+		"Amount required",
+		"Rate max=0.5",
+		"Outputs[1].Value min=1",
+		"Outputs[1].Script hex",
+		"Lookup[b].Value min=1",
+		"Action.Value min=1",
+		"Note len=2",
+	}
+
+	if diff := deep.Equal(paths, want); diff != nil {
+		t.Errorf("Wrong errors : %v", diff)
+	}
+}
+
+func Test_Recursive(t *testing.T) {
+	list := &TestNode{Next: &TestNode{Next: &TestNode{Value: 6}}}
+
+	err := Struct(list)
+	if err == nil {
+		t.Fatalf("Invalid list passed validation")
+	}
+
+	if err.Error() != "validate: Next.Next.Value: 6 above max 5" {
+		t.Errorf("Wrong error : %s", err)
+	}
+}
+
+func Test_InvalidTag(t *testing.T) {
+	tests := []interface{}{
+		struct {
+			Value int `tkvalidate:"min=a"`
+		}{},
+		struct {
+			Value bool `tkvalidate:"max=1"`
+		}{},
+		struct {
+			Value int `tkvalidate:"hex"`
+		}{},
+		struct {
+			Value string `tkvalidate:"unknown"`
+		}{},
+		struct {
+			Values []struct {
+				Value string `tkvalidate:"hexlen=x"`
+			}
+		}{},
+	}
+
+	for i, test := range tests {
+		if err := Struct(test); errors.Cause(err) != ErrInvalidTag {
+			t.Errorf("Wrong error %d : got %v, want %s", i, err, ErrInvalidTag)
+		}
+	}
+}
+
+func Test_Untagged(t *testing.T) {
+	values := []interface{}{
+		nil,
+		1,
+		"text",
+		map[string]interface{}{"a": []interface{}{1, "b"}},
+		struct{ Value int }{},
+	}
+
+	for i, value := range values {
+		if err := Struct(value); err != nil {
+			t.Errorf("Failed to validate %d : %s", i, err)
+		}
+	}
+}